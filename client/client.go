@@ -2,6 +2,7 @@ package client
 
 import (
 	"bytes"
+	"context"
 	"encoding/hex"
 	"encoding/json"
 	"io"
@@ -61,6 +62,36 @@ type RemoteStore interface {
 	GetTarget(path string) (stream io.ReadCloser, size int64, err error)
 }
 
+// RangeRemoteStore is a RemoteStore that can download part of a target file,
+// which lets the client resume interrupted downloads.
+type RangeRemoteStore interface {
+	RemoteStore
+
+	// GetTargetRange downloads the given target file from remote storage,
+	// skipping the first `offset` bytes.
+	//
+	// `err` is ErrNotFound if the given file does not exist.
+	//
+	// `size` is the size of the stream (i.e. of the rest of the file), -1
+	// indicating an unknown length.
+	GetTargetRange(ctx context.Context, path string, offset int64) (stream io.ReadCloser, size int64, err error)
+}
+
+// ContextRemoteStore is a RemoteStore whose downloads can be cancelled with
+// a context. The client uses these methods instead of GetMeta and GetTarget
+// when the remote store implements them.
+type ContextRemoteStore interface {
+	RemoteStore
+
+	// GetMetaContext is like GetMeta, but stops downloading when ctx is
+	// done.
+	GetMetaContext(ctx context.Context, name string) (stream io.ReadCloser, size int64, err error)
+
+	// GetTargetContext is like GetTarget, but stops downloading when ctx is
+	// done.
+	GetTargetContext(ctx context.Context, path string) (stream io.ReadCloser, size int64, err error)
+}
+
 // Client provides methods for fetching updates from a remote repository and
 // downloading remote target files.
 type Client struct {
@@ -95,6 +126,12 @@ type Client struct {
 
 	// MaxRootRotations limits the number of downloaded roots in 1.0.19 root updater
 	MaxRootRotations int
+
+	// TargetCacheDir, if set, is a directory where downloaded target files
+	// are cached, keyed by their hash. Download serves a target from the
+	// cache if the cached file matches the trusted metadata, and Update
+	// removes cached files no longer listed in trusted targets metadata.
+	TargetCacheDir string
 }
 
 func NewClient(local LocalStore, remote RemoteStore) *Client {
@@ -125,7 +162,13 @@ func (c *Client) Init(rootJSON []byte) error {
 //
 // https://theupdateframework.github.io/specification/v1.0.19/index.html#load-trusted-root
 func (c *Client) Update() (data.TargetFiles, error) {
-	if err := c.UpdateRoots(); err != nil {
+	return c.UpdateContext(context.Background())
+}
+
+// UpdateContext is like Update, but stops downloading metadata and returns
+// an error when ctx is done.
+func (c *Client) UpdateContext(ctx context.Context) (data.TargetFiles, error) {
+	if err := c.UpdateRootsContext(ctx); err != nil {
 		if _, ok := err.(verify.ErrExpired); ok {
 			// For backward compatibility, we wrap the ErrExpired inside
 			// ErrDecodeFailed.
@@ -138,14 +181,21 @@ func (c *Client) Update() (data.TargetFiles, error) {
 	c.getLocalMeta()
 
 	// 5.4.1 - Download the timestamp metadata
-	timestampJSON, err := c.downloadMetaUnsafe("timestamp.json", defaultTimestampDownloadLimit)
-	if err != nil {
-		return nil, err
-	}
-	// 5.4.(2,3 and 4) - Verify timestamp against various attacks
-	// Returns the extracted snapshot metadata
-	snapshotMeta, err := c.decodeTimestamp(timestampJSON)
-	if err != nil {
+	var timestampJSON []byte
+	var snapshotMeta data.TimestampFileMeta
+	if err := c.retryBadData(func(bool) (err error) {
+		timestampJSON, err = c.downloadMetaUnsafe(ctx, "timestamp.json", defaultTimestampDownloadLimit)
+		if err != nil {
+			return err
+		}
+		// 5.4.(2,3 and 4) - Verify timestamp against various attacks
+		// Returns the extracted snapshot metadata
+		snapshotMeta, err = c.decodeTimestamp(timestampJSON)
+		if err != nil {
+			return c.reportBadMeta("timestamp.json", err)
+		}
+		return nil
+	}); err != nil {
 		return nil, err
 	}
 	// 5.4.5 - Persist the timestamp metadata
@@ -154,15 +204,22 @@ func (c *Client) Update() (data.TargetFiles, error) {
 	}
 
 	// 5.5.1 - Download snapshot metadata
-	// 5.5.2 and 5.5.4 - Check against timestamp role's snapshot hash and version
-	snapshotJSON, err := c.downloadMetaFromTimestamp("snapshot.json", snapshotMeta)
-	if err != nil {
-		return nil, err
-	}
-	// 5.5.(3,5 and 6) - Verify snapshot against various attacks
-	// Returns the extracted metadata files
-	snapshotMetas, err := c.decodeSnapshot(snapshotJSON)
-	if err != nil {
+	var snapshotJSON []byte
+	var snapshotMetas data.SnapshotFiles
+	if err := c.retryBadData(func(bool) (err error) {
+		// 5.5.2 and 5.5.4 - Check against timestamp role's snapshot hash and version
+		snapshotJSON, err = c.downloadMetaFromTimestamp(ctx, "snapshot.json", snapshotMeta)
+		if err != nil {
+			return err
+		}
+		// 5.5.(3,5 and 6) - Verify snapshot against various attacks
+		// Returns the extracted metadata files
+		snapshotMetas, err = c.decodeSnapshot(snapshotJSON)
+		if err != nil {
+			return c.reportBadMeta(c.remoteMetaPath("snapshot.json", snapshotMeta.Version), err)
+		}
+		return nil
+	}); err != nil {
 		return nil, err
 	}
 	// 5.5.7 - Persist snapshot metadata
@@ -176,14 +233,20 @@ func (c *Client) Update() (data.TargetFiles, error) {
 	targetsMeta := snapshotMetas["targets.json"]
 	if !c.hasMetaFromSnapshot("targets.json", targetsMeta) {
 		// 5.6.1 - Download the top-level targets metadata file
-		// 5.6.2 and 5.6.4 - Check against snapshot role's targets hash and version
-		targetsJSON, err := c.downloadMetaFromSnapshot("targets.json", targetsMeta)
-		if err != nil {
-			return nil, err
-		}
-		// 5.6.(3 and 5) - Verify signatures and check against freeze attack
-		updatedTargets, err = c.decodeTargets(targetsJSON)
-		if err != nil {
+		var targetsJSON []byte
+		if err := c.retryBadData(func(bool) (err error) {
+			// 5.6.2 and 5.6.4 - Check against snapshot role's targets hash and version
+			targetsJSON, err = c.downloadMetaFromSnapshot(ctx, "targets.json", targetsMeta)
+			if err != nil {
+				return err
+			}
+			// 5.6.(3 and 5) - Verify signatures and check against freeze attack
+			updatedTargets, err = c.decodeTargets(targetsJSON)
+			if err != nil {
+				return c.reportBadMeta(c.remoteMetaPath("targets.json", targetsMeta.Version), err)
+			}
+			return nil
+		}); err != nil {
 			return nil, err
 		}
 		// 5.6.6 - Persist targets metadata
@@ -192,10 +255,20 @@ func (c *Client) Update() (data.TargetFiles, error) {
 		}
 	}
 
+	// The target cache is best effort, so failing to prune it does not fail
+	// the update. It is pruned again by the next one.
+	c.PruneTargetCache()
+
 	return updatedTargets, nil
 }
 
 func (c *Client) UpdateRoots() error {
+	return c.UpdateRootsContext(context.Background())
+}
+
+// UpdateRootsContext is like UpdateRoots, but stops downloading metadata and
+// returns an error when ctx is done.
+func (c *Client) UpdateRootsContext(ctx context.Context) error {
 	// https://theupdateframework.github.io/specification/v1.0.19/index.html#load-trusted-root
 	// 5.2 Load the trusted root metadata file. We assume that a good,
 	// trusted copy of this file was shipped with the package manager
@@ -260,8 +333,38 @@ func (c *Client) UpdateRoots() error {
 		// NOTE: as a side effect, we do update c.rootVer to nPlusOne between iterations.
 		nPlusOne := c.rootVer + 1
 		nPlusOneRootPath := util.VersionedPath("root.json", nPlusOne)
-		nPlusOneRootMetadata, err := c.downloadMetaUnsafe(nPlusOneRootPath, defaultRootDownloadLimit)
+		var nPlusOneRootMetadata []byte
+		var nPlusOneRootMetadataSigned *data.Root
+		err := c.retryBadData(func(bool) (err error) {
+			nPlusOneRootMetadata, err = c.downloadMetaUnsafe(ctx, nPlusOneRootPath, defaultRootDownloadLimit)
+			if err != nil {
+				return err
+			}
+
+			// 5.3.4 Check for an arbitrary software attack.
+			// 5.3.4.1 Check that N signed N+1
+			nPlusOneRootMetadataSigned, err = c.verifyRoot(nRootMetadata, nPlusOneRootMetadata)
+			if err != nil {
+				return c.reportBadMeta(nPlusOneRootPath, err)
+			}
+
+			// 5.3.4.2 check that N+1 signed itself.
+			if _, err := c.verifyRoot(nPlusOneRootMetadata, nPlusOneRootMetadata); err != nil {
+				// 5.3.6 Note that the expiration of the new (intermediate) root
+				// metadata file does not matter yet, because we will check for
+				// it in step 5.3.10.
+				return c.reportBadMeta(nPlusOneRootPath, err)
+			}
 
+			// 5.3.5 Check for a rollback attack. Here, we check that nPlusOneRootMetadataSigned.version == nPlusOne.
+			if nPlusOneRootMetadataSigned.Version != nPlusOne {
+				return c.reportBadMeta(nPlusOneRootPath, verify.ErrWrongVersion{
+					Given:    nPlusOneRootMetadataSigned.Version,
+					Expected: nPlusOne,
+				})
+			}
+			return nil
+		})
 		if err != nil {
 			if _, ok := err.(ErrMissingRemoteMetadata); ok {
 				// stop when the next root can't be downloaded
@@ -270,29 +373,6 @@ func (c *Client) UpdateRoots() error {
 			return err
 		}
 
-		// 5.3.4 Check for an arbitrary software attack.
-		// 5.3.4.1 Check that N signed N+1
-		nPlusOneRootMetadataSigned, err := c.verifyRoot(nRootMetadata, nPlusOneRootMetadata)
-		if err != nil {
-			return err
-		}
-
-		// 5.3.4.2 check that N+1 signed itself.
-		if _, err := c.verifyRoot(nPlusOneRootMetadata, nPlusOneRootMetadata); err != nil {
-			// 5.3.6 Note that the expiration of the new (intermediate) root
-			// metadata file does not matter yet, because we will check for
-			// it in step 5.3.10.
-			return err
-		}
-
-		// 5.3.5 Check for a rollback attack. Here, we check that nPlusOneRootMetadataSigned.version == nPlusOne.
-		if nPlusOneRootMetadataSigned.Version != nPlusOne {
-			return verify.ErrWrongVersion{
-				Given:    nPlusOneRootMetadataSigned.Version,
-				Expected: nPlusOne,
-			}
-		}
-
 		// 5.3.7 Set the trusted root metadata file to the new root metadata file.
 		c.rootVer = nPlusOneRootMetadataSigned.Version
 		// NOTE: following up on 5.3.1, we want to always have consistent snapshots on for the duration
@@ -533,8 +613,8 @@ func (c *Client) loadTargets(targets data.TargetFiles) {
 // downloadMetaUnsafe downloads top-level metadata from remote storage without
 // verifying it's length and hashes (used for example to download timestamp.json
 // which has unknown size). It will download at most maxMetaSize bytes.
-func (c *Client) downloadMetaUnsafe(name string, maxMetaSize int64) ([]byte, error) {
-	r, size, err := c.remote.GetMeta(name)
+func (c *Client) downloadMetaUnsafe(ctx context.Context, name string, maxMetaSize int64) ([]byte, error) {
+	r, size, err := c.getMeta(ctx, name)
 	if err != nil {
 		if IsNotFound(err) {
 			return nil, ErrMissingRemoteMetadata{name}
@@ -558,6 +638,91 @@ func (c *Client) downloadMetaUnsafe(name string, maxMetaSize int64) ([]byte, err
 // remote files
 type remoteGetFunc func(string) (io.ReadCloser, int64, error)
 
+// getMeta downloads the given metadata from remote storage, cancelling the
+// download when ctx is done if the remote store supports it.
+func (c *Client) getMeta(ctx context.Context, name string) (io.ReadCloser, int64, error) {
+	if r, ok := c.remote.(ContextRemoteStore); ok {
+		return r.GetMetaContext(ctx, name)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, 0, err
+	}
+	return c.remote.GetMeta(name)
+}
+
+// getTarget downloads the given target file from remote storage, cancelling
+// the download when ctx is done if the remote store supports it.
+func (c *Client) getTarget(ctx context.Context, path string) (io.ReadCloser, int64, error) {
+	if r, ok := c.remote.(ContextRemoteStore); ok {
+		return r.GetTargetContext(ctx, path)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, 0, err
+	}
+	return c.remote.GetTarget(path)
+}
+
+// remoteMetaPath returns the path the given version of top-level or delegated
+// metadata is downloaded from.
+func (c *Client) remoteMetaPath(name string, version int64) string {
+	if c.consistentSnapshot {
+		return util.VersionedPath(name, version)
+	}
+	return name
+}
+
+// maxBadDataRetries limits how many times a file that fails verification is
+// downloaded again, from another source of the remote store.
+const maxBadDataRetries = 3
+
+// errBadData is an error from a file that failed verification and was
+// reported to the remote store, so that retryBadData downloads it again.
+type errBadData struct {
+	err error
+}
+
+func (e errBadData) Error() string {
+	return e.err.Error()
+}
+
+// reportBadMeta tells the remote store that the metadata it served at path
+// failed verification with err, if it serves files from several sources. It
+// returns err, marked for retryBadData to download the file again if it was
+// reported.
+func (c *Client) reportBadMeta(path string, err error) error {
+	if r, ok := c.remote.(BadDataReporter); ok {
+		r.ReportBadMeta(path, err)
+		return errBadData{err}
+	}
+	return err
+}
+
+// reportBadTarget is like reportBadMeta, for target files.
+func (c *Client) reportBadTarget(path string, err error) error {
+	if r, ok := c.remote.(BadDataReporter); ok {
+		r.ReportBadTarget(path, err)
+		return errBadData{err}
+	}
+	return err
+}
+
+// retryBadData calls fetch, which downloads and verifies a file, until it
+// does not fail with data reported as bad to the remote store, which then
+// serves the file from another source, or maxBadDataRetries is reached.
+// canRetry tells fetch whether bad data will be downloaded again.
+func (c *Client) retryBadData(fetch func(canRetry bool) error) error {
+	for retries := maxBadDataRetries; ; retries-- {
+		err := fetch(retries > 0)
+		if e, ok := err.(errBadData); ok {
+			if retries > 0 {
+				continue
+			}
+			return e.err
+		}
+		return err
+	}
+}
+
 // downloadHashed tries to download the hashed prefixed version of the file.
 func (c *Client) downloadHashed(file string, get remoteGetFunc, hashes data.Hashes) (io.ReadCloser, int64, error) {
 	// try each hashed path in turn, and either return the contents,
@@ -587,20 +752,8 @@ func (c *Client) downloadTarget(file string, get remoteGetFunc, hashes data.Hash
 
 // downloadVersionedMeta downloads top-level metadata from remote storage and
 // verifies it using the given file metadata.
-func (c *Client) downloadMeta(name string, version int64, m data.FileMeta) ([]byte, error) {
-	r, size, err := func() (io.ReadCloser, int64, error) {
-		if c.consistentSnapshot {
-			path := util.VersionedPath(name, version)
-			r, size, err := c.remote.GetMeta(path)
-			if err == nil {
-				return r, size, nil
-			}
-
-			return nil, 0, err
-		} else {
-			return c.remote.GetMeta(name)
-		}
-	}()
+func (c *Client) downloadMeta(ctx context.Context, name string, version int64, m data.FileMeta) ([]byte, error) {
+	r, size, err := c.getMeta(ctx, c.remoteMetaPath(name, version))
 	if err != nil {
 		if IsNotFound(err) {
 			return nil, ErrMissingRemoteMetadata{name}
@@ -613,7 +766,7 @@ func (c *Client) downloadMeta(name string, version int64, m data.FileMeta) ([]by
 	var stream io.Reader
 	if m.Length != 0 {
 		if size >= 0 && size != m.Length {
-			return nil, ErrWrongSize{name, size, m.Length}
+			return nil, c.reportBadMeta(c.remoteMetaPath(name, version), ErrWrongSize{name, size, m.Length})
 		}
 
 		// wrap the data in a LimitReader so we download at most m.Length bytes
@@ -625,15 +778,15 @@ func (c *Client) downloadMeta(name string, version int64, m data.FileMeta) ([]by
 	return ioutil.ReadAll(stream)
 }
 
-func (c *Client) downloadMetaFromSnapshot(name string, m data.SnapshotFileMeta) ([]byte, error) {
-	b, err := c.downloadMeta(name, m.Version, data.FileMeta{Length: m.Length, Hashes: m.Hashes})
+func (c *Client) downloadMetaFromSnapshot(ctx context.Context, name string, m data.SnapshotFileMeta) ([]byte, error) {
+	b, err := c.downloadMeta(ctx, name, m.Version, data.FileMeta{Length: m.Length, Hashes: m.Hashes})
 	if err != nil {
 		return nil, err
 	}
 
 	// 5.6.2 – Check length and hashes of fetched bytes *before* parsing metadata
 	if err := util.BytesMatchLenAndHashes(b, m.Length, m.Hashes); err != nil {
-		return nil, ErrDownloadFailed{name, err}
+		return nil, c.reportBadMeta(c.remoteMetaPath(name, m.Version), ErrDownloadFailed{name, err})
 	}
 
 	meta, err := util.GenerateSnapshotFileMeta(bytes.NewReader(b), m.Hashes.HashAlgorithms()...)
@@ -643,21 +796,21 @@ func (c *Client) downloadMetaFromSnapshot(name string, m data.SnapshotFileMeta)
 
 	// 5.6.4 - Check against snapshot role's version
 	if err := util.VersionEqual(meta.Version, m.Version); err != nil {
-		return nil, ErrDownloadFailed{name, err}
+		return nil, c.reportBadMeta(c.remoteMetaPath(name, m.Version), ErrDownloadFailed{name, err})
 	}
 
 	return b, nil
 }
 
-func (c *Client) downloadMetaFromTimestamp(name string, m data.TimestampFileMeta) ([]byte, error) {
-	b, err := c.downloadMeta(name, m.Version, data.FileMeta{Length: m.Length, Hashes: m.Hashes})
+func (c *Client) downloadMetaFromTimestamp(ctx context.Context, name string, m data.TimestampFileMeta) ([]byte, error) {
+	b, err := c.downloadMeta(ctx, name, m.Version, data.FileMeta{Length: m.Length, Hashes: m.Hashes})
 	if err != nil {
 		return nil, err
 	}
 
 	// 5.2.2. – Check length and hashes of fetched bytes *before* parsing metadata
 	if err := util.BytesMatchLenAndHashes(b, m.Length, m.Hashes); err != nil {
-		return nil, ErrDownloadFailed{name, err}
+		return nil, c.reportBadMeta(c.remoteMetaPath(name, m.Version), ErrDownloadFailed{name, err})
 	}
 
 	meta, err := util.GenerateTimestampFileMeta(bytes.NewReader(b), m.Hashes.HashAlgorithms()...)
@@ -667,7 +820,7 @@ func (c *Client) downloadMetaFromTimestamp(name string, m data.TimestampFileMeta
 
 	// 5.5.4 - Check against timestamp role's version
 	if err := util.VersionEqual(meta.Version, m.Version); err != nil {
-		return nil, ErrDownloadFailed{name, err}
+		return nil, c.reportBadMeta(c.remoteMetaPath(name, m.Version), ErrDownloadFailed{name, err})
 	}
 
 	return b, nil
@@ -825,6 +978,17 @@ type Destination interface {
 	Delete() error
 }
 
+// ResumableDestination is a Destination that may already hold the start of a
+// target file, for example from an earlier, interrupted download. If the
+// remote store implements RangeRemoteStore, only the rest of the file is
+// downloaded and appended to the destination.
+type ResumableDestination interface {
+	Destination
+
+	// Partial returns the data already written to the destination.
+	Partial() (io.ReadCloser, error)
+}
+
 // Download downloads the given target file from remote storage into dest.
 //
 // dest will be deleted and an error returned in the following situations:
@@ -834,7 +998,17 @@ type Destination interface {
 //   * The target does not exist in any targets
 //   * Metadata cannot be generated for the downloaded data
 //   * Generated metadata does not match local metadata for the given file
-func (c *Client) Download(name string, dest Destination) (err error) {
+//
+// If dest is a ResumableDestination that already holds the start of the file
+// and the remote store supports ranges, only the rest of the file is
+// downloaded.
+func (c *Client) Download(name string, dest Destination) error {
+	return c.DownloadContext(context.Background(), name, dest)
+}
+
+// DownloadContext is like Download, but stops downloading and returns an
+// error when ctx is done.
+func (c *Client) DownloadContext(ctx context.Context, name string, dest Destination) (err error) {
 	// delete dest if there is an error
 	defer func() {
 		if err != nil {
@@ -849,46 +1023,22 @@ func (c *Client) Download(name string, dest Destination) (err error) {
 		}
 	}
 
-	normalizedName := util.NormalizeTarget(name)
-	localMeta, ok := c.targets[normalizedName]
-	if !ok {
-		// search in delegations
-		localMeta, err = c.getTargetFileMeta(normalizedName)
-		if err != nil {
-			return err
-		}
-	}
-
-	// get the data from remote storage
-	r, size, err := c.downloadTarget(normalizedName, c.remote.GetTarget, localMeta.Hashes)
+	localMeta, err := c.downloadTargetFileMeta(ctx, util.NormalizeTarget(name))
 	if err != nil {
 		return err
 	}
-	defer r.Close()
-
-	// return ErrWrongSize if the reported size is known and incorrect
-	if size >= 0 && size != localMeta.Length {
-		return ErrWrongSize{name, size, localMeta.Length}
-	}
-
-	// wrap the data in a LimitReader so we download at most localMeta.Length bytes
-	stream := io.LimitReader(r, localMeta.Length)
 
-	// read the data, simultaneously writing it to dest and generating metadata
-	actual, err := util.GenerateTargetFileMeta(io.TeeReader(stream, dest), localMeta.HashAlgorithms()...)
-	if err != nil {
-		return ErrDownloadFailed{name, err}
-	}
+	return c.download(ctx, name, localMeta, dest)
+}
 
-	// check the data has the correct length and hashes
-	if err := util.TargetFileMetaEqual(actual, localMeta); err != nil {
-		if e, ok := err.(util.ErrWrongLength); ok {
-			return ErrWrongSize{name, e.Actual, e.Expected}
-		}
-		return ErrDownloadFailed{name, err}
+// downloadTargetFileMeta returns the local metadata for the given normalized
+// target name, searching delegations if it is not a top-level target.
+func (c *Client) downloadTargetFileMeta(ctx context.Context, name string) (data.TargetFileMeta, error) {
+	if localMeta, ok := c.targets[name]; ok {
+		return localMeta, nil
 	}
-
-	return nil
+	// search in delegations
+	return c.getTargetFileMeta(ctx, name)
 }
 
 func (c *Client) VerifyDigest(digest string, digestAlg string, length int64, path string) error {
@@ -918,7 +1068,7 @@ func (c *Client) VerifyDigest(digest string, digestAlg string, length int64, pat
 // exists, searching from top-level level targets then through
 // all delegations. If it does not, ErrNotFound will be returned.
 func (c *Client) Target(name string) (data.TargetFileMeta, error) {
-	target, err := c.getTargetFileMeta(util.NormalizeTarget(name))
+	target, err := c.getTargetFileMeta(context.Background(), util.NormalizeTarget(name))
 	if err == nil {
 		return target, nil
 	}
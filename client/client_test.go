@@ -20,6 +20,7 @@ import (
 	"github.com/theupdateframework/go-tuf/data"
 	"github.com/theupdateframework/go-tuf/internal/sets"
 	"github.com/theupdateframework/go-tuf/pkg/keys"
+	"github.com/theupdateframework/go-tuf/pkg/targets"
 	"github.com/theupdateframework/go-tuf/sign"
 	"github.com/theupdateframework/go-tuf/util"
 	"github.com/theupdateframework/go-tuf/verify"
@@ -1237,3 +1238,33 @@ func (s *ClientSuite) TestVerifyDigest(c *C) {
 
 	c.Assert(client.VerifyDigest(hash, "sha256", size, digest), IsNil)
 }
+
+func (s *ClientSuite) TestSuccinctHashBinDelegations(c *C) {
+	bins, err := targets.NewSuccinctHashBins("bins", 2)
+	c.Assert(err, IsNil)
+	names := []string{}
+	for i := uint64(0); i < bins.NumBins(); i++ {
+		names = append(names, bins.GetBin(i).RoleName())
+	}
+	key, err := s.repo.GenDelegatedKey(data.KeyTypeEd25519, names)
+	c.Assert(err, IsNil)
+	c.Assert(s.repo.AddDelegatedRolesForPathHashBins("targets", bins, []*data.PublicKey{key}, 1), IsNil)
+	s.addRemoteTarget(c, "bar.txt")
+
+	client := s.updatedClient(c)
+	bar, err := client.Target("bar.txt")
+	c.Assert(err, IsNil)
+	assertFile(c, bar, "bar.txt")
+
+	delegation := bins.SuccinctDelegatedRole(key.IDs(), 1)
+	all, err := client.AllTargets()
+	c.Assert(err, IsNil)
+	c.Assert(all, HasLen, 2)
+	c.Assert(all["foo.txt"].Role, Equals, "targets")
+	c.Assert(all["bar.txt"].Role, Equals, delegation.SuccinctRoleNameForPath("bar.txt"))
+
+	var dest testDestination
+	c.Assert(client.Download("bar.txt", &dest), IsNil)
+	c.Assert(dest.deleted, Equals, false)
+	c.Assert(dest.String(), Equals, "bar")
+}
@@ -0,0 +1,77 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+// startBlockingServer starts an HTTP server that responds with status code,
+// or blocks until the request is cancelled if status is 0.
+func startBlockingServer(c *C, status int) (string, func() error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	c.Assert(err, IsNil)
+	go http.Serve(l, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if status == 0 {
+			<-r.Context().Done()
+			return
+		}
+		w.WriteHeader(status)
+	}))
+	return fmt.Sprintf("http://%s", l.Addr()), l.Close
+}
+
+func (s *ClientSuite) TestUpdateContextCancelled(c *C) {
+	client := s.newClient(c)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := client.UpdateContext(ctx)
+	c.Assert(errors.Is(err, context.Canceled), Equals, true, Commentf("err: %v", err))
+}
+
+func (s *ClientSuite) TestDownloadContextCancelled(c *C) {
+	client := s.updatedClient(c)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	var dest testDestination
+	err := client.DownloadContext(ctx, "foo.txt", &dest)
+	c.Assert(errors.Is(err, context.Canceled), Equals, true, Commentf("err: %v", err))
+	c.Assert(dest.deleted, Equals, true)
+
+	err = client.DownloadBatchContext(ctx, map[string]Destination{"foo.txt": &dest}, 1)
+	c.Assert(err, FitsTypeOf, ErrBatchDownloadFailed{})
+	c.Assert(errors.Is(err.(ErrBatchDownloadFailed).Errors["foo.txt"], context.Canceled), Equals, true)
+}
+
+func (s *ClientSuite) TestHTTPRemoteStoreContext(c *C) {
+	// a stuck connection is cancelled
+	url, cleanup := startBlockingServer(c, 0)
+	defer cleanup()
+	remote, err := HTTPRemoteStore(url, nil, nil)
+	c.Assert(err, IsNil)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, _, err = remote.(ContextRemoteStore).GetMetaContext(ctx, "root.json")
+	c.Assert(errors.Is(err, context.DeadlineExceeded), Equals, true, Commentf("err: %v", err))
+	c.Assert(time.Since(start) < 5*time.Second, Equals, true)
+
+	// retries stop as soon as the context is done
+	url, cleanup = startBlockingServer(c, http.StatusServiceUnavailable)
+	defer cleanup()
+	remote, err = HTTPRemoteStore(url, &HTTPRemoteOptions{
+		Retries: &HTTPRemoteRetries{Delay: time.Hour, Total: 2 * time.Hour},
+	}, nil)
+	c.Assert(err, IsNil)
+	ctx, cancel = context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start = time.Now()
+	_, _, err = remote.(ContextRemoteStore).GetTargetContext(ctx, "foo.txt")
+	c.Assert(errors.Is(err, context.DeadlineExceeded), Equals, true, Commentf("err: %v", err))
+	c.Assert(time.Since(start) < 5*time.Second, Equals, true)
+}
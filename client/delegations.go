@@ -1,19 +1,202 @@
 package client
 
 import (
+	"context"
+	"sort"
+	"strings"
+
 	"github.com/theupdateframework/go-tuf/data"
+	"github.com/theupdateframework/go-tuf/internal/sets"
 	"github.com/theupdateframework/go-tuf/pkg/targets"
 	"github.com/theupdateframework/go-tuf/verify"
 )
 
+// TrustedTarget is a target file together with the name of the targets role
+// whose metadata it was found in.
+type TrustedTarget struct {
+	Role string
+	Meta data.TargetFileMeta
+}
+
+// AllTargets returns every target file available from the top-level targets
+// role and its delegations, with the role that trusts each of them.
+//
+// A target is listed with the role that Target would return it from, so
+// path patterns and terminating delegations are respected. Targets that
+// cannot be reached within MaxDelegations steps are left out, as are the
+// targets of delegated roles whose metadata cannot be loaded.
+func (c *Client) AllTargets() (map[string]TrustedTarget, error) {
+	return c.AllTargetsContext(context.Background())
+}
+
+// AllTargetsContext is like AllTargets, but stops downloading delegated
+// metadata when ctx is done.
+func (c *Client) AllTargetsContext(ctx context.Context) (map[string]TrustedTarget, error) {
+	snapshot, err := c.loadLocalSnapshot()
+	if err != nil {
+		return nil, err
+	}
+	loaded := make(map[loadedTargetsKey]*data.Targets)
+
+	// collect the names of the targets listed by the roles a search for
+	// some target could visit: roles are skipped if they are deeper than
+	// MaxDelegations, or if their paths cannot match any of the paths
+	// delegated to their delegator
+	top, err := topLevelDelegation(c.db)
+	if err != nil {
+		return nil, err
+	}
+	type step struct {
+		targets.Delegation
+		depth int
+	}
+	names := make(map[string]struct{})
+	visited := make(map[loadedTargetsKey]struct{})
+	stack := []step{{Delegation: top}}
+	for len(stack) > 0 {
+		d := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		key := loadedTargetsKey{d.Delegator, d.Delegatee.Name}
+		if _, ok := visited[key]; ok {
+			continue
+		}
+		visited[key] = struct{}{}
+
+		t, err := c.loadCachedDelegatedTargets(ctx, snapshot, d.Delegation, loaded)
+		if err != nil {
+			// the targets of a delegated role that cannot be loaded are
+			// not available, but the others are
+			if d.depth == 0 || ctx.Err() != nil {
+				return nil, err
+			}
+			continue
+		}
+		for name := range t.Targets {
+			names[name] = struct{}{}
+		}
+		if t.Delegations == nil || d.depth+1 >= c.MaxDelegations {
+			continue
+		}
+		db, err := verify.NewDBFromDelegations(t.Delegations)
+		if err != nil {
+			continue
+		}
+		for i := len(t.Delegations.Roles) - 1; i >= 0; i-- {
+			r := t.Delegations.Roles[i]
+			if !pathsOverlap(d.Delegatee, r) {
+				continue
+			}
+			for _, delegatee := range delegatees(r, snapshot) {
+				stack = append(stack, step{
+					Delegation: targets.Delegation{
+						Delegator: d.Delegatee.Name,
+						Delegatee: delegatee,
+						DB:        db,
+					},
+					depth: d.depth + 1,
+				})
+			}
+		}
+	}
+
+	// resolve each name the same way as a single target is searched for
+	res := make(map[string]TrustedTarget, len(names))
+	for name := range names {
+		meta, role, err := c.searchTargetFileMeta(ctx, snapshot, name, loaded)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, err
+			}
+			// the target is unknown, too deeply delegated, or delegated
+			// to a role that cannot be loaded
+			continue
+		}
+		res[name] = TrustedTarget{Role: role, Meta: meta}
+	}
+	return res, nil
+}
+
+// pathsOverlap reports whether a target path could match both the paths of
+// the delegation to a role and those of a delegation made by that role. It
+// only compares the literal prefixes of path patterns, and the hash
+// prefixes, so it may report paths that cannot both match as overlapping.
+func pathsOverlap(parent, child data.DelegatedRole) bool {
+	prefixesOverlap := func(a, b []string) bool {
+		for _, x := range a {
+			for _, y := range b {
+				if strings.HasPrefix(x, y) || strings.HasPrefix(y, x) {
+					return true
+				}
+			}
+		}
+		return false
+	}
+	literalPrefixes := func(patterns []string) []string {
+		prefixes := make([]string, 0, len(patterns))
+		for _, p := range patterns {
+			if i := strings.IndexAny(p, `*?[\`); i >= 0 {
+				p = p[:i]
+			}
+			prefixes = append(prefixes, p)
+		}
+		return prefixes
+	}
+
+	switch {
+	case len(parent.Paths) > 0 && len(child.Paths) > 0:
+		return prefixesOverlap(literalPrefixes(parent.Paths), literalPrefixes(child.Paths))
+	case len(parent.PathHashPrefixes) > 0 && len(child.PathHashPrefixes) > 0:
+		return prefixesOverlap(parent.PathHashPrefixes, child.PathHashPrefixes)
+	default:
+		return true
+	}
+}
+
+// delegatees returns the roles a delegation delegates to. For a succinct
+// hash bin delegation, these are the bins listed in the snapshot, as the
+// others cannot be loaded.
+func delegatees(r data.DelegatedRole, snapshot *data.Snapshot) []data.DelegatedRole {
+	if !r.IsSuccinct() {
+		return []data.DelegatedRole{r}
+	}
+	names := []string{}
+	for file := range snapshot.Meta {
+		if name := strings.TrimSuffix(file, ".json"); r.IsSuccinctRoleName(name) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	bins := make([]data.DelegatedRole, 0, len(names))
+	for _, name := range names {
+		bins = append(bins, data.DelegatedRole{
+			Name:        name,
+			KeyIDs:      r.KeyIDs,
+			Threshold:   r.Threshold,
+			Terminating: true,
+		})
+	}
+	return bins
+}
+
 // getTargetFileMeta searches for a verified TargetFileMeta matching a target
 // Requires a local snapshot to be loaded and is locked to the snapshot versions.
 // Searches through delegated targets following TUF spec 1.0.19 section 5.6.
-func (c *Client) getTargetFileMeta(target string) (data.TargetFileMeta, error) {
+func (c *Client) getTargetFileMeta(ctx context.Context, target string) (data.TargetFileMeta, error) {
 	snapshot, err := c.loadLocalSnapshot()
 	if err != nil {
 		return data.TargetFileMeta{}, err
 	}
+	meta, _, err := c.searchTargetFileMeta(ctx, snapshot, target, nil)
+	return meta, err
+}
+
+// searchTargetFileMeta returns the TargetFileMeta of target and the name of
+// the role it was found in. Delegated targets loaded by the search are kept
+// in loaded, if it is not nil, so they can be reused by later searches.
+func (c *Client) searchTargetFileMeta(ctx context.Context, snapshot *data.Snapshot, target string, loaded map[loadedTargetsKey]*data.Targets) (data.TargetFileMeta, string, error) {
+	if loaded == nil {
+		loaded = make(map[loadedTargetsKey]*data.Targets)
+	}
 
 	// delegationsIterator covers 5.6.7
 	// - pre-order depth-first search starting with the top targets
@@ -22,45 +205,84 @@ func (c *Client) getTargetFileMeta(target string) (data.TargetFileMeta, error) {
 	// - 5.6.7.2 terminations
 	delegations, err := targets.NewDelegationsIterator(target, c.db)
 	if err != nil {
-		return data.TargetFileMeta{}, err
+		return data.TargetFileMeta{}, "", err
 	}
 
 	for i := 0; i < c.MaxDelegations; i++ {
 		d, ok := delegations.Next()
 		if !ok {
-			return data.TargetFileMeta{}, ErrUnknownTarget{target, snapshot.Version}
+			return data.TargetFileMeta{}, "", ErrUnknownTarget{target, snapshot.Version}
 		}
 
 		// covers 5.6.{1,2,3,4,5,6}
-		targets, err := c.loadDelegatedTargets(snapshot, d.Delegatee.Name, d.DB)
+		targets, err := c.loadCachedDelegatedTargets(ctx, snapshot, d, loaded)
 		if err != nil {
-			return data.TargetFileMeta{}, err
+			return data.TargetFileMeta{}, "", err
 		}
 
 		// stop when the searched TargetFileMeta is found
 		if m, ok := targets.Targets[target]; ok {
-			return m, nil
+			return m, d.Delegatee.Name, nil
 		}
 
 		if targets.Delegations != nil {
 			delegationsDB, err := verify.NewDBFromDelegations(targets.Delegations)
 			if err != nil {
-				return data.TargetFileMeta{}, err
+				return data.TargetFileMeta{}, "", err
 			}
 			err = delegations.Add(targets.Delegations.Roles, d.Delegatee.Name, delegationsDB)
 			if err != nil {
-				return data.TargetFileMeta{}, err
+				return data.TargetFileMeta{}, "", err
 			}
 		}
 	}
 
-	return data.TargetFileMeta{}, ErrMaxDelegations{
+	return data.TargetFileMeta{}, "", ErrMaxDelegations{
 		Target:          target,
 		MaxDelegations:  c.MaxDelegations,
 		SnapshotVersion: snapshot.Version,
 	}
 }
 
+// topLevelDelegation returns the delegation of the top-level targets role,
+// as the first step of a search through the delegations.
+func topLevelDelegation(db *verify.DB) (targets.Delegation, error) {
+	role := db.GetRole("targets")
+	if role == nil {
+		return targets.Delegation{}, targets.ErrTopLevelTargetsRoleMissing
+	}
+	return targets.Delegation{
+		Delegatee: data.DelegatedRole{
+			Name:      "targets",
+			KeyIDs:    sets.StringSetToSlice(role.KeyIDs),
+			Threshold: role.Threshold,
+		},
+		DB: db,
+	}, nil
+}
+
+// loadedTargetsKey identifies delegated targets metadata verified with the
+// keys of a given delegator.
+type loadedTargetsKey struct {
+	delegator string
+	role      string
+}
+
+// loadCachedDelegatedTargets is like loadDelegatedTargets, but only loads
+// the metadata of each delegation once.
+func (c *Client) loadCachedDelegatedTargets(ctx context.Context, snapshot *data.Snapshot, d targets.Delegation, loaded map[loadedTargetsKey]*data.Targets) (*data.Targets, error) {
+	key := loadedTargetsKey{d.Delegator, d.Delegatee.Name}
+	if t, ok := loaded[key]; ok {
+		return t, nil
+	}
+	t, err := c.loadDelegatedTargets(ctx, snapshot, d.Delegatee.Name, d.DB)
+	if err != nil {
+		return nil, err
+	}
+	loaded[key] = t
+	return t, nil
+}
+
 func (c *Client) loadLocalSnapshot() (*data.Snapshot, error) {
 	if err := c.getLocalMeta(); err != nil {
 		return nil, err
@@ -79,8 +301,7 @@ func (c *Client) loadLocalSnapshot() (*data.Snapshot, error) {
 }
 
 // loadDelegatedTargets downloads, decodes, verifies and stores targets
-func (c *Client) loadDelegatedTargets(snapshot *data.Snapshot, role string, db *verify.DB) (*data.Targets, error) {
-	var err error
+func (c *Client) loadDelegatedTargets(ctx context.Context, snapshot *data.Snapshot, role string, db *verify.DB) (*data.Targets, error) {
 	fileName := role + ".json"
 	fileMeta, ok := snapshot.Meta[fileName]
 	if !ok {
@@ -91,20 +312,30 @@ func (c *Client) loadDelegatedTargets(snapshot *data.Snapshot, role string, db *
 	// 5.6.2 check against snapshot hash
 	// 5.6.4 check against snapshot version
 	raw, alreadyStored := c.localMetaFromSnapshot(fileName, fileMeta)
-	if !alreadyStored {
-		raw, err = c.downloadMetaFromSnapshot(fileName, fileMeta)
-		if err != nil {
-			return nil, err
+	var targets *data.Targets
+	err := c.retryBadData(func(bool) (err error) {
+		if !alreadyStored {
+			raw, err = c.downloadMetaFromSnapshot(ctx, fileName, fileMeta)
+			if err != nil {
+				return err
+			}
 		}
-	}
 
-	targets := &data.Targets{}
-	// 5.6.3 verify signature with parent public keys
-	// 5.6.5 verify that the targets is not expired
-	// role "targets" is a top role verified by root keys loaded in the client db
-	err = db.Unmarshal(raw, targets, role, fileMeta.Version)
+		// 5.6.3 verify signature with parent public keys
+		// 5.6.5 verify that the targets is not expired
+		// role "targets" is a top role verified by root keys loaded in the client db
+		targets = &data.Targets{}
+		if err := db.Unmarshal(raw, targets, role, fileMeta.Version); err != nil {
+			err := ErrDecodeFailed{fileName, err}
+			if !alreadyStored {
+				return c.reportBadMeta(c.remoteMetaPath(fileName, fileMeta.Version), err)
+			}
+			return err
+		}
+		return nil
+	})
 	if err != nil {
-		return nil, ErrDecodeFailed{fileName, err}
+		return nil, err
 	}
 
 	// 5.6.6 persist
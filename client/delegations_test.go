@@ -1,6 +1,7 @@
 package client
 
 import (
+	"context"
 	"crypto/sha256"
 	"encoding/json"
 	"fmt"
@@ -25,12 +26,12 @@ func TestGetTargetMeta(t *testing.T) {
 	_, err := c.Update()
 	assert.Nil(t, err)
 
-	f, err := c.getTargetFileMeta("f.txt")
+	f, err := c.getTargetFileMeta(context.Background(), "f.txt")
 	assert.Nil(t, err)
 	hash := sha256.Sum256([]byte("Contents: f.txt"))
 	assert.Equal(t, data.HexBytes(hash[:]), f.Hashes["sha256"])
 
-	f, err = c.getTargetFileMeta("targets.txt")
+	f, err = c.getTargetFileMeta(context.Background(), "targets.txt")
 	assert.Nil(t, err)
 	hash = sha256.Sum256([]byte("Contents: targets.txt"))
 	assert.Equal(t, data.HexBytes(hash[:]), f.Hashes["sha256"])
@@ -43,7 +44,7 @@ func TestMaxDelegations(t *testing.T) {
 	_, err := c.Update()
 	assert.Nil(t, err)
 	c.MaxDelegations = 2
-	_, err = c.getTargetFileMeta("c.txt")
+	_, err = c.getTargetFileMeta(context.Background(), "c.txt")
 	assert.Equal(t, ErrMaxDelegations{Target: "c.txt", MaxDelegations: 2, SnapshotVersion: 2}, err)
 }
 
@@ -53,10 +54,102 @@ func TestMetaNotFound(t *testing.T) {
 	defer func() { assert.Nil(t, closer()) }()
 	_, err := c.Update()
 	assert.Nil(t, err)
-	_, err = c.getTargetFileMeta("unknown.txt")
+	_, err = c.getTargetFileMeta(context.Background(), "unknown.txt")
 	assert.Equal(t, ErrUnknownTarget{Name: "unknown.txt", SnapshotVersion: 2}, err)
 }
 
+func TestAllTargets(t *testing.T) {
+	verify.IsExpired = func(t time.Time) bool { return false }
+	c, closer := initTestDelegationClient(t, "testdata/php-tuf-fixtures/TUFTestFixture3LevelDelegation")
+	defer func() { assert.Nil(t, closer()) }()
+	_, err := c.Update()
+	assert.Nil(t, err)
+
+	all, err := c.AllTargets()
+	assert.Nil(t, err)
+	roles := make(map[string]string, len(all))
+	for name, target := range all {
+		roles[name] = target.Role
+	}
+	assert.Equal(t, map[string]string{
+		"targets.txt": "targets",
+		"a.txt":       "a",
+		"b.txt":       "b",
+		"c.txt":       "c",
+		"d.txt":       "d",
+		"e.txt":       "e",
+		"f.txt":       "f",
+	}, roles)
+
+	hash := sha256.Sum256([]byte("Contents: f.txt"))
+	assert.Equal(t, data.HexBytes(hash[:]), all["f.txt"].Meta.Hashes["sha256"])
+}
+
+func TestAllTargetsMaxDelegations(t *testing.T) {
+	verify.IsExpired = func(t time.Time) bool { return false }
+	c, closer := initTestDelegationClient(t, "testdata/php-tuf-fixtures/TUFTestFixture3LevelDelegation")
+	defer func() { assert.Nil(t, closer()) }()
+	_, err := c.Update()
+	assert.Nil(t, err)
+	c.MaxDelegations = 2
+
+	all, err := c.AllTargets()
+	assert.Nil(t, err)
+	assert.Len(t, all, 2)
+	assert.Equal(t, "targets", all["targets.txt"].Role)
+	assert.Equal(t, "a", all["a.txt"].Role)
+}
+
+func TestAllTargetsMissingRole(t *testing.T) {
+	verify.IsExpired = func(t time.Time) bool { return false }
+	c, closer := initTestDelegationClient(t, "testdata/php-tuf-fixtures/TUFTestFixture3LevelDelegation")
+	defer func() { assert.Nil(t, closer()) }()
+	_, err := c.Update()
+	assert.Nil(t, err)
+
+	previousRemote := c.remote
+	c.remote = fakeRemote{
+		getMeta: func(path string) (stream io.ReadCloser, size int64, err error) {
+			if path == "1.c.json" {
+				return nil, 0, ErrNotFound{}
+			}
+			return previousRemote.GetMeta(path)
+		},
+		getTarget: previousRemote.GetTarget,
+	}
+
+	// the targets searched for through c are left out
+	all, err := c.AllTargets()
+	assert.Nil(t, err)
+	roles := make(map[string]string, len(all))
+	for name, target := range all {
+		roles[name] = target.Role
+	}
+	assert.Equal(t, map[string]string{
+		"targets.txt": "targets",
+		"a.txt":       "a",
+		"b.txt":       "b",
+	}, roles)
+}
+
+func TestPathsOverlap(t *testing.T) {
+	for _, tt := range []struct {
+		parent, child data.DelegatedRole
+		overlap       bool
+	}{
+		{data.DelegatedRole{}, data.DelegatedRole{Paths: []string{"a/*"}}, true},
+		{data.DelegatedRole{Paths: []string{"a/*"}}, data.DelegatedRole{Paths: []string{"a/b/*"}}, true},
+		{data.DelegatedRole{Paths: []string{"a/b*"}}, data.DelegatedRole{Paths: []string{"a/*"}}, true},
+		{data.DelegatedRole{Paths: []string{"a/*"}}, data.DelegatedRole{Paths: []string{"b/*"}}, false},
+		{data.DelegatedRole{Paths: []string{"a/*", "c/*"}}, data.DelegatedRole{Paths: []string{"b/*", "c/d"}}, true},
+		{data.DelegatedRole{PathHashPrefixes: []string{"ab"}}, data.DelegatedRole{PathHashPrefixes: []string{"abc"}}, true},
+		{data.DelegatedRole{PathHashPrefixes: []string{"ab"}}, data.DelegatedRole{PathHashPrefixes: []string{"ac"}}, false},
+		{data.DelegatedRole{PathHashPrefixes: []string{"ab"}}, data.DelegatedRole{Paths: []string{"a/*"}}, true},
+	} {
+		assert.Equal(t, tt.overlap, pathsOverlap(tt.parent, tt.child), "%v %v", tt.parent, tt.child)
+	}
+}
+
 type fakeRemote struct {
 	getMeta   func(name string) (stream io.ReadCloser, size int64, err error)
 	getTarget func(path string) (stream io.ReadCloser, size int64, err error)
@@ -89,7 +182,7 @@ func TestTargetsNotFound(t *testing.T) {
 	}
 	c.remote = newRemote
 
-	_, err = c.getTargetFileMeta("c.txt")
+	_, err = c.getTargetFileMeta(context.Background(), "c.txt")
 	assert.Equal(t, ErrMissingRemoteMetadata{Name: "c.json"}, err)
 }
 
@@ -113,7 +206,7 @@ func TestUnverifiedTargets(t *testing.T) {
 	}
 	c.remote = newRemote
 
-	_, err = c.getTargetFileMeta("c.txt")
+	_, err = c.getTargetFileMeta(context.Background(), "c.txt")
 	assert.Equal(t, ErrDecodeFailed{File: "c.json", Err: verify.ErrRoleThreshold{Expected: 1, Actual: 0}}, err)
 }
 
@@ -304,3 +397,17 @@ func copyStore(store map[string]json.RawMessage) map[string]json.RawMessage {
 	}
 	return new
 }
+
+func TestSuccinctDelegatees(t *testing.T) {
+	role := data.DelegatedRole{Name: "bins", KeyIDs: []string{"id"}, Threshold: 1, BitLength: 32, NamePrefix: "bins"}
+	snapshot := &data.Snapshot{Meta: data.SnapshotFiles{
+		"targets.json":       {},
+		"bins-00000002.json": {},
+		"bins-00000001.json": {},
+		"other.json":         {},
+	}}
+	assert.Equal(t, []data.DelegatedRole{
+		{Name: "bins-00000001", KeyIDs: []string{"id"}, Threshold: 1, Terminating: true},
+		{Name: "bins-00000002", KeyIDs: []string{"id"}, Threshold: 1, Terminating: true},
+	}, delegatees(role, snapshot))
+}
@@ -0,0 +1,355 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/theupdateframework/go-tuf/data"
+	"github.com/theupdateframework/go-tuf/util"
+)
+
+const (
+	// defaultDownloadConcurrency is the number of targets DownloadBatch
+	// downloads in parallel if no limit is given.
+	defaultDownloadConcurrency = 4
+
+	// maxDownloadResumes limits how many times an interrupted target
+	// download is resumed with a range request.
+	maxDownloadResumes = 3
+)
+
+// DownloadBatch downloads several target files from remote storage in
+// parallel. dests maps target names to their destinations. At most
+// concurrency targets are downloaded at once, or a default number if
+// concurrency is not positive.
+//
+// Each target is checked in the same way as Download, and the destination of
+// each target that fails is deleted. The other targets are still downloaded,
+// and ErrBatchDownloadFailed reports the error of every failed target.
+func (c *Client) DownloadBatch(dests map[string]Destination, concurrency int) error {
+	return c.DownloadBatchContext(context.Background(), dests, concurrency)
+}
+
+// DownloadBatchContext is like DownloadBatch, but stops downloading when ctx
+// is done. Targets that have not finished downloading fail with the error
+// of ctx.
+func (c *Client) DownloadBatchContext(ctx context.Context, dests map[string]Destination, concurrency int) error {
+	if concurrency <= 0 {
+		concurrency = defaultDownloadConcurrency
+	}
+
+	// populate c.targets from local storage if not set
+	if c.targets == nil {
+		if err := c.getLocalMeta(); err != nil {
+			return err
+		}
+	}
+
+	// Look up the metadata up front, as searching delegations is not safe
+	// for concurrent use.
+	errs := make(map[string]error)
+	localMeta := make(map[string]data.TargetFileMeta, len(dests))
+	for name, dest := range dests {
+		meta, err := c.downloadTargetFileMeta(ctx, util.NormalizeTarget(name))
+		if err != nil {
+			dest.Delete()
+			errs[name] = err
+			continue
+		}
+		localMeta[name] = meta
+	}
+
+	var (
+		mu  sync.Mutex
+		wg  sync.WaitGroup
+		sem = make(chan struct{}, concurrency)
+	)
+	for name, meta := range localMeta {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			dests[name].Delete()
+			mu.Lock()
+			errs[name] = ctx.Err()
+			mu.Unlock()
+			continue
+		}
+		wg.Add(1)
+		go func(name string, meta data.TargetFileMeta, dest Destination) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			if err := c.download(ctx, name, meta, dest); err != nil {
+				dest.Delete()
+				mu.Lock()
+				errs[name] = err
+				mu.Unlock()
+			}
+		}(name, meta, dests[name])
+	}
+	wg.Wait()
+
+	if len(errs) > 0 {
+		return ErrBatchDownloadFailed{errs}
+	}
+	return nil
+}
+
+// download downloads the target file described by localMeta into dest and
+// checks its length and hashes. If the remote store serves files from several
+// sources, a file that fails the checks is downloaded again from another
+// source. It does not delete dest on error.
+func (c *Client) download(ctx context.Context, name string, localMeta data.TargetFileMeta, dest Destination) error {
+	return c.retryBadData(func(canRetry bool) error {
+		return c.downloadOnce(ctx, name, localMeta, dest, canRetry)
+	})
+}
+
+// downloadOnce downloads the target file for download. If spool is set, the
+// file is only written to dest once it has been checked, so that bad data
+// can be downloaded again.
+func (c *Client) downloadOnce(ctx context.Context, name string, localMeta data.TargetFileMeta, dest Destination, spool bool) error {
+	t := &targetReader{
+		ctx:  ctx,
+		c:    c,
+		name: util.NormalizeTarget(name),
+		meta: localMeta,
+	}
+
+	// Serve the file from the target cache if there is a valid copy,
+	// otherwise add it to the cache as it is downloaded.
+	var cacheFile *os.File
+	var cacheWriter *bestEffortWriter
+	if t.cached = c.cachedTarget(localMeta); t.cached == "" {
+		cacheFile = c.newTargetCacheFile(localMeta)
+	}
+
+	// Resume from the data already held by dest, if the remote store can
+	// skip it.
+	partial := &countingReader{r: bytes.NewReader(nil)}
+	if d, ok := dest.(ResumableDestination); ok && t.canRange() {
+		r, err := d.Partial()
+		if err != nil {
+			return ErrDownloadFailed{name, err}
+		}
+		defer r.Close()
+		partial.r = r
+	}
+	t.partial = partial
+	defer t.Close()
+
+	var w io.Writer = dest
+	var spoolFile *os.File
+	if spool && t.cached == "" {
+		f, err := os.CreateTemp("", "go-tuf-download-")
+		if err != nil {
+			return ErrDownloadFailed{name, err}
+		}
+		defer func() {
+			f.Close()
+			os.Remove(f.Name())
+		}()
+		spoolFile = f
+		w = f
+	}
+	if cacheFile != nil {
+		cacheWriter = &bestEffortWriter{w: cacheFile}
+		w = io.MultiWriter(w, cacheWriter)
+	}
+
+	// read the data, simultaneously writing the new part to dest and
+	// generating metadata for the whole file
+	stream := io.MultiReader(partial, io.TeeReader(t, w))
+	actual, err := util.GenerateTargetFileMeta(stream, localMeta.HashAlgorithms()...)
+	if cacheFile != nil {
+		// only a complete, verified file may be added to the cache
+		defer func() {
+			commit := err == nil && partial.n == 0 && cacheWriter.err == nil
+			c.closeTargetCacheFile(cacheFile, localMeta, commit)
+		}()
+	}
+	if err != nil {
+		if t.openErr != nil {
+			return t.openErr
+		}
+		return ErrDownloadFailed{name, err}
+	}
+
+	// check the data has the correct length and hashes
+	if err = util.TargetFileMetaEqual(actual, localMeta); err != nil {
+		if e, ok := err.(util.ErrWrongLength); ok {
+			err = ErrWrongSize{name, e.Actual, e.Expected}
+		} else {
+			err = ErrDownloadFailed{name, err}
+		}
+		if t.path == "" {
+			return err
+		}
+		reported := c.reportBadTarget(t.path, err)
+		if partial.n > 0 {
+			// The bad data may be the partial data held by dest, which
+			// downloading the rest of the file again does not fix.
+			return err
+		}
+		return reported
+	}
+
+	if spoolFile != nil {
+		if _, err := spoolFile.Seek(0, io.SeekStart); err != nil {
+			return ErrDownloadFailed{name, err}
+		}
+		if _, err := io.Copy(dest, spoolFile); err != nil {
+			return ErrDownloadFailed{name, err}
+		}
+	}
+	return nil
+}
+
+// bestEffortWriter writes to w until it fails, without reporting the error
+// to the caller.
+type bestEffortWriter struct {
+	w   io.Writer
+	err error
+}
+
+func (b *bestEffortWriter) Write(p []byte) (int, error) {
+	if b.err == nil {
+		_, b.err = b.w.Write(p)
+	}
+	return len(p), nil
+}
+
+// targetReader reads a target file from remote storage, reading at most the
+// expected length of the file. It starts after the data read from partial,
+// and if the remote store supports ranges, resumes the download when reading
+// fails part way through.
+type targetReader struct {
+	ctx     context.Context
+	c       *Client
+	name    string
+	meta    data.TargetFileMeta
+	partial *countingReader
+
+	// cached is the path of a valid copy of the file in the target cache
+	cached string
+
+	r       io.ReadCloser
+	opened  bool
+	path    string
+	offset  int64
+	resumes int
+
+	// openErr is the error, if any, from requesting the file
+	openErr error
+}
+
+func (t *targetReader) canRange() bool {
+	if t.cached != "" {
+		return true
+	}
+	_, ok := t.c.remote.(RangeRemoteStore)
+	return ok
+}
+
+func (t *targetReader) open() error {
+	if t.cached != "" {
+		return t.openCached()
+	}
+
+	get := func(path string) (io.ReadCloser, int64, error) {
+		return t.c.getTarget(t.ctx, path)
+	}
+	if t.offset > 0 {
+		offset := t.offset
+		rs := t.c.remote.(RangeRemoteStore)
+		get = func(path string) (io.ReadCloser, int64, error) {
+			return rs.GetTargetRange(t.ctx, path, offset)
+		}
+	}
+	// remember the path the file is served from, to report bad data
+	getPath := func(path string) (io.ReadCloser, int64, error) {
+		r, size, err := get(path)
+		if err == nil {
+			t.path = path
+		}
+		return r, size, err
+	}
+	r, size, err := t.c.downloadTarget(t.name, getPath, t.meta.Hashes)
+	if err != nil {
+		return err
+	}
+
+	// return ErrWrongSize if the reported size is known and incorrect
+	if size >= 0 && t.offset+size != t.meta.Length {
+		r.Close()
+		return t.c.reportBadTarget(t.path, ErrWrongSize{t.name, t.offset + size, t.meta.Length})
+	}
+	t.r = r
+	return nil
+}
+
+func (t *targetReader) openCached() error {
+	f, err := os.Open(t.cached)
+	if err != nil {
+		return ErrDownloadFailed{t.name, err}
+	}
+	if _, err := f.Seek(t.offset, io.SeekStart); err != nil {
+		f.Close()
+		return ErrDownloadFailed{t.name, err}
+	}
+	t.r = f
+	return nil
+}
+
+func (t *targetReader) Read(p []byte) (int, error) {
+	if !t.opened {
+		t.opened = true
+		t.offset = t.partial.n
+	}
+	if t.offset >= t.meta.Length {
+		return 0, io.EOF
+	}
+	if t.r == nil {
+		if err := t.open(); err != nil {
+			t.openErr = err
+			return 0, err
+		}
+	}
+
+	if remaining := t.meta.Length - t.offset; int64(len(p)) > remaining {
+		p = p[:remaining]
+	}
+	n, err := t.r.Read(p)
+	t.offset += int64(n)
+	if err != nil && err != io.EOF && t.ctx.Err() == nil && t.canRange() && t.resumes < maxDownloadResumes {
+		// Reopen the file at the current offset on the next read.
+		t.r.Close()
+		t.r = nil
+		t.resumes++
+		return n, nil
+	}
+	return n, err
+}
+
+func (t *targetReader) Close() error {
+	if t.r == nil {
+		return nil
+	}
+	return t.r.Close()
+}
+
+// countingReader counts the bytes read from r.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,196 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+
+	. "gopkg.in/check.v1"
+)
+
+// fakeRangeRemoteStore serves targets with range support, and can interrupt
+// downloads part way through.
+type fakeRangeRemoteStore struct {
+	*fakeRemoteStore
+	files map[string][]byte
+
+	// interruptAfter makes reads of a target fail once after this many
+	// bytes of the response.
+	interruptAfter map[string]int
+	offsets        []int64
+}
+
+func (f *fakeRangeRemoteStore) GetTarget(path string) (io.ReadCloser, int64, error) {
+	return f.GetTargetRange(context.Background(), path, 0)
+}
+
+func (f *fakeRangeRemoteStore) GetTargetRange(ctx context.Context, path string, offset int64) (io.ReadCloser, int64, error) {
+	b, ok := f.files[path]
+	if !ok {
+		return nil, 0, ErrNotFound{path}
+	}
+	f.offsets = append(f.offsets, offset)
+	var r io.Reader = bytes.NewReader(b[offset:])
+	if n, ok := f.interruptAfter[path]; ok {
+		delete(f.interruptAfter, path)
+		r = io.MultiReader(io.LimitReader(r, int64(n)), &errReader{errors.New("connection reset")})
+	}
+	return ioutil.NopCloser(r), int64(len(b)) - offset, nil
+}
+
+type errReader struct {
+	err error
+}
+
+func (e *errReader) Read([]byte) (int, error) {
+	return 0, e.err
+}
+
+type resumableTestDestination struct {
+	testDestination
+}
+
+func (t *resumableTestDestination) Partial() (io.ReadCloser, error) {
+	return ioutil.NopCloser(bytes.NewReader(t.Bytes())), nil
+}
+
+func (s *ClientSuite) newRangeRemote() *fakeRangeRemoteStore {
+	remote := &fakeRangeRemoteStore{
+		fakeRemoteStore: s.remote,
+		files:           make(map[string][]byte),
+		interruptAfter:  make(map[string]int),
+	}
+	for name, b := range targetFiles {
+		remote.files[name] = b
+	}
+	return remote
+}
+
+func (s *ClientSuite) TestDownloadBatch(c *C) {
+	s.addRemoteTarget(c, "bar.txt")
+	s.addRemoteTarget(c, "baz.txt")
+	client := s.updatedClient(c)
+
+	dests := map[string]*testDestination{}
+	batch := map[string]Destination{}
+	for _, name := range []string{"foo.txt", "bar.txt", "baz.txt"} {
+		dests[name] = &testDestination{}
+		batch[name] = dests[name]
+	}
+	c.Assert(client.DownloadBatch(batch, 2), IsNil)
+	for name, dest := range dests {
+		c.Assert(dest.deleted, Equals, false)
+		c.Assert(dest.String(), Equals, string(targetFiles[name]))
+	}
+}
+
+func (s *ClientSuite) TestDownloadBatchErrors(c *C) {
+	s.addRemoteTarget(c, "bar.txt")
+	s.addRemoteTarget(c, "baz.txt")
+	client := s.updatedClient(c)
+
+	s.remote.targets["bar.txt"].buf = bytes.NewReader([]byte("corrupt"))
+	delete(s.remote.targets, "baz.txt")
+
+	foo := &testDestination{}
+	bar := &testDestination{}
+	baz := &testDestination{}
+	unknown := &testDestination{}
+	err := client.DownloadBatch(map[string]Destination{
+		"foo.txt":     foo,
+		"bar.txt":     bar,
+		"baz.txt":     baz,
+		"unknown.txt": unknown,
+	}, 0)
+	c.Assert(err, FitsTypeOf, ErrBatchDownloadFailed{})
+	errs := err.(ErrBatchDownloadFailed).Errors
+	c.Assert(errs, HasLen, 3)
+	assertWrongHash(c, errs["bar.txt"])
+	c.Assert(errs["baz.txt"], Equals, ErrNotFound{"baz.txt"})
+	c.Assert(errs["unknown.txt"], Equals, ErrUnknownTarget{Name: "unknown.txt", SnapshotVersion: 3})
+
+	c.Assert(foo.deleted, Equals, false)
+	c.Assert(foo.String(), Equals, "foo")
+	for _, dest := range []*testDestination{bar, baz, unknown} {
+		c.Assert(dest.deleted, Equals, true)
+	}
+}
+
+func (s *ClientSuite) TestDownloadResumePartial(c *C) {
+	client := s.updatedClient(c)
+	remote := s.newRangeRemote()
+	client.remote = remote
+
+	dest := &resumableTestDestination{}
+	dest.WriteString("fo")
+	c.Assert(client.Download("foo.txt", dest), IsNil)
+	c.Assert(dest.deleted, Equals, false)
+	c.Assert(dest.String(), Equals, "foo")
+	c.Assert(remote.offsets, DeepEquals, []int64{2})
+
+	// a complete destination is only verified
+	remote.offsets = nil
+	c.Assert(client.Download("foo.txt", dest), IsNil)
+	c.Assert(dest.String(), Equals, "foo")
+	c.Assert(remote.offsets, HasLen, 0)
+
+	// a partial download that does not match the target is deleted
+	dest = &resumableTestDestination{}
+	dest.WriteString("xo")
+	assertWrongHash(c, client.Download("foo.txt", dest))
+	c.Assert(dest.deleted, Equals, true)
+}
+
+func (s *ClientSuite) TestDownloadResumeInterrupted(c *C) {
+	client := s.updatedClient(c)
+	remote := s.newRangeRemote()
+	client.remote = remote
+
+	remote.interruptAfter["foo.txt"] = 1
+	var dest testDestination
+	c.Assert(client.Download("foo.txt", &dest), IsNil)
+	c.Assert(dest.String(), Equals, "foo")
+	c.Assert(remote.offsets, DeepEquals, []int64{0, 1})
+
+	// without range support, the error is returned
+	client.remote = s.remote
+	s.remote.targets["foo.txt"] = &fakeFile{
+		buf:  bytes.NewReader(nil),
+		size: 3,
+	}
+	dest = testDestination{}
+	c.Assert(client.Download("foo.txt", &dest), DeepEquals, ErrWrongSize{"foo.txt", 0, 3})
+	c.Assert(dest.deleted, Equals, true)
+}
+
+func (s *ClientSuite) TestDownloadResumeHTTP(c *C) {
+	tmp := c.MkDir()
+	addr, cleanup := startFileServer(c, tmp)
+	defer cleanup()
+
+	for _, consistentSnapshot := range []bool{false, true} {
+		dir := fmt.Sprintf("consistent-snapshot-%t", consistentSnapshot)
+		repo := generateRepoFS(c, filepath.Join(tmp, dir), targetFiles, consistentSnapshot)
+
+		remote, err := HTTPRemoteStore(fmt.Sprintf("http://%s/%s/repository", addr, dir), nil, nil)
+		c.Assert(err, IsNil)
+		client := NewClient(MemoryLocalStore(), remote)
+		rootMeta, err := repo.SignedMeta("root.json")
+		c.Assert(err, IsNil)
+		rootJSON, err := json.Marshal(rootMeta)
+		c.Assert(err, IsNil)
+		c.Assert(client.Init(rootJSON), IsNil)
+		_, err = client.Update()
+		c.Assert(err, IsNil)
+
+		dest := &resumableTestDestination{}
+		dest.WriteString("b")
+		c.Assert(client.Download("bar.txt", dest), IsNil)
+		c.Assert(dest.String(), Equals, "bar")
+	}
+}
@@ -3,12 +3,15 @@ package client
 import (
 	"errors"
 	"fmt"
+	"sort"
+	"strings"
 )
 
 var (
 	ErrNoRootKeys       = errors.New("tuf: no root keys found in local meta store")
 	ErrInsufficientKeys = errors.New("tuf: insufficient keys to meet threshold")
 	ErrNoLocalSnapshot  = errors.New("tuf: no snapshot stored locally")
+	ErrNoMirrors        = errors.New("tuf: no mirrors given")
 )
 
 type ErrMissingRemoteMetadata struct {
@@ -28,6 +31,10 @@ func (e ErrDownloadFailed) Error() string {
 	return fmt.Sprintf("tuf: failed to download %s: %s", e.File, e.Err)
 }
 
+func (e ErrDownloadFailed) Unwrap() error {
+	return e.Err
+}
+
 type ErrDecodeFailed struct {
 	File string
 	Err  error
@@ -105,3 +112,21 @@ type ErrRoleNotInSnapshot struct {
 func (e ErrRoleNotInSnapshot) Error() string {
 	return fmt.Sprintf("tuf: role %s not in snapshot version %d", e.Role, e.SnapshotVersion)
 }
+
+type ErrBatchDownloadFailed struct {
+	// Errors maps the name of each target that failed to its error.
+	Errors map[string]error
+}
+
+func (e ErrBatchDownloadFailed) Error() string {
+	names := make([]string, 0, len(e.Errors))
+	for name := range e.Errors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	msgs := make([]string, len(names))
+	for i, name := range names {
+		msgs[i] = fmt.Sprintf("%s: %s", name, e.Errors[name])
+	}
+	return fmt.Sprintf("tuf: failed to download %d target files: %s", len(names), strings.Join(msgs, "; "))
+}
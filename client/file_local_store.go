@@ -0,0 +1,130 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/theupdateframework/go-tuf/util"
+)
+
+// lockFileName is the name of the file locked by a writable
+// FileSystemLocalStore.
+const lockFileName = ".lock"
+
+var ErrReadOnlyLocalStore = errors.New("tuf: local store is read-only")
+
+type ErrLocalStoreLocked struct {
+	Dir string
+	Err error
+}
+
+func (e ErrLocalStoreLocked) Error() string {
+	return fmt.Sprintf("tuf: local store %s is locked by another process: %s", e.Dir, e.Err)
+}
+
+func (e ErrLocalStoreLocked) Unwrap() error {
+	return e.Err
+}
+
+// FileSystemLocalStore returns a LocalStore that keeps each metadata file
+// as a plain ROLE.json file in dir, creating dir if needed. Files are
+// written atomically, and the store holds an exclusive lock on dir until it
+// is closed, so concurrent updaters fail with ErrLocalStoreLocked instead of
+// mixing their metadata.
+func FileSystemLocalStore(dir string) (LocalStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	lock, err := os.OpenFile(filepath.Join(dir, lockFileName), os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	if err := lockFile(lock); err != nil {
+		lock.Close()
+		return nil, ErrLocalStoreLocked{dir, err}
+	}
+	return &fileSystemLocalStore{dir: dir, lock: lock}, nil
+}
+
+// ReadOnlyFileSystemLocalStore returns a LocalStore that reads metadata
+// written by FileSystemLocalStore, for example a trust cache shipped
+// alongside an application. It takes no lock and never writes to dir;
+// SetMeta and DeleteMeta return ErrReadOnlyLocalStore.
+func ReadOnlyFileSystemLocalStore(dir string) (LocalStore, error) {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("tuf: local store %s is not a directory", dir)
+	}
+	return &fileSystemLocalStore{dir: dir, readOnly: true}, nil
+}
+
+type fileSystemLocalStore struct {
+	dir      string
+	readOnly bool
+	lock     *os.File
+}
+
+// metaPath returns the path of the file holding the named metadata. Names
+// are escaped so that delegated role names cannot point outside dir.
+func (f *fileSystemLocalStore) metaPath(name string) string {
+	return filepath.Join(f.dir, url.PathEscape(name))
+}
+
+func (f *fileSystemLocalStore) GetMeta() (map[string]json.RawMessage, error) {
+	entries, err := os.ReadDir(f.dir)
+	if err != nil {
+		return nil, err
+	}
+	meta := make(map[string]json.RawMessage)
+	for _, e := range entries {
+		if !e.Type().IsRegular() || !strings.HasSuffix(e.Name(), ".json") {
+			continue
+		}
+		name, err := url.PathUnescape(e.Name())
+		if err != nil {
+			continue
+		}
+		b, err := os.ReadFile(filepath.Join(f.dir, e.Name()))
+		if err != nil {
+			return nil, err
+		}
+		meta[name] = b
+	}
+	return meta, nil
+}
+
+func (f *fileSystemLocalStore) SetMeta(name string, meta json.RawMessage) error {
+	if f.readOnly {
+		return ErrReadOnlyLocalStore
+	}
+	return util.AtomicallyWriteFile(f.metaPath(name), meta, 0644)
+}
+
+func (f *fileSystemLocalStore) DeleteMeta(name string) error {
+	if f.readOnly {
+		return ErrReadOnlyLocalStore
+	}
+	if err := os.Remove(f.metaPath(name)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+func (f *fileSystemLocalStore) Close() error {
+	if f.lock == nil {
+		return nil
+	}
+	// Closing the file releases the lock.
+	err := f.lock.Close()
+	f.lock = nil
+	return err
+}
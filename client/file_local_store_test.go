@@ -0,0 +1,116 @@
+package client
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+
+	. "gopkg.in/check.v1"
+)
+
+type FileSystemLocalStoreSuite struct{}
+
+var _ = Suite(&FileSystemLocalStoreSuite{})
+
+func (FileSystemLocalStoreSuite) TestSetGetDeleteMeta(c *C) {
+	dir := filepath.Join(c.MkDir(), "tuf")
+	store, err := FileSystemLocalStore(dir)
+	c.Assert(err, IsNil)
+
+	type meta map[string]json.RawMessage
+
+	assertGet := func(store LocalStore, expected meta) {
+		actual, err := store.GetMeta()
+		c.Assert(err, IsNil)
+		c.Assert(meta(actual), DeepEquals, expected)
+	}
+
+	// initial GetMeta should return empty meta
+	assertGet(store, meta{})
+
+	// SetMeta writes plain ROLE.json files
+	rootJSON := []byte(`{"_type":"root"}`)
+	targetsJSON := []byte(`{"_type":"targets"}`)
+	c.Assert(store.SetMeta("root.json", rootJSON), IsNil)
+	c.Assert(store.SetMeta("targets.json", targetsJSON), IsNil)
+	assertGet(store, meta{"root.json": rootJSON, "targets.json": targetsJSON})
+	b, err := os.ReadFile(filepath.Join(dir, "root.json"))
+	c.Assert(err, IsNil)
+	c.Assert(b, DeepEquals, rootJSON)
+
+	// delegated role names cannot escape the directory
+	delegatedJSON := []byte(`{"_type":"targets"}`)
+	c.Assert(store.SetMeta("../a/b.json", delegatedJSON), IsNil)
+	assertGet(store, meta{"root.json": rootJSON, "targets.json": targetsJSON, "../a/b.json": delegatedJSON})
+	_, err = os.Stat(filepath.Join(dir, "..", "a"))
+	c.Assert(os.IsNotExist(err), Equals, true)
+
+	// DeleteMeta removes the file, and ignores missing files
+	c.Assert(store.DeleteMeta("../a/b.json"), IsNil)
+	c.Assert(store.DeleteMeta("missing.json"), IsNil)
+	assertGet(store, meta{"root.json": rootJSON, "targets.json": targetsJSON})
+
+	// a new store should get the same meta
+	c.Assert(store.Close(), IsNil)
+	store, err = FileSystemLocalStore(dir)
+	c.Assert(err, IsNil)
+	defer store.Close()
+	assertGet(store, meta{"root.json": rootJSON, "targets.json": targetsJSON})
+}
+
+func (FileSystemLocalStoreSuite) TestLock(c *C) {
+	dir := c.MkDir()
+	store, err := FileSystemLocalStore(dir)
+	c.Assert(err, IsNil)
+
+	_, err = FileSystemLocalStore(dir)
+	c.Assert(err, FitsTypeOf, ErrLocalStoreLocked{})
+
+	// read-only stores do not need the lock
+	readOnly, err := ReadOnlyFileSystemLocalStore(dir)
+	c.Assert(err, IsNil)
+	c.Assert(readOnly.Close(), IsNil)
+
+	c.Assert(store.Close(), IsNil)
+	store, err = FileSystemLocalStore(dir)
+	c.Assert(err, IsNil)
+	c.Assert(store.Close(), IsNil)
+}
+
+func (FileSystemLocalStoreSuite) TestReadOnly(c *C) {
+	dir := c.MkDir()
+	_, err := ReadOnlyFileSystemLocalStore(filepath.Join(dir, "missing"))
+	c.Assert(os.IsNotExist(err), Equals, true)
+
+	rootJSON := []byte(`{"_type":"root"}`)
+	c.Assert(os.WriteFile(filepath.Join(dir, "root.json"), rootJSON, 0644), IsNil)
+
+	store, err := ReadOnlyFileSystemLocalStore(dir)
+	c.Assert(err, IsNil)
+	defer store.Close()
+	meta, err := store.GetMeta()
+	c.Assert(err, IsNil)
+	c.Assert(meta, DeepEquals, map[string]json.RawMessage{"root.json": rootJSON})
+	c.Assert(store.SetMeta("root.json", rootJSON), Equals, ErrReadOnlyLocalStore)
+	c.Assert(store.DeleteMeta("root.json"), Equals, ErrReadOnlyLocalStore)
+}
+
+func (s *ClientSuite) TestUpdateFileSystemLocalStore(c *C) {
+	dir := c.MkDir()
+	local, err := FileSystemLocalStore(dir)
+	c.Assert(err, IsNil)
+	client := NewClient(local, s.remote)
+	c.Assert(client.Init(s.rootMeta(c)), IsNil)
+	_, err = client.Update()
+	c.Assert(err, IsNil)
+	c.Assert(local.Close(), IsNil)
+
+	// the updated metadata can be used as a read-only trust cache
+	local, err = ReadOnlyFileSystemLocalStore(dir)
+	c.Assert(err, IsNil)
+	defer local.Close()
+	client = NewClient(local, s.remote)
+	targets, err := client.Targets()
+	c.Assert(err, IsNil)
+	assertFiles(c, targets, []string{"foo.txt"})
+}
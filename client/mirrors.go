@@ -0,0 +1,292 @@
+package client
+
+import (
+	"context"
+	"io"
+	"sort"
+	"sync"
+	"time"
+)
+
+// BadDataReporter is implemented by remote stores that serve files from
+// several sources, such as MirrorRemoteStore, so that they can stop using a
+// source that served data that failed verification. The client reports
+// files with the wrong length or hashes, and metadata that fails to verify,
+// and then downloads them again, expecting them to come from another source.
+type BadDataReporter interface {
+	// ReportBadMeta reports that the metadata at path, as passed to
+	// GetMeta, failed verification with err.
+	ReportBadMeta(path string, err error)
+
+	// ReportBadTarget reports that the target file at path, as passed to
+	// GetTarget, failed verification with err.
+	ReportBadTarget(path string, err error)
+}
+
+// MirrorOptions configures a MirrorRemoteStore.
+type MirrorOptions struct {
+	// Cooldown is how long a mirror is skipped for after it fails, which
+	// defaults to 1 minute.
+	Cooldown time.Duration
+
+	// ByHealth makes requests try the mirrors with the best health score
+	// first, rather than in the order they are given in. The score of a
+	// mirror goes up with each success and down with each failure.
+	ByHealth bool
+
+	// OnFailure, if set, is called when a mirror fails a request or is
+	// reported to have served bad data. mirror is its index in the list of
+	// mirrors.
+	OnFailure func(mirror int, path string, err error)
+}
+
+// MirrorStatus is the state of a mirror of a MirrorRemoteStore.
+type MirrorStatus struct {
+	// Score is the health score of the mirror, between 0 and 1.
+	Score float64
+
+	// CooldownUntil is when the mirror is used again, if it failed
+	// recently.
+	CooldownUntil time.Time
+}
+
+// MirrorRemoteStore is a RemoteStore that downloads from the first of
+// several mirrors of the same repository that works.
+//
+// A request falls over to the next mirror when a mirror does not have the
+// file, or fails with another error. Mirrors that fail, or that are reported
+// through BadDataReporter to have served bad data, are skipped for a
+// cooldown period, unless every mirror is cooling down. A mirror is not
+// penalised for not having a file, as clients request files that do not
+// exist yet when checking for new root metadata.
+//
+// The client downloads a file reported as bad again in the same Update or
+// Download, which gets it from another mirror. Target files are then held in
+// a temporary file until they are verified, rather than written to the
+// destination as they are downloaded.
+type MirrorRemoteStore struct {
+	mirrors []RemoteStore
+	opts    MirrorOptions
+
+	// now returns the current time, and is replaced in tests.
+	now func() time.Time
+
+	mu     sync.Mutex
+	status []MirrorStatus
+
+	// served maps the paths of recently served metadata and targets to the
+	// mirror they were served from, so that bad data can be reported.
+	served map[servedFile]int
+}
+
+type servedFile struct {
+	path   string
+	target bool
+}
+
+// maxServedFiles limits how many served paths are remembered.
+const maxServedFiles = 1024
+
+// healthDecay is how much of its previous value the health score of a mirror
+// keeps after each request.
+const healthDecay = 0.8
+
+// NewMirrorRemoteStore returns a MirrorRemoteStore for the mirrors.
+func NewMirrorRemoteStore(mirrors []RemoteStore, opts *MirrorOptions) (*MirrorRemoteStore, error) {
+	if len(mirrors) == 0 {
+		return nil, ErrNoMirrors
+	}
+	s := &MirrorRemoteStore{
+		mirrors: mirrors,
+		now:     time.Now,
+		status:  make([]MirrorStatus, len(mirrors)),
+		served:  make(map[servedFile]int),
+	}
+	if opts != nil {
+		s.opts = *opts
+	}
+	if s.opts.Cooldown <= 0 {
+		s.opts.Cooldown = time.Minute
+	}
+	for i := range s.status {
+		s.status[i].Score = 1
+	}
+	return s, nil
+}
+
+// Status returns the state of each mirror, in the order the mirrors were
+// given in.
+func (s *MirrorRemoteStore) Status() []MirrorStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	status := make([]MirrorStatus, len(s.status))
+	copy(status, s.status)
+	return status
+}
+
+func (s *MirrorRemoteStore) GetMeta(name string) (io.ReadCloser, int64, error) {
+	return s.GetMetaContext(context.Background(), name)
+}
+
+func (s *MirrorRemoteStore) GetTarget(path string) (io.ReadCloser, int64, error) {
+	return s.GetTargetContext(context.Background(), path)
+}
+
+func (s *MirrorRemoteStore) GetMetaContext(ctx context.Context, name string) (io.ReadCloser, int64, error) {
+	return s.get(ctx, servedFile{path: name}, func(m RemoteStore) (io.ReadCloser, int64, error) {
+		if r, ok := m.(ContextRemoteStore); ok {
+			return r.GetMetaContext(ctx, name)
+		}
+		return m.GetMeta(name)
+	})
+}
+
+func (s *MirrorRemoteStore) GetTargetContext(ctx context.Context, path string) (io.ReadCloser, int64, error) {
+	return s.GetTargetRange(ctx, path, 0)
+}
+
+// GetTargetRange downloads the target file from the first mirror that works,
+// skipping the first offset bytes. Mirrors that do not support ranges send
+// the whole file, and its start is skipped.
+func (s *MirrorRemoteStore) GetTargetRange(ctx context.Context, path string, offset int64) (io.ReadCloser, int64, error) {
+	return s.get(ctx, servedFile{path: path, target: true}, func(m RemoteStore) (io.ReadCloser, int64, error) {
+		if r, ok := m.(RangeRemoteStore); ok && offset > 0 {
+			return r.GetTargetRange(ctx, path, offset)
+		}
+		var r io.ReadCloser
+		var size int64
+		var err error
+		if c, ok := m.(ContextRemoteStore); ok {
+			r, size, err = c.GetTargetContext(ctx, path)
+		} else {
+			r, size, err = m.GetTarget(path)
+		}
+		if err != nil || offset == 0 {
+			return r, size, err
+		}
+		if _, err := io.CopyN(io.Discard, r, offset); err != nil {
+			r.Close()
+			return nil, 0, err
+		}
+		if size >= 0 {
+			size -= offset
+		}
+		return r, size, nil
+	})
+}
+
+// get downloads file from the first mirror that works.
+func (s *MirrorRemoteStore) get(ctx context.Context, file servedFile, get func(RemoteStore) (io.ReadCloser, int64, error)) (io.ReadCloser, int64, error) {
+	var notFound, lastErr error
+	for _, i := range s.order() {
+		if err := ctx.Err(); err != nil {
+			return nil, 0, err
+		}
+		r, size, err := get(s.mirrors[i])
+		if err == nil {
+			s.succeeded(i, file)
+			return &mirrorStream{ReadCloser: r, ctx: ctx, s: s, mirror: i, path: file.path}, size, nil
+		}
+		if ctx.Err() != nil {
+			return nil, 0, err
+		}
+		if IsNotFound(err) {
+			notFound = err
+			continue
+		}
+		s.failed(i, file.path, err)
+		lastErr = err
+	}
+
+	// A mirror that does not have the file is more likely to be right than
+	// one that fails, as it is up and serving the repository.
+	if notFound != nil {
+		return nil, 0, notFound
+	}
+	return nil, 0, lastErr
+}
+
+// order returns the indexes of the mirrors in the order they are tried: the
+// mirrors that are not cooling down, then the ones that are, from the one
+// that is used again first.
+func (s *MirrorRemoteStore) order() []int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	order := make([]int, len(s.mirrors))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		sa, sb := s.status[order[a]], s.status[order[b]]
+		coolingA, coolingB := now.Before(sa.CooldownUntil), now.Before(sb.CooldownUntil)
+		if coolingA != coolingB {
+			return coolingB
+		}
+		if coolingA {
+			return sa.CooldownUntil.Before(sb.CooldownUntil)
+		}
+		return s.opts.ByHealth && sa.Score > sb.Score
+	})
+	return order
+}
+
+func (s *MirrorRemoteStore) succeeded(mirror int, file servedFile) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st := &s.status[mirror]
+	st.Score = st.Score*healthDecay + (1 - healthDecay)
+	if len(s.served) >= maxServedFiles {
+		s.served = make(map[servedFile]int)
+	}
+	s.served[file] = mirror
+}
+
+func (s *MirrorRemoteStore) failed(mirror int, path string, err error) {
+	s.mu.Lock()
+	st := &s.status[mirror]
+	st.Score *= healthDecay
+	st.CooldownUntil = s.now().Add(s.opts.Cooldown)
+	s.mu.Unlock()
+	if s.opts.OnFailure != nil {
+		s.opts.OnFailure(mirror, path, err)
+	}
+}
+
+func (s *MirrorRemoteStore) ReportBadMeta(path string, err error) {
+	s.reportBad(servedFile{path: path}, err)
+}
+
+func (s *MirrorRemoteStore) ReportBadTarget(path string, err error) {
+	s.reportBad(servedFile{path: path, target: true}, err)
+}
+
+func (s *MirrorRemoteStore) reportBad(file servedFile, err error) {
+	s.mu.Lock()
+	mirror, ok := s.served[file]
+	delete(s.served, file)
+	s.mu.Unlock()
+	if ok {
+		s.failed(mirror, file.path, err)
+	}
+}
+
+// mirrorStream is a file served by a mirror, which fails the mirror if
+// reading the file fails before ctx is done.
+type mirrorStream struct {
+	io.ReadCloser
+	ctx    context.Context
+	s      *MirrorRemoteStore
+	mirror int
+	path   string
+	failed bool
+}
+
+func (m *mirrorStream) Read(p []byte) (int, error) {
+	n, err := m.ReadCloser.Read(p)
+	if err != nil && err != io.EOF && !m.failed && m.ctx.Err() == nil {
+		m.failed = true
+		m.s.failed(m.mirror, m.path, err)
+	}
+	return n, err
+}
@@ -0,0 +1,170 @@
+package client
+
+import (
+	"errors"
+	"io"
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+// countingRemoteStore counts the requests made to a remote store.
+type countingRemoteStore struct {
+	RemoteStore
+	requests int
+}
+
+func (r *countingRemoteStore) GetMeta(name string) (io.ReadCloser, int64, error) {
+	r.requests++
+	return r.RemoteStore.GetMeta(name)
+}
+
+func (r *countingRemoteStore) GetTarget(path string) (io.ReadCloser, int64, error) {
+	r.requests++
+	return r.RemoteStore.GetTarget(path)
+}
+
+// failingRemoteStore fails every request with err.
+type failingRemoteStore struct {
+	err error
+}
+
+func (r failingRemoteStore) GetMeta(name string) (io.ReadCloser, int64, error) {
+	return nil, 0, r.err
+}
+
+func (r failingRemoteStore) GetTarget(path string) (io.ReadCloser, int64, error) {
+	return nil, 0, r.err
+}
+
+// copyRemote returns a copy of the files of s.remote.
+func (s *ClientSuite) copyRemote(c *C) *fakeRemoteStore {
+	remote := newFakeRemoteStore()
+	for _, files := range []struct{ from, to map[string]*fakeFile }{
+		{s.remote.meta, remote.meta},
+		{s.remote.targets, remote.targets},
+	} {
+		for name, f := range files.from {
+			b, err := io.ReadAll(f)
+			c.Assert(err, IsNil)
+			f.Close()
+			files.to[name] = newFakeFile(b)
+		}
+	}
+	return remote
+}
+
+func (s *ClientSuite) newMirrorClient(c *C, mirrors []RemoteStore, opts *MirrorOptions) (*Client, *MirrorRemoteStore) {
+	remote, err := NewMirrorRemoteStore(mirrors, opts)
+	c.Assert(err, IsNil)
+	client := NewClient(MemoryLocalStore(), remote)
+	c.Assert(client.Init(s.rootMeta(c)), IsNil)
+	return client, remote
+}
+
+func (s *ClientSuite) TestMirrorRemoteStoreFailover(c *C) {
+	down := &countingRemoteStore{RemoteStore: failingRemoteStore{errors.New("connection refused")}}
+	failures := []int{}
+	client, remote := s.newMirrorClient(c, []RemoteStore{down, s.remote}, &MirrorOptions{
+		Cooldown:  time.Minute,
+		OnFailure: func(mirror int, path string, err error) { failures = append(failures, mirror) },
+	})
+	now := time.Now()
+	remote.now = func() time.Time { return now }
+
+	_, err := client.Update()
+	c.Assert(err, IsNil)
+	var dest testDestination
+	c.Assert(client.Download("foo.txt", &dest), IsNil)
+	c.Assert(dest.String(), Equals, "foo")
+
+	// the mirror that is down is only tried once during its cooldown
+	c.Assert(down.requests, Equals, 1)
+	c.Assert(failures, DeepEquals, []int{0})
+	status := remote.Status()
+	c.Assert(status[0].CooldownUntil, Equals, now.Add(time.Minute))
+	c.Assert(status[0].Score < status[1].Score, Equals, true)
+
+	// and tried first again once it is over
+	now = now.Add(time.Minute)
+	c.Assert(client.Download("foo.txt", &testDestination{}), IsNil)
+	c.Assert(down.requests, Equals, 2)
+
+	// when every mirror fails, the last error is returned
+	remote, err = NewMirrorRemoteStore([]RemoteStore{down, failingRemoteStore{errors.New("timeout")}}, nil)
+	c.Assert(err, IsNil)
+	_, _, err = remote.GetMeta("timestamp.json")
+	c.Assert(err, ErrorMatches, "timeout")
+
+	_, err = NewMirrorRemoteStore(nil, nil)
+	c.Assert(err, Equals, ErrNoMirrors)
+}
+
+func (s *ClientSuite) TestMirrorRemoteStoreNotFound(c *C) {
+	empty := newFakeRemoteStore()
+	client, remote := s.newMirrorClient(c, []RemoteStore{empty, s.remote}, nil)
+	_, err := client.Update()
+	c.Assert(err, IsNil)
+
+	// mirrors are not penalised for missing files
+	c.Assert(remote.Status()[0], DeepEquals, MirrorStatus{Score: 1})
+
+	// a missing file is reported as such, even if a mirror failed
+	remote, err = NewMirrorRemoteStore([]RemoteStore{failingRemoteStore{errors.New("timeout")}, empty}, nil)
+	c.Assert(err, IsNil)
+	_, _, err = remote.GetTarget("foo.txt")
+	c.Assert(err, Equals, ErrNotFound{"foo.txt"})
+}
+
+func (s *ClientSuite) TestMirrorRemoteStoreBadData(c *C) {
+	bad := s.copyRemote(c)
+	bad.targets["foo.txt"] = newFakeFile([]byte("bad"))
+	client, remote := s.newMirrorClient(c, []RemoteStore{bad, s.remote}, nil)
+	_, err := client.Update()
+	c.Assert(err, IsNil)
+
+	// the mirror is reported by the client, and the file is downloaded
+	// again from another mirror
+	var dest testDestination
+	c.Assert(client.Download("foo.txt", &dest), IsNil)
+	c.Assert(dest.String(), Equals, "foo")
+	c.Assert(remote.Status()[0].CooldownUntil.After(time.Now()), Equals, true)
+
+	// metadata that fails to verify is reported and downloaded again as well
+	bad = s.copyRemote(c)
+	bad.meta["timestamp.json"] = bad.meta["snapshot.json"]
+	client, remote = s.newMirrorClient(c, []RemoteStore{bad, s.remote}, nil)
+	_, err = client.Update()
+	c.Assert(err, IsNil)
+	c.Assert(remote.Status()[0].CooldownUntil.After(time.Now()), Equals, true)
+
+	// the error is returned once every mirror served bad data
+	client, _ = s.newMirrorClient(c, []RemoteStore{bad, bad}, nil)
+	_, err = client.Update()
+	c.Assert(err, FitsTypeOf, ErrDecodeFailed{})
+}
+
+func (s *ClientSuite) TestMirrorRemoteStoreByHealth(c *C) {
+	mirrors := []RemoteStore{s.remote, s.remote, s.remote}
+	for _, byHealth := range []bool{false, true} {
+		remote, err := NewMirrorRemoteStore(mirrors, &MirrorOptions{ByHealth: byHealth})
+		c.Assert(err, IsNil)
+		now := time.Now()
+		remote.now = func() time.Time { return now }
+		remote.failed(0, "timestamp.json", errors.New("timeout"))
+		now = now.Add(time.Second)
+		remote.failed(1, "timestamp.json", errors.New("timeout"))
+		now = now.Add(time.Second)
+		remote.failed(0, "timestamp.json", errors.New("timeout"))
+
+		// mirrors cooling down are tried last
+		c.Assert(remote.order(), DeepEquals, []int{2, 1, 0})
+
+		now = now.Add(time.Hour)
+		if byHealth {
+			c.Assert(remote.order(), DeepEquals, []int{2, 1, 0})
+		} else {
+			c.Assert(remote.order(), DeepEquals, []int{0, 1, 2})
+		}
+	}
+}
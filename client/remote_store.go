@@ -1,13 +1,16 @@
 package client
 
 import (
+	"context"
 	"fmt"
 	"io"
+	"math/rand"
 	"net/http"
 	"net/url"
 	"path"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -16,11 +19,61 @@ type HTTPRemoteOptions struct {
 	TargetsPath  string
 	UserAgent    string
 	Retries      *HTTPRemoteRetries
+
+	// AttemptTimeout, if set, limits how long each request waits for the
+	// response headers. An attempt that times out is retried like a network
+	// error. It does not limit how long reading the response body takes.
+	AttemptTimeout time.Duration
 }
 
+// HTTPRemoteRetries configures how failed requests are retried. Requests
+// are retried after network errors, including connection resets while the
+// response body is read, and after responses with a 5xx or 429 status code.
 type HTTPRemoteRetries struct {
+	// Delay is how long to wait before the first retry.
 	Delay time.Duration
+
+	// Total is how long to keep retrying for, measured from the first
+	// attempt. No retry is made that would start after Total has elapsed.
 	Total time.Duration
+
+	// Multiplier, if greater than 1, is what the delay is multiplied by
+	// after each retry, for exponential backoff. Otherwise the delay is
+	// constant.
+	Multiplier float64
+
+	// MaxDelay, if set, caps the delay between retries.
+	MaxDelay time.Duration
+
+	// Jitter is the fraction of each delay that is randomized, between 0
+	// and 1, so that clients failing at the same time do not all retry at
+	// the same time. With a Jitter of 0.5, a delay of 2s becomes a random
+	// delay between 1s and 2s.
+	Jitter float64
+
+	// MaxAttempts, if set, limits the number of attempts, counting the
+	// first one.
+	MaxAttempts int
+
+	// OnRetry, if set, is called before waiting to retry a request.
+	OnRetry func(HTTPRetryEvent)
+}
+
+// HTTPRetryEvent describes a failed attempt that is about to be retried.
+type HTTPRetryEvent struct {
+	URL string
+
+	// Attempt is the number of the attempt that failed, starting at 1.
+	Attempt int
+
+	// StatusCode is the status code of the response, or 0 if the attempt
+	// failed with Err.
+	StatusCode int
+	Err        error
+
+	// Delay is how long the retry waits for. It is at least as long as the
+	// Retry-After header of a 429 or 503 response.
+	Delay time.Duration
 }
 
 var DefaultHTTPRetries = &HTTPRemoteRetries{
@@ -51,32 +104,68 @@ type httpRemoteStore struct {
 }
 
 func (h *httpRemoteStore) GetMeta(name string) (io.ReadCloser, int64, error) {
-	return h.get(path.Join(h.opts.MetadataPath, name))
+	return h.GetMetaContext(context.Background(), name)
 }
 
 func (h *httpRemoteStore) GetTarget(name string) (io.ReadCloser, int64, error) {
-	return h.get(path.Join(h.opts.TargetsPath, name))
+	return h.GetTargetContext(context.Background(), name)
 }
 
-func (h *httpRemoteStore) get(s string) (io.ReadCloser, int64, error) {
-	u := h.url(s)
-	req, err := http.NewRequest("GET", u, nil)
+func (h *httpRemoteStore) GetMetaContext(ctx context.Context, name string) (io.ReadCloser, int64, error) {
+	return h.get(ctx, path.Join(h.opts.MetadataPath, name), 0)
+}
+
+func (h *httpRemoteStore) GetTargetContext(ctx context.Context, name string) (io.ReadCloser, int64, error) {
+	return h.get(ctx, path.Join(h.opts.TargetsPath, name), 0)
+}
+
+func (h *httpRemoteStore) GetTargetRange(ctx context.Context, name string, offset int64) (io.ReadCloser, int64, error) {
+	return h.get(ctx, path.Join(h.opts.TargetsPath, name), offset)
+}
+
+func (h *httpRemoteStore) get(ctx context.Context, s string, offset int64) (io.ReadCloser, int64, error) {
+	retries := h.newRetryState()
+	body, size, err := h.open(ctx, s, offset, retries)
 	if err != nil {
 		return nil, 0, err
 	}
-	if h.opts.UserAgent != "" {
-		req.Header.Set("User-Agent", h.opts.UserAgent)
+	if retries != nil {
+		body = &resumingBody{h: h, ctx: ctx, path: s, offset: offset, body: body, retries: retries}
 	}
+	return body, size, nil
+}
+
+// open requests the file at path s from offset on, retrying as configured,
+// and returns the response body.
+func (h *httpRemoteStore) open(ctx context.Context, s string, offset int64, retries *retryState) (io.ReadCloser, int64, error) {
+	u := h.url(s)
 	var res *http.Response
-	if r := h.opts.Retries; r != nil {
-		for start := time.Now(); time.Since(start) < r.Total; time.Sleep(r.Delay) {
-			res, err = h.cli.Do(req)
-			if err == nil && (res.StatusCode < 500 || res.StatusCode > 599) {
-				break
+	var err error
+	for {
+		res, err = h.do(ctx, u, offset)
+		if ctx.Err() != nil {
+			if err == nil {
+				res.Body.Close()
 			}
+			return nil, 0, ctx.Err()
+		}
+		if err == nil && !retryableStatus(res.StatusCode) {
+			break
+		}
+		event := HTTPRetryEvent{URL: u, Err: err}
+		if err == nil {
+			event.StatusCode = res.StatusCode
+			event.Delay = retryAfter(res)
+		}
+		if !retries.next(&event) {
+			break
+		}
+		if err == nil {
+			res.Body.Close()
+		}
+		if err := retries.wait(ctx, event); err != nil {
+			return nil, 0, err
 		}
-	} else {
-		res, err = h.cli.Do(req)
 	}
 	if err != nil {
 		return nil, 0, err
@@ -85,7 +174,7 @@ func (h *httpRemoteStore) get(s string) (io.ReadCloser, int64, error) {
 	if res.StatusCode == http.StatusNotFound {
 		res.Body.Close()
 		return nil, 0, ErrNotFound{s}
-	} else if res.StatusCode != http.StatusOK {
+	} else if res.StatusCode != http.StatusOK && (offset == 0 || res.StatusCode != http.StatusPartialContent) {
 		res.Body.Close()
 		return nil, 0, &url.Error{
 			Op:  "GET",
@@ -96,11 +185,261 @@ func (h *httpRemoteStore) get(s string) (io.ReadCloser, int64, error) {
 
 	size, err := strconv.ParseInt(res.Header.Get("Content-Length"), 10, 0)
 	if err != nil {
-		return res.Body, -1, nil
+		size = -1
+	}
+
+	// The server ignored the range and sent the whole file, so skip the
+	// start of it.
+	if offset > 0 && res.StatusCode == http.StatusOK {
+		if _, err := io.CopyN(io.Discard, res.Body, offset); err != nil {
+			res.Body.Close()
+			return nil, 0, &url.Error{Op: "GET", URL: u, Err: err}
+		}
+		if size >= 0 {
+			size -= offset
+		}
 	}
 	return res.Body, size, nil
 }
 
+// do makes a single attempt at requesting u from offset on.
+func (h *httpRemoteStore) do(ctx context.Context, u string, offset int64) (*http.Response, error) {
+	timeout := h.opts.AttemptTimeout
+	if timeout <= 0 {
+		return h.doRequest(ctx, u, offset)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	timer := time.AfterFunc(timeout, cancel)
+	res, err := h.doRequest(ctx, u, offset)
+	if !timer.Stop() {
+		if err == nil {
+			res.Body.Close()
+		}
+		cancel()
+		return nil, &url.Error{Op: "GET", URL: u, Err: fmt.Errorf("no response within %s", timeout)}
+	}
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	res.Body = &cancelBody{res.Body, cancel}
+	return res, nil
+}
+
+func (h *httpRemoteStore) doRequest(ctx context.Context, u string, offset int64) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", u, nil)
+	if err != nil {
+		return nil, err
+	}
+	if h.opts.UserAgent != "" {
+		req.Header.Set("User-Agent", h.opts.UserAgent)
+	}
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+	return h.cli.Do(req)
+}
+
+// cancelBody cancels the context of its request when it is closed.
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
+
+func retryableStatus(status int) bool {
+	return status == http.StatusTooManyRequests || (status >= 500 && status <= 599)
+}
+
+// retryAfter returns how long the Retry-After header of a 429 or 503
+// response asks to wait before retrying, or 0.
+func retryAfter(res *http.Response) time.Duration {
+	if res.StatusCode != http.StatusTooManyRequests && res.StatusCode != http.StatusServiceUnavailable {
+		return 0
+	}
+	v := strings.TrimSpace(res.Header.Get("Retry-After"))
+	if v == "" {
+		return 0
+	}
+	if secs, err := strconv.ParseInt(v, 10, 64); err == nil {
+		if secs < 0 {
+			return 0
+		}
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		if d := time.Until(t); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
+
+// retryState tracks the retries of a download, including the ones made to
+// resume reading its body.
+type retryState struct {
+	cfg      *HTTPRemoteRetries
+	start    time.Time
+	attempts int
+	delay    time.Duration
+}
+
+// newRetryState returns the retry state for a new download, or nil if
+// requests are not retried.
+func (h *httpRemoteStore) newRetryState() *retryState {
+	if h.opts.Retries == nil {
+		return nil
+	}
+	return &retryState{cfg: h.opts.Retries, start: time.Now(), delay: h.opts.Retries.Delay}
+}
+
+// next records a failed attempt, and returns whether it should be retried.
+// If so, it sets the delay of event to how long to wait first, keeping it
+// at least as long as the delay event already has from Retry-After.
+func (r *retryState) next(event *HTTPRetryEvent) bool {
+	if r == nil {
+		return false
+	}
+	r.attempts++
+	event.Attempt = r.attempts
+	if r.cfg.MaxAttempts > 0 && r.attempts >= r.cfg.MaxAttempts {
+		return false
+	}
+
+	delay := r.delay
+	if j := r.cfg.Jitter; j > 0 {
+		if j > 1 {
+			j = 1
+		}
+		delay -= time.Duration(j * randFloat64() * float64(delay))
+	}
+	if delay < event.Delay {
+		delay = event.Delay
+	}
+	if time.Since(r.start)+delay >= r.cfg.Total {
+		return false
+	}
+	event.Delay = delay
+
+	if r.cfg.Multiplier > 1 {
+		r.delay = time.Duration(float64(r.delay) * r.cfg.Multiplier)
+	}
+	if r.cfg.MaxDelay > 0 && r.delay > r.cfg.MaxDelay {
+		r.delay = r.cfg.MaxDelay
+	}
+	return true
+}
+
+// wait reports the retry to OnRetry, and waits for its delay.
+func (r *retryState) wait(ctx context.Context, event HTTPRetryEvent) error {
+	if r.cfg.OnRetry != nil {
+		r.cfg.OnRetry(event)
+	}
+	return sleepContext(ctx, event.Delay)
+}
+
+var (
+	randMu sync.Mutex
+	// rnd is seeded explicitly, as the global source is not seeded before
+	// Go 1.20 and every client would otherwise jitter the same way.
+	rnd = rand.New(rand.NewSource(time.Now().UnixNano()))
+)
+
+func randFloat64() float64 {
+	randMu.Lock()
+	defer randMu.Unlock()
+	return rnd.Float64()
+}
+
+// resumingBody reads a response body, and when reading fails part way
+// through it requests the rest of the file and carries on from there.
+type resumingBody struct {
+	h       *httpRemoteStore
+	ctx     context.Context
+	path    string
+	offset  int64
+	body    io.ReadCloser
+	retries *retryState
+
+	// readErr is the error reading body failed with. Once the read cannot
+	// be resumed, body is nil and readErr is returned by every Read.
+	readErr error
+}
+
+func (b *resumingBody) Read(p []byte) (int, error) {
+	for {
+		if b.readErr != nil {
+			if err := b.resume(); err != nil {
+				return 0, err
+			}
+		}
+		n, err := b.body.Read(p)
+		b.offset += int64(n)
+		if err == nil || err == io.EOF || b.ctx.Err() != nil {
+			return n, err
+		}
+		b.readErr = err
+		if n > 0 {
+			return n, nil
+		}
+	}
+}
+
+// resume replaces the body that failed with readErr by a new request for the
+// rest of the file, once the retry delay has passed.
+func (b *resumingBody) resume() error {
+	if b.body == nil {
+		return b.readErr
+	}
+	b.body.Close()
+	b.body = nil
+	event := HTTPRetryEvent{URL: b.h.url(b.path), Err: b.readErr}
+	if !b.retries.next(&event) {
+		return b.readErr
+	}
+	if err := b.retries.wait(b.ctx, event); err != nil {
+		b.readErr = err
+		return err
+	}
+	body, _, err := b.h.open(b.ctx, b.path, b.offset, b.retries)
+	if err != nil {
+		b.readErr = err
+		return err
+	}
+	b.body = body
+	b.readErr = nil
+	return nil
+}
+
+func (b *resumingBody) Close() error {
+	if b.body == nil {
+		return nil
+	}
+	err := b.body.Close()
+	b.body = nil
+	b.readErr = io.ErrClosedPipe
+	return err
+}
+
+// sleepContext pauses for d, returning early with the error of ctx if it is
+// done first.
+func sleepContext(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
 func (h *httpRemoteStore) url(path string) string {
 	if !strings.HasPrefix(path, "/") {
 		path = "/" + path
@@ -0,0 +1,241 @@
+package client
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+// retryServer serves "foo" once the handler given for each attempt, if any,
+// has run and not written a response.
+type retryServer struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	attempts []func(w http.ResponseWriter, r *http.Request) bool
+	ranges   []string
+}
+
+func startRetryServer(attempts ...func(w http.ResponseWriter, r *http.Request) bool) *retryServer {
+	s := &retryServer{attempts: attempts}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		n := len(s.ranges)
+		s.ranges = append(s.ranges, r.Header.Get("Range"))
+		s.mu.Unlock()
+		if n < len(s.attempts) && s.attempts[n](w, r) {
+			return
+		}
+		http.ServeContent(w, r, "foo.txt", time.Time{}, strings.NewReader("foo"))
+	}))
+	return s
+}
+
+func (s *retryServer) requests() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.ranges
+}
+
+func respondWith(status int, header ...string) func(w http.ResponseWriter, r *http.Request) bool {
+	return func(w http.ResponseWriter, r *http.Request) bool {
+		for i := 0; i < len(header); i += 2 {
+			w.Header().Set(header[i], header[i+1])
+		}
+		w.WriteHeader(status)
+		return true
+	}
+}
+
+func readTarget(remote RemoteStore) (string, error) {
+	r, _, err := remote.GetTarget("foo.txt")
+	if err != nil {
+		return "", err
+	}
+	defer r.Close()
+	b, err := io.ReadAll(r)
+	return string(b), err
+}
+
+func (s *ClientSuite) TestHTTPRemoteStoreBackoff(c *C) {
+	srv := startRetryServer(
+		respondWith(http.StatusInternalServerError),
+		respondWith(http.StatusBadGateway),
+		respondWith(http.StatusTooManyRequests),
+	)
+	defer srv.Close()
+
+	events := []HTTPRetryEvent{}
+	remote, err := HTTPRemoteStore(srv.URL, &HTTPRemoteOptions{
+		Retries: &HTTPRemoteRetries{
+			Delay:      time.Millisecond,
+			Total:      time.Minute,
+			Multiplier: 3,
+			MaxDelay:   5 * time.Millisecond,
+			OnRetry:    func(e HTTPRetryEvent) { events = append(events, e) },
+		},
+	}, nil)
+	c.Assert(err, IsNil)
+	data, err := readTarget(remote)
+	c.Assert(err, IsNil)
+	c.Assert(data, Equals, "foo")
+
+	url := srv.URL + "/targets/foo.txt"
+	c.Assert(events, DeepEquals, []HTTPRetryEvent{
+		{URL: url, Attempt: 1, StatusCode: 500, Delay: time.Millisecond},
+		{URL: url, Attempt: 2, StatusCode: 502, Delay: 3 * time.Millisecond},
+		{URL: url, Attempt: 3, StatusCode: 429, Delay: 5 * time.Millisecond},
+	})
+}
+
+func (s *ClientSuite) TestHTTPRemoteStoreJitter(c *C) {
+	srv := startRetryServer(
+		respondWith(http.StatusInternalServerError),
+		respondWith(http.StatusInternalServerError),
+		respondWith(http.StatusInternalServerError),
+	)
+	defer srv.Close()
+
+	delays := []time.Duration{}
+	remote, err := HTTPRemoteStore(srv.URL, &HTTPRemoteOptions{
+		Retries: &HTTPRemoteRetries{
+			Delay:   10 * time.Millisecond,
+			Total:   time.Minute,
+			Jitter:  0.5,
+			OnRetry: func(e HTTPRetryEvent) { delays = append(delays, e.Delay) },
+		},
+	}, nil)
+	c.Assert(err, IsNil)
+	_, err = readTarget(remote)
+	c.Assert(err, IsNil)
+	c.Assert(delays, HasLen, 3)
+	for _, d := range delays {
+		c.Assert(d >= 5*time.Millisecond && d <= 10*time.Millisecond, Equals, true, Commentf("delay: %s", d))
+	}
+}
+
+func (s *ClientSuite) TestHTTPRemoteStoreMaxAttempts(c *C) {
+	srv := startRetryServer(
+		respondWith(http.StatusServiceUnavailable),
+		respondWith(http.StatusServiceUnavailable),
+		respondWith(http.StatusServiceUnavailable),
+	)
+	defer srv.Close()
+
+	remote, err := HTTPRemoteStore(srv.URL, &HTTPRemoteOptions{
+		Retries: &HTTPRemoteRetries{Delay: time.Millisecond, Total: time.Minute, MaxAttempts: 2},
+	}, nil)
+	c.Assert(err, IsNil)
+	_, err = readTarget(remote)
+	c.Assert(err, ErrorMatches, ".*unexpected HTTP status 503")
+	c.Assert(srv.requests(), HasLen, 2)
+
+	// client errors are not retried
+	srv = startRetryServer(respondWith(http.StatusForbidden))
+	defer srv.Close()
+	remote, err = HTTPRemoteStore(srv.URL, &HTTPRemoteOptions{
+		Retries: &HTTPRemoteRetries{Delay: time.Millisecond, Total: time.Minute},
+	}, nil)
+	c.Assert(err, IsNil)
+	_, err = readTarget(remote)
+	c.Assert(err, ErrorMatches, ".*unexpected HTTP status 403")
+	c.Assert(srv.requests(), HasLen, 1)
+}
+
+func (s *ClientSuite) TestHTTPRemoteStoreRetryAfter(c *C) {
+	srv := startRetryServer(
+		respondWith(http.StatusServiceUnavailable, "Retry-After", "1"),
+		respondWith(http.StatusTooManyRequests, "Retry-After", "3600"),
+	)
+	defer srv.Close()
+
+	events := []HTTPRetryEvent{}
+	remote, err := HTTPRemoteStore(srv.URL, &HTTPRemoteOptions{
+		Retries: &HTTPRemoteRetries{
+			Delay:   time.Millisecond,
+			Total:   time.Minute,
+			OnRetry: func(e HTTPRetryEvent) { events = append(events, e) },
+		},
+	}, nil)
+	c.Assert(err, IsNil)
+	start := time.Now()
+	_, err = readTarget(remote)
+	c.Assert(time.Since(start) >= time.Second, Equals, true)
+
+	// the retry the server asks for is later than Total allows, so the
+	// request fails instead
+	c.Assert(err, ErrorMatches, ".*unexpected HTTP status 429")
+	c.Assert(events, HasLen, 1)
+	c.Assert(events[0].StatusCode, Equals, http.StatusServiceUnavailable)
+	c.Assert(events[0].Delay, Equals, time.Second)
+	c.Assert(srv.requests(), HasLen, 2)
+}
+
+func (s *ClientSuite) TestHTTPRemoteStoreResumeBody(c *C) {
+	// the connection is reset after the first byte of the body
+	srv := startRetryServer(func(w http.ResponseWriter, r *http.Request) bool {
+		w.Header().Set("Content-Length", "3")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("f"))
+		w.(http.Flusher).Flush()
+		conn, _, err := w.(http.Hijacker).Hijack()
+		if err == nil {
+			conn.Close()
+		}
+		return true
+	})
+	defer srv.Close()
+
+	events := []HTTPRetryEvent{}
+	remote, err := HTTPRemoteStore(srv.URL, &HTTPRemoteOptions{
+		Retries: &HTTPRemoteRetries{
+			Delay:   time.Millisecond,
+			Total:   time.Minute,
+			OnRetry: func(e HTTPRetryEvent) { events = append(events, e) },
+		},
+	}, nil)
+	c.Assert(err, IsNil)
+	data, err := readTarget(remote)
+	c.Assert(err, IsNil)
+	c.Assert(data, Equals, "foo")
+	c.Assert(srv.requests(), DeepEquals, []string{"", "bytes=1-"})
+	c.Assert(events, HasLen, 1)
+	c.Assert(events[0].Err, NotNil)
+
+	// without retries the error is returned
+	srv.ranges = nil
+	remote, err = HTTPRemoteStore(srv.URL, nil, nil)
+	c.Assert(err, IsNil)
+	_, err = readTarget(remote)
+	c.Assert(err, Equals, io.ErrUnexpectedEOF)
+}
+
+func (s *ClientSuite) TestHTTPRemoteStoreAttemptTimeout(c *C) {
+	srv := startRetryServer(func(w http.ResponseWriter, r *http.Request) bool {
+		<-r.Context().Done()
+		return true
+	})
+	defer srv.Close()
+
+	events := []HTTPRetryEvent{}
+	remote, err := HTTPRemoteStore(srv.URL, &HTTPRemoteOptions{
+		AttemptTimeout: 50 * time.Millisecond,
+		Retries: &HTTPRemoteRetries{
+			Delay:   time.Millisecond,
+			Total:   time.Minute,
+			OnRetry: func(e HTTPRetryEvent) { events = append(events, e) },
+		},
+	}, nil)
+	c.Assert(err, IsNil)
+	data, err := readTarget(remote)
+	c.Assert(err, IsNil)
+	c.Assert(data, Equals, "foo")
+	c.Assert(events, HasLen, 1)
+	c.Assert(events[0].Err, ErrorMatches, fmt.Sprintf(`GET "%s/targets/foo.txt": no response within 50ms`, srv.URL))
+}
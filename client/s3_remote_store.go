@@ -0,0 +1,111 @@
+package client
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/theupdateframework/go-tuf/internal/s3"
+)
+
+// S3RemoteOptions configures an S3RemoteStore.
+type S3RemoteOptions struct {
+	// Endpoint is the base URL of the S3 API, e.g. https://s3.amazonaws.com
+	// or http://localhost:9000 for a local MinIO. Buckets are addressed with
+	// path-style URLs.
+	Endpoint string
+
+	// Region is the region of the bucket, which defaults to us-east-1.
+	Region string
+
+	Bucket string
+
+	// AccessKeyID, SecretAccessKey and SessionToken are the credentials
+	// requests are signed with. Requests are sent unsigned if they are
+	// empty, which is enough for a public bucket.
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+
+	// MetadataPath and TargetsPath are the key prefixes of the metadata and
+	// target files, like the paths of HTTPRemoteOptions. MetadataPath is the
+	// root of the bucket by default, and TargetsPath is "targets".
+	MetadataPath string
+	TargetsPath  string
+}
+
+// S3RemoteStore returns a RemoteStore that downloads the repository from a
+// bucket of an S3-compatible API, such as AWS S3, MinIO or Google Cloud
+// Storage's XML API, signing its requests so that private buckets can be
+// read without an HTTP frontend.
+//
+// Objects that do not exist are reported as ErrNotFound. Note that S3 reports
+// missing objects as access denied to credentials that are not allowed to
+// list the bucket, so these should be allowed s3:ListBucket as well as
+// s3:GetObject.
+func S3RemoteStore(opts *S3RemoteOptions, client *http.Client) (RemoteStore, error) {
+	if opts == nil {
+		opts = &S3RemoteOptions{}
+	}
+	s3Client, err := s3.New(s3.Config{
+		Endpoint:        opts.Endpoint,
+		Region:          opts.Region,
+		Bucket:          opts.Bucket,
+		AccessKeyID:     opts.AccessKeyID,
+		SecretAccessKey: opts.SecretAccessKey,
+		SessionToken:    opts.SessionToken,
+		HTTPClient:      client,
+	})
+	if err != nil {
+		return nil, err
+	}
+	targetsPath := opts.TargetsPath
+	if targetsPath == "" {
+		targetsPath = "targets"
+	}
+	return &s3RemoteStore{
+		cli:          s3Client,
+		metadataPath: opts.MetadataPath,
+		targetsPath:  targetsPath,
+	}, nil
+}
+
+type s3RemoteStore struct {
+	cli          *s3.Client
+	metadataPath string
+	targetsPath  string
+}
+
+func (s *s3RemoteStore) GetMeta(name string) (io.ReadCloser, int64, error) {
+	return s.GetMetaContext(context.Background(), name)
+}
+
+func (s *s3RemoteStore) GetTarget(name string) (io.ReadCloser, int64, error) {
+	return s.GetTargetContext(context.Background(), name)
+}
+
+func (s *s3RemoteStore) GetMetaContext(ctx context.Context, name string) (io.ReadCloser, int64, error) {
+	return s.get(ctx, path.Join(s.metadataPath, name), 0)
+}
+
+func (s *s3RemoteStore) GetTargetContext(ctx context.Context, name string) (io.ReadCloser, int64, error) {
+	return s.get(ctx, path.Join(s.targetsPath, name), 0)
+}
+
+func (s *s3RemoteStore) GetTargetRange(ctx context.Context, name string, offset int64) (io.ReadCloser, int64, error) {
+	return s.get(ctx, path.Join(s.targetsPath, name), offset)
+}
+
+func (s *s3RemoteStore) get(ctx context.Context, key string, offset int64) (io.ReadCloser, int64, error) {
+	key = strings.TrimPrefix(key, "/")
+	body, size, err := s.cli.GetRange(ctx, key, offset)
+	if err != nil {
+		if s3.IsNotFound(err) {
+			return nil, 0, ErrNotFound{key}
+		}
+		return nil, 0, err
+	}
+	return body, size, nil
+}
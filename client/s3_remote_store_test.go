@@ -0,0 +1,83 @@
+package client
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+
+	"github.com/theupdateframework/go-tuf/internal/s3/s3test"
+	. "gopkg.in/check.v1"
+)
+
+func (s *ClientSuite) TestS3RemoteStore(c *C) {
+	srv := s3test.NewServer("tuf")
+	defer srv.Close()
+	srv.AccessKeyID = "key"
+	srv.Private = true
+
+	// upload a repository to the bucket
+	tmp := c.MkDir()
+	repo := generateRepoFS(c, tmp, targetFiles, true)
+	repoDir := filepath.Join(tmp, "repository")
+	c.Assert(filepath.Walk(repoDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(repoDir, path)
+		if err != nil {
+			return err
+		}
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		srv.PutObject("repo/"+filepath.ToSlash(rel), b)
+		return nil
+	}), IsNil)
+
+	opts := &S3RemoteOptions{
+		Endpoint:        srv.URL,
+		Bucket:          "tuf",
+		AccessKeyID:     "key",
+		SecretAccessKey: "secret",
+		MetadataPath:    "repo",
+		TargetsPath:     "repo/targets",
+	}
+	remote, err := S3RemoteStore(opts, nil)
+	c.Assert(err, IsNil)
+	client := NewClient(MemoryLocalStore(), remote)
+	rootMeta, err := repo.SignedMeta("root.json")
+	c.Assert(err, IsNil)
+	rootJSON, err := json.Marshal(rootMeta)
+	c.Assert(err, IsNil)
+	c.Assert(client.Init(rootJSON), IsNil)
+	files, err := client.Update()
+	c.Assert(err, IsNil)
+	c.Assert(files, HasLen, len(targetFiles))
+
+	dest := &resumableTestDestination{}
+	dest.WriteString("b")
+	c.Assert(client.Download("bar.txt", dest), IsNil)
+	c.Assert(dest.String(), Equals, "bar")
+
+	// missing objects are reported as ErrNotFound
+	_, _, err = remote.GetMeta("2.root.json")
+	c.Assert(err, DeepEquals, ErrNotFound{"repo/2.root.json"})
+	_, _, err = remote.GetTarget("/missing.txt")
+	c.Assert(err, DeepEquals, ErrNotFound{"repo/targets/missing.txt"})
+
+	// but a missing bucket or missing credentials are not
+	opts.Bucket = "other"
+	remote, err = S3RemoteStore(opts, nil)
+	c.Assert(err, IsNil)
+	_, _, err = remote.GetMeta("root.json")
+	c.Assert(err, ErrorMatches, "s3: NoSuchBucket: .*")
+	c.Assert(IsNotFound(err), Equals, false)
+	remote, err = S3RemoteStore(&S3RemoteOptions{Endpoint: srv.URL, Bucket: "tuf"}, nil)
+	c.Assert(err, IsNil)
+	_, _, err = remote.GetMeta("repo/root.json")
+	c.Assert(err, ErrorMatches, "s3: AccessDenied: .*")
+
+	_, err = S3RemoteStore(&S3RemoteOptions{Endpoint: "localhost:9000", Bucket: "tuf"}, nil)
+	c.Assert(err, NotNil)
+}
@@ -0,0 +1,175 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/theupdateframework/go-tuf/data"
+	"github.com/theupdateframework/go-tuf/util"
+)
+
+// targetCacheAlgorithms are the hash algorithms cached target files may be
+// keyed by, in order of preference.
+var targetCacheAlgorithms = []string{"sha512", "sha256"}
+
+// targetCachePath returns the path a target file with the given hashes is
+// cached at, or "" if the cache is disabled or none of the hashes can be
+// used as a key.
+func (c *Client) targetCachePath(hashes data.Hashes) string {
+	if c.TargetCacheDir == "" {
+		return ""
+	}
+	for _, alg := range targetCacheAlgorithms {
+		if h, ok := hashes[alg]; ok {
+			return filepath.Join(c.TargetCacheDir, alg, h.String())
+		}
+	}
+	return ""
+}
+
+// cachedTarget returns the path of the cached copy of the target file
+// described by meta, or "" if there is no valid copy. A copy that does not
+// match meta is evicted.
+func (c *Client) cachedTarget(meta data.TargetFileMeta) string {
+	path := c.targetCachePath(meta.Hashes)
+	if path == "" {
+		return ""
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return ""
+	}
+	actual, err := util.GenerateTargetFileMeta(f, meta.HashAlgorithms()...)
+	f.Close()
+	if err != nil || util.TargetFileMetaEqual(actual, meta) != nil {
+		os.Remove(path)
+		return ""
+	}
+	return path
+}
+
+// newTargetCacheFile creates a temporary file to add the target file
+// described by meta to the cache, or returns nil if it cannot be cached.
+// Errors are ignored, as the cache is only an optimisation.
+func (c *Client) newTargetCacheFile(meta data.TargetFileMeta) *os.File {
+	path := c.targetCachePath(meta.Hashes)
+	if path == "" {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil
+	}
+	f, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path))
+	if err != nil {
+		return nil
+	}
+	return f
+}
+
+// closeTargetCacheFile closes a file created by newTargetCacheFile, moving
+// it into the cache if commit is true and removing it otherwise.
+func (c *Client) closeTargetCacheFile(f *os.File, meta data.TargetFileMeta, commit bool) {
+	if err := f.Close(); err != nil {
+		commit = false
+	}
+	if commit && os.Rename(f.Name(), c.targetCachePath(meta.Hashes)) == nil {
+		return
+	}
+	os.Remove(f.Name())
+}
+
+// PruneTargetCache removes the files in TargetCacheDir that are not listed
+// in any trusted targets metadata. The files of a delegated role are kept
+// as long as the trusted snapshot still lists the role, using the last
+// metadata fetched for it, so roles that have not been fetched since the
+// last update do not lose their cached files.
+//
+// It is called by Update when TargetCacheDir is set, which ignores its
+// errors.
+func (c *Client) PruneTargetCache() error {
+	if c.TargetCacheDir == "" {
+		return nil
+	}
+	if err := c.getLocalMeta(); err != nil {
+		return err
+	}
+
+	keep := make(map[string]struct{})
+	for _, meta := range c.targets {
+		keep[c.targetCachePath(meta.Hashes)] = struct{}{}
+	}
+	delegated, err := c.localDelegatedTargets()
+	if err != nil {
+		return err
+	}
+	for _, targets := range delegated {
+		for _, meta := range targets {
+			keep[c.targetCachePath(meta.Hashes)] = struct{}{}
+		}
+	}
+
+	for _, alg := range targetCacheAlgorithms {
+		dir := filepath.Join(c.TargetCacheDir, alg)
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+			return err
+		}
+		for _, e := range entries {
+			// skip files still being added to the cache
+			if strings.HasPrefix(e.Name(), ".") {
+				continue
+			}
+			path := filepath.Join(dir, e.Name())
+			if _, ok := keep[path]; ok {
+				continue
+			}
+			if err := os.RemoveAll(path); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// localDelegatedTargets returns the targets of the delegated targets
+// metadata in local storage whose role is listed in the trusted snapshot,
+// whether or not the metadata is the version the snapshot lists.
+func (c *Client) localDelegatedTargets() (map[string]data.TargetFiles, error) {
+	snapshot, err := c.loadLocalSnapshot()
+	if err != nil {
+		if err == ErrNoLocalSnapshot {
+			return nil, nil
+		}
+		return nil, err
+	}
+	meta, err := c.local.GetMeta()
+	if err != nil {
+		return nil, err
+	}
+
+	delegated := make(map[string]data.TargetFiles)
+	for name := range snapshot.Meta {
+		raw, ok := meta[name]
+		if name == "targets.json" || !ok {
+			continue
+		}
+		s := &data.Signed{}
+		if err := json.Unmarshal(raw, s); err != nil {
+			continue
+		}
+		targets := &data.Targets{}
+		if err := json.Unmarshal(s.Signed, targets); err != nil {
+			continue
+		}
+		delegated[name] = targets.Targets
+	}
+	return delegated, nil
+}
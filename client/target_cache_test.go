@@ -0,0 +1,153 @@
+package client
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/theupdateframework/go-tuf/data"
+	. "gopkg.in/check.v1"
+)
+
+func (s *ClientSuite) cachedTargetPath(c *C, client *Client, name string) string {
+	meta, err := client.Target(name)
+	c.Assert(err, IsNil)
+	return filepath.Join(client.TargetCacheDir, "sha512", meta.Hashes["sha512"].String())
+}
+
+func (s *ClientSuite) TestTargetCache(c *C) {
+	client := s.updatedClient(c)
+	client.TargetCacheDir = c.MkDir()
+	cached := s.cachedTargetPath(c, client, "foo.txt")
+
+	// downloading fills the cache
+	var dest testDestination
+	c.Assert(client.Download("foo.txt", &dest), IsNil)
+	c.Assert(dest.String(), Equals, "foo")
+	b, err := os.ReadFile(cached)
+	c.Assert(err, IsNil)
+	c.Assert(string(b), Equals, "foo")
+
+	// a cached target is not downloaded again
+	remoteFile := s.remote.targets["foo.txt"]
+	delete(s.remote.targets, "foo.txt")
+	dest = testDestination{}
+	c.Assert(client.Download("foo.txt", &dest), IsNil)
+	c.Assert(dest.String(), Equals, "foo")
+
+	// a corrupt cached target is evicted and downloaded again
+	c.Assert(os.WriteFile(cached, []byte("bad"), 0644), IsNil)
+	dest = testDestination{}
+	c.Assert(client.Download("foo.txt", &dest), Equals, ErrNotFound{"foo.txt"})
+	c.Assert(dest.deleted, Equals, true)
+	_, err = os.Stat(cached)
+	c.Assert(os.IsNotExist(err), Equals, true)
+
+	s.remote.targets["foo.txt"] = remoteFile
+	dest = testDestination{}
+	c.Assert(client.Download("foo.txt", &dest), IsNil)
+	c.Assert(dest.String(), Equals, "foo")
+	b, err = os.ReadFile(cached)
+	c.Assert(err, IsNil)
+	c.Assert(string(b), Equals, "foo")
+
+	// a download that fails verification is not cached
+	c.Assert(os.Remove(cached), IsNil)
+	remoteFile.buf.Reset([]byte("bad"))
+	dest = testDestination{}
+	assertWrongHash(c, client.Download("foo.txt", &dest))
+	_, err = os.Stat(cached)
+	c.Assert(os.IsNotExist(err), Equals, true)
+}
+
+func (s *ClientSuite) TestTargetCachePrune(c *C) {
+	client := s.updatedClient(c)
+	client.TargetCacheDir = c.MkDir()
+	var dest testDestination
+	c.Assert(client.Download("foo.txt", &dest), IsNil)
+	foo := s.cachedTargetPath(c, client, "foo.txt")
+
+	unknown := filepath.Join(client.TargetCacheDir, "sha512", "unknown")
+	c.Assert(os.WriteFile(unknown, []byte("unknown"), 0644), IsNil)
+	partial := filepath.Join(client.TargetCacheDir, "sha512", ".partial")
+	c.Assert(os.WriteFile(partial, []byte("partial"), 0644), IsNil)
+
+	// updating keeps trusted targets and removes unknown files
+	_, err := client.Update()
+	c.Assert(err, IsNil)
+	for path, exists := range map[string]bool{foo: true, unknown: false, partial: true} {
+		_, err := os.Stat(path)
+		c.Assert(err == nil, Equals, exists, Commentf("path: %s", path))
+	}
+
+	// removed targets are evicted
+	c.Assert(s.repo.RemoveTarget("foo.txt"), IsNil)
+	s.addRemoteTarget(c, "bar.txt")
+	_, err = client.Update()
+	c.Assert(err, IsNil)
+	_, err = os.Stat(foo)
+	c.Assert(os.IsNotExist(err), Equals, true)
+}
+
+func (s *ClientSuite) TestTargetCachePruneDelegatedRole(c *C) {
+	key, err := s.repo.GenDelegatedKey(data.KeyTypeEd25519, []string{"role1"})
+	c.Assert(err, IsNil)
+	role := data.DelegatedRole{
+		Name:      "role1",
+		KeyIDs:    key.IDs(),
+		Paths:     []string{"bar.txt", "baz.txt"},
+		Threshold: 1,
+	}
+	c.Assert(s.repo.AddDelegatedRole("targets", role, []*data.PublicKey{key}), IsNil)
+	c.Assert(s.repo.AddTargetToPreferredRole("bar.txt", nil, "role1"), IsNil)
+	c.Assert(s.repo.Snapshot(), IsNil)
+	c.Assert(s.repo.Timestamp(), IsNil)
+	c.Assert(s.repo.Commit(), IsNil)
+	s.syncRemote(c)
+
+	client := s.updatedClient(c)
+	client.TargetCacheDir = c.MkDir()
+	var dest testDestination
+	c.Assert(client.Download("bar.txt", &dest), IsNil)
+	bar := s.cachedTargetPath(c, client, "bar.txt")
+
+	// a delegated role whose new metadata has not been fetched keeps its
+	// cached targets
+	c.Assert(s.repo.AddTargetToPreferredRole("baz.txt", nil, "role1"), IsNil)
+	c.Assert(s.repo.Snapshot(), IsNil)
+	c.Assert(s.repo.Timestamp(), IsNil)
+	c.Assert(s.repo.Commit(), IsNil)
+	s.syncRemote(c)
+	_, err = client.Update()
+	c.Assert(err, IsNil)
+	_, err = os.Stat(bar)
+	c.Assert(err, IsNil)
+
+	// targets removed from a delegated role are evicted once its metadata
+	// has been fetched
+	c.Assert(s.repo.RemoveTarget("bar.txt"), IsNil)
+	c.Assert(s.repo.Snapshot(), IsNil)
+	c.Assert(s.repo.Timestamp(), IsNil)
+	c.Assert(s.repo.Commit(), IsNil)
+	s.syncRemote(c)
+	_, err = client.Update()
+	c.Assert(err, IsNil)
+	_, err = os.Stat(bar)
+	c.Assert(err, IsNil)
+	_, err = client.Target("baz.txt")
+	c.Assert(err, IsNil)
+	c.Assert(client.PruneTargetCache(), IsNil)
+	c.Assert(err, IsNil)
+	_, err = os.Stat(bar)
+	c.Assert(os.IsNotExist(err), Equals, true)
+}
+
+func (s *ClientSuite) TestTargetCachePruneError(c *C) {
+	client := s.updatedClient(c)
+	client.TargetCacheDir = c.MkDir()
+	c.Assert(os.WriteFile(filepath.Join(client.TargetCacheDir, "sha512"), nil, 0644), IsNil)
+
+	// failing to prune the cache does not fail the update
+	c.Assert(client.PruneTargetCache(), NotNil)
+	_, err := client.Update()
+	c.Assert(err, IsNil)
+}
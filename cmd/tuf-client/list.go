@@ -17,7 +17,7 @@ usage: tuf-client list [-s|--store=<path>] <url>
 Options:
   -s <path>    The path to the local file store [default: tuf.db]
 
-List available target files.
+List available target files, including those of delegated targets roles.
   `)
 }
 
@@ -25,15 +25,15 @@ func cmdList(args *docopt.Args, client *tuf.Client) error {
 	if _, err := client.Update(); err != nil {
 		return err
 	}
-	targets, err := client.Targets()
+	targets, err := client.AllTargets()
 	if err != nil {
 		return err
 	}
 	w := tabwriter.NewWriter(os.Stdout, 1, 2, 2, ' ', 0)
 	defer w.Flush()
-	fmt.Fprintln(w, "PATH\tSIZE")
-	for path, meta := range targets {
-		fmt.Fprintf(w, "%s\t%s\n", path, humanize.Bytes(uint64(meta.Length)))
+	fmt.Fprintln(w, "PATH\tSIZE\tROLE")
+	for path, target := range targets {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", path, humanize.Bytes(uint64(target.Meta.Length)), target.Role)
 	}
 	return nil
 }
@@ -9,16 +9,21 @@ import (
 
 func init() {
 	register("add", cmdAdd, `
-usage: tuf add [--expires=<days>] [--custom=<data>] [<path>...]
+usage: tuf add [--expires=<days>] [--custom=<data>] [--role=<role>] [<path>...]
 
 Add target file(s).
 
+Each target is added to the metadata of the role its path is delegated to.
+With --role, targets are added to the given role, which must be trusted for
+their paths by the delegations.
+
 Alternatively, passphrases can be set via environment variables in the
 form of TUF_{{ROLE}}_PASSPHRASE
 
 Options:
   --expires=<days>   Set the targets metadata file to expire <days> days from now.
   --custom=<data>    Set custom JSON data for the target(s).
+  --role=<role>      Add the target(s) to the given targets role.
 `)
 }
 
@@ -28,12 +33,13 @@ func cmdAdd(args *docopt.Args, repo *tuf.Repo) error {
 		custom = json.RawMessage(c)
 	}
 	paths := args.All["<path>"].([]string)
+	role := args.String["--role"]
 	if arg := args.String["--expires"]; arg != "" {
 		expires, err := parseExpires(arg)
 		if err != nil {
 			return err
 		}
-		return repo.AddTargetsWithExpires(paths, custom, expires)
+		return repo.AddTargetsWithExpiresToPreferredRole(paths, custom, expires, role)
 	}
-	return repo.AddTargets(paths, custom)
+	return repo.AddTargetsToPreferredRole(paths, custom, role)
 }
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/flynn/go-docopt"
+	"github.com/theupdateframework/go-tuf"
+	"github.com/theupdateframework/go-tuf/data"
+	"github.com/theupdateframework/go-tuf/pkg/keys"
+)
+
+func init() {
+	register("add-command-key", cmdAddCommandKey, `
+usage: tuf add-command-key [--expires=<days>] <role> <public_key_file> [--] <command>...
+
+Add a signing key for the given role that is held outside of the repository,
+for example in a KMS or an HSM.
+
+<public_key_file> contains the key's public data as JSON, in the same format
+as the keys in root.json. Whenever metadata for the role needs signing,
+<command> is run with the canonical payload on its standard input, and must
+write the raw signature to its standard output. The ID of the key being
+signed for is set in the TUF_SIGNER_KEYID environment variable.
+
+Only the public key and the command are written to the "keys" directory. The
+root metadata file will be staged with the addition of the key's ID to the
+role's list of key IDs.
+
+Options:
+  --expires=<days>   Set the root metadata file to expire <days> days from now.
+`)
+}
+
+func cmdAddCommandKey(args *docopt.Args, repo *tuf.Repo) error {
+	role := args.String["<role>"]
+	pubBytes, err := os.ReadFile(args.String["<public_key_file>"])
+	if err != nil {
+		return err
+	}
+	pub := &data.PublicKey{}
+	if err := json.Unmarshal(pubBytes, pub); err != nil {
+		return err
+	}
+	signer, err := keys.NewCommandSignerFromKey(pub, args.All["<command>"].([]string))
+	if err != nil {
+		return err
+	}
+
+	expires := data.DefaultExpires(role)
+	if arg := args.String["--expires"]; arg != "" {
+		expires, err = parseExpires(arg)
+		if err != nil {
+			return err
+		}
+	}
+	if err := repo.AddPrivateKeyWithExpires(role, signer, expires); err != nil {
+		return err
+	}
+	for _, id := range pub.IDs() {
+		fmt.Println("Added", role, "command key with ID", id)
+	}
+	return nil
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/flynn/go-docopt"
+	"github.com/theupdateframework/go-tuf"
+	"github.com/theupdateframework/go-tuf/data"
+)
+
+func init() {
+	register("delegate", cmdDelegate, `
+usage: tuf delegate [--expires=<days>] [--delegator=<role>] [--threshold=<n>] [--terminating] [--path=<pattern>...] [--path-hash-prefix=<prefix>...] [--public-key=<file>...] [--gen-key] [--type=<type>] <role>
+
+Delegate trust for some target paths from a targets role to a new role.
+
+The delegator's metadata file is staged with the delegation to <role>, and
+an empty metadata file is staged for <role>. The paths the role is trusted
+for are given either as path patterns or as path hash prefixes, not both.
+
+The keys of the delegated role are read from public key files, in the same
+format as the keys in root.json, or generated with --gen-key. A generated
+key is written to the "keys" directory so that the role's metadata can be
+signed by the repository.
+
+Alternatively, passphrases can be set via environment variables in the
+form of TUF_{{ROLE}}_PASSPHRASE
+
+Options:
+  --expires=<days>              Set the metadata files to expire <days> days from now.
+  --delegator=<role>            Set the role to delegate from [default: targets].
+  --threshold=<n>               Set the number of keys that must sign the role's
+                                metadata [default: 1].
+  --terminating                 Stop searching other delegations for the role's paths.
+  --path=<pattern>              Trust the role for target paths matching <pattern>.
+  --path-hash-prefix=<prefix>   Trust the role for target paths whose hash starts
+                                with <prefix>.
+  --public-key=<file>           Add the public key in <file> to the role.
+  --gen-key                     Generate a new key for the role.
+  --type=<type>                 Set the type of key to generate [default: ed25519].
+`)
+}
+
+func cmdDelegate(args *docopt.Args, repo *tuf.Repo) error {
+	role := args.String["<role>"]
+	threshold, err := parseThreshold(args.String["--threshold"])
+	if err != nil {
+		return err
+	}
+	paths := args.All["--path"].([]string)
+	pathHashPrefixes := args.All["--path-hash-prefix"].([]string)
+	if len(paths) == 0 && len(pathHashPrefixes) == 0 {
+		return errors.New("either --path or --path-hash-prefix must be set")
+	}
+
+	keys, err := delegationKeys(args, repo, []string{role})
+	if err != nil {
+		return err
+	}
+	keyIDs := []string{}
+	for _, key := range keys {
+		keyIDs = append(keyIDs, key.IDs()...)
+	}
+
+	delegatedRole := data.DelegatedRole{
+		Name:             role,
+		KeyIDs:           keyIDs,
+		Threshold:        threshold,
+		Terminating:      args.Bool["--terminating"],
+		Paths:            paths,
+		PathHashPrefixes: pathHashPrefixes,
+	}
+	delegator := args.String["--delegator"]
+	if arg := args.String["--expires"]; arg != "" {
+		expires, err := parseExpires(arg)
+		if err != nil {
+			return err
+		}
+		return repo.AddDelegatedRoleWithExpires(delegator, delegatedRole, keys, expires)
+	}
+	return repo.AddDelegatedRole(delegator, delegatedRole, keys)
+}
+
+// delegationKeys returns the public keys given with --public-key, plus a
+// new key saved for each of the delegatees if --gen-key is set.
+func delegationKeys(args *docopt.Args, repo *tuf.Repo, delegatees []string) ([]*data.PublicKey, error) {
+	keys := []*data.PublicKey{}
+	for _, file := range args.All["--public-key"].([]string) {
+		b, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		key := &data.PublicKey{}
+		if err := json.Unmarshal(b, key); err != nil {
+			return nil, fmt.Errorf("failed to parse public key %s: %s", file, err)
+		}
+		keys = append(keys, key)
+	}
+	if args.Bool["--gen-key"] {
+		key, err := repo.GenDelegatedKey(args.String["--type"], delegatees)
+		if err != nil {
+			return nil, err
+		}
+		for _, id := range key.IDs() {
+			fmt.Println("Generated delegated targets key with ID", id)
+		}
+		keys = append(keys, key)
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("either --public-key or --gen-key must be set")
+	}
+	return keys, nil
+}
+
+func parseThreshold(arg string) (int, error) {
+	threshold, err := strconv.Atoi(arg)
+	if err != nil || threshold < 1 {
+		return 0, fmt.Errorf("invalid --threshold arg: %s", arg)
+	}
+	return threshold, nil
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/flynn/go-docopt"
+	"github.com/theupdateframework/go-tuf"
+	"github.com/theupdateframework/go-tuf/pkg/targets"
+)
+
+func init() {
+	register("delegate-hash-bins", cmdDelegateHashBins, `
+usage: tuf delegate-hash-bins [--expires=<days>] [--delegator=<role>] [--threshold=<n>] [--succinct] [--public-key=<file>...] [--gen-key] [--type=<type>] <role_prefix> <bit_length>
+
+Delegate all target paths from a targets role to 2^<bit_length> hash bin roles.
+
+Each target path is trusted to the role whose path hash prefixes match the
+hash of the path. The roles are named <role_prefix> followed by the
+range of prefixes they cover, and all of them share the same keys.
+
+With --succinct, the delegator's metadata only lists a single succinct hash
+bin delegation (TAP 15) instead of one delegation for each bin, and the bins
+are named <role_prefix>, a dash and the bin number in hex. The metadata of
+every bin is staged, so <bit_length> can be at most 16.
+
+The keys are read from public key files, in the same format as the keys in
+root.json, or generated with --gen-key. A generated key is written to the
+"keys" directory once for <role_prefix>, which the bins' metadata is signed
+with by the repository.
+
+Alternatively, passphrases can be set via environment variables in the
+form of TUF_{{ROLE}}_PASSPHRASE
+
+Options:
+  --expires=<days>     Set the metadata files to expire <days> days from now.
+  --delegator=<role>   Set the role to delegate from [default: targets].
+  --threshold=<n>      Set the number of keys that must sign each bin's
+                       metadata [default: 1].
+  --succinct           Use a succinct hash bin delegation.
+  --public-key=<file>  Add the public key in <file> to the bins.
+  --gen-key            Generate a new key for the bins.
+  --type=<type>        Set the type of key to generate [default: ed25519].
+`)
+}
+
+func cmdDelegateHashBins(args *docopt.Args, repo *tuf.Repo) error {
+	threshold, err := parseThreshold(args.String["--threshold"])
+	if err != nil {
+		return err
+	}
+	bitLen, err := strconv.Atoi(args.String["<bit_length>"])
+	if err != nil {
+		return fmt.Errorf("failed to parse <bit_length> arg: %s", err)
+	}
+	newHashBins := targets.NewHashBins
+	if args.Bool["--succinct"] {
+		newHashBins = targets.NewSuccinctHashBins
+	}
+	bins, err := newHashBins(args.String["<role_prefix>"], bitLen)
+	if err != nil {
+		return err
+	}
+
+	// The bins share the key saved for the prefix of their names.
+	keys, err := delegationKeys(args, repo, []string{bins.RolePrefix()})
+	if err != nil {
+		return err
+	}
+
+	delegator := args.String["--delegator"]
+	if arg := args.String["--expires"]; arg != "" {
+		expires, err := parseExpires(arg)
+		if err != nil {
+			return err
+		}
+		return repo.AddDelegatedRolesForPathHashBinsWithExpires(delegator, bins, keys, threshold, expires)
+	}
+	return repo.AddDelegatedRolesForPathHashBins(delegator, bins, keys, threshold)
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/flynn/go-docopt"
+	"github.com/theupdateframework/go-tuf"
+)
+
+func init() {
+	register("diff", cmdDiff, `
+usage: tuf diff [--json] [<role>...]
+
+Show how the staged metadata differs from the metadata in the repository.
+
+Lists added, removed and modified targets, key and threshold changes in root,
+the consistent snapshot setting, delegation changes including their keys and
+order, and version and expiry changes. Only roles with staged
+metadata are shown unless roles are given.
+
+Options:
+  --json  Output the changes as JSON.
+`)
+}
+
+func cmdDiff(args *docopt.Args, repo *tuf.Repo) error {
+	diffs, err := repo.Diff(args.All["<role>"].([]string)...)
+	if err != nil {
+		return err
+	}
+
+	if args.Bool["--json"] {
+		out, err := json.MarshalIndent(diffs, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(out))
+		return nil
+	}
+
+	if len(diffs) == 0 {
+		fmt.Println("No staged metadata")
+		return nil
+	}
+	for _, d := range diffs {
+		fmt.Print(d)
+	}
+	return nil
+}
@@ -2,15 +2,15 @@ package main
 
 import (
 	"fmt"
-	"time"
 
 	"github.com/flynn/go-docopt"
 	"github.com/theupdateframework/go-tuf"
+	"github.com/theupdateframework/go-tuf/data"
 )
 
 func init() {
 	register("gen-key", cmdGenKey, `
-usage: tuf gen-key [--expires=<days>] <role>
+usage: tuf gen-key [--expires=<days>] [--type=<type>] <role>
 
 Generate a new signing key for the given role.
 
@@ -23,23 +23,27 @@ form of TUF_{{ROLE}}_PASSPHRASE
 
 Options:
   --expires=<days>   Set the root metadata file to expire <days> days from now.
+  --type=<type>      Set the type of key to generate [default: ed25519].
+                     Supported types: ed25519, ecdsa-sha2-nistp256,
+                     ecdsa-sha2-nistp384, ecdsa-sha2-nistp521.
 `)
 }
 
 func cmdGenKey(args *docopt.Args, repo *tuf.Repo) error {
 	role := args.String["<role>"]
-	var keyids []string
-	var err error
+	keyType := args.String["--type"]
+	if keyType == "" {
+		keyType = data.KeyTypeEd25519
+	}
+	expires := data.DefaultExpires(role)
 	if arg := args.String["--expires"]; arg != "" {
-		var expires time.Time
+		var err error
 		expires, err = parseExpires(arg)
 		if err != nil {
 			return err
 		}
-		keyids, err = repo.GenKeyWithExpires(role, expires)
-	} else {
-		keyids, err = repo.GenKey(role)
 	}
+	keyids, err := repo.GenKeyWithTypeAndExpires(role, keyType, expires)
 	if err != nil {
 		return err
 	}
@@ -13,6 +13,7 @@ import (
 
 	docopt "github.com/flynn/go-docopt"
 	tuf "github.com/theupdateframework/go-tuf"
+	_ "github.com/theupdateframework/go-tuf/pkg/keys/pkcs11" // load keys held in PKCS#11 tokens
 	"github.com/theupdateframework/go-tuf/util"
 	"golang.org/x/term"
 )
@@ -31,18 +32,27 @@ Commands:
   help               Show usage for a specific command
   init               Initialize a new repository
   gen-key            Generate a new signing key for a specific metadata file
+  add-command-key    Add a signing key held by an external signing command
   revoke-key         Revoke a signing key
   add                Add target file(s)
   remove             Remove a target file
+  delegate           Delegate target paths to a new targets role
+  delegate-hash-bins Delegate target paths to hash bin targets roles
+  reset-delegations  Remove all delegations from a targets role
   snapshot           Update the snapshot metadata file
   timestamp          Update the timestamp metadata file
+  serve-online-roles Keep re-signing the snapshot and timestamp metadata files
   payload            Output a role's metadata file for signing
   add-signatures     Adds signatures generated offline
   sign               Sign a role's metadata file
   sign-payload       Sign a file from the "payload" command.
+  root-ceremony      Collect root metadata signatures from offline key holders
   status             Check if a role's metadata has expired
+  serve              Serve the repository over HTTP
+  diff               Show the changes staged to the metadata files
+  verify             Check the integrity of the committed repository
   commit             Commit staged files to the repository
-  regenerate         Recreate the targets metadata file [Not supported yet]
+  regenerate         Recreate the targets metadata files
   set-threshold      Sets the threshold for a role
   get-threshold      Outputs the threshold for a role
   change-passphrase  Changes the passphrase for given role keys file
@@ -92,6 +102,23 @@ type command struct {
 
 var commands = make(map[string]*command)
 
+// repoDir is the directory of the repository, for commands that access its
+// files directly rather than through a tuf.Repo.
+var repoDir string
+
+// unlockedCommands do not change the repository, or lock it themselves, so
+// they run without holding its lock.
+var unlockedCommands = map[string]bool{
+	"diff":               true,
+	"get-threshold":      true,
+	"payload":            true,
+	"root-keys":          true,
+	"serve":              true,
+	"serve-online-roles": true,
+	"status":             true,
+	"verify":             true,
+}
+
 func register(name string, f cmdFunc, usage string) {
 	commands[name] = &command{usage: usage, f: f}
 }
@@ -111,11 +138,23 @@ func runCommand(name string, args []string, dir string, insecure bool) error {
 		return err
 	}
 
+	repoDir = dir
+
 	var p util.PassphraseFunc
 	if !insecure {
 		p = getPassphrase
 	}
-	repo, err := tuf.NewRepo(tuf.FileSystemStore(dir, p))
+	store := tuf.FileSystemStore(dir, p)
+	if !unlockedCommands[name] {
+		// Keep other tuf commands, and serve-online-roles, from changing
+		// the repository at the same time.
+		unlock, err := store.(tuf.RepoLocker).Lock()
+		if err != nil {
+			return err
+		}
+		defer unlock()
+	}
+	repo, err := tuf.NewRepo(store)
 	if err != nil {
 		return err
 	}
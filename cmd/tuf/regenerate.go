@@ -1,25 +1,39 @@
 package main
 
 import (
-	"log"
-
 	"github.com/flynn/go-docopt"
 	"github.com/theupdateframework/go-tuf"
 )
 
 func init() {
 	register("regenerate", cmdRegenerate, `
-usage: tuf regenerate [--consistent-snapshot=false]
+usage: tuf regenerate [--expires=<days>]
+
+Recreate the targets metadata files from the target files committed in
+repository/targets.
 
-Recreate the targets metadata file. Important: Not supported yet
+Each file is assigned to the targets role its path is delegated to, and the
+targets of every targets role are replaced with the files found for it. If
+the repository uses consistent snapshots, the hash prefix is stripped from the
+committed file names, and where older versions of a target are still present,
+the one listed in the current targets metadata is kept. The regenerated
+metadata is staged.
 
 Alternatively, passphrases can be set via environment variables in the
 form of TUF_{{ROLE}}_PASSPHRASE
+
+Options:
+  --expires=<days>   Set the targets metadata files to expire <days> days from now.
 `)
 }
 
 func cmdRegenerate(args *docopt.Args, repo *tuf.Repo) error {
-	// TODO: implement this
-	log.Println("Not supported yet")
-	return nil
+	if arg := args.String["--expires"]; arg != "" {
+		expires, err := parseExpires(arg)
+		if err != nil {
+			return err
+		}
+		return repo.RegenerateWithExpires(expires)
+	}
+	return repo.Regenerate()
 }
@@ -9,15 +9,19 @@ import (
 
 func init() {
 	register("remove", cmdRemove, `
-usage: tuf remove [--expires=<days>] [--all] [<path>...]
+usage: tuf remove [--expires=<days>] [--all] [--role=<role>] [<path>...]
 
 Remove target file(s).
 
+Targets are removed from every targets role listing them, or with --role,
+from the given role only.
+
 Alternatively, passphrases can be set via environment variables in the
 form of TUF_{{ROLE}}_PASSPHRASE
 
 Options:
   --all              Remove all target files.
+  --role=<role>      Only remove the target(s) from the given targets role.
   --expires=<days>   Set the targets metadata file to expire <days> days from now.
 `)
 }
@@ -27,12 +31,19 @@ func cmdRemove(args *docopt.Args, repo *tuf.Repo) error {
 	if len(paths) == 0 && !args.Bool["--all"] {
 		return errors.New("either specify some paths or set the --all flag to remove all targets")
 	}
+	role := args.String["--role"]
 	if arg := args.String["--expires"]; arg != "" {
 		expires, err := parseExpires(arg)
 		if err != nil {
 			return err
 		}
+		if role != "" {
+			return repo.RemoveTargetsFromRoleWithExpires(role, paths, expires)
+		}
 		return repo.RemoveTargetsWithExpires(paths, expires)
 	}
+	if role != "" {
+		return repo.RemoveTargetsFromRole(role, paths)
+	}
 	return repo.RemoveTargets(paths)
 }
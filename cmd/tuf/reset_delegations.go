@@ -0,0 +1,39 @@
+package main
+
+import (
+	"github.com/flynn/go-docopt"
+	"github.com/theupdateframework/go-tuf"
+)
+
+func init() {
+	register("reset-delegations", cmdResetDelegations, `
+usage: tuf reset-delegations [--expires=<days>] [<delegator>]
+
+Remove all delegations from a targets role (defaults to "targets").
+
+The metadata files of the roles that are left without a delegator are no
+longer listed by the snapshot, and are removed from the repository by the
+next commit.
+
+Alternatively, passphrases can be set via environment variables in the
+form of TUF_{{ROLE}}_PASSPHRASE
+
+Options:
+  --expires=<days>   Set the delegator's metadata file to expire <days> days from now.
+`)
+}
+
+func cmdResetDelegations(args *docopt.Args, repo *tuf.Repo) error {
+	delegator := args.String["<delegator>"]
+	if delegator == "" {
+		delegator = "targets"
+	}
+	if arg := args.String["--expires"]; arg != "" {
+		expires, err := parseExpires(arg)
+		if err != nil {
+			return err
+		}
+		return repo.ResetTargetsDelegationsWithExpires(delegator, expires)
+	}
+	return repo.ResetTargetsDelegations(delegator)
+}
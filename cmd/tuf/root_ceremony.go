@@ -0,0 +1,154 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/flynn/go-docopt"
+	"github.com/theupdateframework/go-tuf"
+)
+
+func init() {
+	register("root-ceremony", cmdRootCeremony, `
+usage:
+  tuf root-ceremony propose <bundle>
+  tuf root-ceremony sign <bundle>
+  tuf root-ceremony merge <merged> <bundle>...
+  tuf root-ceremony status <bundle>
+  tuf root-ceremony apply <bundle>
+
+Collect signatures for root metadata from root key holders who sign offline.
+
+  propose  Write the staged root metadata to a new bundle file, and print how
+           it differs from the previous root.
+  sign     Sign the bundle with the root keys in this repository, and print
+           how it differs from the root committed to this repository, which
+           it must be the next version of. Each key holder runs this on their
+           own copy of the bundle, in a repository with the current root.
+  merge    Combine the signatures of copies of the same bundle into <merged>,
+           checking them against the committed root like sign.
+  status   Print which keys of the new and the previous root have signed.
+  apply    Add the bundle's signatures to the staged root metadata, which must
+           be the metadata it proposes.
+
+The new root metadata must be signed by a threshold of its own root keys, and
+by a threshold of the root keys of the previous root so that clients can
+update to it.
+`)
+}
+
+func cmdRootCeremony(args *docopt.Args, repo *tuf.Repo) error {
+	switch {
+	case args.Bool["propose"]:
+		b, err := repo.RootSigningBundle()
+		if err != nil {
+			return err
+		}
+		if err := writeRootSigningBundle(args.All["<bundle>"].([]string)[0], b); err != nil {
+			return err
+		}
+		for _, change := range b.Changes {
+			fmt.Println(change)
+		}
+		return printRootSigningStatus(b)
+	case args.Bool["sign"]:
+		path := args.All["<bundle>"].([]string)[0]
+		b, err := readRootSigningBundle(path)
+		if err != nil {
+			return err
+		}
+		numKeys, err := repo.SignRootSigningBundle(b)
+		if err != nil {
+			return err
+		}
+		if err := writeRootSigningBundle(path, b); err != nil {
+			return err
+		}
+		for _, change := range b.Changes {
+			fmt.Println(change)
+		}
+		fmt.Fprintln(os.Stderr, "tuf: signed with", numKeys, "key(s)")
+		return nil
+	case args.Bool["merge"]:
+		paths := args.All["<bundle>"].([]string)
+		bundles := make([]*tuf.RootSigningBundle, 0, len(paths))
+		for _, path := range paths {
+			b, err := readRootSigningBundle(path)
+			if err != nil {
+				return err
+			}
+			bundles = append(bundles, b)
+		}
+		merged, err := repo.MergeRootSigningBundles(bundles...)
+		if err != nil {
+			return err
+		}
+		if err := writeRootSigningBundle(args.String["<merged>"], merged); err != nil {
+			return err
+		}
+		return printRootSigningStatus(merged)
+	case args.Bool["status"]:
+		b, err := readRootSigningBundle(args.All["<bundle>"].([]string)[0])
+		if err != nil {
+			return err
+		}
+		return printRootSigningStatus(b)
+	default:
+		b, err := readRootSigningBundle(args.All["<bundle>"].([]string)[0])
+		if err != nil {
+			return err
+		}
+		if err := repo.AddRootSigningBundle(b); err != nil {
+			return err
+		}
+		return printRootSigningStatus(b)
+	}
+}
+
+func readRootSigningBundle(path string) (*tuf.RootSigningBundle, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	b := &tuf.RootSigningBundle{}
+	if err := json.Unmarshal(raw, b); err != nil {
+		return nil, fmt.Errorf("failed to parse root signing bundle %s: %s", path, err)
+	}
+	return b, nil
+}
+
+func writeRootSigningBundle(path string, b *tuf.RootSigningBundle) error {
+	raw, err := json.MarshalIndent(b, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(raw, '\n'), 0644)
+}
+
+func printRootSigningStatus(b *tuf.RootSigningBundle) error {
+	status, err := b.Status()
+	if err != nil {
+		return err
+	}
+	printRootKeysStatus("new root", status.Root)
+	if status.PreviousRoot != nil {
+		printRootKeysStatus("previous root", status.PreviousRoot)
+	}
+	if status.Complete() {
+		fmt.Println("The root metadata is fully signed")
+	} else {
+		fmt.Println("The root metadata needs more signatures")
+	}
+	return nil
+}
+
+func printRootKeysStatus(name string, s *tuf.RootKeysStatus) {
+	fmt.Printf("%s: %d of %d required signatures\n", name, s.Signatures, s.Threshold)
+	for _, id := range s.Signed {
+		fmt.Println("  signed: ", id)
+	}
+	for _, id := range s.Missing {
+		fmt.Println("  missing:", id)
+	}
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/flynn/go-docopt"
+	"github.com/theupdateframework/go-tuf"
+	"github.com/theupdateframework/go-tuf/pkg/server"
+)
+
+func init() {
+	register("serve", cmdServe, `
+usage: tuf serve [--addr=<addr>] [--metadata-path=<path>] [--targets-path=<path>]
+
+Serve the committed repository over HTTP.
+
+Metadata files are served under the metadata path, and target files under the
+targets path, matching the layout tuf-client and client.HTTPRemoteStore expect
+by default. Staged files and keys are not served.
+
+Example:
+  tuf serve --addr localhost:8080 &
+  tuf-client init http://localhost:8080 < root.json
+
+Options:
+  --addr=<addr>           The address to listen on [default: localhost:8080].
+  --metadata-path=<path>  The URL path to serve metadata files under [default: /].
+  --targets-path=<path>   The URL path to serve target files under [default: targets].
+`)
+}
+
+func cmdServe(args *docopt.Args, repo *tuf.Repo) error {
+	handler := server.NewHandler(filepath.Join(repoDir, "repository"), &server.Options{
+		MetadataPath: args.String["--metadata-path"],
+		TargetsPath:  args.String["--targets-path"],
+	})
+	addr := args.String["--addr"]
+	fmt.Fprintln(os.Stderr, "tuf: serving the repository on", addr)
+	return http.ListenAndServe(addr, handler)
+}
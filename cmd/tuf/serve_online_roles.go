@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/flynn/go-docopt"
+	"github.com/theupdateframework/go-tuf"
+)
+
+func init() {
+	register("serve-online-roles", cmdServeOnlineRoles, `
+usage: tuf serve-online-roles [--interval=<duration>] [--refresh-before=<duration>] [--snapshot-expires=<days>] [--timestamp-expires=<days>] [--once]
+
+Keep the snapshot and timestamp metadata from expiring.
+
+Runs until interrupted, checking the committed metadata every interval. The
+timestamp metadata is re-signed when it expires within the refresh duration,
+and so is the snapshot metadata, which causes the timestamp metadata to be
+re-signed too. The re-signed metadata is committed straight away. Nothing is
+re-signed while other metadata is staged, and a failed refresh is reported and
+removes what it staged, leaving the repository as it was. Each refresh locks
+the repository, and is skipped while another tuf command is changing it.
+
+The snapshot and timestamp keys must be in the keys directory. Passphrases for
+encrypted keys are read from TUF_SNAPSHOT_PASSPHRASE and
+TUF_TIMESTAMP_PASSPHRASE.
+
+Options:
+  --interval=<duration>        How often to check, e.g. 30s or 5m [default: 1m].
+  --refresh-before=<duration>  How long before they expire to re-sign roles, e.g.
+                               6h. Defaults to half the timestamp expiry, and
+                               must be shorter than both expiries.
+  --snapshot-expires=<days>    Days re-signed snapshot metadata is valid for
+                               [default: 7].
+  --timestamp-expires=<days>   Days re-signed timestamp metadata is valid for
+                               [default: 1].
+  --once                       Refresh once and exit, for use from cron. The
+                               exit status will be 1 if the refresh failed.
+`)
+}
+
+func cmdServeOnlineRoles(args *docopt.Args, repo *tuf.Repo) error {
+	opts := &tuf.OnlineRolesSignerOptions{}
+
+	var err error
+	if opts.Interval, err = time.ParseDuration(args.String["--interval"]); err != nil {
+		return fmt.Errorf("failed to parse --interval arg: %s", err)
+	}
+	if arg := args.String["--refresh-before"]; arg != "" {
+		if opts.RefreshBefore, err = time.ParseDuration(arg); err != nil {
+			return fmt.Errorf("failed to parse --refresh-before arg: %s", err)
+		}
+	}
+	if opts.SnapshotExpires, err = parseDays("--snapshot-expires", args.String["--snapshot-expires"]); err != nil {
+		return err
+	}
+	if opts.TimestampExpires, err = parseDays("--timestamp-expires", args.String["--timestamp-expires"]); err != nil {
+		return err
+	}
+	opts.OnRefresh = printRefreshed
+	opts.OnError = func(err error) {
+		fmt.Fprintln(os.Stderr, "tuf: failed to refresh online roles:", err)
+	}
+	s, err := tuf.NewOnlineRolesSigner(repo, opts)
+	if err != nil {
+		return err
+	}
+
+	if args.Bool["--once"] {
+		refreshed, err := s.Refresh()
+		if err != nil {
+			return err
+		}
+		printRefreshed(refreshed)
+		return nil
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if err := s.Run(ctx); err != nil && err != context.Canceled {
+		return err
+	}
+	return nil
+}
+
+func parseDays(name, arg string) (time.Duration, error) {
+	days, err := strconv.Atoi(arg)
+	if err != nil || days < 1 {
+		return 0, fmt.Errorf("failed to parse %s arg: must be a positive number of days", name)
+	}
+	return time.Duration(days) * 24 * time.Hour, nil
+}
+
+func printRefreshed(roles []string) {
+	if len(roles) == 0 {
+		return
+	}
+	fmt.Printf("%s: re-signed %s\n", time.Now().UTC().Format(time.RFC3339), strings.Join(roles, ", "))
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/flynn/go-docopt"
+	"github.com/theupdateframework/go-tuf"
+)
+
+func init() {
+	register("verify", cmdVerify, `
+usage: tuf verify [--expiring-within=<days>] [--json]
+
+Check the integrity of the committed repository.
+
+Verifies the signatures of every top-level and delegated role, the versions
+and hashes listed by the snapshot and timestamp metadata, and that every target
+file is committed with the right length and hashes. Files that are not listed
+by any metadata are reported as orphaned. Staged files are ignored.
+
+The command's exit status will be 1 if any problems are found, 0 otherwise.
+Roles that are about to expire are listed, but are not problems.
+
+Options:
+  --expiring-within=<days>  List the roles that expire within the given
+                            number of days [default: 7].
+  --json                    Output the report as JSON.
+`)
+}
+
+func cmdVerify(args *docopt.Args, repo *tuf.Repo) error {
+	days, err := strconv.Atoi(args.String["--expiring-within"])
+	if err != nil {
+		return fmt.Errorf("failed to parse --expiring-within arg: %s", err)
+	}
+	report, err := repo.Verify(time.Now().AddDate(0, 0, days))
+	if err != nil {
+		return err
+	}
+
+	if args.Bool["--json"] {
+		out, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(out))
+	} else {
+		for _, p := range report.Problems {
+			fmt.Println(p)
+		}
+		for _, role := range report.Expiring {
+			fmt.Printf("%s: expires on %s\n", role.Role, role.Expires.UTC().Format(time.RFC3339))
+		}
+	}
+
+	if !report.OK() {
+		return fmt.Errorf("found %d problem(s) in the repository", len(report.Problems))
+	}
+	return nil
+}
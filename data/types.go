@@ -8,6 +8,7 @@ import (
 	"errors"
 	"fmt"
 	"path"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -19,8 +20,12 @@ const (
 	KeyIDLength                = sha256.Size * 2
 	KeyTypeEd25519             = "ed25519"
 	KeyTypeECDSA_SHA2_P256     = "ecdsa-sha2-nistp256"
+	KeyTypeECDSA_SHA2_P384     = "ecdsa-sha2-nistp384"
+	KeyTypeECDSA_SHA2_P521     = "ecdsa-sha2-nistp521"
 	KeySchemeEd25519           = "ed25519"
 	KeySchemeECDSA_SHA2_P256   = "ecdsa-sha2-nistp256"
+	KeySchemeECDSA_SHA2_P384   = "ecdsa-sha2-nistp384"
+	KeySchemeECDSA_SHA2_P521   = "ecdsa-sha2-nistp521"
 	KeyTypeRSASSA_PSS_SHA256   = "rsa"
 	KeySchemeRSASSA_PSS_SHA256 = "rsassa-pss-sha256"
 )
@@ -28,6 +33,7 @@ const (
 var (
 	HashAlgorithms           = []string{"sha256", "sha512"}
 	ErrPathsAndPathHashesSet = errors.New("tuf: failed validation of delegated target: paths and path_hash_prefixes are both set")
+	ErrInvalidSuccinctRoles  = errors.New("tuf: failed validation of delegated target: invalid succinct hash bin delegation")
 )
 
 type Signed struct {
@@ -230,16 +236,73 @@ type DelegatedRole struct {
 	Terminating      bool     `json:"terminating"`
 	PathHashPrefixes []string `json:"path_hash_prefixes,omitempty"`
 	Paths            []string `json:"paths"`
+
+	// BitLength and NamePrefix are set instead of paths for a succinct hash
+	// bin delegation (TAP 15). It delegates every path to one of
+	// 2^BitLength roles named NamePrefix, a dash and the bin number in hex,
+	// with the bin given by the first BitLength bits of the SHA-256 hash of
+	// the path.
+	BitLength  int    `json:"bit_length,omitempty"`
+	NamePrefix string `json:"name_prefix,omitempty"`
+}
+
+const (
+	MinSuccinctBitLength = 1
+	MaxSuccinctBitLength = 32
+)
+
+// IsSuccinct reports whether d is a succinct hash bin delegation.
+func (d *DelegatedRole) IsSuccinct() bool {
+	return d.BitLength != 0
+}
+
+// NumSuccinctBins returns the number of roles a succinct hash bin delegation
+// delegates to.
+func (d *DelegatedRole) NumSuccinctBins() uint64 {
+	return uint64(1) << d.BitLength
+}
+
+// SuccinctRoleName returns the name of the role of the given bin of a
+// succinct hash bin delegation.
+func (d *DelegatedRole) SuccinctRoleName(bin uint64) string {
+	hexDigits := (d.BitLength + 3) / 4
+	return fmt.Sprintf("%s-%0*x", d.NamePrefix, hexDigits, bin)
+}
+
+// SuccinctRoleNameForPath returns the name of the role that a succinct hash
+// bin delegation delegates the given file to.
+func (d *DelegatedRole) SuccinctRoleNameForPath(file string) string {
+	h := sha256.Sum256([]byte(file))
+	prefix := uint64(h[0])<<24 | uint64(h[1])<<16 | uint64(h[2])<<8 | uint64(h[3])
+	return d.SuccinctRoleName(prefix >> (MaxSuccinctBitLength - d.BitLength))
+}
+
+// IsSuccinctRoleName reports whether name is one of the roles of a succinct
+// hash bin delegation.
+func (d *DelegatedRole) IsSuccinctRoleName(name string) bool {
+	if !d.IsSuccinct() || !strings.HasPrefix(name, d.NamePrefix+"-") {
+		return false
+	}
+	bin, err := strconv.ParseUint(strings.TrimPrefix(name, d.NamePrefix+"-"), 16, 64)
+	if err != nil || bin >= d.NumSuccinctBins() {
+		return false
+	}
+	return name == d.SuccinctRoleName(bin)
 }
 
 // MatchesPath evaluates whether the path patterns or path hash prefixes match
 // a given file. This determines whether a delegated role is responsible for
-// signing and verifying the file.
+// signing and verifying the file. A succinct hash bin delegation matches
+// every file.
 func (d *DelegatedRole) MatchesPath(file string) (bool, error) {
 	if err := d.validatePaths(); err != nil {
 		return false, err
 	}
 
+	if d.IsSuccinct() {
+		return true, nil
+	}
+
 	for _, pattern := range d.Paths {
 		if matched, _ := path.Match(pattern, file); matched {
 			return true, nil
@@ -256,16 +319,31 @@ func (d *DelegatedRole) MatchesPath(file string) (bool, error) {
 	return false, nil
 }
 
+// Validate returns ErrPathsAndPathHashesSet or ErrInvalidSuccinctRoles if
+// d cannot be marshalled, as described for validatePaths.
+func (d *DelegatedRole) Validate() error {
+	return d.validatePaths()
+}
+
 // validatePaths enforces the spec
 // https://theupdateframework.github.io/specification/v1.0.19/index.html#file-formats-targets
 // 'role MUST specify only one of the "path_hash_prefixes" or "paths"'
 // Marshalling and unmarshalling JSON will fail and return
-// ErrPathsAndPathHashesSet if both fields are set and not empty.
+// ErrPathsAndPathHashesSet if both fields are set and not empty, and
+// ErrInvalidSuccinctRoles if a succinct hash bin delegation is invalid or
+// also sets either field.
 func (d *DelegatedRole) validatePaths() error {
 	if len(d.PathHashPrefixes) > 0 && len(d.Paths) > 0 {
 		return ErrPathsAndPathHashesSet
 	}
 
+	if d.BitLength != 0 || d.NamePrefix != "" {
+		if d.BitLength < MinSuccinctBitLength || d.BitLength > MaxSuccinctBitLength ||
+			d.NamePrefix == "" || len(d.PathHashPrefixes) > 0 || len(d.Paths) > 0 {
+			return ErrInvalidSuccinctRoles
+		}
+	}
+
 	return nil
 }
 
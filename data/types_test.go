@@ -209,6 +209,18 @@ func TestDelegatedRoleJSON(t *testing.T) {
 			},
 			rawCJSON: `{"keyids":["k1","k3"],"name":"n2","paths":["*.txt"],"terminating":false,"threshold":12}`,
 		},
+		{
+			testName: "succinct hash bins",
+			d: &DelegatedRole{
+				Name:        "bins",
+				KeyIDs:      []string{"k1"},
+				Threshold:   1,
+				Terminating: true,
+				BitLength:   8,
+				NamePrefix:  "bins",
+			},
+			rawCJSON: `{"bit_length":8,"keyids":["k1"],"name":"bins","name_prefix":"bins","paths":null,"terminating":true,"threshold":1}`,
+		},
 		{
 			testName: "default",
 			d:        &DelegatedRole{},
@@ -235,11 +247,58 @@ func TestDelegatedRoleUnmarshalErr(t *testing.T) {
 	var d DelegatedRole
 	assert.Equal(t, ErrPathsAndPathHashesSet, json.Unmarshal(targetsWithBothMatchers, &d))
 
+	for _, raw := range []string{
+		`{"bit_length":0,"name_prefix":"bins"}`,
+		`{"bit_length":33,"name_prefix":"bins"}`,
+		`{"bit_length":8}`,
+		`{"bit_length":8,"name_prefix":"bins","paths":["*.txt"]}`,
+		`{"bit_length":8,"name_prefix":"bins","path_hash_prefixes":["8f"]}`,
+	} {
+		var d DelegatedRole
+		assert.Equal(t, ErrInvalidSuccinctRoles, json.Unmarshal([]byte(raw), &d), raw)
+	}
+
 	// test for type errors
 	err := json.Unmarshal([]byte(`{"keyids":"a"}`), &d)
 	assert.Equal(t, "keyids", err.(*json.UnmarshalTypeError).Field)
 }
 
+func TestSuccinctRoleNames(t *testing.T) {
+	// The SHA-256 hash of /file3.txt starts with 8bafeada.
+	var tts = []struct {
+		bitLength int
+		roleName  string
+		numBins   uint64
+	}{
+		{bitLength: 1, roleName: "bin-1", numBins: 2},
+		{bitLength: 4, roleName: "bin-8", numBins: 16},
+		{bitLength: 5, roleName: "bin-11", numBins: 32},
+		{bitLength: 16, roleName: "bin-8baf", numBins: 65536},
+		{bitLength: 32, roleName: "bin-8bafeada", numBins: 1 << 32},
+	}
+	for _, tt := range tts {
+		t.Run(tt.roleName, func(t *testing.T) {
+			d := DelegatedRole{BitLength: tt.bitLength, NamePrefix: "bin"}
+			assert.True(t, d.IsSuccinct())
+			assert.Equal(t, tt.numBins, d.NumSuccinctBins())
+			assert.Equal(t, tt.roleName, d.SuccinctRoleNameForPath("/file3.txt"))
+			assert.True(t, d.IsSuccinctRoleName(tt.roleName))
+
+			matchesPath, err := d.MatchesPath("/file3.txt")
+			assert.NoError(t, err)
+			assert.True(t, matchesPath)
+		})
+	}
+
+	d := DelegatedRole{BitLength: 5, NamePrefix: "bin"}
+	assert.Equal(t, "bin-00", d.SuccinctRoleName(0))
+	assert.Equal(t, "bin-1f", d.SuccinctRoleName(31))
+	for _, name := range []string{"bin-20", "bin-1", "bin-001", "bin-1F", "bin-xx", "bins-00", "bin"} {
+		assert.False(t, d.IsSuccinctRoleName(name), name)
+	}
+	assert.False(t, (&DelegatedRole{Name: "bin-00"}).IsSuccinctRoleName("bin-00"))
+}
+
 func TestCustomField(t *testing.T) {
 	testCustomJSON := json.RawMessage([]byte(`{"test":true}`))
 
@@ -0,0 +1,767 @@
+package tuf
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/theupdateframework/go-tuf/data"
+	"github.com/theupdateframework/go-tuf/internal/roles"
+)
+
+// ChangeType says whether an entry of a metadata file was added, removed or
+// modified.
+type ChangeType string
+
+const (
+	ChangeAdded    ChangeType = "added"
+	ChangeRemoved  ChangeType = "removed"
+	ChangeModified ChangeType = "modified"
+)
+
+// MetadataDiff describes how the staged metadata of a role differs from the
+// metadata committed to the repository.
+type MetadataDiff struct {
+	Role string `json:"role"`
+
+	// New is true if the role has no committed metadata.
+	New bool `json:"new,omitempty"`
+
+	Version *VersionChange `json:"version,omitempty"`
+	Expires *ExpiresChange `json:"expires,omitempty"`
+
+	// ConsistentSnapshot is the change of the consistent snapshot setting of
+	// a root.
+	ConsistentSnapshot *ConsistentSnapshotChange `json:"consistent_snapshot,omitempty"`
+
+	// Keys lists the changed keys of a root, or the changed delegation keys
+	// of a targets role.
+	Keys []KeyChange `json:"keys,omitempty"`
+
+	// Targets lists the changed targets of a targets role.
+	Targets []TargetChange `json:"targets,omitempty"`
+
+	// Meta lists the changed metadata files of a snapshot or timestamp.
+	Meta []MetaFileChange `json:"meta,omitempty"`
+
+	// Roles lists the changed top-level roles of a root, and Delegations the
+	// changed delegations of a targets role.
+	Roles       []RoleChange `json:"roles,omitempty"`
+	Delegations []RoleChange `json:"delegations,omitempty"`
+
+	// DelegationOrder is set if the delegations of a targets role were
+	// reordered, which changes the order they are searched in.
+	DelegationOrder *OrderChange `json:"delegation_order,omitempty"`
+}
+
+// VersionChange is a change of a metadata version. Old is zero for new
+// metadata.
+type VersionChange struct {
+	Old int64 `json:"old"`
+	New int64 `json:"new"`
+}
+
+// ExpiresChange is a change of a metadata expiration time. Old is the zero
+// time for new metadata.
+type ExpiresChange struct {
+	Old time.Time `json:"old"`
+	New time.Time `json:"new"`
+}
+
+// ConsistentSnapshotChange is a change of the consistent snapshot setting of
+// root metadata. Old is false for new metadata.
+type ConsistentSnapshotChange struct {
+	Old bool `json:"old"`
+	New bool `json:"new"`
+}
+
+// KeyChange is a change of a key listed by root metadata, or of a delegation
+// key. Old is nil for an added key and New is nil for a removed one.
+type KeyChange struct {
+	ID     string          `json:"id"`
+	Change ChangeType      `json:"change"`
+	Old    *data.PublicKey `json:"old,omitempty"`
+	New    *data.PublicKey `json:"new,omitempty"`
+}
+
+// OrderChange is a change of the order of delegations, listed by role name.
+type OrderChange struct {
+	Old []string `json:"old"`
+	New []string `json:"new"`
+}
+
+// TargetChange is a change of a target file. Old is nil for an added target
+// and New is nil for a removed one.
+type TargetChange struct {
+	Path   string               `json:"path"`
+	Change ChangeType           `json:"change"`
+	Old    *data.TargetFileMeta `json:"old,omitempty"`
+	New    *data.TargetFileMeta `json:"new,omitempty"`
+}
+
+// MetaFileChange is a change of a metadata file listed by a snapshot or
+// timestamp. Old is nil for an added file and New is nil for a removed one.
+type MetaFileChange struct {
+	Name   string                 `json:"name"`
+	Change ChangeType             `json:"change"`
+	Old    *data.SnapshotFileMeta `json:"old,omitempty"`
+	New    *data.SnapshotFileMeta `json:"new,omitempty"`
+}
+
+// RoleChange is a change of a top-level role in root metadata, or of a
+// delegation. The old values are zero for an added role, and the new values
+// are zero for a removed one.
+type RoleChange struct {
+	Name         string     `json:"name"`
+	Change       ChangeType `json:"change"`
+	OldThreshold int        `json:"old_threshold"`
+	NewThreshold int        `json:"new_threshold"`
+	AddedKeys    []string   `json:"added_keys,omitempty"`
+	RemovedKeys  []string   `json:"removed_keys,omitempty"`
+
+	// The remaining fields are only set for delegations.
+	AddedPaths              []string `json:"added_paths,omitempty"`
+	RemovedPaths            []string `json:"removed_paths,omitempty"`
+	AddedPathHashPrefixes   []string `json:"added_path_hash_prefixes,omitempty"`
+	RemovedPathHashPrefixes []string `json:"removed_path_hash_prefixes,omitempty"`
+	OldTerminating          bool     `json:"old_terminating,omitempty"`
+	NewTerminating          bool     `json:"new_terminating,omitempty"`
+	OldBitLength            int      `json:"old_bit_length,omitempty"`
+	NewBitLength            int      `json:"new_bit_length,omitempty"`
+	OldNamePrefix           string   `json:"old_name_prefix,omitempty"`
+	NewNamePrefix           string   `json:"new_name_prefix,omitempty"`
+}
+
+// Empty returns whether the diff has no changes.
+func (d *MetadataDiff) Empty() bool {
+	return !d.New && d.Version == nil && d.Expires == nil && d.ConsistentSnapshot == nil &&
+		len(d.Keys) == 0 && len(d.Targets) == 0 && len(d.Meta) == 0 && len(d.Roles) == 0 &&
+		len(d.Delegations) == 0 && d.DelegationOrder == nil
+}
+
+// Lines describes the changes in d, one per line.
+func (d *MetadataDiff) Lines() []string {
+	lines := []string{}
+	if d.Version != nil {
+		if d.New {
+			lines = append(lines, fmt.Sprintf("version: %d", d.Version.New))
+		} else {
+			lines = append(lines, fmt.Sprintf("version: %d -> %d", d.Version.Old, d.Version.New))
+		}
+	}
+	if d.Expires != nil {
+		if d.New {
+			lines = append(lines, fmt.Sprintf("expires: %s", formatExpires(d.Expires.New)))
+		} else {
+			lines = append(lines, fmt.Sprintf("expires: %s -> %s", formatExpires(d.Expires.Old), formatExpires(d.Expires.New)))
+		}
+	}
+	if c := d.ConsistentSnapshot; c != nil {
+		if d.New {
+			lines = append(lines, fmt.Sprintf("consistent snapshot: %t", c.New))
+		} else {
+			lines = append(lines, fmt.Sprintf("consistent snapshot: %t -> %t", c.Old, c.New))
+		}
+	}
+	for _, c := range d.Keys {
+		lines = append(lines, c.lines()...)
+	}
+	for _, c := range d.Roles {
+		lines = append(lines, c.lines("role")...)
+	}
+	if c := d.DelegationOrder; c != nil {
+		lines = append(lines, fmt.Sprintf("delegations: order %s -> %s", strings.Join(c.Old, ", "), strings.Join(c.New, ", ")))
+	}
+	for _, c := range d.Delegations {
+		lines = append(lines, c.lines("delegation")...)
+	}
+	for _, c := range d.Targets {
+		lines = append(lines, c.lines()...)
+	}
+	for _, c := range d.Meta {
+		lines = append(lines, c.lines()...)
+	}
+	return lines
+}
+
+// String describes the changes in d under a heading with the role's
+// metadata file name.
+func (d *MetadataDiff) String() string {
+	var b strings.Builder
+	b.WriteString(d.Role + ".json:")
+	if d.Empty() {
+		b.WriteString(" no changes")
+	}
+	b.WriteString("\n")
+	for _, line := range d.Lines() {
+		b.WriteString("  " + line + "\n")
+	}
+	return b.String()
+}
+
+func (c KeyChange) lines() []string {
+	prefix := "key " + c.ID + ": "
+	switch c.Change {
+	case ChangeAdded:
+		return []string{prefix + "added (" + describeKey(c.New) + ")"}
+	case ChangeRemoved:
+		return []string{prefix + "removed"}
+	}
+	return []string{prefix + describeKey(c.Old) + " -> " + describeKey(c.New)}
+}
+
+func describeKey(k *data.PublicKey) string {
+	return fmt.Sprintf("%s %s %s", k.Type, k.Scheme, compactJSON(k.Value))
+}
+
+// compactJSON returns raw without insignificant whitespace, so that the
+// same value is described the same however its metadata was formatted.
+func compactJSON(raw json.RawMessage) []byte {
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, raw); err != nil {
+		return bytes.TrimSpace(raw)
+	}
+	return buf.Bytes()
+}
+
+func (c TargetChange) lines() []string {
+	switch c.Change {
+	case ChangeAdded:
+		return []string{fmt.Sprintf("target %s: added (%s)", c.Path, describeFileMeta(c.New.FileMeta))}
+	case ChangeRemoved:
+		return []string{fmt.Sprintf("target %s: removed", c.Path)}
+	}
+	prefix := "target " + c.Path + ": "
+	lines := fileMetaChanges(prefix, c.Old.FileMeta, c.New.FileMeta)
+	if !customEqual(c.Old.Custom, c.New.Custom) {
+		lines = append(lines, prefix+"custom metadata changed")
+	}
+	return lines
+}
+
+func (c MetaFileChange) lines() []string {
+	switch c.Change {
+	case ChangeAdded:
+		return []string{fmt.Sprintf("meta %s: added with version %d", c.Name, c.New.Version)}
+	case ChangeRemoved:
+		return []string{fmt.Sprintf("meta %s: removed", c.Name)}
+	}
+	prefix := "meta " + c.Name + ": "
+	lines := []string{}
+	if c.Old.Version != c.New.Version {
+		lines = append(lines, fmt.Sprintf("%sversion %d -> %d", prefix, c.Old.Version, c.New.Version))
+	}
+	return append(lines, fileMetaChanges(prefix,
+		data.FileMeta{Length: c.Old.Length, Hashes: c.Old.Hashes},
+		data.FileMeta{Length: c.New.Length, Hashes: c.New.Hashes})...)
+}
+
+func (c RoleChange) lines(kind string) []string {
+	prefix := kind + " " + c.Name + ": "
+	lines := []string{}
+	switch c.Change {
+	case ChangeAdded:
+		lines = append(lines, fmt.Sprintf("%sadded with threshold %d", prefix, c.NewThreshold))
+		if c.NewTerminating {
+			lines = append(lines, prefix+"terminating")
+		}
+		if c.NewBitLength != 0 {
+			lines = append(lines, fmt.Sprintf("%ssuccinct hash bins with bit length %d and name prefix %s", prefix, c.NewBitLength, c.NewNamePrefix))
+		}
+	case ChangeRemoved:
+		return []string{prefix + "removed"}
+	default:
+		if c.OldThreshold != c.NewThreshold {
+			lines = append(lines, fmt.Sprintf("%sthreshold %d -> %d", prefix, c.OldThreshold, c.NewThreshold))
+		}
+		if c.OldTerminating != c.NewTerminating {
+			lines = append(lines, fmt.Sprintf("%sterminating %t -> %t", prefix, c.OldTerminating, c.NewTerminating))
+		}
+		if c.OldBitLength != c.NewBitLength {
+			lines = append(lines, fmt.Sprintf("%sbit length %d -> %d", prefix, c.OldBitLength, c.NewBitLength))
+		}
+		if c.OldNamePrefix != c.NewNamePrefix {
+			lines = append(lines, fmt.Sprintf("%sname prefix %q -> %q", prefix, c.OldNamePrefix, c.NewNamePrefix))
+		}
+	}
+	for _, id := range c.AddedKeys {
+		lines = append(lines, prefix+"added key "+id)
+	}
+	for _, id := range c.RemovedKeys {
+		lines = append(lines, prefix+"removed key "+id)
+	}
+	for _, p := range c.AddedPaths {
+		lines = append(lines, prefix+"added path "+p)
+	}
+	for _, p := range c.RemovedPaths {
+		lines = append(lines, prefix+"removed path "+p)
+	}
+	for _, p := range c.AddedPathHashPrefixes {
+		lines = append(lines, prefix+"added path hash prefix "+p)
+	}
+	for _, p := range c.RemovedPathHashPrefixes {
+		lines = append(lines, prefix+"removed path hash prefix "+p)
+	}
+	return lines
+}
+
+func formatExpires(t time.Time) string {
+	return t.UTC().Format(time.RFC3339)
+}
+
+func describeFileMeta(m data.FileMeta) string {
+	parts := []string{fmt.Sprintf("length %d", m.Length)}
+	for _, alg := range sortedHashAlgorithms(m.Hashes) {
+		parts = append(parts, fmt.Sprintf("%s %s", alg, m.Hashes[alg]))
+	}
+	return strings.Join(parts, ", ")
+}
+
+func fileMetaChanges(prefix string, old, new data.FileMeta) []string {
+	lines := []string{}
+	if old.Length != new.Length {
+		lines = append(lines, fmt.Sprintf("%slength %d -> %d", prefix, old.Length, new.Length))
+	}
+	algs := sortedHashAlgorithms(old.Hashes)
+	for _, alg := range sortedHashAlgorithms(new.Hashes) {
+		if _, ok := old.Hashes[alg]; !ok {
+			algs = append(algs, alg)
+		}
+	}
+	for _, alg := range algs {
+		o, n := old.Hashes[alg].String(), new.Hashes[alg].String()
+		switch {
+		case o == n:
+		case o == "":
+			lines = append(lines, fmt.Sprintf("%sadded %s %s", prefix, alg, n))
+		case n == "":
+			lines = append(lines, fmt.Sprintf("%sremoved %s %s", prefix, alg, o))
+		default:
+			lines = append(lines, fmt.Sprintf("%s%s %s -> %s", prefix, alg, o, n))
+		}
+	}
+	return lines
+}
+
+func sortedHashAlgorithms(h data.Hashes) []string {
+	algs := h.HashAlgorithms()
+	sort.Strings(algs)
+	return algs
+}
+
+func customEqual(a, b *json.RawMessage) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return string(*a) == string(*b)
+}
+
+// Diff compares the staged metadata of the given roles with the metadata
+// committed to the repository. If no roles are given, every role with staged
+// metadata is compared. The diffs are ordered like the top-level roles,
+// followed by delegated roles sorted by name.
+func (r *Repo) Diff(roleNames ...string) ([]*MetadataDiff, error) {
+	getter, ok := r.local.(CommittedMetaGetter)
+	if !ok {
+		return nil, ErrDiffNotSupported
+	}
+	committed, err := getter.GetCommittedMeta()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(roleNames) == 0 {
+		for name := range r.meta {
+			if r.local.FileIsStaged(name) {
+				roleNames = append(roleNames, strings.TrimSuffix(name, ".json"))
+			}
+		}
+	}
+	sort.Slice(roleNames, func(i, j int) bool {
+		a, b := roleNames[i], roleNames[j]
+		if roles.IsTopLevelRole(a) != roles.IsTopLevelRole(b) {
+			return roles.IsTopLevelRole(a)
+		}
+		if roles.IsTopLevelRole(a) {
+			return topLevelRoleIndex(a) < topLevelRoleIndex(b)
+		}
+		return a < b
+	})
+
+	diffs := make([]*MetadataDiff, 0, len(roleNames))
+	for _, role := range roleNames {
+		name := role + ".json"
+		staged, ok := r.meta[name]
+		if !ok {
+			return nil, ErrMissingMetadata{name}
+		}
+		d, err := diffMetadata(role, committed[name], staged)
+		if err != nil {
+			return nil, fmt.Errorf("error comparing %s: %w", name, err)
+		}
+		diffs = append(diffs, d)
+	}
+	return diffs, nil
+}
+
+func topLevelRoleIndex(role string) int {
+	for i, name := range topLevelMetadata {
+		if name == role+".json" {
+			return i
+		}
+	}
+	return len(topLevelMetadata)
+}
+
+// diffMetadata compares the signed metadata of a role, where old is nil if
+// the role has no committed metadata.
+func diffMetadata(role string, old, new json.RawMessage) (*MetadataDiff, error) {
+	oldSigned, newSigned := &data.Signed{}, &data.Signed{}
+	if old != nil {
+		if err := json.Unmarshal(old, oldSigned); err != nil {
+			return nil, err
+		}
+	}
+	if err := json.Unmarshal(new, newSigned); err != nil {
+		return nil, err
+	}
+
+	switch role {
+	case "root":
+		var prev *data.Root
+		if old != nil {
+			prev = &data.Root{}
+			if err := json.Unmarshal(oldSigned.Signed, prev); err != nil {
+				return nil, err
+			}
+		}
+		next := &data.Root{}
+		if err := json.Unmarshal(newSigned.Signed, next); err != nil {
+			return nil, err
+		}
+		return diffRoot(prev, next), nil
+	case "snapshot":
+		prev, next := &data.Snapshot{}, &data.Snapshot{}
+		if err := unmarshalSignedPair(old, oldSigned, prev, newSigned, next); err != nil {
+			return nil, err
+		}
+		d := newMetadataDiff(role, old == nil, prev.Version, next.Version, prev.Expires, next.Expires)
+		d.Meta = diffMetaFiles(prev.Meta, next.Meta)
+		return d, nil
+	case "timestamp":
+		prev, next := &data.Timestamp{}, &data.Timestamp{}
+		if err := unmarshalSignedPair(old, oldSigned, prev, newSigned, next); err != nil {
+			return nil, err
+		}
+		d := newMetadataDiff(role, old == nil, prev.Version, next.Version, prev.Expires, next.Expires)
+		prevMeta, nextMeta := make(data.SnapshotFiles), make(data.SnapshotFiles)
+		for name, m := range prev.Meta {
+			prevMeta[name] = data.SnapshotFileMeta(m)
+		}
+		for name, m := range next.Meta {
+			nextMeta[name] = data.SnapshotFileMeta(m)
+		}
+		d.Meta = diffMetaFiles(prevMeta, nextMeta)
+		return d, nil
+	default:
+		prev, next := data.NewTargets(), data.NewTargets()
+		if err := unmarshalSignedPair(old, oldSigned, prev, newSigned, next); err != nil {
+			return nil, err
+		}
+		d := newMetadataDiff(role, old == nil, prev.Version, next.Version, prev.Expires, next.Expires)
+		d.Targets = diffTargets(prev.Targets, next.Targets)
+		var prevKeys, nextKeys map[string]*data.PublicKey
+		if prev.Delegations != nil {
+			prevKeys = prev.Delegations.Keys
+		}
+		if next.Delegations != nil {
+			nextKeys = next.Delegations.Keys
+		}
+		d.Keys = diffKeys(prevKeys, nextKeys)
+		d.Delegations = diffDelegations(prev.Delegations, next.Delegations)
+		d.DelegationOrder = diffDelegationOrder(prev.Delegations, next.Delegations)
+		return d, nil
+	}
+}
+
+func unmarshalSignedPair(old json.RawMessage, oldSigned *data.Signed, prev interface{}, newSigned *data.Signed, next interface{}) error {
+	if old != nil {
+		if err := json.Unmarshal(oldSigned.Signed, prev); err != nil {
+			return err
+		}
+	}
+	return json.Unmarshal(newSigned.Signed, next)
+}
+
+func newMetadataDiff(role string, isNew bool, oldVersion, newVersion int64, oldExpires, newExpires time.Time) *MetadataDiff {
+	d := &MetadataDiff{Role: role, New: isNew}
+	if isNew {
+		oldVersion, oldExpires = 0, time.Time{}
+	}
+	if oldVersion != newVersion {
+		d.Version = &VersionChange{Old: oldVersion, New: newVersion}
+	}
+	if !oldExpires.Equal(newExpires) {
+		d.Expires = &ExpiresChange{Old: oldExpires, New: newExpires}
+	}
+	return d
+}
+
+// diffRoot compares root metadata, where prev is nil for new metadata.
+func diffRoot(prev, next *data.Root) *MetadataDiff {
+	isNew := prev == nil
+	if isNew {
+		prev = &data.Root{}
+	}
+	d := newMetadataDiff("root", isNew, prev.Version, next.Version, prev.Expires, next.Expires)
+	if prev.ConsistentSnapshot != next.ConsistentSnapshot {
+		d.ConsistentSnapshot = &ConsistentSnapshotChange{Old: prev.ConsistentSnapshot, New: next.ConsistentSnapshot}
+	}
+	d.Keys = diffKeys(prev.Keys, next.Keys)
+
+	names := make(map[string]struct{})
+	for name := range prev.Roles {
+		names[name] = struct{}{}
+	}
+	for name := range next.Roles {
+		names[name] = struct{}{}
+	}
+
+	for _, name := range sortedNames(names) {
+		p, n := prev.Roles[name], next.Roles[name]
+		c := RoleChange{Name: name}
+		switch {
+		case n == nil:
+			c.Change, c.OldThreshold = ChangeRemoved, p.Threshold
+			d.Roles = append(d.Roles, c)
+			continue
+		case p == nil:
+			c.Change = ChangeAdded
+			p = &data.Role{}
+		default:
+			c.Change = ChangeModified
+		}
+		c.OldThreshold, c.NewThreshold = p.Threshold, n.Threshold
+		c.AddedKeys = missingStrings(n.KeyIDs, p.KeyIDs)
+		c.RemovedKeys = missingStrings(p.KeyIDs, n.KeyIDs)
+		if c.Change == ChangeModified && c.OldThreshold == c.NewThreshold &&
+			len(c.AddedKeys) == 0 && len(c.RemovedKeys) == 0 {
+			continue
+		}
+		d.Roles = append(d.Roles, c)
+	}
+	return d
+}
+
+func diffTargets(prev, next data.TargetFiles) []TargetChange {
+	paths := make(map[string]struct{})
+	for path := range prev {
+		paths[path] = struct{}{}
+	}
+	for path := range next {
+		paths[path] = struct{}{}
+	}
+
+	changes := []TargetChange{}
+	for _, path := range sortedNames(paths) {
+		p, inPrev := prev[path]
+		n, inNext := next[path]
+		switch {
+		case !inNext:
+			changes = append(changes, TargetChange{Path: path, Change: ChangeRemoved, Old: &p})
+		case !inPrev:
+			changes = append(changes, TargetChange{Path: path, Change: ChangeAdded, New: &n})
+		default:
+			c := TargetChange{Path: path, Change: ChangeModified, Old: &p, New: &n}
+			if len(c.lines()) > 0 {
+				changes = append(changes, c)
+			}
+		}
+	}
+	return changes
+}
+
+func diffMetaFiles(prev, next data.SnapshotFiles) []MetaFileChange {
+	names := make(map[string]struct{})
+	for name := range prev {
+		names[name] = struct{}{}
+	}
+	for name := range next {
+		names[name] = struct{}{}
+	}
+
+	changes := []MetaFileChange{}
+	for _, name := range sortedNames(names) {
+		p, inPrev := prev[name]
+		n, inNext := next[name]
+		switch {
+		case !inNext:
+			changes = append(changes, MetaFileChange{Name: name, Change: ChangeRemoved, Old: &p})
+		case !inPrev:
+			changes = append(changes, MetaFileChange{Name: name, Change: ChangeAdded, New: &n})
+		default:
+			c := MetaFileChange{Name: name, Change: ChangeModified, Old: &p, New: &n}
+			if len(c.lines()) > 0 {
+				changes = append(changes, c)
+			}
+		}
+	}
+	return changes
+}
+
+func diffDelegations(prev, next *data.Delegations) []RoleChange {
+	names := make(map[string]struct{})
+	prevRoles, nextRoles := map[string]data.DelegatedRole{}, map[string]data.DelegatedRole{}
+	if prev != nil {
+		for _, r := range prev.Roles {
+			prevRoles[r.Name] = r
+			names[r.Name] = struct{}{}
+		}
+	}
+	if next != nil {
+		for _, r := range next.Roles {
+			nextRoles[r.Name] = r
+			names[r.Name] = struct{}{}
+		}
+	}
+
+	changes := []RoleChange{}
+	for _, name := range sortedNames(names) {
+		p, inPrev := prevRoles[name]
+		n, inNext := nextRoles[name]
+		c := RoleChange{Name: name, Change: ChangeModified}
+		switch {
+		case !inNext:
+			changes = append(changes, RoleChange{
+				Name:           name,
+				Change:         ChangeRemoved,
+				OldThreshold:   p.Threshold,
+				OldTerminating: p.Terminating,
+				OldBitLength:   p.BitLength,
+				OldNamePrefix:  p.NamePrefix,
+			})
+			continue
+		case !inPrev:
+			c.Change = ChangeAdded
+		}
+		c.OldThreshold, c.NewThreshold = p.Threshold, n.Threshold
+		c.OldTerminating, c.NewTerminating = p.Terminating, n.Terminating
+		c.OldBitLength, c.NewBitLength = p.BitLength, n.BitLength
+		c.OldNamePrefix, c.NewNamePrefix = p.NamePrefix, n.NamePrefix
+		c.AddedKeys = missingStrings(n.KeyIDs, p.KeyIDs)
+		c.RemovedKeys = missingStrings(p.KeyIDs, n.KeyIDs)
+		c.AddedPaths = missingStrings(n.Paths, p.Paths)
+		c.RemovedPaths = missingStrings(p.Paths, n.Paths)
+		c.AddedPathHashPrefixes = missingStrings(n.PathHashPrefixes, p.PathHashPrefixes)
+		c.RemovedPathHashPrefixes = missingStrings(p.PathHashPrefixes, n.PathHashPrefixes)
+		if c.Change == ChangeModified && len(c.lines("delegation")) == 0 {
+			continue
+		}
+		changes = append(changes, c)
+	}
+	return changes
+}
+
+// diffDelegationOrder returns the change of the order of the delegations
+// present in both prev and next, or of where the added ones are, or nil if
+// the delegations kept their order and the added ones come last.
+func diffDelegationOrder(prev, next *data.Delegations) *OrderChange {
+	var prevNames, nextNames []string
+	if prev != nil {
+		for _, r := range prev.Roles {
+			prevNames = append(prevNames, r.Name)
+		}
+	}
+	if next != nil {
+		for _, r := range next.Roles {
+			nextNames = append(nextNames, r.Name)
+		}
+	}
+
+	// The expected order keeps the previous delegations that remain, then
+	// the added ones.
+	inNext := make(map[string]struct{}, len(nextNames))
+	for _, name := range nextNames {
+		inNext[name] = struct{}{}
+	}
+	expected := []string{}
+	for _, name := range prevNames {
+		if _, ok := inNext[name]; ok {
+			expected = append(expected, name)
+		}
+	}
+	for _, name := range missingInOrder(nextNames, prevNames) {
+		expected = append(expected, name)
+	}
+	for i, name := range nextNames {
+		if expected[i] != name {
+			return &OrderChange{Old: prevNames, New: nextNames}
+		}
+	}
+	return nil
+}
+
+// missingInOrder returns the strings in a that are not in b, in the order
+// of a.
+func missingInOrder(a, b []string) []string {
+	in := make(map[string]struct{}, len(b))
+	for _, s := range b {
+		in[s] = struct{}{}
+	}
+	missing := []string{}
+	for _, s := range a {
+		if _, ok := in[s]; !ok {
+			missing = append(missing, s)
+		}
+	}
+	return missing
+}
+
+func diffKeys(prev, next map[string]*data.PublicKey) []KeyChange {
+	ids := make(map[string]struct{})
+	for id := range prev {
+		ids[id] = struct{}{}
+	}
+	for id := range next {
+		ids[id] = struct{}{}
+	}
+
+	changes := []KeyChange{}
+	for _, id := range sortedNames(ids) {
+		p, n := prev[id], next[id]
+		switch {
+		case n == nil:
+			changes = append(changes, KeyChange{ID: id, Change: ChangeRemoved, Old: p})
+		case p == nil:
+			changes = append(changes, KeyChange{ID: id, Change: ChangeAdded, New: n})
+		case !keysEqual(p, n):
+			changes = append(changes, KeyChange{ID: id, Change: ChangeModified, Old: p, New: n})
+		}
+	}
+	return changes
+}
+
+func keysEqual(a, b *data.PublicKey) bool {
+	if a.Type != b.Type || a.Scheme != b.Scheme || len(a.Algorithms) != len(b.Algorithms) {
+		return false
+	}
+	for i := range a.Algorithms {
+		if a.Algorithms[i] != b.Algorithms[i] {
+			return false
+		}
+	}
+	return bytes.Equal(compactJSON(a.Value), compactJSON(b.Value))
+}
+
+// sortedNames returns the names in a set, sorted.
+func sortedNames(names map[string]struct{}) []string {
+	sorted := make([]string, 0, len(names))
+	for name := range names {
+		sorted = append(sorted, name)
+	}
+	sort.Strings(sorted)
+	return sorted
+}
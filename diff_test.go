@@ -0,0 +1,250 @@
+package tuf
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/theupdateframework/go-tuf/data"
+	"github.com/theupdateframework/go-tuf/pkg/keys"
+	. "gopkg.in/check.v1"
+)
+
+func (rs *RepoSuite) TestDiff(c *C) {
+	tmp := newTmpDir(c)
+	local := FileSystemStore(tmp.path, nil)
+	r, err := NewRepo(local, "sha256")
+	c.Assert(err, IsNil)
+
+	genKey(c, r, "root")
+	genKey(c, r, "targets")
+	genKey(c, r, "snapshot")
+	genKey(c, r, "timestamp")
+	tmp.writeStagedTarget("foo.txt", "foo")
+	tmp.writeStagedTarget("bar.txt", "bar")
+	c.Assert(r.AddTargets([]string{"foo.txt", "bar.txt"}, nil), IsNil)
+	c.Assert(r.Snapshot(), IsNil)
+	c.Assert(r.Timestamp(), IsNil)
+	c.Assert(r.Commit(), IsNil)
+
+	// nothing is staged after a commit
+	diffs, err := r.Diff()
+	c.Assert(err, IsNil)
+	c.Assert(diffs, HasLen, 0)
+	diffs, err = r.Diff("targets")
+	c.Assert(err, IsNil)
+	c.Assert(diffs, HasLen, 1)
+	c.Assert(diffs[0].Empty(), Equals, true)
+	c.Assert(diffs[0].String(), Equals, "targets.json: no changes\n")
+	_, err = r.Diff("foo")
+	c.Assert(err, Equals, ErrMissingMetadata{"foo.json"})
+
+	// stage changes to every role
+	targetsIDs := genKey(c, r, "targets")
+	tmp.writeStagedTarget("foo.txt", "foo v2")
+	tmp.writeStagedTarget("baz.txt", "baz")
+	c.Assert(r.AddTargets([]string{"foo.txt", "baz.txt"}, nil), IsNil)
+	c.Assert(r.RemoveTarget("bar.txt"), IsNil)
+	roleKey, err := keys.GenerateEd25519Key()
+	c.Assert(err, IsNil)
+	c.Assert(local.SaveSigner("role", roleKey), IsNil)
+	c.Assert(r.AddDelegatedRole("targets", data.DelegatedRole{
+		Name:      "role",
+		KeyIDs:    roleKey.PublicData().IDs(),
+		Paths:     []string{"A/*"},
+		Threshold: 1,
+	}, []*data.PublicKey{roleKey.PublicData()}), IsNil)
+	c.Assert(r.Snapshot(), IsNil)
+	c.Assert(r.Timestamp(), IsNil)
+
+	diffs, err = r.Diff()
+	c.Assert(err, IsNil)
+	roles := []string{}
+	for _, d := range diffs {
+		roles = append(roles, d.Role)
+	}
+	c.Assert(roles, DeepEquals, []string{"root", "targets", "snapshot", "timestamp", "role"})
+
+	root := diffs[0]
+	c.Assert(root.Version, DeepEquals, &VersionChange{Old: 1, New: 2})
+	c.Assert(root.Roles, DeepEquals, []RoleChange{{
+		Name:         "targets",
+		Change:       ChangeModified,
+		OldThreshold: 1,
+		NewThreshold: 1,
+		AddedKeys:    targetsIDs,
+		RemovedKeys:  []string{},
+	}})
+	c.Assert(root.Keys, HasLen, len(targetsIDs))
+	for i, k := range root.Keys {
+		c.Assert(k.ID, Equals, targetsIDs[i])
+		c.Assert(k.Change, Equals, ChangeAdded)
+	}
+
+	targets := diffs[1]
+	c.Assert(targets.New, Equals, false)
+	c.Assert(targets.Version, DeepEquals, &VersionChange{Old: 1, New: 2})
+	fooHash := sha256.Sum256([]byte("foo"))
+	fooV2Hash := sha256.Sum256([]byte("foo v2"))
+	bazHash := sha256.Sum256([]byte("baz"))
+	lines := []string{}
+	for _, line := range targets.Lines() {
+		if !strings.HasPrefix(line, "expires: ") {
+			lines = append(lines, line)
+		}
+	}
+	c.Assert(lines, DeepEquals, []string{
+		"version: 1 -> 2",
+		fmt.Sprintf("key %s: added (%s)", roleKey.PublicData().IDs()[0], describeKey(roleKey.PublicData())),
+		"delegation role: added with threshold 1",
+		"delegation role: added key " + roleKey.PublicData().IDs()[0],
+		"delegation role: added path A/*",
+		"target bar.txt: removed",
+		fmt.Sprintf("target baz.txt: added (length 3, sha256 %x)", bazHash),
+		"target foo.txt: length 3 -> 6",
+		fmt.Sprintf("target foo.txt: sha256 %x -> %x", fooHash, fooV2Hash),
+	})
+
+	snapshot := diffs[2]
+	c.Assert(snapshot.Meta, HasLen, 2)
+	c.Assert(snapshot.Meta[0].Name, Equals, "role.json")
+	c.Assert(snapshot.Meta[0].Change, Equals, ChangeAdded)
+	c.Assert(snapshot.Meta[1].Name, Equals, "targets.json")
+	c.Assert(snapshot.Meta[1].Change, Equals, ChangeModified)
+
+	role := diffs[4]
+	c.Assert(role.New, Equals, true)
+	c.Assert(role.Version, DeepEquals, &VersionChange{Old: 0, New: 1})
+	c.Assert(role.Lines()[0], Equals, "version: 1")
+
+	// the diffs can be encoded for other tools
+	raw, err := json.Marshal(diffs[1])
+	c.Assert(err, IsNil)
+	decoded := &MetadataDiff{}
+	c.Assert(json.Unmarshal(raw, decoded), IsNil)
+	c.Assert(decoded.Targets, HasLen, 3)
+	c.Assert(decoded.Targets[0], DeepEquals, TargetChange{
+		Path:   "bar.txt",
+		Change: ChangeRemoved,
+		Old:    targets.Targets[0].Old,
+	})
+}
+
+func (rs *RepoSuite) TestDiffNotSupported(c *C) {
+	r, err := NewRepo(struct{ LocalStore }{MemoryStore(nil, nil)})
+	c.Assert(err, IsNil)
+	_, err = r.Diff()
+	c.Assert(err, Equals, ErrDiffNotSupported)
+}
+
+func marshalSignedMetadata(c *C, v interface{}) json.RawMessage {
+	signed, err := json.Marshal(v)
+	c.Assert(err, IsNil)
+	raw, err := json.Marshal(&data.Signed{Signed: signed})
+	c.Assert(err, IsNil)
+	return raw
+}
+
+func (rs *RepoSuite) TestDiffRootConsistentSnapshotAndKeys(c *C) {
+	key1, err := keys.GenerateEd25519Key()
+	c.Assert(err, IsNil)
+	key2, err := keys.GenerateEd25519Key()
+	c.Assert(err, IsNil)
+	id := key1.PublicData().IDs()[0]
+
+	prev := data.NewRoot()
+	prev.Version = 1
+	prev.ConsistentSnapshot = false
+	prev.AddKey(key1.PublicData())
+	next := data.NewRoot()
+	next.Version = 2
+	next.Expires = prev.Expires
+	next.ConsistentSnapshot = true
+	// the same key ID now lists other key material
+	next.Keys[id] = key2.PublicData()
+
+	d, err := diffMetadata("root", marshalSignedMetadata(c, prev), marshalSignedMetadata(c, next))
+	c.Assert(err, IsNil)
+	c.Assert(d.ConsistentSnapshot, DeepEquals, &ConsistentSnapshotChange{Old: false, New: true})
+	c.Assert(d.Keys, HasLen, 1)
+	c.Assert(d.Keys[0].Change, Equals, ChangeModified)
+	c.Assert(d.Lines(), DeepEquals, []string{
+		"version: 1 -> 2",
+		"consistent snapshot: false -> true",
+		fmt.Sprintf("key %s: %s -> %s", id, describeKey(key1.PublicData()), describeKey(key2.PublicData())),
+	})
+	c.Assert(rootChanges(prev, next), DeepEquals, d.Lines())
+}
+
+func (rs *RepoSuite) TestDiffDelegations(c *C) {
+	key1, err := keys.GenerateEd25519Key()
+	c.Assert(err, IsNil)
+	key2, err := keys.GenerateEd25519Key()
+	c.Assert(err, IsNil)
+	id1, id2 := key1.PublicData().IDs()[0], key2.PublicData().IDs()[0]
+
+	prev := data.NewTargets()
+	prev.Version = 1
+	prev.Delegations = &data.Delegations{
+		Keys: map[string]*data.PublicKey{id1: key1.PublicData()},
+		Roles: []data.DelegatedRole{
+			{Name: "a", KeyIDs: []string{id1}, Threshold: 1, Paths: []string{"a/*"}},
+			{Name: "b", KeyIDs: []string{id1}, Threshold: 1, Paths: []string{"b/*"}},
+			{Name: "bins-", KeyIDs: []string{id1}, Threshold: 1, BitLength: 2, NamePrefix: "bins"},
+		},
+	}
+
+	// Adding a delegation last keeps the order.
+	next := data.NewTargets()
+	next.Version = 2
+	next.Expires = prev.Expires
+	next.Delegations = &data.Delegations{
+		Keys:  prev.Delegations.Keys,
+		Roles: append(append([]data.DelegatedRole{}, prev.Delegations.Roles...), data.DelegatedRole{Name: "c", KeyIDs: []string{id1}, Threshold: 1, Paths: []string{"c/*"}}),
+	}
+	d, err := diffMetadata("targets", marshalSignedMetadata(c, prev), marshalSignedMetadata(c, next))
+	c.Assert(err, IsNil)
+	c.Assert(d.DelegationOrder, IsNil)
+	c.Assert(d.Keys, HasLen, 0)
+
+	// Reordered, re-keyed and re-binned delegations are all reported.
+	next.Delegations = &data.Delegations{
+		Keys: map[string]*data.PublicKey{id2: key2.PublicData()},
+		Roles: []data.DelegatedRole{
+			{Name: "b", KeyIDs: []string{id2}, Threshold: 1, Paths: []string{"b/*"}},
+			{Name: "a", KeyIDs: []string{id2}, Threshold: 1, Paths: []string{"a/*"}},
+			{Name: "bins-", KeyIDs: []string{id2}, Threshold: 1, BitLength: 3, NamePrefix: "other"},
+		},
+	}
+	d, err = diffMetadata("targets", marshalSignedMetadata(c, prev), marshalSignedMetadata(c, next))
+	c.Assert(err, IsNil)
+	c.Assert(d.Empty(), Equals, false)
+	c.Assert(d.DelegationOrder, DeepEquals, &OrderChange{
+		Old: []string{"a", "b", "bins-"},
+		New: []string{"b", "a", "bins-"},
+	})
+	expected := []string{"version: 1 -> 2"}
+	keyLines := []string{
+		fmt.Sprintf("key %s: removed", id1),
+		fmt.Sprintf("key %s: added (%s)", id2, describeKey(key2.PublicData())),
+	}
+	if id2 < id1 {
+		keyLines[0], keyLines[1] = keyLines[1], keyLines[0]
+	}
+	expected = append(expected, keyLines...)
+	expected = append(expected, "delegations: order a, b, bins- -> b, a, bins-")
+	for _, name := range []string{"a", "b", "bins-"} {
+		if name == "bins-" {
+			expected = append(expected,
+				"delegation bins-: bit length 2 -> 3",
+				`delegation bins-: name prefix "bins" -> "other"`,
+			)
+		}
+		expected = append(expected,
+			fmt.Sprintf("delegation %s: added key %s", name, id2),
+			fmt.Sprintf("delegation %s: removed key %s", name, id1),
+		)
+	}
+	c.Assert(d.Lines(), DeepEquals, expected)
+}
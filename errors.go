@@ -10,8 +10,31 @@ var (
 	ErrInitNotAllowed               = errors.New("tuf: repository already initialized")
 	ErrNewRepository                = errors.New("tuf: repository not yet committed")
 	ErrChangePassphraseNotSupported = errors.New("tuf: store does not support changing passphrase")
+	ErrRegenerateNotSupported       = errors.New("tuf: store does not support regenerating targets metadata")
+	ErrDiffNotSupported             = errors.New("tuf: store does not support reading committed metadata")
+	ErrVerifyNotSupported           = errors.New("tuf: store does not support reading committed metadata and targets")
+	ErrRootSigningBundleMismatch    = errors.New("tuf: root signing bundles propose different root metadata")
+	ErrStaleRootSigningBundle       = errors.New("tuf: root signing bundle does not propose the staged root metadata")
+	ErrRootSigningBundleChanges     = errors.New("tuf: root signing bundle lists changes that do not match its root metadata")
+	ErrUntrustedRootSigningBundle   = errors.New("tuf: root signing bundle does not propose the next version of the committed root metadata")
+	ErrStagedChanges                = errors.New("tuf: repository has staged changes")
+	ErrStagedInRepository           = errors.New("tuf: staged files must be stored outside the repository")
+	ErrRefreshBeforeTooLong         = errors.New("tuf: online roles must be refreshed less long before they expire than they are valid for")
 )
 
+type ErrRepoLocked struct {
+	Dir string
+	Err error
+}
+
+func (e ErrRepoLocked) Error() string {
+	return fmt.Sprintf("tuf: repository %s is locked by another process: %s", e.Dir, e.Err)
+}
+
+func (e ErrRepoLocked) Unwrap() error {
+	return e.Err
+}
+
 type ErrMissingMetadata struct {
 	Name string
 }
@@ -96,3 +119,28 @@ type ErrNoDelegatedTarget struct {
 func (e ErrNoDelegatedTarget) Error() string {
 	return fmt.Sprintf("tuf: no delegated target for path %s", e.Path)
 }
+
+type ErrAmbiguousTarget struct {
+	Path string
+}
+
+func (e ErrAmbiguousTarget) Error() string {
+	return fmt.Sprintf("tuf: several committed files for target %s, and none of them is the one in the targets metadata", e.Path)
+}
+
+type ErrNoDelegatedRole struct {
+	Delegator string
+	Role      string
+}
+
+func (e ErrNoDelegatedRole) Error() string {
+	return fmt.Sprintf("tuf: role %s is not delegated to by %s", e.Role, e.Delegator)
+}
+
+type ErrUnsupportedKeyType struct {
+	Type string
+}
+
+func (e ErrUnsupportedKeyType) Error() string {
+	return fmt.Sprintf("tuf: unsupported key type %s", e.Type)
+}
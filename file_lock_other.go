@@ -0,0 +1,10 @@
+//go:build !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd && !windows
+
+package tuf
+
+import "os"
+
+// lockFile is a no-op on platforms without file locking.
+func lockFile(f *os.File) error {
+	return nil
+}
@@ -0,0 +1,408 @@
+// Package s3 is a minimal client for the S3 API, covering what is needed to
+// publish and fetch a TUF repository in an S3-compatible bucket.
+//
+// Objects are addressed with path-style URLs (endpoint/bucket/key), which
+// AWS S3, MinIO and most other S3-compatible services support.
+package s3
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Config configures a Client.
+type Config struct {
+	// Endpoint is the base URL of the S3 API, e.g. https://s3.amazonaws.com
+	// or http://localhost:9000 for a local MinIO.
+	Endpoint string
+
+	// Region is the region of the bucket, which defaults to us-east-1.
+	Region string
+
+	Bucket string
+
+	// AccessKeyID and SecretAccessKey are the credentials requests are
+	// signed with. Requests are sent unsigned if they are empty, which is
+	// enough to read from a public bucket.
+	AccessKeyID     string
+	SecretAccessKey string
+
+	// SessionToken is set when using temporary credentials.
+	SessionToken string
+
+	// HTTPClient defaults to http.DefaultClient.
+	HTTPClient *http.Client
+}
+
+// Client makes requests to a single bucket.
+type Client struct {
+	cfg      Config
+	endpoint *url.URL
+	cli      *http.Client
+
+	// now returns the time requests are signed at.
+	now func() time.Time
+}
+
+// New returns a client for the bucket in cfg.
+func New(cfg Config) (*Client, error) {
+	if cfg.Bucket == "" {
+		return nil, errors.New("s3: missing bucket")
+	}
+	endpoint, err := url.Parse(strings.TrimSuffix(cfg.Endpoint, "/"))
+	if err != nil {
+		return nil, fmt.Errorf("s3: invalid endpoint %q: %w", cfg.Endpoint, err)
+	}
+	if endpoint.Scheme != "http" && endpoint.Scheme != "https" {
+		return nil, fmt.Errorf("s3: invalid endpoint %q: must be an http or https URL", cfg.Endpoint)
+	}
+	if cfg.Region == "" {
+		cfg.Region = "us-east-1"
+	}
+	cli := cfg.HTTPClient
+	if cli == nil {
+		cli = http.DefaultClient
+	}
+	return &Client{cfg: cfg, endpoint: endpoint, cli: cli, now: time.Now}, nil
+}
+
+// Error is an error response from the S3 API.
+type Error struct {
+	StatusCode int
+	Code       string `xml:"Code"`
+	Message    string `xml:"Message"`
+	Key        string `xml:"Key"`
+}
+
+func (e *Error) Error() string {
+	if e.Code == "" {
+		return fmt.Sprintf("s3: unexpected status code %d", e.StatusCode)
+	}
+	return fmt.Sprintf("s3: %s: %s (status code %d)", e.Code, e.Message, e.StatusCode)
+}
+
+// IsNotFound returns whether err reports that an object does not exist. A
+// missing bucket is not reported as a missing object.
+func IsNotFound(err error) bool {
+	var e *Error
+	return errors.As(err, &e) && e.StatusCode == http.StatusNotFound && e.Code != "NoSuchBucket"
+}
+
+// Object describes an object in the bucket.
+type Object struct {
+	Key  string `xml:"Key"`
+	Size int64  `xml:"Size"`
+}
+
+// PutOptions sets the headers stored with an object.
+type PutOptions struct {
+	ContentType  string
+	CacheControl string
+}
+
+func (o *PutOptions) setHeaders(h http.Header) {
+	if o == nil {
+		return
+	}
+	if o.ContentType != "" {
+		h.Set("Content-Type", o.ContentType)
+	}
+	if o.CacheControl != "" {
+		h.Set("Cache-Control", o.CacheControl)
+	}
+}
+
+// Get returns the content of the object and its length.
+func (c *Client) Get(ctx context.Context, key string) (io.ReadCloser, int64, error) {
+	return c.GetRange(ctx, key, 0)
+}
+
+// GetRange returns the content of the object from offset on, and the length
+// of that content.
+func (c *Client) GetRange(ctx context.Context, key string, offset int64) (io.ReadCloser, int64, error) {
+	header := http.Header{}
+	if offset > 0 {
+		header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+	res, err := c.do(ctx, http.MethodGet, key, nil, header, nil, 0)
+	if err != nil {
+		return nil, 0, err
+	}
+	if offset > 0 && res.StatusCode != http.StatusPartialContent {
+		res.Body.Close()
+		return nil, 0, fmt.Errorf("s3: range request for %s returned status code %d", key, res.StatusCode)
+	}
+	return res.Body, res.ContentLength, nil
+}
+
+// Head returns the size of the object.
+func (c *Client) Head(ctx context.Context, key string) (int64, error) {
+	res, err := c.do(ctx, http.MethodHead, key, nil, nil, nil, 0)
+	if err != nil {
+		return 0, err
+	}
+	res.Body.Close()
+	return res.ContentLength, nil
+}
+
+// Put uploads size bytes read from body to the object.
+func (c *Client) Put(ctx context.Context, key string, body io.Reader, size int64, opts *PutOptions) error {
+	header := http.Header{}
+	opts.setHeaders(header)
+	res, err := c.do(ctx, http.MethodPut, key, nil, header, body, size)
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+	return nil
+}
+
+// Copy copies the object srcKey to dstKey within the bucket, replacing the
+// headers stored with it by opts.
+func (c *Client) Copy(ctx context.Context, srcKey, dstKey string, opts *PutOptions) error {
+	header := http.Header{}
+	header.Set("X-Amz-Copy-Source", "/"+c.cfg.Bucket+"/"+escapePath(srcKey))
+	header.Set("X-Amz-Metadata-Directive", "REPLACE")
+	opts.setHeaders(header)
+	res, err := c.do(ctx, http.MethodPut, dstKey, nil, header, nil, 0)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	// A copy can fail after the response status has been sent, in which
+	// case the error is in the body.
+	b, err := io.ReadAll(res.Body)
+	if err != nil {
+		return err
+	}
+	if bytes.Contains(b, []byte("<Error>")) {
+		e := &Error{StatusCode: res.StatusCode}
+		if err := xml.Unmarshal(b, e); err != nil {
+			return err
+		}
+		return e
+	}
+	return nil
+}
+
+// Delete removes the object. Deleting an object that does not exist is not
+// an error.
+func (c *Client) Delete(ctx context.Context, key string) error {
+	res, err := c.do(ctx, http.MethodDelete, key, nil, nil, nil, 0)
+	if err != nil {
+		if IsNotFound(err) {
+			return nil
+		}
+		return err
+	}
+	res.Body.Close()
+	return nil
+}
+
+type listResult struct {
+	IsTruncated           bool     `xml:"IsTruncated"`
+	Contents              []Object `xml:"Contents"`
+	NextContinuationToken string   `xml:"NextContinuationToken"`
+}
+
+// List returns the objects with keys that start with prefix, sorted by key.
+// If delimiter is not empty, keys that contain it after the prefix are left
+// out, so that List("dir/", "/") lists the objects directly in dir/.
+func (c *Client) List(ctx context.Context, prefix, delimiter string) ([]Object, error) {
+	objects := []Object{}
+	token := ""
+	for {
+		query := url.Values{}
+		query.Set("list-type", "2")
+		query.Set("prefix", prefix)
+		if delimiter != "" {
+			query.Set("delimiter", delimiter)
+		}
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+		res, err := c.do(ctx, http.MethodGet, "", query, nil, nil, 0)
+		if err != nil {
+			return nil, err
+		}
+		result := &listResult{}
+		err = xml.NewDecoder(res.Body).Decode(result)
+		res.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("s3: invalid list response: %w", err)
+		}
+		objects = append(objects, result.Contents...)
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			break
+		}
+		token = result.NextContinuationToken
+	}
+	sort.Slice(objects, func(i, j int) bool { return objects[i].Key < objects[j].Key })
+	return objects, nil
+}
+
+// do sends a request for the object key, or for the bucket if key is empty,
+// and returns the response if it has a 2xx status code.
+func (c *Client) do(ctx context.Context, method, key string, query url.Values, header http.Header, body io.Reader, size int64) (*http.Response, error) {
+	escapedPath := c.endpoint.EscapedPath() + "/" + escapePath(c.cfg.Bucket)
+	if key != "" {
+		escapedPath += "/" + escapePath(key)
+	}
+	u := *c.endpoint
+	u.RawQuery = canonicalQuery(query)
+	u.Path, _ = url.PathUnescape(escapedPath)
+	u.RawPath = escapedPath
+
+	if body == nil {
+		body = http.NoBody
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	req.ContentLength = size
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	if c.cfg.AccessKeyID != "" {
+		c.sign(req, escapedPath, "UNSIGNED-PAYLOAD")
+	}
+
+	res, err := c.cli.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode >= 200 && res.StatusCode < 300 {
+		return res, nil
+	}
+	defer res.Body.Close()
+	e := &Error{StatusCode: res.StatusCode}
+	if b, err := io.ReadAll(io.LimitReader(res.Body, 64*1024)); err == nil && len(b) > 0 {
+		xml.Unmarshal(b, e)
+	}
+	return nil, e
+}
+
+// sign adds an AWS Signature Version 4 authorization header to req, with the
+// given hash of the payload. Requests are sent with UNSIGNED-PAYLOAD, so that
+// large targets can be streamed.
+func (c *Client) sign(req *http.Request, escapedPath, payloadHash string) {
+	now := c.now().UTC()
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	if c.cfg.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", c.cfg.SessionToken)
+	}
+
+	headers := map[string]string{"host": req.URL.Host}
+	for k, v := range req.Header {
+		k = strings.ToLower(k)
+		if strings.HasPrefix(k, "x-amz-") || k == "content-type" || k == "range" {
+			headers[k] = strings.TrimSpace(strings.Join(v, ","))
+		}
+	}
+	names := make([]string, 0, len(headers))
+	for k := range headers {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, k := range names {
+		canonicalHeaders.WriteString(k + ":" + headers[k] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		escapedPath,
+		req.URL.RawQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	scope := date + "/" + c.cfg.Region + "/s3/aws4_request"
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		amzDate,
+		scope,
+		hexSHA256([]byte(canonicalRequest)),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+c.cfg.SecretAccessKey), date)
+	key = hmacSHA256(key, c.cfg.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf(
+		"AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		c.cfg.AccessKeyID, scope, signedHeaders, signature,
+	))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+func hexSHA256(b []byte) string {
+	h := sha256.Sum256(b)
+	return hex.EncodeToString(h[:])
+}
+
+// escape percent-encodes everything but the characters S3 leaves unreserved.
+func escape(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		ch := s[i]
+		if ('A' <= ch && ch <= 'Z') || ('a' <= ch && ch <= 'z') || ('0' <= ch && ch <= '9') ||
+			ch == '-' || ch == '_' || ch == '.' || ch == '~' {
+			b.WriteByte(ch)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", ch)
+		}
+	}
+	return b.String()
+}
+
+// escapePath escapes each segment of a slash separated path.
+func escapePath(p string) string {
+	segments := strings.Split(p, "/")
+	for i, s := range segments {
+		segments[i] = escape(s)
+	}
+	return strings.Join(segments, "/")
+}
+
+// canonicalQuery encodes query sorted by key, as signatures require.
+func canonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	parts := make([]string, 0, len(keys))
+	for _, k := range keys {
+		for _, v := range query[k] {
+			parts = append(parts, escape(k)+"="+escape(v))
+		}
+	}
+	return strings.Join(parts, "&")
+}
@@ -0,0 +1,285 @@
+// Package s3test provides an in-process fake of the parts of the S3 API the
+// s3 package uses, for tests.
+package s3test
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Object is an object stored by a Server.
+type Object struct {
+	Data         []byte
+	ContentType  string
+	CacheControl string
+}
+
+// Server is a fake S3 API serving a single bucket with path-style URLs.
+type Server struct {
+	*httptest.Server
+
+	Bucket string
+
+	// AccessKeyID, if set, is the only access key requests may be signed
+	// with. Unsigned requests may only read objects, unless Private is set.
+	// Signatures themselves are not checked.
+	AccessKeyID string
+	Private     bool
+
+	// MaxKeys is the number of objects returned per page of a list, which
+	// defaults to 1000 as in S3.
+	MaxKeys int
+
+	// FailRequest, if set, is called before each request is handled, and
+	// the request fails with the status code it returns unless that is 0.
+	FailRequest func(r *http.Request, key string) int
+
+	mu      sync.Mutex
+	objects map[string]*Object
+	writes  []string
+}
+
+// NewServer starts a fake S3 API for the bucket.
+func NewServer(bucket string) *Server {
+	s := &Server{Bucket: bucket, objects: make(map[string]*Object)}
+	s.Server = httptest.NewServer(s)
+	return s
+}
+
+// Object returns the object stored under key, or nil if there is none.
+func (s *Server) Object(key string) *Object {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.objects[key]
+}
+
+// PutObject stores data under key.
+func (s *Server) PutObject(key string, data []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.objects[key] = &Object{Data: data}
+}
+
+// Keys returns the sorted keys of the stored objects.
+func (s *Server) Keys() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	keys := make([]string, 0, len(s.objects))
+	for key := range s.objects {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Writes returns the writes made to the bucket since the last call, as
+// "PUT key" and "DELETE key", in the order they were made. Copies are
+// reported as puts of the destination key.
+func (s *Server) Writes() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	writes := s.writes
+	s.writes = nil
+	return writes
+}
+
+type errorResponse struct {
+	XMLName xml.Name `xml:"Error"`
+	Code    string   `xml:"Code"`
+	Message string   `xml:"Message"`
+	Key     string   `xml:"Key,omitempty"`
+}
+
+func writeError(w http.ResponseWriter, status int, code, message, key string) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	xml.NewEncoder(w).Encode(errorResponse{Code: code, Message: message, Key: key})
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	if bucket != s.Bucket {
+		writeError(w, http.StatusNotFound, "NoSuchBucket", "The specified bucket does not exist", "")
+		return
+	}
+	if s.FailRequest != nil {
+		if status := s.FailRequest(r, key); status != 0 {
+			writeError(w, status, "InternalError", "injected failure", key)
+			return
+		}
+	}
+
+	if s.AccessKeyID != "" {
+		auth := r.Header.Get("Authorization")
+		signed := strings.HasPrefix(auth, "AWS4-HMAC-SHA256 Credential="+s.AccessKeyID+"/")
+		read := (r.Method == http.MethodGet || r.Method == http.MethodHead) && !s.Private
+		if !signed && (auth != "" || !read) {
+			writeError(w, http.StatusForbidden, "AccessDenied", "Access Denied", key)
+			return
+		}
+	}
+
+	switch {
+	case key == "" && r.Method == http.MethodGet:
+		s.list(w, r)
+	case key == "":
+		writeError(w, http.StatusMethodNotAllowed, "MethodNotAllowed", "The specified method is not allowed", "")
+	case r.Method == http.MethodGet || r.Method == http.MethodHead:
+		s.get(w, r, key)
+	case r.Method == http.MethodPut && r.Header.Get("X-Amz-Copy-Source") != "":
+		s.copy(w, r, key)
+	case r.Method == http.MethodPut:
+		s.put(w, r, key)
+	case r.Method == http.MethodDelete:
+		s.mu.Lock()
+		delete(s.objects, key)
+		s.writes = append(s.writes, "DELETE "+key)
+		s.mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "MethodNotAllowed", "The specified method is not allowed", key)
+	}
+}
+
+func (s *Server) get(w http.ResponseWriter, r *http.Request, key string) {
+	obj := s.Object(key)
+	if obj == nil {
+		writeError(w, http.StatusNotFound, "NoSuchKey", "The specified key does not exist.", key)
+		return
+	}
+	data := obj.Data
+	status := http.StatusOK
+	if rng := r.Header.Get("Range"); rng != "" {
+		offset, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(rng, "bytes="), "-"))
+		if err != nil || offset >= len(data) {
+			writeError(w, http.StatusRequestedRangeNotSatisfiable, "InvalidRange", "The requested range is not satisfiable", key)
+			return
+		}
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", offset, len(data)-1, len(data)))
+		data = data[offset:]
+		status = http.StatusPartialContent
+	}
+	if obj.ContentType != "" {
+		w.Header().Set("Content-Type", obj.ContentType)
+	}
+	if obj.CacheControl != "" {
+		w.Header().Set("Cache-Control", obj.CacheControl)
+	}
+	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	w.WriteHeader(status)
+	if r.Method == http.MethodGet {
+		w.Write(data)
+	}
+}
+
+func (s *Server) put(w http.ResponseWriter, r *http.Request, key string) {
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "IncompleteBody", err.Error(), key)
+		return
+	}
+	s.mu.Lock()
+	s.objects[key] = &Object{
+		Data:         data,
+		ContentType:  r.Header.Get("Content-Type"),
+		CacheControl: r.Header.Get("Cache-Control"),
+	}
+	s.writes = append(s.writes, "PUT "+key)
+	s.mu.Unlock()
+}
+
+func (s *Server) copy(w http.ResponseWriter, r *http.Request, key string) {
+	source, err := url.PathUnescape(r.Header.Get("X-Amz-Copy-Source"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "InvalidArgument", "invalid copy source", key)
+		return
+	}
+	srcBucket, srcKey, _ := strings.Cut(strings.TrimPrefix(source, "/"), "/")
+	src := s.Object(srcKey)
+	if srcBucket != s.Bucket || src == nil {
+		writeError(w, http.StatusNotFound, "NoSuchKey", "The specified key does not exist.", srcKey)
+		return
+	}
+	obj := &Object{Data: src.Data, ContentType: src.ContentType, CacheControl: src.CacheControl}
+	if r.Header.Get("X-Amz-Metadata-Directive") == "REPLACE" {
+		obj.ContentType = r.Header.Get("Content-Type")
+		obj.CacheControl = r.Header.Get("Cache-Control")
+	}
+	s.mu.Lock()
+	s.objects[key] = obj
+	s.writes = append(s.writes, "PUT "+key)
+	s.mu.Unlock()
+	w.Header().Set("Content-Type", "application/xml")
+	fmt.Fprint(w, `<CopyObjectResult></CopyObjectResult>`)
+}
+
+type listContents struct {
+	Key  string `xml:"Key"`
+	Size int    `xml:"Size"`
+}
+
+type listResult struct {
+	XMLName               xml.Name       `xml:"ListBucketResult"`
+	Name                  string         `xml:"Name"`
+	Prefix                string         `xml:"Prefix"`
+	KeyCount              int            `xml:"KeyCount"`
+	IsTruncated           bool           `xml:"IsTruncated"`
+	Contents              []listContents `xml:"Contents"`
+	CommonPrefixes        []string       `xml:"CommonPrefixes>Prefix"`
+	NextContinuationToken string         `xml:"NextContinuationToken,omitempty"`
+}
+
+func (s *Server) list(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	if query.Get("list-type") != "2" {
+		writeError(w, http.StatusNotImplemented, "NotImplemented", "only ListObjectsV2 is supported", "")
+		return
+	}
+	prefix := query.Get("prefix")
+	delimiter := query.Get("delimiter")
+	after := query.Get("continuation-token")
+	maxKeys := s.MaxKeys
+	if maxKeys <= 0 {
+		maxKeys = 1000
+	}
+
+	result := listResult{Name: s.Bucket, Prefix: prefix}
+	commonPrefixes := map[string]struct{}{}
+	for _, key := range s.Keys() {
+		if !strings.HasPrefix(key, prefix) || key <= after {
+			continue
+		}
+		if delimiter != "" {
+			if i := strings.Index(key[len(prefix):], delimiter); i >= 0 {
+				commonPrefixes[key[:len(prefix)+i+len(delimiter)]] = struct{}{}
+				continue
+			}
+		}
+		if len(result.Contents) == maxKeys {
+			result.IsTruncated = true
+			result.NextContinuationToken = result.Contents[len(result.Contents)-1].Key
+			break
+		}
+		obj := s.Object(key)
+		if obj == nil {
+			continue
+		}
+		result.Contents = append(result.Contents, listContents{Key: key, Size: len(obj.Data)})
+	}
+	for p := range commonPrefixes {
+		result.CommonPrefixes = append(result.CommonPrefixes, p)
+	}
+	sort.Strings(result.CommonPrefixes)
+	result.KeyCount = len(result.Contents)
+
+	w.Header().Set("Content-Type", "application/xml")
+	xml.NewEncoder(w).Encode(result)
+}
@@ -0,0 +1,49 @@
+// Package signertest implements an external signing command for testing
+// keys.CommandSigner.
+package signertest
+
+import (
+	"crypto/ed25519"
+	"encoding/hex"
+	"io"
+	"os"
+)
+
+// HelperProcess signs its standard input with the ed25519 private key given
+// as a hex argument after "--", and exits, when the test binary is run as a
+// signing command. It returns straight away otherwise.
+//
+// It is meant to be called from a test function, which is run as the
+// command by Command.
+func HelperProcess() {
+	if os.Getenv("TUF_SIGNER_KEYID") == "" {
+		return
+	}
+	defer os.Exit(0)
+
+	args := os.Args
+	for len(args) > 0 && args[0] != "--" {
+		args = args[1:]
+	}
+	if len(args) != 2 {
+		os.Stderr.WriteString("missing private key")
+		os.Exit(2)
+	}
+	priv, err := hex.DecodeString(args[1])
+	if err != nil {
+		os.Stderr.WriteString(err.Error())
+		os.Exit(2)
+	}
+	msg, err := io.ReadAll(os.Stdin)
+	if err != nil {
+		os.Stderr.WriteString(err.Error())
+		os.Exit(2)
+	}
+	os.Stdout.Write(ed25519.Sign(ed25519.PrivateKey(priv), msg))
+}
+
+// Command returns the command that runs the test function test of the
+// current test binary, which calls HelperProcess, to sign with priv.
+func Command(test string, priv ed25519.PrivateKey) []string {
+	return []string{os.Args[0], "-test.run=^" + test + "$", "--", hex.EncodeToString(priv)}
+}
@@ -9,11 +9,14 @@ import (
 	"io/fs"
 	"io/ioutil"
 	"os"
+	"path"
 	"path/filepath"
+	"sort"
 	"strings"
 
 	"github.com/theupdateframework/go-tuf/data"
 	"github.com/theupdateframework/go-tuf/encrypted"
+	"github.com/theupdateframework/go-tuf/internal/roles"
 	"github.com/theupdateframework/go-tuf/internal/sets"
 	"github.com/theupdateframework/go-tuf/pkg/keys"
 	"github.com/theupdateframework/go-tuf/util"
@@ -36,6 +39,10 @@ type LocalStore interface {
 
 	// Commit is used to publish staged files to the repository
 	//
+	// The metadata of delegated targets roles missing from the versions,
+	// which are no longer delegated to, and the target files missing from
+	// the hashes are removed from the repository.
+	//
 	// This will also reset the staged meta to signal incrementing version numbers.
 	// TUF 1.0 requires that the root metadata version numbers in the repository does not
 	// gaps. To avoid this, we will only increment the number once until we commit.
@@ -61,6 +68,44 @@ type PassphraseChanger interface {
 	ChangePassphrase(string) error
 }
 
+// CommittedTargetsWalker is implemented by stores that can list the target
+// files already committed to the repository, which is needed to regenerate
+// the targets metadata.
+type CommittedTargetsWalker interface {
+	// WalkCommittedTargets calls targetsFn for each committed target file.
+	// The path is relative to the targets directory and is the name the file
+	// is stored under, so it includes the hash prefix when the repository
+	// uses consistent snapshots.
+	WalkCommittedTargets(targetsFn TargetsWalkFunc) error
+}
+
+// CommittedMetaGetter is implemented by stores that can return the metadata
+// committed to the repository without any staged changes, which is needed to
+// show what the staged changes are.
+type CommittedMetaGetter interface {
+	// GetCommittedMeta returns a map from committed metadata file names
+	// (e.g. root.json) to their raw JSON payload or an error.
+	GetCommittedMeta() (map[string]json.RawMessage, error)
+}
+
+// RepoLocker is implemented by stores that can lock the repository, so that
+// changes made by several processes, such as an OnlineRolesSigner and an
+// operator, are not interleaved.
+type RepoLocker interface {
+	// Lock takes an exclusive lock on the repository, failing with
+	// ErrRepoLocked if another process holds it, and returns a function
+	// that releases it.
+	Lock() (unlock func() error, err error)
+}
+
+// StagedMetaRemover is implemented by stores that can remove a single staged
+// metadata file, leaving the other staged files alone.
+type StagedMetaRemover interface {
+	// RemoveStagedMeta removes the staged metadata file name, if it is
+	// staged.
+	RemoveStagedMeta(name string) error
+}
+
 func MemoryStore(meta map[string]json.RawMessage, files map[string][]byte) LocalStore {
 	if meta == nil {
 		meta = make(map[string]json.RawMessage)
@@ -94,6 +139,14 @@ func (m *memoryStore) GetMeta() (map[string]json.RawMessage, error) {
 	return meta, nil
 }
 
+func (m *memoryStore) GetCommittedMeta() (map[string]json.RawMessage, error) {
+	meta := make(map[string]json.RawMessage, len(m.meta))
+	for key, value := range m.meta {
+		meta[key] = value
+	}
+	return meta, nil
+}
+
 func (m *memoryStore) SetMeta(name string, meta json.RawMessage) error {
 	m.stagedMeta[name] = meta
 	return nil
@@ -104,6 +157,11 @@ func (m *memoryStore) FileIsStaged(name string) bool {
 	return ok
 }
 
+func (m *memoryStore) RemoveStagedMeta(name string) error {
+	delete(m.stagedMeta, name)
+	return nil
+}
+
 func (m *memoryStore) WalkStagedTargets(paths []string, targetsFn TargetsWalkFunc) error {
 	if len(paths) == 0 {
 		for path, data := range m.files {
@@ -127,7 +185,16 @@ func (m *memoryStore) WalkStagedTargets(paths []string, targetsFn TargetsWalkFun
 }
 
 func (m *memoryStore) Commit(consistentSnapshot bool, versions map[string]int64, hashes map[string]data.Hashes) error {
+	for name := range m.meta {
+		if metaNeedsRemoval(name, versions) {
+			delete(m.meta, name)
+		}
+	}
 	for name, meta := range m.stagedMeta {
+		if metaNeedsRemoval(name, versions) {
+			delete(m.stagedMeta, name)
+			continue
+		}
 		paths := computeMetadataPaths(consistentSnapshot, name, versions)
 		for _, path := range paths {
 			m.meta[path] = meta
@@ -210,6 +277,15 @@ type fileSystemStore struct {
 	dir            string
 	passphraseFunc util.PassphraseFunc
 
+	// generations makes commits build a new generation of the repository
+	// and switch to it, see FileSystemStoreWithGenerations.
+	generations bool
+
+	// publishHook, if set, is called before each staged file is published
+	// by a commit, and the commit stops if it returns an error. It is set
+	// by tests.
+	publishHook func(path string) error
+
 	signerForKeyID map[string]keys.Signer
 	keyIDsForRole  map[string][]string
 }
@@ -239,41 +315,45 @@ func (f *fileSystemStore) GetMeta() (map[string]json.RawMessage, error) {
 	// Build a map of metadata names (e.g. root.json) to their full paths
 	// (whether in the committed repo dir, or in the staged repo dir).
 	metaPaths := map[string]string{}
-
-	rd := f.repoDir()
-	committed, err := os.ReadDir(f.repoDir())
-	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+	if err := addMetaPaths(metaPaths, f.repoDir()); err != nil {
 		return nil, fmt.Errorf("could not list repo dir: %w", err)
 	}
+	if err := addMetaPaths(metaPaths, f.stagedDir()); err != nil {
+		return nil, fmt.Errorf("could not list staged dir: %w", err)
+	}
+	return readMetaPaths(metaPaths)
+}
 
-	for _, e := range committed {
-		imf, err := isMetaFile(e)
-		if err != nil {
-			return nil, err
-		}
-		if imf {
-			name := e.Name()
-			metaPaths[name] = filepath.Join(rd, name)
-		}
+func (f *fileSystemStore) GetCommittedMeta() (map[string]json.RawMessage, error) {
+	metaPaths := map[string]string{}
+	if err := addMetaPaths(metaPaths, f.repoDir()); err != nil {
+		return nil, fmt.Errorf("could not list repo dir: %w", err)
 	}
+	return readMetaPaths(metaPaths)
+}
 
-	sd := f.stagedDir()
-	staged, err := os.ReadDir(sd)
+// addMetaPaths adds the names of the metadata files in dir to metaPaths,
+// mapped to their full paths. A missing dir has no metadata files.
+func addMetaPaths(metaPaths map[string]string, dir string) error {
+	entries, err := os.ReadDir(dir)
 	if err != nil && !errors.Is(err, fs.ErrNotExist) {
-		return nil, fmt.Errorf("could not list staged dir: %w", err)
+		return err
 	}
 
-	for _, e := range staged {
+	for _, e := range entries {
 		imf, err := isMetaFile(e)
 		if err != nil {
-			return nil, err
+			return err
 		}
 		if imf {
 			name := e.Name()
-			metaPaths[name] = filepath.Join(sd, name)
+			metaPaths[name] = filepath.Join(dir, name)
 		}
 	}
+	return nil
+}
 
+func readMetaPaths(metaPaths map[string]string) (map[string]json.RawMessage, error) {
 	meta := make(map[string]json.RawMessage)
 	for name, path := range metaPaths {
 		f, err := ioutil.ReadFile(path)
@@ -300,6 +380,35 @@ func (f *fileSystemStore) FileIsStaged(name string) bool {
 	return err == nil
 }
 
+func (f *fileSystemStore) RemoveStagedMeta(name string) error {
+	if err := os.Remove(filepath.Join(f.stagedDir(), name)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// lockFileName is the name of the file locked by Lock, in the directory of
+// the store.
+const lockFileName = ".lock"
+
+// Lock takes an exclusive lock on the file .lock in the directory of the
+// store. The lock is held until the returned function is called, or the
+// process exits.
+func (f *fileSystemStore) Lock() (func() error, error) {
+	if err := os.MkdirAll(f.dir, 0755); err != nil {
+		return nil, err
+	}
+	lock, err := os.OpenFile(filepath.Join(f.dir, lockFileName), os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	if err := lockFile(lock); err != nil {
+		lock.Close()
+		return nil, ErrRepoLocked{f.dir, err}
+	}
+	return lock.Close, nil
+}
+
 func (f *fileSystemStore) createDirs() error {
 	for _, dir := range []string{"keys", "repository", "staged/targets"} {
 		if err := os.MkdirAll(filepath.Join(f.dir, dir), 0755); err != nil {
@@ -361,19 +470,99 @@ func (f *fileSystemStore) WalkStagedTargets(paths []string, targetsFn TargetsWal
 	return nil
 }
 
-func (f *fileSystemStore) createRepoFile(path string) (*os.File, error) {
-	dst := filepath.Join(f.repoDir(), path)
-	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
-		return nil, err
+func (f *fileSystemStore) WalkCommittedTargets(targetsFn TargetsWalkFunc) error {
+	targetsDir := filepath.Join(f.repoDir(), "targets")
+	walkFunc := func(fpath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || !info.Mode().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(targetsDir, fpath)
+		if err != nil {
+			return err
+		}
+		file, err := os.Open(fpath)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		return targetsFn(filepath.ToSlash(rel), file)
 	}
-	return os.Create(dst)
+	if err := filepath.Walk(targetsDir, walkFunc); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func (f *fileSystemStore) commitDir() string {
+	return filepath.Join(f.dir, "commit")
+}
+
+func (f *fileSystemStore) commitJournalPath() string {
+	return filepath.Join(f.commitDir(), "journal.json")
+}
+
+// commitJournal lists the changes a commit makes to the repository. Once it
+// has been written, the commit is carried out even if it is interrupted.
+type commitJournal struct {
+	// Publish lists the files to move from the commit directory into the
+	// repository, in order.
+	Publish []string `json:"publish"`
+
+	// Remove lists the target files to remove from the repository.
+	Remove []string `json:"remove"`
 }
 
+// Commit publishes the staged files to the repository in two phases, so that
+// an interrupted commit can be finished or rolled back:
+//
+//  1. The staged files are copied under the commit directory, and a journal
+//     listing the files to publish and the targets to remove is written.
+//  2. The files are moved into the repository one by one: target files
+//     first, then metadata, with snapshot.json and lastly timestamp.json at
+//     the end. As clients start updating from timestamp.json, they do not
+//     see the new metadata until everything it refers to is in place. Then
+//     the removed targets are deleted, and the staged files are cleaned.
+//
+// If the commit is interrupted before the journal is written, the next
+// commit rolls it back by removing the commit directory. If it is
+// interrupted after that, the next commit finishes it first.
+//
+// The files are replaced in place, so readers of the repository may see a
+// mix of old and new files while a commit runs. A store created with
+// FileSystemStoreWithGenerations switches to the new files at once instead.
 func (f *fileSystemStore) Commit(consistentSnapshot bool, versions map[string]int64, hashes map[string]data.Hashes) error {
+	if f.generations {
+		return f.commitGeneration(consistentSnapshot, versions, hashes)
+	}
+	if err := f.recoverCommit(); err != nil {
+		return err
+	}
+	if err := f.prepareCommit(consistentSnapshot, versions, hashes); err != nil {
+		os.RemoveAll(f.commitDir())
+		return err
+	}
+	if err := f.finishCommit(); err != nil {
+		return err
+	}
+	return f.Clean()
+}
+
+// prepareCommit copies the staged files under the commit directory and writes
+// the commit journal.
+func (f *fileSystemStore) prepareCommit(consistentSnapshot bool, versions map[string]int64, hashes map[string]data.Hashes) error {
 	isTarget := func(path string) bool {
 		return strings.HasPrefix(path, "targets/")
 	}
-	copyToRepo := func(fpath string, info os.FileInfo, err error) error {
+	filesDir := filepath.Join(f.commitDir(), "files")
+	journal := &commitJournal{
+		Publish: []string{},
+		Remove:  []string{},
+	}
+
+	copyToCommit := func(fpath string, info os.FileInfo, err error) error {
 		if err != nil {
 			return err
 		}
@@ -389,82 +578,193 @@ func (f *fileSystemStore) Commit(consistentSnapshot bool, versions map[string]in
 		var paths []string
 		if isTarget(relpath) {
 			paths = computeTargetPaths(consistentSnapshot, relpath, hashes)
-		} else {
+		} else if !metaNeedsRemoval(relpath, versions) {
 			paths = computeMetadataPaths(consistentSnapshot, relpath, versions)
 		}
-		var files []io.Writer
 		for _, path := range paths {
-			file, err := f.createRepoFile(path)
-			if err != nil {
+			if err := copyFileSync(fpath, filepath.Join(filesDir, filepath.FromSlash(path))); err != nil {
 				return err
 			}
-			defer file.Close()
-			files = append(files, file)
 		}
-		staged, err := os.Open(fpath)
+		journal.Publish = append(journal.Publish, paths...)
+		return nil
+	}
+	findRemoved := func(fpath string, info os.FileInfo, err error) error {
 		if err != nil {
 			return err
 		}
-		defer staged.Close()
-		if _, err = io.Copy(io.MultiWriter(files...), staged); err != nil {
+		rel, err := filepath.Rel(f.repoDir(), fpath)
+		if err != nil {
 			return err
 		}
+		relpath := filepath.ToSlash(rel)
+		if info.IsDir() {
+			return nil
+		}
+		if isTarget(relpath) && targetNeedsRemoval(consistentSnapshot, relpath, hashes) ||
+			!isTarget(relpath) && metaNeedsRemoval(relpath, versions) {
+			journal.Remove = append(journal.Remove, relpath)
+		}
 		return nil
 	}
-	// Checks if target file should be deleted
-	needsRemoval := func(fpath string) bool {
-		if consistentSnapshot {
-			// strip out the hash
-			name := strings.SplitN(filepath.Base(fpath), ".", 2)
-			if len(name) != 2 || name[1] == "" {
-				return false
+
+	if err := os.RemoveAll(f.commitDir()); err != nil {
+		return err
+	}
+	if err := filepath.Walk(f.stagedDir(), copyToCommit); err != nil {
+		return err
+	}
+	if err := filepath.Walk(f.repoDir(), findRemoved); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	sort.SliceStable(journal.Publish, func(i, j int) bool {
+		return publishOrder(journal.Publish[i]) < publishOrder(journal.Publish[j])
+	})
+	b, err := json.Marshal(journal)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(f.commitDir(), 0755); err != nil {
+		return err
+	}
+	if err := util.AtomicallyWriteFile(f.commitJournalPath(), b, 0644); err != nil {
+		return err
+	}
+	syncDir(f.commitDir())
+	return nil
+}
+
+// publishOrder ranks the paths of a commit in the order they are published.
+// Versioned metadata comes before the metadata clients find it through.
+func publishOrder(path string) int {
+	if strings.HasPrefix(path, "targets/") {
+		return 0
+	}
+	_, name, versioned := parseVersionedName(path)
+	if !versioned {
+		name = path
+	}
+	order := 1
+	switch name {
+	case "snapshot.json":
+		order = 3
+	case "timestamp.json":
+		order = 5
+	}
+	if !versioned {
+		order++
+	}
+	return order
+}
+
+// finishCommit carries out the commit journal by publishing its files and
+// removing its targets, then removes the commit directory. It can be run
+// again if it is interrupted.
+func (f *fileSystemStore) finishCommit() error {
+	b, err := os.ReadFile(f.commitJournalPath())
+	if err != nil {
+		return err
+	}
+	journal := &commitJournal{}
+	if err := json.Unmarshal(b, journal); err != nil {
+		return fmt.Errorf("tuf: invalid commit journal %s: %w", f.commitJournalPath(), err)
+	}
+
+	filesDir := filepath.Join(f.commitDir(), "files")
+	for _, path := range journal.Publish {
+		if f.publishHook != nil {
+			if err := f.publishHook(path); err != nil {
+				return err
 			}
-			fpath = filepath.Join(filepath.Dir(fpath), name[1])
 		}
-		_, ok := hashes[filepath.ToSlash(fpath)]
-		return !ok
-	}
-	// Checks if folder is empty
-	folderNeedsRemoval := func(fpath string) bool {
-		f, err := os.Open(fpath)
-		if err != nil {
-			return false
+		src := filepath.Join(filesDir, filepath.FromSlash(path))
+		if _, err := os.Stat(src); os.IsNotExist(err) {
+			// published before the commit was interrupted
+			continue
 		}
-		defer f.Close()
-		_, err = f.Readdirnames(1)
-		return err == io.EOF
-	}
-	removeFile := func(fpath string, info os.FileInfo, err error) error {
-		if err != nil {
+		dst := filepath.Join(f.repoDir(), filepath.FromSlash(path))
+		if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
 			return err
 		}
-		rel, err := filepath.Rel(f.repoDir(), fpath)
-		if err != nil {
+		if err := os.Rename(src, dst); err != nil {
 			return err
 		}
-		relpath := filepath.ToSlash(rel)
-		if !info.IsDir() && isTarget(relpath) && needsRemoval(rel) {
-			// Delete the target file
-			if err := os.Remove(fpath); err != nil {
+		syncDir(filepath.Dir(dst))
+	}
+
+	for _, path := range journal.Remove {
+		fpath := filepath.Join(f.repoDir(), filepath.FromSlash(path))
+		if err := os.Remove(fpath); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		// Delete the target folder too if it's empty
+		if targetFolder := filepath.Dir(fpath); folderIsEmpty(targetFolder) {
+			if err := os.Remove(targetFolder); err != nil {
 				return err
 			}
-			// Delete the target folder too if it's empty
-			targetFolder := filepath.Dir(fpath)
-			if folderNeedsRemoval(targetFolder) {
-				if err := os.Remove(targetFolder); err != nil {
-					return err
-				}
-			}
 		}
-		return nil
 	}
-	if err := filepath.Walk(f.stagedDir(), copyToRepo); err != nil {
+
+	return os.RemoveAll(f.commitDir())
+}
+
+// recoverCommit finishes a commit that was interrupted after its journal was
+// written, or rolls it back if it was interrupted before. The staged files
+// are left alone, as they may have been changed since.
+func (f *fileSystemStore) recoverCommit() error {
+	if _, err := os.Stat(f.commitJournalPath()); err == nil {
+		return f.finishCommit()
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+	return os.RemoveAll(f.commitDir())
+}
+
+func folderIsEmpty(fpath string) bool {
+	f, err := os.Open(fpath)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	_, err = f.Readdirnames(1)
+	return err == io.EOF
+}
+
+// copyFileSync copies src to dst, and flushes dst to disk.
+func copyFileSync(src, dst string) error {
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
 		return err
 	}
-	if err := filepath.Walk(f.repoDir(), removeFile); err != nil {
+	in, err := os.Open(src)
+	if err != nil {
 		return err
 	}
-	return f.Clean()
+	defer in.Close()
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Sync(); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// syncDir flushes the entries of a directory to disk. This is not supported
+// on all platforms, so it is done on a best effort basis.
+func syncDir(dir string) {
+	d, err := os.Open(dir)
+	if err != nil {
+		return
+	}
+	d.Sync()
+	d.Close()
 }
 
 func (f *fileSystemStore) GetSigners(role string) ([]keys.Signer, error) {
@@ -682,6 +982,11 @@ func (f *fileSystemStore) keysPath(role string) string {
 }
 
 func (f *fileSystemStore) Clean() error {
+	if f.generations {
+		if err := f.recoverGenerations(); err != nil {
+			return err
+		}
+	}
 	_, err := os.Stat(filepath.Join(f.repoDir(), "root.json"))
 	if os.IsNotExist(err) {
 		return ErrNewRepository
@@ -694,6 +999,41 @@ func (f *fileSystemStore) Clean() error {
 	return os.MkdirAll(filepath.Join(f.stagedDir(), "targets"), 0755)
 }
 
+// metaNeedsRemoval returns whether the metadata file at relpath, e.g.
+// "role.json" or "1.role.json", is of a delegated targets role missing from
+// versions, which is no longer delegated to and should be removed by a
+// commit.
+func metaNeedsRemoval(relpath string, versions map[string]int64) bool {
+	if strings.Contains(relpath, "/") || path.Ext(relpath) != ".json" {
+		return false
+	}
+	name := relpath
+	if _, unversioned, ok := parseVersionedName(relpath); ok {
+		name = unversioned
+	}
+	if roles.IsTopLevelManifest(name) {
+		return false
+	}
+	_, ok := versions[name]
+	return !ok
+}
+
+// targetNeedsRemoval returns whether the committed target file at relpath,
+// e.g. "targets/foo.txt", is no longer listed in hashes and should be
+// removed by a commit.
+func targetNeedsRemoval(consistentSnapshot bool, relpath string, hashes map[string]data.Hashes) bool {
+	if consistentSnapshot {
+		// strip out the hash
+		name := strings.SplitN(path.Base(relpath), ".", 2)
+		if len(name) != 2 || name[1] == "" {
+			return false
+		}
+		relpath = path.Join(path.Dir(relpath), name[1])
+	}
+	_, ok := hashes[relpath]
+	return !ok
+}
+
 func computeTargetPaths(consistentSnapshot bool, name string, hashes map[string]data.Hashes) []string {
 	if consistentSnapshot {
 		return util.HashedPaths(name, hashes[name])
@@ -0,0 +1,342 @@
+package tuf
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/theupdateframework/go-tuf/data"
+	"github.com/theupdateframework/go-tuf/pkg/keys"
+	"github.com/theupdateframework/go-tuf/util"
+)
+
+// FileSystemStoreWithGenerations returns a LocalStore like FileSystemStore,
+// whose commits switch the repository to the new files at once, so that
+// readers of the repository never see a mix of old and new files.
+//
+// Each commit builds a new generation of the repository under the
+// "generations" directory, then replaces "repository" with a symlink to it.
+// This changes the layout of the repository: tools that walk or sync
+// "repository" must follow the symlink, for example by resolving it with
+// filepath.EvalSymlinks first, as filepath.Walk does not descend into a
+// symlinked root. The committed files are linked, or copied where hard
+// links are not supported, into every new generation, so a commit takes
+// time in proportion to the number of committed files.
+func FileSystemStoreWithGenerations(dir string, p util.PassphraseFunc) LocalStore {
+	return &fileSystemStore{
+		dir:            dir,
+		passphraseFunc: p,
+		generations:    true,
+		signerForKeyID: make(map[string]keys.Signer),
+		keyIDsForRole:  make(map[string][]string),
+	}
+}
+
+func (f *fileSystemStore) generationsDir() string {
+	return filepath.Join(f.dir, "generations")
+}
+
+// commitGeneration publishes the staged files by building a new generation of
+// the repository and switching to it at once:
+//
+//  1. The committed files that are kept are linked, or copied, into a new
+//     directory under "generations". The staged files are then copied into
+//     it in the order given by publishOrder, with the target files first
+//     and timestamp.json last.
+//  2. "repository", which is a symlink to the current generation, is
+//     atomically replaced with a symlink to the new one, and the previous
+//     generation and the staged files are removed.
+//
+// An interrupted commit leaves the repository as it was, and the partial
+// generation it leaves behind is removed by the next commit, or by Clean.
+//
+// The first commit to a repository whose "repository" is a plain directory
+// moves it into "generations", which makes it briefly missing. If that
+// commit is interrupted, the next commit or Clean finishes the switch. Where
+// symlinks are not supported, every commit renames the previous and the new
+// generations in turn instead, and an interrupted commit is rolled back.
+func (f *fileSystemStore) commitGeneration(consistentSnapshot bool, versions map[string]int64, hashes map[string]data.Hashes) error {
+	if err := f.recoverGenerations(); err != nil {
+		return err
+	}
+	gen, err := f.buildGeneration(consistentSnapshot, versions, hashes)
+	if err != nil {
+		return err
+	}
+	if err := f.switchGeneration(gen); err != nil {
+		return err
+	}
+	return f.Clean()
+}
+
+// buildGeneration creates a new generation of the repository, with the
+// committed files that are kept and the staged files, and returns its path.
+func (f *fileSystemStore) buildGeneration(consistentSnapshot bool, versions map[string]int64, hashes map[string]data.Hashes) (string, error) {
+	isTarget := func(path string) bool {
+		return strings.HasPrefix(path, "targets/")
+	}
+	gen, err := f.newGenerationDir()
+	if err != nil {
+		return "", err
+	}
+
+	// Link the committed files, leaving out the removed targets and
+	// metadata.
+	linkCommitted := func(root string) filepath.WalkFunc {
+		return func(fpath string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if info.IsDir() || !info.Mode().IsRegular() {
+				return nil
+			}
+			rel, err := filepath.Rel(root, fpath)
+			if err != nil {
+				return err
+			}
+			relpath := filepath.ToSlash(rel)
+			if isTarget(relpath) && targetNeedsRemoval(consistentSnapshot, relpath, hashes) ||
+				!isTarget(relpath) && metaNeedsRemoval(relpath, versions) {
+				return nil
+			}
+			return linkOrCopyFile(fpath, filepath.Join(gen, rel))
+		}
+	}
+	if root, err := filepath.EvalSymlinks(f.repoDir()); err == nil {
+		if err := filepath.Walk(root, linkCommitted(root)); err != nil {
+			return "", err
+		}
+	} else if !os.IsNotExist(err) {
+		return "", err
+	}
+
+	// Copy the staged files over them.
+	sources := make(map[string]string)
+	publish := []string{}
+	if err := filepath.Walk(f.stagedDir(), func(fpath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || !info.Mode().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(f.stagedDir(), fpath)
+		if err != nil {
+			return err
+		}
+		relpath := filepath.ToSlash(rel)
+
+		var paths []string
+		if isTarget(relpath) {
+			paths = computeTargetPaths(consistentSnapshot, relpath, hashes)
+		} else if !metaNeedsRemoval(relpath, versions) {
+			paths = computeMetadataPaths(consistentSnapshot, relpath, versions)
+		}
+		for _, p := range paths {
+			sources[p] = fpath
+		}
+		publish = append(publish, paths...)
+		return nil
+	}); err != nil {
+		return "", err
+	}
+	sort.SliceStable(publish, func(i, j int) bool {
+		return publishOrder(publish[i]) < publishOrder(publish[j])
+	})
+	for _, p := range publish {
+		if f.publishHook != nil {
+			if err := f.publishHook(p); err != nil {
+				return "", err
+			}
+		}
+		dst := filepath.Join(gen, filepath.FromSlash(p))
+		// dst may be linked to a file of the current generation, which
+		// must not be changed.
+		if err := os.Remove(dst); err != nil && !os.IsNotExist(err) {
+			return "", err
+		}
+		if err := copyFileSync(sources[p], dst); err != nil {
+			return "", err
+		}
+	}
+
+	if err := filepath.Walk(gen, func(fpath string, info os.FileInfo, err error) error {
+		if err == nil && info.IsDir() {
+			syncDir(fpath)
+		}
+		return err
+	}); err != nil {
+		return "", err
+	}
+	syncDir(f.generationsDir())
+	return gen, nil
+}
+
+// newGenerationDir creates the directory of a new generation, numbered
+// after the existing ones.
+func (f *fileSystemStore) newGenerationDir() (string, error) {
+	if err := os.MkdirAll(f.generationsDir(), 0755); err != nil {
+		return "", err
+	}
+	entries, err := os.ReadDir(f.generationsDir())
+	if err != nil {
+		return "", err
+	}
+	next := 1
+	for _, e := range entries {
+		if n, err := strconv.Atoi(e.Name()); err == nil && n >= next {
+			next = n + 1
+		}
+	}
+	gen := filepath.Join(f.generationsDir(), strconv.Itoa(next))
+	return gen, os.Mkdir(gen, 0755)
+}
+
+// switchGeneration makes gen the committed repository, and removes the
+// previous generation.
+func (f *fileSystemStore) switchGeneration(gen string) error {
+	rel, err := filepath.Rel(f.dir, gen)
+	if err != nil {
+		return err
+	}
+	link := f.repoDir() + ".new"
+	if err := os.Remove(link); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := os.Symlink(rel, link); err != nil {
+		return f.renameGeneration(gen)
+	}
+	syncDir(f.dir)
+
+	// A plain repository directory cannot be atomically replaced, so it is
+	// moved out of the way first, to be removed as a stale generation. If
+	// the commit is interrupted before the link takes its place,
+	// recoverGenerations renames the link.
+	if info, err := os.Lstat(f.repoDir()); err == nil && info.IsDir() {
+		legacy, err := f.newGenerationDir()
+		if err != nil {
+			return err
+		}
+		if err := os.Remove(legacy); err != nil {
+			return err
+		}
+		if err := os.Rename(f.repoDir(), legacy); err != nil {
+			return err
+		}
+	}
+	if err := os.Rename(link, f.repoDir()); err != nil {
+		return err
+	}
+	syncDir(f.dir)
+	return f.recoverGenerations()
+}
+
+// renameGeneration makes gen the committed repository by renaming it to
+// "repository", for platforms without symlinks.
+func (f *fileSystemStore) renameGeneration(gen string) error {
+	old := f.repoDir() + ".old"
+	if err := os.RemoveAll(old); err != nil {
+		return err
+	}
+	if err := os.Rename(f.repoDir(), old); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := os.Rename(gen, f.repoDir()); err != nil {
+		return err
+	}
+	syncDir(f.dir)
+	return f.recoverGenerations()
+}
+
+// recoverGenerations restores the repository if a switch between generations
+// was interrupted while it was missing, then removes the generations other
+// than the committed one, which are left by an interrupted commit or
+// replaced by a commit. Nothing is removed unless the committed repository
+// is found.
+func (f *fileSystemStore) recoverGenerations() error {
+	link, old := f.repoDir()+".new", f.repoDir()+".old"
+	if _, err := os.Lstat(f.repoDir()); os.IsNotExist(err) {
+		// The link to the new generation is only created once it is
+		// complete, so finish the switch to it. Otherwise restore the
+		// repository renameGeneration moved away.
+		err := os.Rename(link, f.repoDir())
+		if os.IsNotExist(err) {
+			err = os.Rename(old, f.repoDir())
+		}
+		if os.IsNotExist(err) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		syncDir(f.dir)
+	} else if err != nil {
+		return err
+	}
+
+	current, err := f.currentGeneration()
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(link); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := os.RemoveAll(old); err != nil {
+		return err
+	}
+	entries, err := os.ReadDir(f.generationsDir())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	for _, e := range entries {
+		if e.Name() == current {
+			continue
+		}
+		if err := os.RemoveAll(filepath.Join(f.generationsDir(), e.Name())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// currentGeneration returns the name of the generation the repository links
+// to, or "" if the repository is a plain directory.
+func (f *fileSystemStore) currentGeneration() (string, error) {
+	info, err := os.Lstat(f.repoDir())
+	if err != nil {
+		return "", err
+	}
+	if info.IsDir() {
+		return "", nil
+	}
+	target, err := os.Readlink(f.repoDir())
+	if err != nil {
+		return "", err
+	}
+	if !filepath.IsAbs(target) {
+		target = filepath.Join(f.dir, target)
+	}
+	if filepath.Dir(target) != f.generationsDir() {
+		return "", fmt.Errorf("tuf: %s does not link to a generation in %s", f.repoDir(), f.generationsDir())
+	}
+	if _, err := os.Stat(target); err != nil {
+		return "", err
+	}
+	return filepath.Base(target), nil
+}
+
+// linkOrCopyFile hard links dst to src, or copies src to dst if it cannot.
+func linkOrCopyFile(src, dst string) error {
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	if err := os.Link(src, dst); err == nil {
+		return nil
+	}
+	return copyFileSync(src, dst)
+}
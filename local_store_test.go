@@ -1,10 +1,15 @@
 package tuf
 
 import (
+	"encoding/json"
+	"errors"
 	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/theupdateframework/go-tuf/data"
 	"github.com/theupdateframework/go-tuf/pkg/keys"
 )
 
@@ -68,3 +73,169 @@ func TestLocalStoreSigners(t *testing.T) {
 		})
 	}
 }
+
+func TestFileSystemStoreInterruptedCommit(t *testing.T) {
+	dir := t.TempDir()
+	writeStaged := func(path, content string) {
+		path = filepath.Join(dir, "staged", "targets", path)
+		assert.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		assert.NoError(t, os.WriteFile(path, []byte(content), 0644))
+	}
+	committedVersion := func(name string) int64 {
+		b, err := os.ReadFile(filepath.Join(dir, "repository", name))
+		assert.NoError(t, err)
+		s := &data.Signed{}
+		assert.NoError(t, json.Unmarshal(b, s))
+		sm := &struct {
+			Version int64 `json:"version"`
+		}{}
+		assert.NoError(t, json.Unmarshal(s.Signed, sm))
+		return sm.Version
+	}
+
+	store := FileSystemStore(dir, nil)
+	r, err := NewRepo(store, "sha256")
+	assert.NoError(t, err)
+	for _, role := range []string{"root", "targets", "snapshot", "timestamp"} {
+		_, err := r.GenKey(role)
+		assert.NoError(t, err)
+	}
+	writeStaged("foo.txt", "foo")
+	assert.NoError(t, r.AddTarget("foo.txt", nil))
+	assert.NoError(t, r.Snapshot())
+	assert.NoError(t, r.Timestamp())
+	assert.NoError(t, r.Commit())
+
+	writeStaged("foo.txt", "foo v2")
+	writeStaged("bar.txt", "bar")
+	assert.NoError(t, r.AddTargets([]string{"foo.txt", "bar.txt"}, nil))
+	assert.NoError(t, r.Snapshot())
+	assert.NoError(t, r.Timestamp())
+
+	// Interrupt the commit just before publishing timestamp.json.
+	errInterrupted := errors.New("interrupted")
+	store.(*fileSystemStore).publishHook = func(path string) error {
+		if path == "timestamp.json" {
+			return errInterrupted
+		}
+		return nil
+	}
+	err = r.Commit()
+	store.(*fileSystemStore).publishHook = nil
+	assert.Equal(t, errInterrupted, err)
+	assert.Equal(t, int64(2), committedVersion("snapshot.json"))
+	assert.Equal(t, int64(1), committedVersion("timestamp.json"))
+	assert.FileExists(t, filepath.Join(dir, "commit", "journal.json"))
+	assert.FileExists(t, filepath.Join(dir, "staged", "timestamp.json"))
+
+	// The next commit finishes the interrupted one first.
+	r, err = NewRepo(FileSystemStore(dir, nil), "sha256")
+	assert.NoError(t, err)
+	assert.NoError(t, r.Commit())
+	assert.Equal(t, int64(2), committedVersion("timestamp.json"))
+	assert.NoDirExists(t, filepath.Join(dir, "commit"))
+	assert.NoFileExists(t, filepath.Join(dir, "staged", "timestamp.json"))
+	report, err := r.Verify(time.Now())
+	assert.NoError(t, err)
+	assert.Equal(t, []VerifyProblem{}, report.Problems)
+
+	// A commit interrupted before its journal was written is rolled back.
+	junk := filepath.Join(dir, "commit", "files", "timestamp.json")
+	assert.NoError(t, os.MkdirAll(filepath.Dir(junk), 0755))
+	assert.NoError(t, os.WriteFile(junk, []byte("junk"), 0644))
+	assert.NoError(t, r.Timestamp())
+	assert.NoError(t, r.Commit())
+	assert.Equal(t, int64(3), committedVersion("timestamp.json"))
+	assert.NoDirExists(t, filepath.Join(dir, "commit"))
+}
+
+func TestFileSystemStoreWithGenerationsInterruptedCommit(t *testing.T) {
+	dir := t.TempDir()
+	writeStaged := func(path, content string) {
+		path = filepath.Join(dir, "staged", "targets", path)
+		assert.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		assert.NoError(t, os.WriteFile(path, []byte(content), 0644))
+	}
+	committedVersion := func(name string) int64 {
+		b, err := os.ReadFile(filepath.Join(dir, "repository", name))
+		assert.NoError(t, err)
+		s := &data.Signed{}
+		assert.NoError(t, json.Unmarshal(b, s))
+		sm := &struct {
+			Version int64 `json:"version"`
+		}{}
+		assert.NoError(t, json.Unmarshal(s.Signed, sm))
+		return sm.Version
+	}
+
+	store := FileSystemStoreWithGenerations(dir, nil)
+	r, err := NewRepo(store, "sha256")
+	assert.NoError(t, err)
+	for _, role := range []string{"root", "targets", "snapshot", "timestamp"} {
+		_, err := r.GenKey(role)
+		assert.NoError(t, err)
+	}
+	writeStaged("foo.txt", "foo")
+	assert.NoError(t, r.AddTarget("foo.txt", nil))
+	assert.NoError(t, r.Snapshot())
+	assert.NoError(t, r.Timestamp())
+	assert.NoError(t, r.Commit())
+	gen, err := os.Readlink(filepath.Join(dir, "repository"))
+	assert.NoError(t, err)
+
+	writeStaged("foo.txt", "foo v2")
+	writeStaged("bar.txt", "bar")
+	assert.NoError(t, r.AddTargets([]string{"foo.txt", "bar.txt"}, nil))
+	assert.NoError(t, r.Snapshot())
+	assert.NoError(t, r.Timestamp())
+
+	// Interrupt the commit just before publishing timestamp.json. The
+	// repository is left as it was.
+	errInterrupted := errors.New("interrupted")
+	store.(*fileSystemStore).publishHook = func(path string) error {
+		if path == "timestamp.json" {
+			return errInterrupted
+		}
+		return nil
+	}
+	assert.Equal(t, errInterrupted, r.Commit())
+	store.(*fileSystemStore).publishHook = nil
+	current, err := os.Readlink(filepath.Join(dir, "repository"))
+	assert.NoError(t, err)
+	assert.Equal(t, gen, current)
+	assert.Equal(t, int64(1), committedVersion("targets.json"))
+	assert.Equal(t, int64(1), committedVersion("snapshot.json"))
+	assert.Equal(t, int64(1), committedVersion("timestamp.json"))
+	assert.NoFileExists(t, filepath.Join(dir, "repository", "2.targets.json"))
+	assert.FileExists(t, filepath.Join(dir, "staged", "timestamp.json"))
+
+	// The next commit removes the partial generation and publishes the
+	// staged files.
+	r, err = NewRepo(FileSystemStoreWithGenerations(dir, nil), "sha256")
+	assert.NoError(t, err)
+	assert.NoError(t, r.Commit())
+	assert.Equal(t, int64(2), committedVersion("snapshot.json"))
+	assert.Equal(t, int64(2), committedVersion("timestamp.json"))
+	assert.Equal(t, int64(2), committedVersion("targets.json"))
+	assert.NoFileExists(t, filepath.Join(dir, "staged", "timestamp.json"))
+	gens, err := os.ReadDir(filepath.Join(dir, "generations"))
+	assert.NoError(t, err)
+	assert.Len(t, gens, 1)
+	report, err := r.Verify(time.Now())
+	assert.NoError(t, err)
+	assert.Equal(t, []VerifyProblem{}, report.Problems)
+
+	// A commit interrupted while the repository is missing is finished by
+	// the next Clean.
+	assert.NoError(t, os.Rename(filepath.Join(dir, "repository"), filepath.Join(dir, "repository.new")))
+	assert.NoError(t, r.Clean())
+	assert.Equal(t, int64(2), committedVersion("timestamp.json"))
+	assert.NoFileExists(t, filepath.Join(dir, "repository.new"))
+
+	// Generations are left alone if the repository cannot be found.
+	assert.NoError(t, os.Remove(filepath.Join(dir, "repository")))
+	assert.Equal(t, ErrNewRepository, r.Clean())
+	gens, err = os.ReadDir(filepath.Join(dir, "generations"))
+	assert.NoError(t, err)
+	assert.Len(t, gens, 1)
+}
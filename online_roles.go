@@ -0,0 +1,194 @@
+package tuf
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// OnlineRolesSignerOptions configures an OnlineRolesSigner. The zero values
+// of the duration fields select their defaults.
+type OnlineRolesSignerOptions struct {
+	// SnapshotExpires and TimestampExpires are how long re-signed metadata
+	// is valid for. They default to 7 days and 1 day.
+	SnapshotExpires  time.Duration
+	TimestampExpires time.Duration
+
+	// RefreshBefore is how long before it expires metadata is re-signed. It
+	// defaults to half of TimestampExpires, and must be shorter than both
+	// SnapshotExpires and TimestampExpires.
+	RefreshBefore time.Duration
+
+	// Interval is how often Run checks the expiration dates. It defaults to
+	// 1 minute.
+	Interval time.Duration
+
+	// OnRefresh, if set, is called by Run with the roles it re-signed and
+	// committed.
+	OnRefresh func(roles []string)
+
+	// OnError, if set, is called by Run when a refresh fails. Run keeps
+	// going, and tries again after Interval.
+	OnError func(err error)
+}
+
+// OnlineRolesSigner keeps the snapshot and timestamp metadata of a repository
+// from expiring by re-signing and committing them before they do. The keys
+// of both roles must be available in the repository's local store.
+type OnlineRolesSigner struct {
+	repo *Repo
+
+	snapshotExpires  time.Duration
+	timestampExpires time.Duration
+	refreshBefore    time.Duration
+	interval         time.Duration
+	onRefresh        func(roles []string)
+	onError          func(err error)
+}
+
+// NewOnlineRolesSigner returns an OnlineRolesSigner for the repository. It
+// returns ErrRefreshBeforeTooLong if RefreshBefore is not shorter than
+// SnapshotExpires and TimestampExpires, as the metadata would then be
+// re-signed on every check.
+func NewOnlineRolesSigner(repo *Repo, opts *OnlineRolesSignerOptions) (*OnlineRolesSigner, error) {
+	if opts == nil {
+		opts = &OnlineRolesSignerOptions{}
+	}
+	s := &OnlineRolesSigner{
+		repo:             repo,
+		snapshotExpires:  opts.SnapshotExpires,
+		timestampExpires: opts.TimestampExpires,
+		refreshBefore:    opts.RefreshBefore,
+		interval:         opts.Interval,
+		onRefresh:        opts.OnRefresh,
+		onError:          opts.OnError,
+	}
+	if s.snapshotExpires <= 0 {
+		s.snapshotExpires = 7 * 24 * time.Hour
+	}
+	if s.timestampExpires <= 0 {
+		s.timestampExpires = 24 * time.Hour
+	}
+	if s.refreshBefore <= 0 {
+		s.refreshBefore = s.timestampExpires / 2
+	}
+	if s.interval <= 0 {
+		s.interval = time.Minute
+	}
+	if s.refreshBefore >= s.timestampExpires || s.refreshBefore >= s.snapshotExpires {
+		return nil, ErrRefreshBeforeTooLong
+	}
+	return s, nil
+}
+
+// Refresh re-signs snapshot.json if it expires within RefreshBefore, and
+// timestamp.json if it does or if snapshot.json was re-signed, then commits
+// them. It returns the roles that were re-signed, which is empty if none
+// needed to be.
+//
+// If the local store implements RepoLocker, Refresh holds its lock from
+// checking the metadata until the commit, and fails with ErrRepoLocked if
+// another process holds it. The metadata is reloaded from the local store
+// first, so that changes committed by others since the last refresh are
+// picked up. Refresh fails with ErrStagedChanges rather than commit metadata
+// that someone else has staged, and if any step fails the metadata it staged
+// is removed again, leaving the committed repository and the other staged
+// files as they were.
+func (s *OnlineRolesSigner) Refresh() ([]string, error) {
+	r := s.repo
+	if locker, ok := r.local.(RepoLocker); ok {
+		unlock, err := locker.Lock()
+		if err != nil {
+			return nil, err
+		}
+		defer unlock()
+	}
+
+	meta, err := r.local.GetMeta()
+	if err != nil {
+		return nil, err
+	}
+	r.meta = meta
+	for name := range r.meta {
+		if r.local.FileIsStaged(name) {
+			return nil, ErrStagedChanges
+		}
+	}
+
+	snapshot, err := r.snapshot()
+	if err != nil {
+		return nil, err
+	}
+	timestamp, err := r.timestamp()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	refreshAt := now.Add(s.refreshBefore)
+	refreshed := []string{}
+	if snapshot.Expires.Before(refreshAt) {
+		if err := r.SnapshotWithExpires(now.Add(s.snapshotExpires)); err != nil {
+			return nil, s.abort(err)
+		}
+		refreshed = append(refreshed, "snapshot")
+	}
+	if len(refreshed) > 0 || timestamp.Expires.Before(refreshAt) {
+		if err := r.TimestampWithExpires(now.Add(s.timestampExpires)); err != nil {
+			return nil, s.abort(err)
+		}
+		refreshed = append(refreshed, "timestamp")
+	}
+	if len(refreshed) == 0 {
+		return refreshed, nil
+	}
+
+	if err := r.Commit(); err != nil {
+		return nil, s.abort(err)
+	}
+	return refreshed, nil
+}
+
+// abort removes the snapshot.json and timestamp.json staged by a failed
+// refresh, which were not staged before it as Refresh checks, reloads the
+// committed metadata, and returns err. Stores that cannot remove single
+// staged files are left as they are.
+func (s *OnlineRolesSigner) abort(err error) error {
+	remover, ok := s.repo.local.(StagedMetaRemover)
+	if !ok {
+		return fmt.Errorf("%w (the staged snapshot.json and timestamp.json were not removed)", err)
+	}
+	for _, name := range []string{"snapshot.json", "timestamp.json"} {
+		if removeErr := remover.RemoveStagedMeta(name); removeErr != nil {
+			return fmt.Errorf("%w (removing the staged %s failed: %s)", err, name, removeErr)
+		}
+	}
+	if meta, metaErr := s.repo.local.GetMeta(); metaErr == nil {
+		s.repo.meta = meta
+	}
+	return err
+}
+
+// Run calls Refresh every Interval until ctx is done, reporting the outcome
+// of each refresh to OnRefresh and OnError. It refreshes once immediately,
+// and returns ctx.Err() once ctx is done.
+func (s *OnlineRolesSigner) Run(ctx context.Context) error {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+	for {
+		refreshed, err := s.Refresh()
+		if err != nil {
+			if s.onError != nil {
+				s.onError(err)
+			}
+		} else if len(refreshed) > 0 && s.onRefresh != nil {
+			s.onRefresh(refreshed)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package tuf
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+func (rs *RepoSuite) TestOnlineRolesSigner(c *C) {
+	tmp := newTmpDir(c)
+	local := FileSystemStore(tmp.path, nil)
+	r, err := NewRepo(local)
+	c.Assert(err, IsNil)
+
+	genKey(c, r, "root")
+	genKey(c, r, "targets")
+	genKey(c, r, "snapshot")
+	genKey(c, r, "timestamp")
+	c.Assert(r.AddTargets([]string{}, nil), IsNil)
+	c.Assert(r.SnapshotWithExpires(time.Now().Add(time.Hour)), IsNil)
+	c.Assert(r.TimestampWithExpires(time.Now().Add(time.Hour)), IsNil)
+	c.Assert(r.Commit(), IsNil)
+
+	// the signer works on a separate Repo, as a daemon would
+	signerRepo, err := NewRepo(FileSystemStore(tmp.path, nil))
+	c.Assert(err, IsNil)
+	s, err := NewOnlineRolesSigner(signerRepo, nil)
+	c.Assert(err, IsNil)
+
+	// both roles expire within the default 12 hours
+	refreshed, err := s.Refresh()
+	c.Assert(err, IsNil)
+	c.Assert(refreshed, DeepEquals, []string{"snapshot", "timestamp"})
+	snapshotVersion, err := signerRepo.SnapshotVersion()
+	c.Assert(err, IsNil)
+	c.Assert(snapshotVersion, Equals, int64(2))
+	timestampVersion, err := signerRepo.TimestampVersion()
+	c.Assert(err, IsNil)
+	c.Assert(timestampVersion, Equals, int64(2))
+
+	refreshed, err = s.Refresh()
+	c.Assert(err, IsNil)
+	c.Assert(refreshed, DeepEquals, []string{})
+
+	// only timestamp.json is re-signed while snapshot.json is fresh
+	s, err = NewOnlineRolesSigner(signerRepo, &OnlineRolesSignerOptions{
+		TimestampExpires: 3 * 24 * time.Hour,
+		RefreshBefore:    2 * 24 * time.Hour,
+	})
+	c.Assert(err, IsNil)
+	refreshed, err = s.Refresh()
+	c.Assert(err, IsNil)
+	c.Assert(refreshed, DeepEquals, []string{"timestamp"})
+	snapshotVersion, err = signerRepo.SnapshotVersion()
+	c.Assert(err, IsNil)
+	c.Assert(snapshotVersion, Equals, int64(2))
+	timestampVersion, err = signerRepo.TimestampVersion()
+	c.Assert(err, IsNil)
+	c.Assert(timestampVersion, Equals, int64(3))
+
+	// changes staged by others are not committed
+	c.Assert(r.SetTargetsVersion(10), IsNil)
+	_, err = s.Refresh()
+	c.Assert(err, Equals, ErrStagedChanges)
+	c.Assert(r.Clean(), IsNil)
+
+	// no refresh happens while another process holds the lock
+	unlock, err := local.(RepoLocker).Lock()
+	c.Assert(err, IsNil)
+	_, err = s.Refresh()
+	c.Assert(err, FitsTypeOf, ErrRepoLocked{})
+	c.Assert(unlock(), IsNil)
+
+	// a failed refresh removes what it staged, and nothing else
+	tmp.writeStagedTarget("foo.txt", "foo")
+	c.Assert(os.Remove(filepath.Join(tmp.path, "keys", "timestamp.json")), IsNil)
+	signerRepo, err = NewRepo(FileSystemStore(tmp.path, nil))
+	c.Assert(err, IsNil)
+	s, err = NewOnlineRolesSigner(signerRepo, &OnlineRolesSignerOptions{
+		SnapshotExpires:  9 * 24 * time.Hour,
+		TimestampExpires: 9 * 24 * time.Hour,
+		RefreshBefore:    8 * 24 * time.Hour,
+	})
+	c.Assert(err, IsNil)
+	_, err = s.Refresh()
+	c.Assert(err, FitsTypeOf, ErrInsufficientSignatures{})
+	c.Assert(local.FileIsStaged("snapshot.json"), Equals, false)
+	c.Assert(local.FileIsStaged("timestamp.json"), Equals, false)
+	tmp.assertExists("staged/targets/foo.txt")
+	snapshotVersion, err = signerRepo.SnapshotVersion()
+	c.Assert(err, IsNil)
+	c.Assert(snapshotVersion, Equals, int64(2))
+}
+
+func (rs *RepoSuite) TestOnlineRolesSignerRun(c *C) {
+	local := MemoryStore(nil, nil)
+	r, err := NewRepo(local)
+	c.Assert(err, IsNil)
+
+	genKey(c, r, "root")
+	genKey(c, r, "targets")
+	genKey(c, r, "snapshot")
+	genKey(c, r, "timestamp")
+	c.Assert(r.AddTargets([]string{}, nil), IsNil)
+	c.Assert(r.Snapshot(), IsNil)
+	c.Assert(r.TimestampWithExpires(time.Now().Add(time.Hour)), IsNil)
+	c.Assert(r.Commit(), IsNil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	refreshes := [][]string{}
+	s, err := NewOnlineRolesSigner(r, &OnlineRolesSignerOptions{
+		Interval: time.Millisecond,
+		OnRefresh: func(roles []string) {
+			refreshes = append(refreshes, roles)
+		},
+		OnError: func(err error) {
+			c.Errorf("unexpected refresh error: %s", err)
+		},
+	})
+	c.Assert(err, IsNil)
+	go func() {
+		// run a few more checks, which have nothing to refresh
+		time.Sleep(20 * time.Millisecond)
+		cancel()
+	}()
+	c.Assert(s.Run(ctx), Equals, context.Canceled)
+	c.Assert(refreshes, DeepEquals, [][]string{{"timestamp"}})
+}
+
+func (rs *RepoSuite) TestOnlineRolesSignerOptions(c *C) {
+	r, err := NewRepo(MemoryStore(nil, nil))
+	c.Assert(err, IsNil)
+
+	for _, opts := range []*OnlineRolesSignerOptions{
+		{RefreshBefore: 24 * time.Hour},
+		{RefreshBefore: 2 * 24 * time.Hour, TimestampExpires: 24 * time.Hour},
+		{RefreshBefore: 2 * 24 * time.Hour, TimestampExpires: 3 * 24 * time.Hour, SnapshotExpires: 2 * 24 * time.Hour},
+	} {
+		_, err := NewOnlineRolesSigner(r, opts)
+		c.Assert(err, Equals, ErrRefreshBeforeTooLong)
+	}
+	_, err = NewOnlineRolesSigner(r, &OnlineRolesSignerOptions{RefreshBefore: 23 * time.Hour})
+	c.Assert(err, IsNil)
+}
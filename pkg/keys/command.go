@@ -0,0 +1,129 @@
+package keys
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/theupdateframework/go-tuf/data"
+)
+
+// KeyTypeCommand is the private key type used to persist a reference to a
+// signing key that lives outside of go-tuf (for example in a KMS or an HSM).
+// It is never used as the type of a public key: the public key keeps the type
+// of the external key, e.g. data.KeyTypeECDSA_SHA2_P256.
+const KeyTypeCommand = "command"
+
+func init() {
+	SignerMap.Store(KeyTypeCommand, NewCommandSigner)
+}
+
+func NewCommandSigner() Signer {
+	return &commandSigner{}
+}
+
+// CommandPrivateKeyValue is the keyval of a command signer. It holds the
+// public key of the external signing key and the command used to sign with
+// it. No private key material is stored.
+type CommandPrivateKeyValue struct {
+	Public  *data.PublicKey `json:"public"`
+	Command []string        `json:"command"`
+}
+
+// commandSigner signs messages by running an external command. The message
+// is written to the command's standard input and the raw signature is read
+// from its standard output. The key ID being signed for is passed in the
+// TUF_SIGNER_KEYID environment variable.
+type commandSigner struct {
+	public   *data.PublicKey
+	verifier Verifier
+	command  []string
+}
+
+// NewCommandSignerFromKey returns a Signer that signs for the public key pub
+// by running command. The signatures returned by the command are checked
+// against pub before being used.
+func NewCommandSignerFromKey(pub *data.PublicKey, command []string) (Signer, error) {
+	s := &commandSigner{}
+	if err := s.init(pub, command); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *commandSigner) init(pub *data.PublicKey, command []string) error {
+	if pub == nil {
+		return errors.New("tuf: command signer is missing a public key")
+	}
+	if len(command) == 0 {
+		return errors.New("tuf: command signer is missing a command")
+	}
+	verifier, err := GetVerifier(pub)
+	if err != nil {
+		return err
+	}
+	*s = commandSigner{
+		public:   pub,
+		verifier: verifier,
+		command:  command,
+	}
+	return nil
+}
+
+func (s *commandSigner) PublicData() *data.PublicKey {
+	return s.public
+}
+
+func (s *commandSigner) SignMessage(message []byte) ([]byte, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(s.command[0], s.command[1:]...)
+	cmd.Env = append(os.Environ(), "TUF_SIGNER_KEYID="+s.public.IDs()[0])
+	cmd.Stdin = bytes.NewReader(message)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("tuf: signing command %q failed: %w: %s", s.command[0], err, strings.TrimSpace(stderr.String()))
+	}
+
+	sig := stdout.Bytes()
+	if err := s.verifier.Verify(message, sig); err != nil {
+		return nil, fmt.Errorf("tuf: signing command %q returned an invalid signature: %w", s.command[0], err)
+	}
+	return sig, nil
+}
+
+func (s *commandSigner) MarshalPrivateKey() (*data.PrivateKey, error) {
+	valueBytes, err := json.Marshal(CommandPrivateKeyValue{
+		Public:  s.public,
+		Command: s.command,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &data.PrivateKey{
+		Type:  KeyTypeCommand,
+		Value: valueBytes,
+	}, nil
+}
+
+func (s *commandSigner) UnmarshalPrivateKey(key *data.PrivateKey) error {
+	keyValue := &CommandPrivateKeyValue{}
+
+	// Prepare decoder limited to 512Kb
+	dec := json.NewDecoder(io.LimitReader(bytes.NewReader(key.Value), MaxJSONKeySize))
+
+	// Unmarshal key value
+	if err := dec.Decode(keyValue); err != nil {
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return fmt.Errorf("tuf: the private key is truncated or too large: %w", err)
+		}
+		return err
+	}
+
+	return s.init(keyValue.Public, keyValue.Command)
+}
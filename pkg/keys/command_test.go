@@ -0,0 +1,96 @@
+package keys
+
+import (
+	"crypto/ed25519"
+	"os"
+	"testing"
+
+	"github.com/theupdateframework/go-tuf/data"
+	"github.com/theupdateframework/go-tuf/internal/signertest"
+	. "gopkg.in/check.v1"
+)
+
+type CommandSuite struct{}
+
+var _ = Suite(&CommandSuite{})
+
+// TestHelperProcess is not a real test. It is run as the external signing
+// command by the tests below.
+func TestHelperProcess(t *testing.T) {
+	signertest.HelperProcess()
+}
+
+func helperCommand(priv ed25519.PrivateKey) []string {
+	return signertest.Command("TestHelperProcess", priv)
+}
+
+func (CommandSuite) TestSignVerify(c *C) {
+	key, err := GenerateEd25519Key()
+	c.Assert(err, IsNil)
+
+	signer, err := NewCommandSignerFromKey(key.PublicData(), helperCommand(key.PrivateKey))
+	c.Assert(err, IsNil)
+	c.Assert(signer.PublicData().IDs(), DeepEquals, key.PublicData().IDs())
+
+	msg := []byte("foo")
+	sig, err := signer.SignMessage(msg)
+	c.Assert(err, IsNil)
+	verifier, err := GetVerifier(key.PublicData())
+	c.Assert(err, IsNil)
+	c.Assert(verifier.Verify(msg, sig), IsNil)
+}
+
+func (CommandSuite) TestSignInvalidSignature(c *C) {
+	key, err := GenerateEd25519Key()
+	c.Assert(err, IsNil)
+	other, err := GenerateEd25519Key()
+	c.Assert(err, IsNil)
+
+	// The command signs with a different key than the one it claims.
+	signer, err := NewCommandSignerFromKey(key.PublicData(), helperCommand(other.PrivateKey))
+	c.Assert(err, IsNil)
+	_, err = signer.SignMessage([]byte("foo"))
+	c.Assert(err, ErrorMatches, "tuf: signing command .* returned an invalid signature: .*")
+}
+
+func (CommandSuite) TestSignCommandFails(c *C) {
+	key, err := GenerateEd25519Key()
+	c.Assert(err, IsNil)
+
+	signer, err := NewCommandSignerFromKey(key.PublicData(), []string{os.Args[0], "-test.run=TestHelperProcess", "--"})
+	c.Assert(err, IsNil)
+	_, err = signer.SignMessage([]byte("foo"))
+	c.Assert(err, ErrorMatches, "tuf: signing command .* failed: exit status 2: missing private key")
+}
+
+func (CommandSuite) TestMarshalUnmarshalPrivateKey(c *C) {
+	key, err := GenerateEd25519Key()
+	c.Assert(err, IsNil)
+	command := helperCommand(key.PrivateKey)
+
+	signer, err := NewCommandSignerFromKey(key.PublicData(), command)
+	c.Assert(err, IsNil)
+	privKey, err := signer.MarshalPrivateKey()
+	c.Assert(err, IsNil)
+	c.Assert(privKey.Type, Equals, KeyTypeCommand)
+
+	unmarshalled, err := GetSigner(privKey)
+	c.Assert(err, IsNil)
+	c.Assert(unmarshalled.PublicData().IDs(), DeepEquals, key.PublicData().IDs())
+	_, err = unmarshalled.SignMessage([]byte("foo"))
+	c.Assert(err, IsNil)
+}
+
+func (CommandSuite) TestNewCommandSignerFromKey_Invalid(c *C) {
+	key, err := GenerateEd25519Key()
+	c.Assert(err, IsNil)
+
+	_, err = NewCommandSignerFromKey(nil, []string{"true"})
+	c.Assert(err, ErrorMatches, "tuf: command signer is missing a public key")
+
+	_, err = NewCommandSignerFromKey(key.PublicData(), nil)
+	c.Assert(err, ErrorMatches, "tuf: command signer is missing a command")
+
+	_, err = NewCommandSignerFromKey(&data.PublicKey{Type: "foo"}, []string{"true"})
+	c.Assert(err, Equals, ErrInvalidKey)
+}
@@ -2,11 +2,18 @@ package keys
 
 import (
 	"bytes"
+	"crypto"
 	"crypto/ecdsa"
 	"crypto/elliptic"
-	"crypto/sha256"
+	"crypto/rand"
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+	"crypto/subtle"
+	"crypto/x509"
 	"encoding/asn1"
+	"encoding/hex"
 	"encoding/json"
+	"encoding/pem"
 	"errors"
 	"fmt"
 	"io"
@@ -16,52 +23,104 @@ import (
 )
 
 func init() {
-	VerifierMap.Store(data.KeyTypeECDSA_SHA2_P256, NewEcdsaVerifier)
+	for _, p := range ecdsaCurves {
+		VerifierMap.Store(p.keyType, NewEcdsaVerifier)
+		SignerMap.Store(p.keyType, NewEcdsaSigner)
+	}
+}
+
+// ecdsaCurveParams ties an ECDSA key type to its curve and the hash function
+// used over the signed message.
+type ecdsaCurveParams struct {
+	keyType string
+	scheme  string
+	curve   elliptic.Curve
+	hash    crypto.Hash
+}
+
+var ecdsaCurves = []*ecdsaCurveParams{
+	{data.KeyTypeECDSA_SHA2_P256, data.KeySchemeECDSA_SHA2_P256, elliptic.P256(), crypto.SHA256},
+	{data.KeyTypeECDSA_SHA2_P384, data.KeySchemeECDSA_SHA2_P384, elliptic.P384(), crypto.SHA384},
+	{data.KeyTypeECDSA_SHA2_P521, data.KeySchemeECDSA_SHA2_P521, elliptic.P521(), crypto.SHA512},
+}
+
+func ecdsaCurveForKeyType(keyType string) (*ecdsaCurveParams, error) {
+	for _, p := range ecdsaCurves {
+		if p.keyType == keyType {
+			return p, nil
+		}
+	}
+	return nil, fmt.Errorf("tuf: unsupported ecdsa key type %q", keyType)
+}
+
+func ecdsaCurveForCurve(curve elliptic.Curve) (*ecdsaCurveParams, error) {
+	for _, p := range ecdsaCurves {
+		if p.curve == curve {
+			return p, nil
+		}
+	}
+	return nil, fmt.Errorf("tuf: unsupported ecdsa curve %s", curve.Params().Name)
+}
+
+func (p *ecdsaCurveParams) digest(msg []byte) []byte {
+	h := p.hash.New()
+	h.Write(msg)
+	return h.Sum(nil)
+}
+
+func (p *ecdsaCurveParams) privateKeySize() int {
+	return (p.curve.Params().BitSize + 7) / 8
 }
 
 func NewEcdsaVerifier() Verifier {
-	return &p256Verifier{}
+	return &ecdsaVerifier{}
+}
+
+func NewEcdsaSigner() Signer {
+	return &ecdsaSigner{}
 }
 
 type ecdsaSignature struct {
 	R, S *big.Int
 }
 
-type p256Verifier struct {
-	PublicKey data.HexBytes `json:"public"`
+type ecdsaVerifier struct {
+	// PublicKey is either a hex-encoded uncompressed point or a PEM-encoded
+	// SubjectPublicKeyInfo, as written by securesystemslib and sigstore.
+	PublicKey string `json:"public"`
+	ecdsaKey  *ecdsa.PublicKey
+	params    *ecdsaCurveParams
 	key       *data.PublicKey
 }
 
-func (p *p256Verifier) Public() string {
-	return p.PublicKey.String()
+func (p *ecdsaVerifier) Public() string {
+	// Unique public key identifier, use a uniform encoding so that the same
+	// key is identified identically whether it was given as hex or PEM.
+	return hex.EncodeToString(elliptic.Marshal(p.ecdsaKey.Curve, p.ecdsaKey.X, p.ecdsaKey.Y))
 }
 
-func (p *p256Verifier) Verify(msg, sigBytes []byte) error {
-	x, y := elliptic.Unmarshal(elliptic.P256(), p.PublicKey)
-	k := &ecdsa.PublicKey{
-		Curve: elliptic.P256(),
-		X:     x,
-		Y:     y,
-	}
-
+func (p *ecdsaVerifier) Verify(msg, sigBytes []byte) error {
 	var sig ecdsaSignature
 	if _, err := asn1.Unmarshal(sigBytes, &sig); err != nil {
 		return err
 	}
 
-	hash := sha256.Sum256(msg)
-
-	if !ecdsa.Verify(k, hash[:], sig.R, sig.S) {
+	if !ecdsa.Verify(p.ecdsaKey, p.params.digest(msg), sig.R, sig.S) {
 		return errors.New("tuf: ecdsa signature verification failed")
 	}
 	return nil
 }
 
-func (p *p256Verifier) MarshalPublicKey() *data.PublicKey {
+func (p *ecdsaVerifier) MarshalPublicKey() *data.PublicKey {
 	return p.key
 }
 
-func (p *p256Verifier) UnmarshalPublicKey(key *data.PublicKey) error {
+func (p *ecdsaVerifier) UnmarshalPublicKey(key *data.PublicKey) error {
+	params, err := ecdsaCurveForKeyType(key.Type)
+	if err != nil {
+		return err
+	}
+
 	// Prepare decoder limited to 512Kb
 	dec := json.NewDecoder(io.LimitReader(bytes.NewReader(key.Value), MaxJSONKeySize))
 
@@ -73,14 +132,157 @@ func (p *p256Verifier) UnmarshalPublicKey(key *data.PublicKey) error {
 		return err
 	}
 
-	curve := elliptic.P256()
+	p.ecdsaKey, err = parseEcdsaPublicKey(params, p.PublicKey)
+	if err != nil {
+		return err
+	}
+	p.params = params
+	p.key = key
+	return nil
+}
+
+// parseEcdsaPublicKey parses a PEM-encoded SubjectPublicKeyInfo if the value
+// looks like PEM, and a hex-encoded uncompressed point otherwise. The key must
+// be on the curve of the given key type.
+func parseEcdsaPublicKey(params *ecdsaCurveParams, public string) (*ecdsa.PublicKey, error) {
+	if block, _ := pem.Decode([]byte(public)); block != nil {
+		key, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("tuf: error unmarshalling ecdsa key: %w", err)
+		}
+		ecdsaKey, ok := key.(*ecdsa.PublicKey)
+		if !ok {
+			return nil, errors.New("tuf: invalid ecdsa key")
+		}
+		if ecdsaKey.Curve != params.curve {
+			return nil, fmt.Errorf("tuf: ecdsa key curve %s does not match key type %s", ecdsaKey.Curve.Params().Name, params.keyType)
+		}
+		return ecdsaKey, nil
+	}
+
+	point, err := hex.DecodeString(public)
+	if err != nil {
+		return nil, fmt.Errorf("tuf: invalid ecdsa public key encoding: %w", err)
+	}
 
 	// Parse as uncompressed marshalled point.
-	x, _ := elliptic.Unmarshal(curve, p.PublicKey)
+	x, y := elliptic.Unmarshal(params.curve, point)
 	if x == nil {
-		return errors.New("tuf: invalid ecdsa public key point")
+		return nil, errors.New("tuf: invalid ecdsa public key point")
 	}
+	return &ecdsa.PublicKey{Curve: params.curve, X: x, Y: y}, nil
+}
 
-	p.key = key
+// EcdsaPrivateKeyValue is the keyval of an ECDSA private key. Both the public
+// point (uncompressed) and the private scalar are hex encoded, matching the
+// hex public key format read by the verifier.
+type EcdsaPrivateKeyValue struct {
+	Public  data.HexBytes `json:"public"`
+	Private data.HexBytes `json:"private"`
+}
+
+type ecdsaSigner struct {
+	*ecdsa.PrivateKey
+	params *ecdsaCurveParams
+}
+
+// GenerateEcdsaKey generates an ECDSA P-256 key.
+func GenerateEcdsaKey() (*ecdsaSigner, error) {
+	return GenerateEcdsaKeyWithCurve(elliptic.P256())
+}
+
+// GenerateEcdsaKeyWithCurve generates an ECDSA key on the given curve, which
+// must be one of P-256, P-384 or P-521.
+func GenerateEcdsaKeyWithCurve(curve elliptic.Curve) (*ecdsaSigner, error) {
+	params, err := ecdsaCurveForCurve(curve)
+	if err != nil {
+		return nil, err
+	}
+	privkey, err := ecdsa.GenerateKey(params.curve, rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	return &ecdsaSigner{privkey, params}, nil
+}
+
+func (s *ecdsaSigner) publicBytes() []byte {
+	return elliptic.Marshal(s.Curve, s.X, s.Y)
+}
+
+func (s *ecdsaSigner) privateBytes() []byte {
+	return s.D.FillBytes(make([]byte, s.params.privateKeySize()))
+}
+
+func (s *ecdsaSigner) PublicData() *data.PublicKey {
+	keyValBytes, _ := json.Marshal(ecdsaVerifier{PublicKey: hex.EncodeToString(s.publicBytes())})
+	return &data.PublicKey{
+		Type:       s.params.keyType,
+		Scheme:     s.params.scheme,
+		Algorithms: data.HashAlgorithms,
+		Value:      keyValBytes,
+	}
+}
+
+func (s *ecdsaSigner) SignMessage(message []byte) ([]byte, error) {
+	return ecdsa.SignASN1(rand.Reader, s.PrivateKey, s.params.digest(message))
+}
+
+func (s *ecdsaSigner) MarshalPrivateKey() (*data.PrivateKey, error) {
+	valueBytes, err := json.Marshal(EcdsaPrivateKeyValue{
+		Public:  s.publicBytes(),
+		Private: s.privateBytes(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &data.PrivateKey{
+		Type:       s.params.keyType,
+		Scheme:     s.params.scheme,
+		Algorithms: data.HashAlgorithms,
+		Value:      valueBytes,
+	}, nil
+}
+
+func (s *ecdsaSigner) UnmarshalPrivateKey(key *data.PrivateKey) error {
+	params, err := ecdsaCurveForKeyType(key.Type)
+	if err != nil {
+		return err
+	}
+
+	keyValue := &EcdsaPrivateKeyValue{}
+
+	// Prepare decoder limited to 512Kb
+	dec := json.NewDecoder(io.LimitReader(bytes.NewReader(key.Value), MaxJSONKeySize))
+
+	// Unmarshal key value
+	if err := dec.Decode(keyValue); err != nil {
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return fmt.Errorf("tuf: the private key is truncated or too large: %w", err)
+		}
+		return err
+	}
+
+	curve := params.curve
+
+	// Check private key length
+	if n, size := len(keyValue.Private), params.privateKeySize(); n != size {
+		return fmt.Errorf("tuf: invalid ecdsa private key length, expected %d, got %d", size, n)
+	}
+	d := new(big.Int).SetBytes(keyValue.Private)
+	if d.Sign() == 0 || d.Cmp(curve.Params().N) >= 0 {
+		return errors.New("tuf: invalid ecdsa private key")
+	}
+
+	// Derive public key from private key
+	priv := &ecdsa.PrivateKey{D: d}
+	priv.Curve = curve
+	priv.X, priv.Y = curve.ScalarBaseMult(keyValue.Private)
+
+	// Compare keys
+	if subtle.ConstantTimeCompare(keyValue.Public, elliptic.Marshal(curve, priv.X, priv.Y)) != 1 {
+		return errors.New("tuf: public and private keys don't match")
+	}
+
+	*s = ecdsaSigner{priv, params}
 	return nil
 }
@@ -4,8 +4,11 @@ import (
 	"crypto/ecdsa"
 	"crypto/elliptic"
 	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
 	"encoding/hex"
 	"encoding/json"
+	"encoding/pem"
 	"errors"
 	"io"
 	"strings"
@@ -90,3 +93,125 @@ func (ECDSASuite) TestUnmarshalECDSA_TooLongContent(c *C) {
 	err = verifier.UnmarshalPublicKey(badKey)
 	c.Assert(errors.Is(err, io.ErrUnexpectedEOF), Equals, true)
 }
+
+func (ECDSASuite) TestSignVerify(c *C) {
+	for _, curve := range []elliptic.Curve{elliptic.P256(), elliptic.P384(), elliptic.P521()} {
+		signer, err := GenerateEcdsaKeyWithCurve(curve)
+		c.Assert(err, IsNil)
+		msg := []byte("foo")
+		sig, err := signer.SignMessage(msg)
+		c.Assert(err, IsNil)
+		publicData := signer.PublicData()
+		pubKey, err := GetVerifier(publicData)
+		c.Assert(err, IsNil)
+		c.Assert(pubKey.Verify(msg, sig), IsNil)
+		c.Assert(pubKey.Verify([]byte("bar"), sig), NotNil)
+	}
+}
+
+func (ECDSASuite) TestMarshalUnmarshalPrivateKey(c *C) {
+	for keyType, curve := range map[string]elliptic.Curve{
+		data.KeyTypeECDSA_SHA2_P256: elliptic.P256(),
+		data.KeyTypeECDSA_SHA2_P384: elliptic.P384(),
+		data.KeyTypeECDSA_SHA2_P521: elliptic.P521(),
+	} {
+		signer, err := GenerateEcdsaKeyWithCurve(curve)
+		c.Assert(err, IsNil)
+		privKey, err := signer.MarshalPrivateKey()
+		c.Assert(err, IsNil)
+		c.Assert(privKey.Type, Equals, keyType)
+		c.Assert(privKey.Scheme, Equals, keyType)
+
+		unmarshalled, err := GetSigner(privKey)
+		c.Assert(err, IsNil)
+		c.Assert(unmarshalled.PublicData().IDs(), DeepEquals, signer.PublicData().IDs())
+
+		msg := []byte("foo")
+		sig, err := unmarshalled.SignMessage(msg)
+		c.Assert(err, IsNil)
+		pubKey, err := GetVerifier(signer.PublicData())
+		c.Assert(err, IsNil)
+		c.Assert(pubKey.Verify(msg, sig), IsNil)
+	}
+}
+
+func (ECDSASuite) TestUnmarshalECDSA_WrongCurve(c *C) {
+	signer, err := GenerateEcdsaKeyWithCurve(elliptic.P384())
+	c.Assert(err, IsNil)
+	publicData := signer.PublicData()
+	publicData.Type = data.KeyTypeECDSA_SHA2_P256
+	publicData.Scheme = data.KeySchemeECDSA_SHA2_P256
+	verifier := NewEcdsaVerifier()
+	c.Assert(verifier.UnmarshalPublicKey(publicData), ErrorMatches, "tuf: invalid ecdsa public key point")
+}
+
+func (ECDSASuite) TestUnmarshalPrivateKey_Mismatch(c *C) {
+	signer, err := GenerateEcdsaKey()
+	c.Assert(err, IsNil)
+	other, err := GenerateEcdsaKey()
+	c.Assert(err, IsNil)
+
+	keyValue, err := json.Marshal(EcdsaPrivateKeyValue{
+		Public:  other.publicBytes(),
+		Private: signer.privateBytes(),
+	})
+	c.Assert(err, IsNil)
+	privKey := &data.PrivateKey{
+		Type:       data.KeyTypeECDSA_SHA2_P256,
+		Scheme:     data.KeySchemeECDSA_SHA2_P256,
+		Algorithms: data.HashAlgorithms,
+		Value:      keyValue,
+	}
+	c.Assert(NewEcdsaSigner().UnmarshalPrivateKey(privKey), ErrorMatches, "tuf: public and private keys don't match")
+}
+
+func pemPublicKey(c *C, keyType string, pub interface{}) *data.PublicKey {
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	c.Assert(err, IsNil)
+	value, err := json.Marshal(map[string]string{
+		"public": string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})),
+	})
+	c.Assert(err, IsNil)
+	return &data.PublicKey{
+		Type:   keyType,
+		Scheme: keyType,
+		Value:  value,
+	}
+}
+
+func (ECDSASuite) TestUnmarshalECDSA_PEM(c *C) {
+	signer, err := GenerateEcdsaKeyWithCurve(elliptic.P384())
+	c.Assert(err, IsNil)
+	publicData := pemPublicKey(c, data.KeyTypeECDSA_SHA2_P384, signer.Public())
+
+	verifier, err := GetVerifier(publicData)
+	c.Assert(err, IsNil)
+
+	// The key ID is computed over the PEM encoded key value.
+	c.Assert(verifier.MarshalPublicKey().IDs(), DeepEquals, publicData.IDs())
+	c.Assert(publicData.IDs(), Not(DeepEquals), signer.PublicData().IDs())
+
+	// The same key in hex and PEM encodings has the same unique identifier.
+	hexVerifier, err := GetVerifier(signer.PublicData())
+	c.Assert(err, IsNil)
+	c.Assert(verifier.Public(), Equals, hexVerifier.Public())
+
+	msg := []byte("foo")
+	sig, err := signer.SignMessage(msg)
+	c.Assert(err, IsNil)
+	c.Assert(verifier.Verify(msg, sig), IsNil)
+}
+
+func (ECDSASuite) TestUnmarshalECDSA_PEMWrongCurve(c *C) {
+	signer, err := GenerateEcdsaKeyWithCurve(elliptic.P384())
+	c.Assert(err, IsNil)
+	publicData := pemPublicKey(c, data.KeyTypeECDSA_SHA2_P256, signer.Public())
+	c.Assert(NewEcdsaVerifier().UnmarshalPublicKey(publicData), ErrorMatches, "tuf: ecdsa key curve P-384 does not match key type ecdsa-sha2-nistp256")
+}
+
+func (ECDSASuite) TestUnmarshalECDSA_PEMNotECDSA(c *C) {
+	priv, err := rsa.GenerateKey(rand.Reader, 2048)
+	c.Assert(err, IsNil)
+	publicData := pemPublicKey(c, data.KeyTypeECDSA_SHA2_P256, priv.Public())
+	c.Assert(NewEcdsaVerifier().UnmarshalPublicKey(publicData), ErrorMatches, "tuf: invalid ecdsa key")
+}
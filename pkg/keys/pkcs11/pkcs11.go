@@ -0,0 +1,465 @@
+//go:build cgo
+
+// Package pkcs11 provides a keys.Signer backed by a key held in a PKCS#11
+// token, such as a YubiHSM or SoftHSM2. Importing the package registers the
+// signer for the KeyTypePKCS11 private key type, so that references to token
+// keys can be saved in and loaded from a repository's keys directory.
+//
+// The package uses cgo to load the PKCS#11 module. Without cgo, the signer
+// is still registered, but fails to load or use token keys.
+package pkcs11
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"sync"
+
+	p11 "github.com/miekg/pkcs11"
+	"github.com/theupdateframework/go-tuf/data"
+	"github.com/theupdateframework/go-tuf/pkg/keys"
+)
+
+// KeyTypePKCS11 is the private key type used to persist a reference to a key
+// held in a PKCS#11 token. The public key keeps the type of the token key.
+const KeyTypePKCS11 = "pkcs11"
+
+// PKCS#11 v3.0 constants for EdDSA, which are missing from the bindings.
+const (
+	ckkECEdwards = 0x00000040
+	ckmEdDSA     = 0x00001057
+)
+
+func init() {
+	keys.SignerMap.Store(KeyTypePKCS11, NewSigner)
+}
+
+func NewSigner() keys.Signer {
+	return &signer{}
+}
+
+// PrivateKeyValue is the keyval of a PKCS#11 signer. It holds the public key
+// of the token key and the URI used to find it. No private key material is
+// stored, but note that the URI may contain the PIN if it has a pin-value
+// attribute.
+type PrivateKeyValue struct {
+	Public *data.PublicKey `json:"public"`
+	URI    string          `json:"uri"`
+}
+
+type signer struct {
+	public   *data.PublicKey
+	verifier keys.Verifier
+	rawURI   string
+	uri      *URI
+
+	mu      sync.Mutex
+	ctx     *p11.Ctx
+	session p11.SessionHandle
+	key     p11.ObjectHandle
+}
+
+// NewSignerFromURI returns a Signer for the ed25519, ECDSA or RSA key found
+// in a token with the given PKCS#11 URI. The public key is read from the
+// token's public key object with the same label or ID.
+func NewSignerFromURI(rawURI string) (keys.Signer, error) {
+	uri, err := ParseURI(rawURI)
+	if err != nil {
+		return nil, err
+	}
+	s := &signer{rawURI: rawURI, uri: uri}
+	if err := s.open(); err != nil {
+		return nil, err
+	}
+	pub, err := s.readPublicKey()
+	if err != nil {
+		s.Close()
+		return nil, err
+	}
+	if s.verifier, err = keys.GetVerifier(pub); err != nil {
+		s.Close()
+		return nil, err
+	}
+	s.public = pub
+	return s, nil
+}
+
+func (s *signer) PublicData() *data.PublicKey {
+	return s.public
+}
+
+func (s *signer) SignMessage(message []byte) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.ctx == nil {
+		if err := s.open(); err != nil {
+			return nil, err
+		}
+	}
+
+	var (
+		mech   *p11.Mechanism
+		digest []byte
+		isEC   bool
+	)
+	switch s.public.Type {
+	case data.KeyTypeEd25519:
+		mech, digest = p11.NewMechanism(ckmEdDSA, nil), message
+	case data.KeyTypeECDSA_SHA2_P256:
+		mech, digest, isEC = p11.NewMechanism(p11.CKM_ECDSA, nil), hashMessage(crypto.SHA256, message), true
+	case data.KeyTypeECDSA_SHA2_P384:
+		mech, digest, isEC = p11.NewMechanism(p11.CKM_ECDSA, nil), hashMessage(crypto.SHA384, message), true
+	case data.KeyTypeECDSA_SHA2_P521:
+		mech, digest, isEC = p11.NewMechanism(p11.CKM_ECDSA, nil), hashMessage(crypto.SHA512, message), true
+	case data.KeyTypeRSASSA_PSS_SHA256:
+		params := p11.NewPSSParams(p11.CKM_SHA256, p11.CKG_MGF1_SHA256, uint(crypto.SHA256.Size()))
+		mech, digest = p11.NewMechanism(p11.CKM_RSA_PKCS_PSS, params), hashMessage(crypto.SHA256, message)
+	default:
+		return nil, fmt.Errorf("tuf: unsupported pkcs11 key type %s", s.public.Type)
+	}
+
+	if err := s.ctx.SignInit(s.session, []*p11.Mechanism{mech}, s.key); err != nil {
+		return nil, fmt.Errorf("tuf: pkcs11 sign init failed: %w", err)
+	}
+	sig, err := s.ctx.Sign(s.session, digest)
+	if err != nil {
+		return nil, fmt.Errorf("tuf: pkcs11 sign failed: %w", err)
+	}
+
+	if isEC {
+		// PKCS#11 returns r || s, TUF expects an ASN.1 DER signature.
+		n := len(sig) / 2
+		sig, err = asn1.Marshal(struct{ R, S *big.Int }{
+			new(big.Int).SetBytes(sig[:n]),
+			new(big.Int).SetBytes(sig[n:]),
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if err := s.verifier.Verify(message, sig); err != nil {
+		return nil, fmt.Errorf("tuf: pkcs11 token returned an invalid signature: %w", err)
+	}
+	return sig, nil
+}
+
+func (s *signer) MarshalPrivateKey() (*data.PrivateKey, error) {
+	valueBytes, err := json.Marshal(PrivateKeyValue{
+		Public: s.public,
+		URI:    s.rawURI,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &data.PrivateKey{
+		Type:  KeyTypePKCS11,
+		Value: valueBytes,
+	}, nil
+}
+
+// UnmarshalPrivateKey loads a reference to a token key. The token is only
+// opened when the first message is signed.
+func (s *signer) UnmarshalPrivateKey(key *data.PrivateKey) error {
+	keyValue := &PrivateKeyValue{}
+
+	// Prepare decoder limited to 512Kb
+	dec := json.NewDecoder(io.LimitReader(bytes.NewReader(key.Value), keys.MaxJSONKeySize))
+
+	// Unmarshal key value
+	if err := dec.Decode(keyValue); err != nil {
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return fmt.Errorf("tuf: the private key is truncated or too large: %w", err)
+		}
+		return err
+	}
+	if keyValue.Public == nil {
+		return errors.New("tuf: pkcs11 key is missing a public key")
+	}
+
+	uri, err := ParseURI(keyValue.URI)
+	if err != nil {
+		return err
+	}
+	verifier, err := keys.GetVerifier(keyValue.Public)
+	if err != nil {
+		return err
+	}
+
+	s.Close()
+	s.public = keyValue.Public
+	s.verifier = verifier
+	s.rawURI = keyValue.URI
+	s.uri = uri
+	return nil
+}
+
+// Close closes the session with the token. The signer reopens it if it is
+// used again. It does not log out, as the login state is shared by all the
+// sessions of the process with the token.
+func (s *signer) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.ctx == nil {
+		return nil
+	}
+	err := s.ctx.CloseSession(s.session)
+	s.ctx = nil
+	return err
+}
+
+var (
+	modulesMu sync.Mutex
+	modules   = map[string]*p11.Ctx{}
+)
+
+// loadModule loads and initializes a PKCS#11 module once per process, since
+// modules can only be initialized once.
+func loadModule(path string) (*p11.Ctx, error) {
+	modulesMu.Lock()
+	defer modulesMu.Unlock()
+
+	if ctx, ok := modules[path]; ok {
+		return ctx, nil
+	}
+	ctx := p11.New(path)
+	if ctx == nil {
+		return nil, fmt.Errorf("tuf: unable to load pkcs11 module %s", path)
+	}
+	if err := ctx.Initialize(); err != nil && !errors.Is(err, p11.Error(p11.CKR_CRYPTOKI_ALREADY_INITIALIZED)) {
+		ctx.Destroy()
+		return nil, fmt.Errorf("tuf: unable to initialize pkcs11 module %s: %w", path, err)
+	}
+	modules[path] = ctx
+	return ctx, nil
+}
+
+func (s *signer) open() error {
+	ctx, err := loadModule(s.uri.ModulePath)
+	if err != nil {
+		return err
+	}
+
+	slot, err := s.findSlot(ctx)
+	if err != nil {
+		return err
+	}
+	session, err := ctx.OpenSession(slot, p11.CKF_SERIAL_SESSION)
+	if err != nil {
+		return fmt.Errorf("tuf: unable to open pkcs11 session: %w", err)
+	}
+	pin, err := s.uri.Pin()
+	if err != nil {
+		ctx.CloseSession(session)
+		return err
+	}
+	if pin != "" {
+		if err := ctx.Login(session, p11.CKU_USER, pin); err != nil && !errors.Is(err, p11.Error(p11.CKR_USER_ALREADY_LOGGED_IN)) {
+			ctx.CloseSession(session)
+			return fmt.Errorf("tuf: unable to log in to pkcs11 token: %w", err)
+		}
+	}
+
+	key, err := findObject(ctx, session, s.uri, p11.CKO_PRIVATE_KEY)
+	if err != nil {
+		ctx.CloseSession(session)
+		return err
+	}
+
+	s.ctx, s.session, s.key = ctx, session, key
+	return nil
+}
+
+func (s *signer) findSlot(ctx *p11.Ctx) (uint, error) {
+	if s.uri.SlotID != nil {
+		return *s.uri.SlotID, nil
+	}
+	slots, err := ctx.GetSlotList(true)
+	if err != nil {
+		return 0, fmt.Errorf("tuf: unable to list pkcs11 slots: %w", err)
+	}
+	for _, slot := range slots {
+		info, err := ctx.GetTokenInfo(slot)
+		if err != nil {
+			return 0, fmt.Errorf("tuf: unable to get pkcs11 token info: %w", err)
+		}
+		if info.Label == s.uri.Token {
+			return slot, nil
+		}
+	}
+	return 0, fmt.Errorf("tuf: pkcs11 token %q not found", s.uri.Token)
+}
+
+func findObject(ctx *p11.Ctx, session p11.SessionHandle, uri *URI, class uint) (p11.ObjectHandle, error) {
+	template := []*p11.Attribute{p11.NewAttribute(p11.CKA_CLASS, class)}
+	if uri.Object != "" {
+		template = append(template, p11.NewAttribute(p11.CKA_LABEL, uri.Object))
+	}
+	if len(uri.ID) > 0 {
+		template = append(template, p11.NewAttribute(p11.CKA_ID, uri.ID))
+	}
+	if err := ctx.FindObjectsInit(session, template); err != nil {
+		return 0, fmt.Errorf("tuf: unable to search pkcs11 objects: %w", err)
+	}
+	objects, _, err := ctx.FindObjects(session, 2)
+	if finalErr := ctx.FindObjectsFinal(session); err == nil {
+		err = finalErr
+	}
+	if err != nil {
+		return 0, fmt.Errorf("tuf: unable to search pkcs11 objects: %w", err)
+	}
+	switch len(objects) {
+	case 0:
+		return 0, fmt.Errorf("tuf: pkcs11 key %q not found", uri.Object)
+	case 1:
+		return objects[0], nil
+	default:
+		return 0, fmt.Errorf("tuf: pkcs11 key %q is ambiguous", uri.Object)
+	}
+}
+
+var (
+	oidEd25519   = asn1.ObjectIdentifier{1, 3, 101, 112}
+	oidNamedP256 = asn1.ObjectIdentifier{1, 2, 840, 10045, 3, 1, 7}
+	oidNamedP384 = asn1.ObjectIdentifier{1, 3, 132, 0, 34}
+	oidNamedP521 = asn1.ObjectIdentifier{1, 3, 132, 0, 35}
+)
+
+// readPublicKey reads the token's public key object matching the URI and
+// returns it in the format used by the keys package signers.
+func (s *signer) readPublicKey() (*data.PublicKey, error) {
+	obj, err := findObject(s.ctx, s.session, s.uri, p11.CKO_PUBLIC_KEY)
+	if err != nil {
+		return nil, err
+	}
+	attrs, err := s.ctx.GetAttributeValue(s.session, obj, []*p11.Attribute{
+		p11.NewAttribute(p11.CKA_KEY_TYPE, nil),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("tuf: unable to read pkcs11 key type: %w", err)
+	}
+
+	keyType := attrs[0].Value
+	isEdwards := bytes.Equal(keyType, ulong(ckkECEdwards))
+	switch {
+	case bytes.Equal(keyType, ulong(p11.CKK_EC)) || isEdwards:
+		attrs, err = s.ctx.GetAttributeValue(s.session, obj, []*p11.Attribute{
+			p11.NewAttribute(p11.CKA_EC_PARAMS, nil),
+			p11.NewAttribute(p11.CKA_EC_POINT, nil),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("tuf: unable to read pkcs11 ec key: %w", err)
+		}
+		point := attrs[1].Value
+		// CKA_EC_POINT is a DER encoded octet string, but some tokens return
+		// the raw point.
+		var raw []byte
+		if rest, err := asn1.Unmarshal(point, &raw); err == nil && len(rest) == 0 {
+			point = raw
+		}
+		if isEdwards {
+			return ed25519PublicKey(point)
+		}
+		return ecdsaPublicKey(attrs[0].Value, point)
+	case bytes.Equal(keyType, ulong(p11.CKK_RSA)):
+		attrs, err = s.ctx.GetAttributeValue(s.session, obj, []*p11.Attribute{
+			p11.NewAttribute(p11.CKA_MODULUS, nil),
+			p11.NewAttribute(p11.CKA_PUBLIC_EXPONENT, nil),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("tuf: unable to read pkcs11 rsa key: %w", err)
+		}
+		return rsaPublicKey(&rsa.PublicKey{
+			N: new(big.Int).SetBytes(attrs[0].Value),
+			E: int(new(big.Int).SetBytes(attrs[1].Value).Int64()),
+		})
+	default:
+		return nil, fmt.Errorf("tuf: unsupported pkcs11 key type %x", keyType)
+	}
+}
+
+func ed25519PublicKey(point []byte) (*data.PublicKey, error) {
+	if len(point) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("tuf: unexpected public key length for ed25519 key, expected %d, got %d", ed25519.PublicKeySize, len(point))
+	}
+	return newPublicKey(data.KeyTypeEd25519, data.KeySchemeEd25519, hex.EncodeToString(point))
+}
+
+func ecdsaPublicKey(params, point []byte) (*data.PublicKey, error) {
+	var oid asn1.ObjectIdentifier
+	if _, err := asn1.Unmarshal(params, &oid); err != nil {
+		return nil, fmt.Errorf("tuf: unsupported pkcs11 ec params: %w", err)
+	}
+	var (
+		curve           elliptic.Curve
+		keyType, scheme string
+	)
+	switch {
+	case oid.Equal(oidNamedP256):
+		curve, keyType, scheme = elliptic.P256(), data.KeyTypeECDSA_SHA2_P256, data.KeySchemeECDSA_SHA2_P256
+	case oid.Equal(oidNamedP384):
+		curve, keyType, scheme = elliptic.P384(), data.KeyTypeECDSA_SHA2_P384, data.KeySchemeECDSA_SHA2_P384
+	case oid.Equal(oidNamedP521):
+		curve, keyType, scheme = elliptic.P521(), data.KeyTypeECDSA_SHA2_P521, data.KeySchemeECDSA_SHA2_P521
+	case oid.Equal(oidEd25519):
+		return ed25519PublicKey(point)
+	default:
+		return nil, fmt.Errorf("tuf: unsupported pkcs11 ec curve %s", oid)
+	}
+	if x, _ := elliptic.Unmarshal(curve, point); x == nil {
+		return nil, errors.New("tuf: invalid ecdsa public key point")
+	}
+	return newPublicKey(keyType, scheme, hex.EncodeToString(point))
+}
+
+func rsaPublicKey(pub *rsa.PublicKey) (*data.PublicKey, error) {
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return nil, err
+	}
+	pubPEM := pem.EncodeToMemory(&pem.Block{
+		Type:  "RSA PUBLIC KEY",
+		Bytes: der,
+	})
+	return newPublicKey(data.KeyTypeRSASSA_PSS_SHA256, data.KeySchemeRSASSA_PSS_SHA256, string(pubPEM))
+}
+
+func newPublicKey(keyType, scheme, public string) (*data.PublicKey, error) {
+	keyValBytes, err := json.Marshal(map[string]string{"public": public})
+	if err != nil {
+		return nil, err
+	}
+	return &data.PublicKey{
+		Type:       keyType,
+		Scheme:     scheme,
+		Algorithms: data.HashAlgorithms,
+		Value:      keyValBytes,
+	}, nil
+}
+
+func hashMessage(h crypto.Hash, message []byte) []byte {
+	hasher := h.New()
+	hasher.Write(message)
+	return hasher.Sum(nil)
+}
+
+// ulong encodes v as a CK_ULONG attribute value, for comparison with values
+// read from the token.
+func ulong(v uint) []byte {
+	return p11.NewAttribute(0, v).Value
+}
@@ -0,0 +1,58 @@
+//go:build !cgo
+
+package pkcs11
+
+import (
+	"errors"
+
+	"github.com/theupdateframework/go-tuf/data"
+	"github.com/theupdateframework/go-tuf/pkg/keys"
+)
+
+// KeyTypePKCS11 is the private key type used to persist a reference to a key
+// held in a PKCS#11 token. The public key keeps the type of the token key.
+const KeyTypePKCS11 = "pkcs11"
+
+// errNoCgo is returned when the package is built without cgo, which is
+// needed to load PKCS#11 modules.
+var errNoCgo = errors.New("tuf: pkcs11 keys are not supported by this build, which does not use cgo")
+
+func init() {
+	keys.SignerMap.Store(KeyTypePKCS11, NewSigner)
+}
+
+func NewSigner() keys.Signer {
+	return &signer{}
+}
+
+// PrivateKeyValue is the keyval of a PKCS#11 signer. It holds the public key
+// of the token key and the URI used to find it.
+type PrivateKeyValue struct {
+	Public *data.PublicKey `json:"public"`
+	URI    string          `json:"uri"`
+}
+
+// NewSignerFromURI always fails, as PKCS#11 modules cannot be loaded
+// without cgo.
+func NewSignerFromURI(rawURI string) (keys.Signer, error) {
+	return nil, errNoCgo
+}
+
+// signer fails to load or use any key.
+type signer struct{}
+
+func (s *signer) PublicData() *data.PublicKey {
+	return nil
+}
+
+func (s *signer) SignMessage(message []byte) ([]byte, error) {
+	return nil, errNoCgo
+}
+
+func (s *signer) MarshalPrivateKey() (*data.PrivateKey, error) {
+	return nil, errNoCgo
+}
+
+func (s *signer) UnmarshalPrivateKey(key *data.PrivateKey) error {
+	return errNoCgo
+}
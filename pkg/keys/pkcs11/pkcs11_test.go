@@ -0,0 +1,191 @@
+//go:build cgo
+
+package pkcs11
+
+import (
+	"encoding/asn1"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	p11 "github.com/miekg/pkcs11"
+	"github.com/theupdateframework/go-tuf/data"
+	"github.com/theupdateframework/go-tuf/pkg/keys"
+	. "gopkg.in/check.v1"
+)
+
+// Hook up gocheck into the "go test" runner.
+func Test(t *testing.T) { TestingT(t) }
+
+const (
+	testTokenLabel = "tuf-test"
+	testUserPin    = "1234"
+	testSOPin      = "123456"
+)
+
+// softHSMModules are the usual install locations of SoftHSM2. The
+// SOFTHSM2_MODULE environment variable takes precedence.
+var softHSMModules = []string{
+	"/usr/lib/softhsm/libsofthsm2.so",
+	"/usr/lib/x86_64-linux-gnu/softhsm/libsofthsm2.so",
+	"/usr/local/lib/softhsm/libsofthsm2.so",
+	"/opt/homebrew/lib/softhsm/libsofthsm2.so",
+}
+
+// SoftHSMSuite runs against a SoftHSM2 token created in a temporary
+// directory. It is skipped if SoftHSM2 is not installed.
+type SoftHSMSuite struct {
+	module string
+	// keyTypes maps the label of each generated key to its TUF key type.
+	keyTypes map[string]string
+}
+
+var _ = Suite(&SoftHSMSuite{})
+
+func findSoftHSM() string {
+	if m := os.Getenv("SOFTHSM2_MODULE"); m != "" {
+		return m
+	}
+	for _, m := range softHSMModules {
+		if _, err := os.Stat(m); err == nil {
+			return m
+		}
+	}
+	return ""
+}
+
+func (s *SoftHSMSuite) SetUpSuite(c *C) {
+	s.module = findSoftHSM()
+	if s.module == "" {
+		c.Skip("SoftHSM2 is not installed")
+	}
+
+	dir := c.MkDir()
+	tokenDir := filepath.Join(dir, "tokens")
+	c.Assert(os.Mkdir(tokenDir, 0700), IsNil)
+	conf := filepath.Join(dir, "softhsm2.conf")
+	c.Assert(os.WriteFile(conf, []byte(fmt.Sprintf("directories.tokendir = %s\nobjectstore.backend = file\n", tokenDir)), 0600), IsNil)
+	os.Setenv("SOFTHSM2_CONF", conf)
+
+	ctx, err := loadModule(s.module)
+	c.Assert(err, IsNil)
+
+	slots, err := ctx.GetSlotList(false)
+	c.Assert(err, IsNil)
+	c.Assert(len(slots) > 0, Equals, true)
+	c.Assert(ctx.InitToken(slots[0], testSOPin, testTokenLabel), IsNil)
+
+	// SoftHSM2 moves the token to a new slot once it is initialized.
+	signer := &signer{uri: &URI{Token: testTokenLabel}}
+	slot, err := signer.findSlot(ctx)
+	c.Assert(err, IsNil)
+	session, err := ctx.OpenSession(slot, p11.CKF_SERIAL_SESSION|p11.CKF_RW_SESSION)
+	c.Assert(err, IsNil)
+	defer ctx.CloseSession(session)
+	c.Assert(ctx.Login(session, p11.CKU_SO, testSOPin), IsNil)
+	c.Assert(ctx.InitPIN(session, testUserPin), IsNil)
+	c.Assert(ctx.Logout(session), IsNil)
+	c.Assert(ctx.Login(session, p11.CKU_USER, testUserPin), IsNil)
+
+	s.keyTypes = map[string]string{}
+	for label, curve := range map[string]asn1.ObjectIdentifier{
+		"p256": oidNamedP256,
+		"p384": oidNamedP384,
+	} {
+		params, err := asn1.Marshal(curve)
+		c.Assert(err, IsNil)
+		c.Assert(generateKeyPair(ctx, session, label, p11.CKM_EC_KEY_PAIR_GEN, []*p11.Attribute{
+			p11.NewAttribute(p11.CKA_EC_PARAMS, params),
+		}), IsNil)
+	}
+	s.keyTypes["p256"] = data.KeyTypeECDSA_SHA2_P256
+	s.keyTypes["p384"] = data.KeyTypeECDSA_SHA2_P384
+
+	c.Assert(generateKeyPair(ctx, session, "rsa", p11.CKM_RSA_PKCS_KEY_PAIR_GEN, []*p11.Attribute{
+		p11.NewAttribute(p11.CKA_MODULUS_BITS, 2048),
+		p11.NewAttribute(p11.CKA_PUBLIC_EXPONENT, []byte{1, 0, 1}),
+	}), IsNil)
+	s.keyTypes["rsa"] = data.KeyTypeRSASSA_PSS_SHA256
+
+	// Not all SoftHSM2 builds support EdDSA.
+	params, err := asn1.Marshal(oidEd25519)
+	c.Assert(err, IsNil)
+	if generateKeyPair(ctx, session, "ed25519", 0x00001055 /* CKM_EC_EDWARDS_KEY_PAIR_GEN */, []*p11.Attribute{
+		p11.NewAttribute(p11.CKA_EC_PARAMS, params),
+	}) == nil {
+		s.keyTypes["ed25519"] = data.KeyTypeEd25519
+	}
+}
+
+func generateKeyPair(ctx *p11.Ctx, session p11.SessionHandle, label string, mech uint, publicAttrs []*p11.Attribute) error {
+	public := append([]*p11.Attribute{
+		p11.NewAttribute(p11.CKA_TOKEN, true),
+		p11.NewAttribute(p11.CKA_VERIFY, true),
+		p11.NewAttribute(p11.CKA_LABEL, label),
+		p11.NewAttribute(p11.CKA_ID, []byte(label)),
+	}, publicAttrs...)
+	private := []*p11.Attribute{
+		p11.NewAttribute(p11.CKA_TOKEN, true),
+		p11.NewAttribute(p11.CKA_SIGN, true),
+		p11.NewAttribute(p11.CKA_PRIVATE, true),
+		p11.NewAttribute(p11.CKA_SENSITIVE, true),
+		p11.NewAttribute(p11.CKA_LABEL, label),
+		p11.NewAttribute(p11.CKA_ID, []byte(label)),
+	}
+	_, _, err := ctx.GenerateKeyPair(session, []*p11.Mechanism{p11.NewMechanism(mech, nil)}, public, private)
+	return err
+}
+
+func (s *SoftHSMSuite) uri(object string) string {
+	return fmt.Sprintf("pkcs11:token=%s;object=%s?module-path=%s&pin-value=%s", testTokenLabel, object, s.module, testUserPin)
+}
+
+func (s *SoftHSMSuite) TestSignVerify(c *C) {
+	for label, keyType := range s.keyTypes {
+		signer, err := NewSignerFromURI(s.uri(label))
+		c.Assert(err, IsNil, Commentf("key: %s", label))
+		c.Assert(signer.PublicData().Type, Equals, keyType)
+
+		msg := []byte("foo")
+		sig, err := signer.SignMessage(msg)
+		c.Assert(err, IsNil, Commentf("key: %s", label))
+		verifier, err := keys.GetVerifier(signer.PublicData())
+		c.Assert(err, IsNil)
+		c.Assert(verifier.Verify(msg, sig), IsNil)
+	}
+}
+
+func (s *SoftHSMSuite) TestMarshalUnmarshalPrivateKey(c *C) {
+	for label := range s.keyTypes {
+		signer, err := NewSignerFromURI(s.uri(label))
+		c.Assert(err, IsNil)
+		privKey, err := signer.MarshalPrivateKey()
+		c.Assert(err, IsNil)
+		c.Assert(privKey.Type, Equals, KeyTypePKCS11)
+
+		unmarshalled, err := keys.GetSigner(privKey)
+		c.Assert(err, IsNil)
+		c.Assert(unmarshalled.PublicData().IDs(), DeepEquals, signer.PublicData().IDs())
+
+		msg := []byte("foo")
+		sig, err := unmarshalled.SignMessage(msg)
+		c.Assert(err, IsNil)
+		verifier, err := keys.GetVerifier(signer.PublicData())
+		c.Assert(err, IsNil)
+		c.Assert(verifier.Verify(msg, sig), IsNil)
+	}
+}
+
+func (s *SoftHSMSuite) TestNewSignerFromURI_NotFound(c *C) {
+	_, err := NewSignerFromURI(s.uri("missing"))
+	c.Assert(err, ErrorMatches, `tuf: pkcs11 key "missing" not found`)
+
+	_, err = NewSignerFromURI(fmt.Sprintf("pkcs11:token=missing;object=p256?module-path=%s", s.module))
+	c.Assert(err, ErrorMatches, `tuf: pkcs11 token "missing" not found`)
+}
+
+func (s *SoftHSMSuite) TestWrongPin(c *C) {
+	_, err := NewSignerFromURI(fmt.Sprintf("pkcs11:token=%s;object=p256?module-path=%s&pin-value=0000", testTokenLabel, s.module))
+	c.Assert(err, ErrorMatches, "tuf: unable to log in to pkcs11 token: .*")
+}
@@ -0,0 +1,138 @@
+package pkcs11
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// PinEnvVar is read for the user PIN when a URI has neither a pin-value nor
+// a pin-source attribute, so that the PIN does not need to be persisted in
+// the keys directory.
+const PinEnvVar = "TUF_PKCS11_PIN"
+
+// URI is the subset of an RFC 7512 PKCS#11 URI used to locate a signing key,
+// e.g.
+//
+//	pkcs11:token=tuf;object=timestamp?module-path=/usr/lib/softhsm/libsofthsm2.so&pin-source=file:/etc/tuf/pin
+type URI struct {
+	// Token is the label of the token holding the key.
+	Token string
+	// SlotID selects the slot directly, if set.
+	SlotID *uint
+	// Object is the label of the key objects.
+	Object string
+	// ID is the CKA_ID of the key objects.
+	ID []byte
+
+	// ModulePath is the path to the PKCS#11 module to load.
+	ModulePath string
+	// PinValue is the user PIN.
+	PinValue string
+	// PinSource is a file the user PIN is read from.
+	PinSource string
+}
+
+// ParseURI parses a PKCS#11 URI.
+func ParseURI(s string) (*URI, error) {
+	rest := strings.TrimPrefix(s, "pkcs11:")
+	if rest == s {
+		return nil, fmt.Errorf("tuf: invalid pkcs11 uri %q: missing pkcs11 scheme", s)
+	}
+	path, query := rest, ""
+	if i := strings.IndexByte(rest, '?'); i >= 0 {
+		path, query = rest[:i], rest[i+1:]
+	}
+
+	u := &URI{}
+	for _, attr := range splitAttrs(path, ";") {
+		k, v, err := parseAttr(attr)
+		if err != nil {
+			return nil, fmt.Errorf("tuf: invalid pkcs11 uri %q: %w", s, err)
+		}
+		switch k {
+		case "token":
+			u.Token = v
+		case "object":
+			u.Object = v
+		case "id":
+			u.ID = []byte(v)
+		case "slot-id":
+			id, err := strconv.ParseUint(v, 10, 0)
+			if err != nil {
+				return nil, fmt.Errorf("tuf: invalid pkcs11 uri %q: invalid slot-id: %w", s, err)
+			}
+			slotID := uint(id)
+			u.SlotID = &slotID
+		}
+	}
+	for _, attr := range splitAttrs(query, "&") {
+		k, v, err := parseAttr(attr)
+		if err != nil {
+			return nil, fmt.Errorf("tuf: invalid pkcs11 uri %q: %w", s, err)
+		}
+		switch k {
+		case "module-path":
+			u.ModulePath = v
+		case "pin-value":
+			u.PinValue = v
+		case "pin-source":
+			u.PinSource = v
+		}
+	}
+
+	if u.ModulePath == "" {
+		return nil, fmt.Errorf("tuf: invalid pkcs11 uri %q: missing module-path", s)
+	}
+	if u.Token == "" && u.SlotID == nil {
+		return nil, fmt.Errorf("tuf: invalid pkcs11 uri %q: missing token or slot-id", s)
+	}
+	if u.Object == "" && len(u.ID) == 0 {
+		return nil, fmt.Errorf("tuf: invalid pkcs11 uri %q: missing object or id", s)
+	}
+	return u, nil
+}
+
+func splitAttrs(s, sep string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, sep)
+}
+
+func parseAttr(attr string) (string, string, error) {
+	i := strings.IndexByte(attr, '=')
+	if i < 0 {
+		return "", "", fmt.Errorf("invalid attribute %q", attr)
+	}
+	v, err := url.PathUnescape(attr[i+1:])
+	if err != nil {
+		return "", "", fmt.Errorf("invalid attribute %q: %w", attr, err)
+	}
+	return attr[:i], v, nil
+}
+
+// Pin returns the user PIN from the pin-value or pin-source attributes, or
+// from the TUF_PKCS11_PIN environment variable. An empty PIN means no login
+// is needed.
+func (u *URI) Pin() (string, error) {
+	if u.PinValue != "" {
+		return u.PinValue, nil
+	}
+	if u.PinSource != "" {
+		path := strings.TrimPrefix(u.PinSource, "file:")
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return "", fmt.Errorf("tuf: error reading pkcs11 pin-source: %w", err)
+		}
+		pin := strings.TrimRight(string(b), "\r\n")
+		if pin == "" {
+			return "", errors.New("tuf: empty pkcs11 pin-source")
+		}
+		return pin, nil
+	}
+	return os.Getenv(PinEnvVar), nil
+}
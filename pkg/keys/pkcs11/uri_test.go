@@ -0,0 +1,64 @@
+package pkcs11
+
+import (
+	"os"
+	"path/filepath"
+
+	. "gopkg.in/check.v1"
+)
+
+type URISuite struct{}
+
+var _ = Suite(&URISuite{})
+
+func (URISuite) TestParseURI(c *C) {
+	u, err := ParseURI("pkcs11:token=My%20Token;object=timestamp;id=%01%02?module-path=/usr/lib/softhsm/libsofthsm2.so&pin-value=1234")
+	c.Assert(err, IsNil)
+	c.Assert(u.Token, Equals, "My Token")
+	c.Assert(u.Object, Equals, "timestamp")
+	c.Assert(u.ID, DeepEquals, []byte{1, 2})
+	c.Assert(u.SlotID, IsNil)
+	c.Assert(u.ModulePath, Equals, "/usr/lib/softhsm/libsofthsm2.so")
+	c.Assert(u.PinValue, Equals, "1234")
+
+	u, err = ParseURI("pkcs11:slot-id=3;id=%ab?module-path=/lib/p11.so")
+	c.Assert(err, IsNil)
+	c.Assert(*u.SlotID, Equals, uint(3))
+	c.Assert(u.ID, DeepEquals, []byte{0xab})
+}
+
+func (URISuite) TestParseURI_Invalid(c *C) {
+	for uri, msg := range map[string]string{
+		"token=foo;object=bar?module-path=/lib/p11.so":    ".*missing pkcs11 scheme",
+		"pkcs11:token=foo;object=bar":                     ".*missing module-path",
+		"pkcs11:object=bar?module-path=/lib/p11.so":       ".*missing token or slot-id",
+		"pkcs11:token=foo?module-path=/lib/p11.so":        ".*missing object or id",
+		"pkcs11:token=foo;object?module-path=/lib/p11.so": `.*invalid attribute "object"`,
+		"pkcs11:slot-id=x;id=%01?module-path=/lib/p11.so": ".*invalid slot-id.*",
+		"pkcs11:token=foo;id=%zz?module-path=/lib/p11.so": `.*invalid attribute "id=%zz".*`,
+	} {
+		_, err := ParseURI(uri)
+		c.Assert(err, ErrorMatches, msg, Commentf("uri: %s", uri))
+	}
+}
+
+func (URISuite) TestPin(c *C) {
+	u := &URI{PinValue: "1234"}
+	pin, err := u.Pin()
+	c.Assert(err, IsNil)
+	c.Assert(pin, Equals, "1234")
+
+	pinFile := filepath.Join(c.MkDir(), "pin")
+	c.Assert(os.WriteFile(pinFile, []byte("5678\n"), 0600), IsNil)
+	u = &URI{PinSource: "file:" + pinFile}
+	pin, err = u.Pin()
+	c.Assert(err, IsNil)
+	c.Assert(pin, Equals, "5678")
+
+	os.Setenv(PinEnvVar, "9012")
+	defer os.Unsetenv(PinEnvVar)
+	u = &URI{}
+	pin, err = u.Pin()
+	c.Assert(err, IsNil)
+	c.Assert(pin, Equals, "9012")
+}
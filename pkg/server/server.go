@@ -0,0 +1,161 @@
+// Package server serves a committed TUF repository over HTTP.
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Options configures the URL layout of a repository handler. The paths match
+// the ones of client.HTTPRemoteOptions, so that a client configured with the
+// same paths can update from the handler.
+type Options struct {
+	// MetadataPath is the URL path metadata files are served under, which
+	// is the root by default.
+	MetadataPath string
+
+	// TargetsPath is the URL path target files are served under, which is
+	// "targets" by default.
+	TargetsPath string
+}
+
+// NewHandler returns a handler serving the committed repository in
+// repoDir, which is the "repository" directory of a tuf.FileSystemStore.
+// Only metadata files and the files in the targets directory are served,
+// so the staged files and keys next to repoDir are never exposed, even
+// through symlinks.
+//
+// Responses support Range requests and conditional requests with ETags.
+func NewHandler(repoDir string, opts *Options) http.Handler {
+	if opts == nil {
+		opts = &Options{}
+	}
+	targetsPath := opts.TargetsPath
+	if targetsPath == "" {
+		targetsPath = "targets"
+	}
+	return &handler{
+		repoDir:      repoDir,
+		metadataPath: cleanPrefix(opts.MetadataPath),
+		targetsPath:  cleanPrefix(targetsPath),
+	}
+}
+
+type handler struct {
+	repoDir      string
+	metadataPath string
+	targetsPath  string
+}
+
+// cleanPrefix returns p as a URL path prefix with leading and trailing
+// slashes, e.g. "/targets/".
+func cleanPrefix(p string) string {
+	p = path.Clean("/" + p)
+	if p == "/" {
+		return p
+	}
+	return p + "/"
+}
+
+func (h *handler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Resolve the repository once, so that all the files of a request come
+	// from the same generation of a repository that is a symlink, as with
+	// tuf.FileSystemStoreWithGenerations, even if it is switched meanwhile.
+	root, err := filepath.EvalSymlinks(h.repoDir)
+	if err != nil {
+		http.NotFound(w, req)
+		return
+	}
+
+	urlPath := path.Clean("/" + req.URL.Path)
+	for _, file := range h.files(urlPath) {
+		f, info, err := open(root, file.path)
+		if err != nil {
+			continue
+		}
+		defer f.Close()
+
+		w.Header().Set("ETag", fmt.Sprintf(`"%x-%x"`, info.ModTime().UnixNano(), info.Size()))
+		if file.metadata {
+			// Metadata files other than the versioned ones are updated in
+			// place, so clients should always revalidate them.
+			w.Header().Set("Cache-Control", "no-cache")
+		}
+		http.ServeContent(w, req, info.Name(), info.ModTime(), f)
+		return
+	}
+	http.NotFound(w, req)
+}
+
+// errOutsideRepo is returned for files that are symlinks to files outside
+// the repository directory.
+var errOutsideRepo = errors.New("file is outside the repository")
+
+// open opens the regular file at name, relative to the resolved repository
+// directory root. It must resolve to a file in root, so that symlinks cannot
+// expose the staged files or keys.
+func open(root, name string) (*os.File, os.FileInfo, error) {
+	resolved, err := filepath.EvalSymlinks(filepath.Join(root, name))
+	if err != nil {
+		return nil, nil, err
+	}
+	rel, err := filepath.Rel(root, resolved)
+	if err != nil {
+		return nil, nil, err
+	}
+	if rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return nil, nil, errOutsideRepo
+	}
+
+	f, err := os.Open(resolved)
+	if err != nil {
+		return nil, nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+	if !info.Mode().IsRegular() {
+		f.Close()
+		return nil, nil, fmt.Errorf("%s is not a regular file", name)
+	}
+	return f, info, nil
+}
+
+type file struct {
+	path     string
+	metadata bool
+}
+
+// files returns the files a URL path may refer to, relative to the repository
+// directory, in the order they should be tried.
+func (h *handler) files(urlPath string) []file {
+	files := []file{}
+
+	// Metadata files are all in the top-level directory.
+	if name := strings.TrimPrefix(urlPath, h.metadataPath); name != urlPath {
+		name = strings.TrimPrefix(name, "/")
+		if name != "" && !strings.Contains(name, "/") && path.Ext(name) == ".json" {
+			files = append(files, file{path: name, metadata: true})
+		}
+	}
+
+	if name := strings.TrimPrefix(urlPath, h.targetsPath); name != urlPath {
+		if name != "" {
+			files = append(files, file{path: filepath.Join("targets", filepath.FromSlash(name))})
+		}
+	}
+	return files
+}
@@ -0,0 +1,158 @@
+package server
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeFile(t *testing.T, path, content string) {
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+	require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+}
+
+// newRepoDir returns a directory laid out like a tuf.FileSystemStore.
+func newRepoDir(t *testing.T) string {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "repository", "root.json"), `{"root":1}`)
+	writeFile(t, filepath.Join(dir, "repository", "1.root.json"), `{"root":1}`)
+	writeFile(t, filepath.Join(dir, "repository", "targets", "foo.txt"), "foo")
+	writeFile(t, filepath.Join(dir, "repository", "targets", "dir", "bar.json"), "0123456789")
+	writeFile(t, filepath.Join(dir, "staged", "root.json"), `{"staged":1}`)
+	writeFile(t, filepath.Join(dir, "keys", "root.json"), `{"secret":1}`)
+	return dir
+}
+
+func get(t *testing.T, h http.Handler, target string, header map[string]string) *http.Response {
+	req := httptest.NewRequest(http.MethodGet, target, nil)
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	return w.Result()
+}
+
+func body(t *testing.T, res *http.Response) string {
+	b, err := io.ReadAll(res.Body)
+	require.NoError(t, err)
+	return string(b)
+}
+
+func TestHandler(t *testing.T) {
+	dir := newRepoDir(t)
+	h := NewHandler(filepath.Join(dir, "repository"), nil)
+
+	res := get(t, h, "/root.json", nil)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Equal(t, `{"root":1}`, body(t, res))
+	assert.Equal(t, "10", res.Header.Get("Content-Length"))
+	assert.Equal(t, "application/json", res.Header.Get("Content-Type"))
+	assert.Equal(t, "no-cache", res.Header.Get("Cache-Control"))
+	etag := res.Header.Get("ETag")
+	assert.NotEmpty(t, etag)
+
+	res = get(t, h, "/root.json", map[string]string{"If-None-Match": etag})
+	assert.Equal(t, http.StatusNotModified, res.StatusCode)
+
+	res = get(t, h, "/1.root.json", nil)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+
+	res = get(t, h, "/targets/foo.txt", nil)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Equal(t, "foo", body(t, res))
+	assert.Empty(t, res.Header.Get("Cache-Control"))
+
+	res = get(t, h, "/targets/dir/bar.json", map[string]string{"Range": "bytes=4-"})
+	assert.Equal(t, http.StatusPartialContent, res.StatusCode)
+	assert.Equal(t, "456789", body(t, res))
+	assert.Equal(t, "6", res.Header.Get("Content-Length"))
+	assert.Equal(t, "bytes 4-9/10", res.Header.Get("Content-Range"))
+
+	for _, target := range []string{
+		"/",
+		"/targets/",
+		"/targets/dir",
+		"/targets/missing.txt",
+		"/targets/../root.json/x",
+		"/../staged/root.json",
+		"/../keys/root.json",
+		"/staged/root.json",
+		"/keys/root.json",
+		"/targets/../../keys/root.json",
+		"/repository/root.json",
+	} {
+		res := get(t, h, target, nil)
+		assert.Equal(t, http.StatusNotFound, res.StatusCode, target)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/root.json", nil)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+	assert.Equal(t, "GET, HEAD", w.Header().Get("Allow"))
+}
+
+func TestHandlerPaths(t *testing.T) {
+	dir := newRepoDir(t)
+	h := NewHandler(filepath.Join(dir, "repository"), &Options{
+		MetadataPath: "/metadata",
+		TargetsPath:  "files/",
+	})
+
+	res := get(t, h, "/metadata/root.json", nil)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Equal(t, `{"root":1}`, body(t, res))
+
+	res = get(t, h, "/files/dir/bar.json", nil)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Equal(t, "0123456789", body(t, res))
+
+	for _, target := range []string{"/root.json", "/targets/foo.txt", "/metadatax/root.json"} {
+		res := get(t, h, target, nil)
+		assert.Equal(t, http.StatusNotFound, res.StatusCode, target)
+	}
+}
+
+func TestHandlerSymlinks(t *testing.T) {
+	dir := newRepoDir(t)
+	repoDir := filepath.Join(dir, "repository")
+	h := NewHandler(repoDir, nil)
+
+	// Symlinks to files outside the repository are not followed.
+	require.NoError(t, os.Symlink(filepath.Join(dir, "keys", "root.json"), filepath.Join(repoDir, "targets", "keys.json")))
+	require.NoError(t, os.Symlink(filepath.Join(dir, "staged"), filepath.Join(repoDir, "targets", "staged")))
+	require.NoError(t, os.Symlink("../staged/root.json", filepath.Join(repoDir, "staged.json")))
+	for _, target := range []string{"/targets/keys.json", "/targets/staged/root.json", "/staged.json"} {
+		assert.Equal(t, http.StatusNotFound, get(t, h, target, nil).StatusCode, target)
+	}
+
+	// Symlinks within the repository are.
+	require.NoError(t, os.Symlink("foo.txt", filepath.Join(repoDir, "targets", "link.txt")))
+	res := get(t, h, "/targets/link.txt", nil)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Equal(t, "foo", body(t, res))
+
+	// So is a repository directory that is itself a symlink.
+	link := filepath.Join(dir, "link")
+	require.NoError(t, os.Symlink(repoDir, link))
+	h = NewHandler(link, nil)
+	res = get(t, h, "/targets/foo.txt", nil)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Equal(t, "foo", body(t, res))
+
+	// Switching the symlink to another directory serves files from there.
+	gen := filepath.Join(dir, "gen")
+	writeFile(t, filepath.Join(gen, "targets", "foo.txt"), "foo v2")
+	require.NoError(t, os.Remove(link))
+	require.NoError(t, os.Symlink(gen, link))
+	res = get(t, h, "/targets/foo.txt", nil)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Equal(t, "foo v2", body(t, res))
+}
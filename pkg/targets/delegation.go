@@ -82,6 +82,9 @@ func (d *delegationsIterator) Add(roles []data.DelegatedRole, delegator string,
 			return err
 		}
 		if matchesPath {
+			if r.IsSuccinct() {
+				r = succinctBinRole(r, d.target)
+			}
 			delegation := Delegation{
 				Delegator: delegator,
 				Delegatee: r,
@@ -93,3 +96,14 @@ func (d *delegationsIterator) Add(roles []data.DelegatedRole, delegator string,
 
 	return nil
 }
+
+// succinctBinRole returns the role a succinct hash bin delegation delegates
+// target to. As in TAP 15, the bin roles are terminating.
+func succinctBinRole(r data.DelegatedRole, target string) data.DelegatedRole {
+	return data.DelegatedRole{
+		Name:        r.SuccinctRoleNameForPath(target),
+		KeyIDs:      r.KeyIDs,
+		Threshold:   r.Threshold,
+		Terminating: true,
+	}
+}
@@ -184,6 +184,19 @@ func TestDelegationsIterator(t *testing.T) {
 			file:        "",
 			resultOrder: []string{"targets", "b", "d", "c"},
 		},
+		{
+			testName: "succinct hash bins",
+			roles: map[string][]data.DelegatedRole{
+				"targets": {
+					{Name: "bins", Threshold: 1, KeyIDs: defaultKeyIDs, BitLength: 4, NamePrefix: "bins"},
+					{Name: "e", Paths: defaultPathPatterns, Threshold: 1, KeyIDs: defaultKeyIDs},
+				},
+			},
+			// The SHA-256 hash of /file3.txt starts with 8, and the bins
+			// are terminating.
+			file:        "/file3.txt",
+			resultOrder: []string{"targets", "bins-8"},
+		},
 		{
 			testName: "simple cycle",
 			roles: map[string][]data.DelegatedRole{
@@ -4,11 +4,19 @@ import (
 	"fmt"
 	"strconv"
 	"strings"
+
+	"github.com/theupdateframework/go-tuf/data"
 )
 
 const MinDelegationHashPrefixBitLen = 1
 const MaxDelegationHashPrefixBitLen = 32
 
+// MaxSuccinctHashBinsBitLen is the largest bit length of succinct hash bins
+// that a repository can set up, as the metadata of all 2^bitLen bins is
+// staged when they are delegated to. Clients accept succinct hash bin
+// delegations up to data.MaxSuccinctBitLength.
+const MaxSuccinctHashBinsBitLen = 16
+
 // hexEncode formats x as a hex string. The hex string is left padded with
 // zeros to padWidth, if necessary.
 func hexEncode(x uint64, padWidth int) string {
@@ -36,6 +44,7 @@ type HashBins struct {
 	rolePrefix  string
 	bitLen      int
 	hexDigitLen int
+	succinct    bool
 
 	numBins           uint64
 	numPrefixesPerBin uint64
@@ -62,6 +71,49 @@ func NewHashBins(rolePrefix string, bitLen int) (*HashBins, error) {
 	}, nil
 }
 
+// NewSuccinctHashBins creates a HashBins partitioning with 2^bitLen buckets
+// that is delegated to with a single succinct hash bin delegation (TAP 15).
+// The bins' roles are named namePrefix, a dash and the bin number in hex.
+// bitLen must be at most MaxSuccinctHashBinsBitLen.
+func NewSuccinctHashBins(namePrefix string, bitLen int) (*HashBins, error) {
+	if namePrefix == "" {
+		return nil, fmt.Errorf("namePrefix must not be empty")
+	}
+	if bitLen > MaxSuccinctHashBinsBitLen {
+		return nil, fmt.Errorf("bitLen is out of bounds, should be between %v and %v inclusive for succinct hash bins", MinDelegationHashPrefixBitLen, MaxSuccinctHashBinsBitLen)
+	}
+	hb, err := NewHashBins(namePrefix, bitLen)
+	if err != nil {
+		return nil, err
+	}
+	hb.succinct = true
+	return hb, nil
+}
+
+// Succinct reports whether the bins are delegated to with a single succinct
+// hash bin delegation.
+func (hb *HashBins) Succinct() bool {
+	return hb.succinct
+}
+
+// RolePrefix returns the prefix of the names of the bins' roles.
+func (hb *HashBins) RolePrefix() string {
+	return hb.rolePrefix
+}
+
+// SuccinctDelegatedRole returns the succinct hash bin delegation to the bins,
+// named after the prefix of the bins' names.
+func (hb *HashBins) SuccinctDelegatedRole(keyIDs []string, threshold int) data.DelegatedRole {
+	return data.DelegatedRole{
+		Name:        hb.rolePrefix,
+		KeyIDs:      keyIDs,
+		Threshold:   threshold,
+		Terminating: true,
+		BitLength:   hb.bitLen,
+		NamePrefix:  hb.rolePrefix,
+	}
+}
+
 // NumBins returns the number of hash bin partitions.
 func (hb *HashBins) NumBins() uint64 {
 	return hb.numBins
@@ -76,6 +128,8 @@ func (hb *HashBins) GetBin(i uint64) *HashBin {
 	return &HashBin{
 		rolePrefix:  hb.rolePrefix,
 		hexDigitLen: hb.hexDigitLen,
+		succinct:    hb.succinct,
+		index:       i,
 		first:       i * hb.numPrefixesPerBin,
 		last:        ((i + 1) * hb.numPrefixesPerBin) - 1,
 	}
@@ -87,10 +141,18 @@ type HashBin struct {
 	hexDigitLen int
 	first       uint64
 	last        uint64
+
+	// succinct bins are named after their index rather than their range
+	succinct bool
+	index    uint64
 }
 
 // RoleName returns the name of the role that signs for the HashBin.
 func (b *HashBin) RoleName() string {
+	if b.succinct {
+		return b.rolePrefix + "-" + hexEncode(b.index, b.hexDigitLen)
+	}
+
 	if b.first == b.last {
 		return b.rolePrefix + hexEncode(b.first, b.hexDigitLen)
 	}
@@ -4,6 +4,7 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/theupdateframework/go-tuf/data"
 )
 
 func BenchmarkHexEncode1(b *testing.B) {
@@ -117,3 +118,39 @@ func TestHashBins(t *testing.T) {
 	_, err = NewHashBins("", 33)
 	assert.Error(t, err)
 }
+
+func TestSuccinctHashBins(t *testing.T) {
+	hbs, err := NewSuccinctHashBins("bins", 5)
+	assert.NoError(t, err)
+	assert.True(t, hbs.Succinct())
+
+	d := hbs.SuccinctDelegatedRole([]string{"k1"}, 1)
+	assert.Equal(t, data.DelegatedRole{
+		Name:        "bins",
+		KeyIDs:      []string{"k1"},
+		Threshold:   1,
+		Terminating: true,
+		BitLength:   5,
+		NamePrefix:  "bins",
+	}, d)
+
+	// The bins cover the same hash prefixes as explicit bins, and are
+	// named the way the succinct delegation names them.
+	explicit, err := NewHashBins("bins", 5)
+	assert.NoError(t, err)
+	for i := uint64(0); i < hbs.NumBins(); i++ {
+		b := hbs.GetBin(i)
+		assert.Equal(t, d.SuccinctRoleName(i), b.RoleName())
+		assert.Equal(t, explicit.GetBin(i).HashPrefixes(), b.HashPrefixes())
+		assert.True(t, d.IsSuccinctRoleName(b.RoleName()))
+	}
+
+	_, err = NewSuccinctHashBins("", 5)
+	assert.Error(t, err)
+	_, err = NewSuccinctHashBins("bins", 33)
+	assert.Error(t, err)
+	_, err = NewSuccinctHashBins("bins", MaxSuccinctHashBinsBitLen+1)
+	assert.Error(t, err)
+	_, err = NewSuccinctHashBins("bins", MaxSuccinctHashBinsBitLen)
+	assert.NoError(t, err)
+}
@@ -2,12 +2,14 @@ package tuf
 
 import (
 	"bytes"
+	"crypto/elliptic"
 	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"path"
+	"reflect"
 	"sort"
 	"strings"
 	"time"
@@ -96,11 +98,16 @@ func (r *Repo) Init(consistentSnapshot bool) error {
 }
 
 func (r *Repo) topLevelKeysDB() (*verify.DB, error) {
-	db := verify.NewDB()
 	root, err := r.root()
 	if err != nil {
 		return nil, err
 	}
+	return rootKeysDB(root)
+}
+
+// rootKeysDB returns a key DB for the top-level roles of the given root.
+func rootKeysDB(root *data.Root) (*verify.DB, error) {
+	db := verify.NewDB()
 	for id, k := range root.Keys {
 		if err := db.AddKey(id, k); err != nil {
 			return nil, err
@@ -312,7 +319,17 @@ func (r *Repo) GenKeyWithExpires(keyRole string, expires time.Time) (keyids []st
 	// Not compatible with delegated targets roles, since delegated targets keys
 	// are associated with a delegation (edge), not a role (node).
 
-	signer, err := keys.GenerateEd25519Key()
+	return r.GenKeyWithTypeAndExpires(keyRole, data.KeyTypeEd25519, expires)
+}
+
+// GenKeyWithTypeAndExpires generates a new signing key of the given key type
+// (e.g. data.KeyTypeECDSA_SHA2_P256), saves it in the local store and adds
+// it to the role in the root metadata.
+func (r *Repo) GenKeyWithTypeAndExpires(keyRole string, keyType string, expires time.Time) (keyids []string, err error) {
+	// Not compatible with delegated targets roles, since delegated targets keys
+	// are associated with a delegation (edge), not a role (node).
+
+	signer, err := generateSigner(keyType)
 	if err != nil {
 		return []string{}, err
 	}
@@ -324,6 +341,51 @@ func (r *Repo) GenKeyWithExpires(keyRole string, expires time.Time) (keyids []st
 	return
 }
 
+// GenDelegatedKey generates a new signing key of the given key type and saves
+// it in the local store for each of the given delegated targets roles, so
+// that their metadata can be signed. No metadata is changed: the returned
+// public key has to be added to the delegations with AddDelegatedRole.
+//
+// A key for hash bins only needs saving once, under the prefix of the bins'
+// names, as the bins are signed with the keys saved for it.
+func (r *Repo) GenDelegatedKey(keyType string, delegatees []string) (*data.PublicKey, error) {
+	for _, role := range delegatees {
+		if !roles.IsDelegatedTargetsRole(role) {
+			return nil, ErrInvalidRole{role, "only delegated targets roles are supported"}
+		}
+	}
+
+	signer, err := generateSigner(keyType)
+	if err != nil {
+		return nil, err
+	}
+	for _, role := range delegatees {
+		if err := r.local.SaveSigner(role, signer); err != nil {
+			return nil, err
+		}
+	}
+	return signer.PublicData(), nil
+}
+
+func generateSigner(keyType string) (keys.Signer, error) {
+	switch keyType {
+	case data.KeyTypeEd25519:
+		return keys.GenerateEd25519Key()
+	case data.KeyTypeECDSA_SHA2_P256:
+		return keys.GenerateEcdsaKeyWithCurve(elliptic.P256())
+	case data.KeyTypeECDSA_SHA2_P384:
+		return keys.GenerateEcdsaKeyWithCurve(elliptic.P384())
+	case data.KeyTypeECDSA_SHA2_P521:
+		return keys.GenerateEcdsaKeyWithCurve(elliptic.P521())
+	default:
+		return nil, ErrUnsupportedKeyType{keyType}
+	}
+}
+
+// AddPrivateKey saves the signer in the local store and adds its public key
+// to the role in the root metadata. The signer does not have to hold private
+// key material: see keys.NewCommandSignerFromKey for signing with a key held
+// by an external process.
 func (r *Repo) AddPrivateKey(role string, signer keys.Signer) error {
 	// Not compatible with delegated targets roles, since delegated targets keys
 	// are associated with a delegation (edge), not a role (node).
@@ -534,7 +596,14 @@ func (r *Repo) AddDelegatedRole(delegator string, delegatedRole data.DelegatedRo
 // role specified in the role argument. Key IDs referenced in role.KeyIDs
 // should have corresponding Key entries in the keys argument. New metadata is
 // written with the given expiration time.
+//
+// The metadata of every role a succinct hash bin delegation delegates to is
+// staged, so its BitLength must be at most
+// targets.MaxSuccinctHashBinsBitLen.
 func (r *Repo) AddDelegatedRoleWithExpires(delegator string, delegatedRole data.DelegatedRole, keys []*data.PublicKey, expires time.Time) error {
+	if err := validateDelegatedRole(delegatedRole); err != nil {
+		return err
+	}
 	expires = expires.Round(time.Second)
 
 	t, err := r.targets(delegator)
@@ -574,21 +643,93 @@ func (r *Repo) AddDelegatedRoleWithExpires(delegator string, delegatedRole data.
 		return fmt.Errorf("error setting metadata for %q: %w", delegatorFile, err)
 	}
 
-	delegatee := delegatedRole.Name
-	dt, err := r.targets(delegatee)
-	if err != nil {
-		return fmt.Errorf("error getting delegatee (%q) metadata: %w", delegatee, err)
+	return r.stageDelegatees(delegateeNames(delegatedRole), expires)
+}
+
+// validateDelegatedRole checks a delegation before it is added or updated:
+// the role must be named so that its metadata can be stored as
+// "<name>.json" beside the top-level metadata, its paths must be valid, and
+// a succinct hash bin delegation must not delegate to more bins than can be
+// staged.
+func validateDelegatedRole(role data.DelegatedRole) error {
+	if role.Name == "" || role.Name == "." || role.Name == ".." || strings.ContainsAny(role.Name, "/\\") ||
+		!roles.IsDelegatedTargetsRole(role.Name) || roles.IsVersionedManifest(role.Name+".json") {
+		return ErrInvalidRole{role.Name, "delegated role names must not be empty, contain path separators, start with a version number or be a top-level role name"}
+	}
+	if err := role.Validate(); err != nil {
+		return err
+	}
+	if role.BitLength > targets.MaxSuccinctHashBinsBitLen {
+		return ErrInvalidRole{role.Name, fmt.Sprintf("succinct hash bin delegations can have a bit length of at most %d", targets.MaxSuccinctHashBinsBitLen)}
+	}
+	return nil
+}
+
+// delegateeNames returns the names of the roles a delegation delegates to,
+// which are the bins of a succinct hash bin delegation.
+func delegateeNames(role data.DelegatedRole) []string {
+	if !role.IsSuccinct() {
+		return []string{role.Name}
+	}
+	names := make([]string, 0, role.NumSuccinctBins())
+	for i := uint64(0); i < role.NumSuccinctBins(); i++ {
+		names = append(names, role.SuccinctRoleName(i))
 	}
-	dt.Expires = expires
+	return names
+}
 
-	delegateeFile := delegatee + ".json"
-	if !r.local.FileIsStaged(delegateeFile) {
-		dt.Version++
+// existingDelegateeNames returns the names of the roles a delegation
+// delegates to that have metadata in meta, sorted. The bins of a succinct
+// hash bin delegation are looked up by name rather than listed, as there may
+// be up to 2^data.MaxSuccinctBitLength of them.
+func existingDelegateeNames(meta map[string]json.RawMessage, role data.DelegatedRole) []string {
+	if !role.IsSuccinct() {
+		if _, ok := meta[role.Name+".json"]; ok {
+			return []string{role.Name}
+		}
+		return nil
 	}
+	names := []string{}
+	for file := range meta {
+		name := strings.TrimSuffix(file, ".json")
+		if name != file && role.IsSuccinctRoleName(name) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
 
-	err = r.setMeta(delegateeFile, dt)
+// stageDelegatees stages the metadata of the named delegated roles with the
+// given expiration time, signed with the keys of their delegations.
+func (r *Repo) stageDelegatees(names []string, expires time.Time) error {
+	// Load the delegations once, as a succinct hash bin delegation may
+	// delegate to many roles.
+	delegators, err := r.delegators()
 	if err != nil {
-		return fmt.Errorf("error setting metadata for %q: %w", delegateeFile, err)
+		return err
+	}
+
+	for _, delegatee := range names {
+		dt, err := r.targets(delegatee)
+		if err != nil {
+			return fmt.Errorf("error getting delegatee (%q) metadata: %w", delegatee, err)
+		}
+		dt.Expires = expires
+
+		delegateeFile := delegatee + ".json"
+		if !r.local.FileIsStaged(delegateeFile) {
+			dt.Version++
+		}
+
+		signers, err := r.delegateeSigners(delegatee, delegators)
+		if err != nil {
+			return err
+		}
+		err = r.setMetaWithSigners(delegateeFile, dt, signers)
+		if err != nil {
+			return fmt.Errorf("error setting metadata for %q: %w", delegateeFile, err)
+		}
 	}
 
 	return nil
@@ -602,30 +743,138 @@ func (r *Repo) AddDelegatedRolesForPathHashBins(delegator string, bins *targets.
 }
 
 // AddDelegatedRolesForPathHashBinsWithExpires adds delegations to the
-// delegator role for the given hash bins configuration. New metadata is
+// delegator role for the given hash bins configuration. Bins created with
+// targets.NewSuccinctHashBins are delegated to with a single succinct hash
+// bin delegation, otherwise each bin gets its own delegation. New metadata is
 // written with the given expiration time.
 func (r *Repo) AddDelegatedRolesForPathHashBinsWithExpires(delegator string, bins *targets.HashBins, keys []*data.PublicKey, threshold int, expires time.Time) error {
+	for _, delegatedRole := range hashBinsDelegatedRoles(bins, keys, threshold) {
+		err := r.AddDelegatedRoleWithExpires(delegator, delegatedRole, keys, expires)
+		if err != nil {
+			if delegatedRole.IsSuccinct() {
+				return fmt.Errorf("error adding succinct delegation from %v to %v: %w", delegator, delegatedRole.Name, err)
+			}
+			return fmt.Errorf("error adding delegation from %v to %v: %w", delegator, delegatedRole.Name, err)
+		}
+	}
+	return nil
+}
+
+// hashBinsDelegatedRoles returns the delegations to the given hash bins,
+// which is a single delegation if they are succinct.
+func hashBinsDelegatedRoles(bins *targets.HashBins, keys []*data.PublicKey, threshold int) []data.DelegatedRole {
 	keyIDs := []string{}
 	for _, key := range keys {
 		keyIDs = append(keyIDs, key.IDs()...)
 	}
+	keyIDs = sets.DeduplicateStrings(keyIDs)
+
+	if bins.Succinct() {
+		return []data.DelegatedRole{bins.SuccinctDelegatedRole(keyIDs, threshold)}
+	}
 
 	n := bins.NumBins()
+	delegatedRoles := make([]data.DelegatedRole, 0, n)
 	for i := uint64(0); i < n; i += 1 {
 		bin := bins.GetBin(i)
-		name := bin.RoleName()
-		err := r.AddDelegatedRoleWithExpires(delegator, data.DelegatedRole{
-			Name:             name,
-			KeyIDs:           sets.DeduplicateStrings(keyIDs),
+		delegatedRoles = append(delegatedRoles, data.DelegatedRole{
+			Name:             bin.RoleName(),
+			KeyIDs:           keyIDs,
 			PathHashPrefixes: bin.HashPrefixes(),
 			Threshold:        threshold,
-		}, keys, expires)
+		})
+	}
+	return delegatedRoles
+}
+
+// SetHashBinsLayout is equivalent to SetHashBinsLayoutWithExpires, but with
+// a default expiration time.
+func (r *Repo) SetHashBinsLayout(bins *targets.HashBins, signers []keys.Signer, threshold int) error {
+	return r.SetHashBinsLayoutWithExpires(bins, signers, threshold, data.DefaultExpires("targets"))
+}
+
+// SetHashBinsLayoutWithExpires delegates every target path from the
+// top-level targets role to the given hash bins, signed by the given
+// signers. AddTargets then places each new target in its bin, so only the
+// bins it touches get new versions, and only their entries change in the
+// next snapshot.
+//
+// The targets role must not have any delegations yet, and targets it already
+// lists are moved to their bins. The layout is validated before anything is
+// saved, and the signers are then saved once for all of the bins, under the
+// prefix of their names. New metadata is written with the given expiration
+// time.
+func (r *Repo) SetHashBinsLayoutWithExpires(bins *targets.HashBins, signers []keys.Signer, threshold int, expires time.Time) error {
+	if !validExpires(expires) {
+		return ErrInvalidExpires{expires}
+	}
+	if bins == nil {
+		return ErrInvalidRole{"targets", "no hash bins given"}
+	}
+	if threshold < 1 || threshold > len(signers) {
+		return ErrNotEnoughKeys{"targets", len(signers), threshold}
+	}
+
+	t, err := r.topLevelTargets()
+	if err != nil {
+		return err
+	}
+	if t.Delegations != nil && len(t.Delegations.Roles) > 0 {
+		return ErrInvalidRole{"targets", "hash bins can only be set up on a targets role without delegations"}
+	}
+
+	keysRole := bins.RolePrefix()
+	if !roles.IsDelegatedTargetsRole(keysRole) {
+		return ErrInvalidRole{keysRole, "the keys of hash bins are saved under the prefix of their names, which must be a delegated targets role name"}
+	}
+	pks := make([]*data.PublicKey, 0, len(signers))
+	for _, s := range signers {
+		pks = append(pks, s.PublicData())
+	}
+	// Check every delegation before saving the signers or adding any of
+	// them, so an invalid layout leaves the repository untouched. The
+	// signers are saved before the bins are staged, which signs them.
+	for _, delegatedRole := range hashBinsDelegatedRoles(bins, pks, threshold) {
+		if err := validateDelegatedRole(delegatedRole); err != nil {
+			return err
+		}
+	}
+	for _, s := range signers {
+		if err := r.local.SaveSigner(keysRole, s); err != nil {
+			return err
+		}
+	}
+
+	if err := r.AddDelegatedRolesForPathHashBinsWithExpires("targets", bins, pks, threshold, expires); err != nil {
+		return err
+	}
+
+	// Move the targets listed by the targets role to their bins.
+	updatedTargetsMeta := map[string]*data.Targets{}
+	for path, meta := range t.Targets {
+		binMeta, delegation, err := r.targetDelegationForPath(path, "")
 		if err != nil {
-			return fmt.Errorf("error adding delegation from %v to %v: %w", delegator, name, err)
+			return err
 		}
+		name := delegation.Delegatee.Name
+		if tm, ok := updatedTargetsMeta[name]; ok {
+			binMeta = tm
+		}
+		binMeta.Targets[path] = meta
+		updatedTargetsMeta[name] = binMeta
+	}
+	if len(updatedTargetsMeta) == 0 {
+		return nil
 	}
 
-	return nil
+	t, err = r.topLevelTargets()
+	if err != nil {
+		return err
+	}
+	t.Targets = make(data.TargetFiles)
+	updatedTargetsMeta["targets"] = t
+
+	return r.stageTargetsMeta(updatedTargetsMeta, expires)
 }
 
 // ResetTargetsDelegation is equivalent to ResetTargetsDelegationsWithExpires
@@ -638,6 +887,10 @@ func (r *Repo) ResetTargetsDelegations(delegator string) error {
 // given delegator role. New metadata is written with the given expiration
 // time.
 func (r *Repo) ResetTargetsDelegationsWithExpires(delegator string, expires time.Time) error {
+	delegated, err := r.delegatedMetadata()
+	if err != nil {
+		return err
+	}
 	t, err := r.targets(delegator)
 	if err != nil {
 		return fmt.Errorf("error getting delegator (%q) metadata: %w", delegator, err)
@@ -658,9 +911,213 @@ func (r *Repo) ResetTargetsDelegationsWithExpires(delegator string, expires time
 		return fmt.Errorf("error setting metadata for %q: %w", delegatorFile, err)
 	}
 
+	return r.removeUndelegatedMetadata(delegated)
+}
+
+// UpdateDelegatedRole is equivalent to UpdateDelegatedRoleWithExpires, but
+// with a default expiration time.
+func (r *Repo) UpdateDelegatedRole(delegator string, delegatedRole data.DelegatedRole, keys []*data.PublicKey) error {
+	return r.UpdateDelegatedRoleWithExpires(delegator, delegatedRole, keys, data.DefaultExpires("targets"))
+}
+
+// UpdateDelegatedRoleWithExpires replaces the delegation from the delegator
+// to the role with the same name as delegatedRole, keeping its position
+// among the delegator's other delegations. Key IDs referenced in
+// delegatedRole.KeyIDs should either be used by the delegator already, or
+// have corresponding Key entries in the keys argument. Keys no longer used by
+// any delegation are removed.
+//
+// If the keys or threshold of the role change, the role's metadata is
+// signed again with the new keys. New metadata is written with the given
+// expiration time. delegatedRole is checked as by AddDelegatedRoleWithExpires.
+func (r *Repo) UpdateDelegatedRoleWithExpires(delegator string, delegatedRole data.DelegatedRole, keys []*data.PublicKey, expires time.Time) error {
+	if err := validateDelegatedRole(delegatedRole); err != nil {
+		return err
+	}
+	return r.updateDelegations(delegator, delegatedRole.Name, expires, func(d *data.Delegations, i int) (bool, error) {
+		if len(delegatedRole.KeyIDs) < delegatedRole.Threshold {
+			return false, ErrNotEnoughKeys{delegatedRole.Name, len(delegatedRole.KeyIDs), delegatedRole.Threshold}
+		}
+		for _, keyID := range delegatedRole.KeyIDs {
+			for _, key := range keys {
+				if key.ContainsID(keyID) {
+					d.Keys[keyID] = key
+					break
+				}
+			}
+			if _, ok := d.Keys[keyID]; !ok {
+				return false, ErrKeyNotFound{delegatedRole.Name, keyID}
+			}
+		}
+
+		old := d.Roles[i]
+		d.Roles[i] = delegatedRole
+		keysChanged := !reflect.DeepEqual(sets.StringSliceToSet(old.KeyIDs), sets.StringSliceToSet(delegatedRole.KeyIDs))
+		return keysChanged || old.Threshold != delegatedRole.Threshold, nil
+	})
+}
+
+// RemoveDelegatedRole is equivalent to RemoveDelegatedRoleWithExpires, but
+// with a default expiration time.
+func (r *Repo) RemoveDelegatedRole(delegator string, name string) error {
+	return r.RemoveDelegatedRoleWithExpires(delegator, name, data.DefaultExpires("targets"))
+}
+
+// RemoveDelegatedRoleWithExpires removes the delegation from the delegator
+// to the named role, leaving the delegator's other delegations untouched.
+// Keys no longer used by any delegation are removed. New metadata is
+// written with the given expiration time.
+//
+// The metadata of the role, and of the roles it delegates to that are left
+// without a delegator, is no longer listed by the snapshot, and is removed
+// from the repository by the next commit.
+func (r *Repo) RemoveDelegatedRoleWithExpires(delegator string, name string, expires time.Time) error {
+	delegated, err := r.delegatedMetadata()
+	if err != nil {
+		return err
+	}
+	err = r.updateDelegations(delegator, name, expires, func(d *data.Delegations, i int) (bool, error) {
+		d.Roles = append(d.Roles[:i], d.Roles[i+1:]...)
+		return false, nil
+	})
+	if err != nil {
+		return err
+	}
+	return r.removeUndelegatedMetadata(delegated)
+}
+
+// removeUndelegatedMetadata drops the metadata of the roles in prev that
+// are no longer delegated to, and removes it from the staged files where the
+// store supports it. The committed metadata is removed by the next commit.
+func (r *Repo) removeUndelegatedMetadata(prev map[string]struct{}) error {
+	delegated, err := r.delegatedMetadata()
+	if err != nil {
+		return err
+	}
+	remover, canRemove := r.local.(StagedMetaRemover)
+	for metaName := range prev {
+		if _, ok := delegated[metaName]; ok {
+			continue
+		}
+		delete(r.meta, metaName)
+		if canRemove {
+			if err := remover.RemoveStagedMeta(metaName); err != nil {
+				return err
+			}
+		}
+	}
 	return nil
 }
 
+// RevokeDelegatedRoleKey is equivalent to RevokeDelegatedRoleKeyWithExpires,
+// but with a default expiration time.
+func (r *Repo) RevokeDelegatedRoleKey(delegator string, name string, id string) error {
+	return r.RevokeDelegatedRoleKeyWithExpires(delegator, name, id, data.DefaultExpires("targets"))
+}
+
+// RevokeDelegatedRoleKeyWithExpires removes the key with the given ID from
+// the delegation from the delegator to the named role. The key is removed
+// from the delegator's keys if no other delegation uses it, and the role's
+// metadata is signed again without it. New metadata is written with the
+// given expiration time.
+func (r *Repo) RevokeDelegatedRoleKeyWithExpires(delegator string, name string, id string, expires time.Time) error {
+	return r.updateDelegations(delegator, name, expires, func(d *data.Delegations, i int) (bool, error) {
+		key, ok := d.Keys[id]
+		if !ok {
+			return false, ErrKeyNotFound{name, id}
+		}
+
+		// There may be multiple keyids that correspond to this key, so
+		// filter all of them out.
+		role := &d.Roles[i]
+		filteredKeyIDs := make([]string, 0, len(role.KeyIDs))
+		for _, keyID := range role.KeyIDs {
+			if !key.ContainsID(keyID) {
+				filteredKeyIDs = append(filteredKeyIDs, keyID)
+			}
+		}
+		if len(filteredKeyIDs) == len(role.KeyIDs) {
+			return false, ErrKeyNotFound{name, id}
+		}
+		if len(filteredKeyIDs) < role.Threshold {
+			return false, ErrNotEnoughKeys{name, len(filteredKeyIDs), role.Threshold}
+		}
+		role.KeyIDs = filteredKeyIDs
+		return true, nil
+	})
+}
+
+// updateDelegations applies update to the delegation from the delegator to
+// the named role, which is at index i of the delegator's roles, then removes
+// unused keys and stages the delegator's metadata. If update reports that
+// the keys or threshold of the role changed, the role's metadata is staged
+// again so that it is signed with the new keys.
+func (r *Repo) updateDelegations(delegator string, name string, expires time.Time, update func(d *data.Delegations, i int) (bool, error)) error {
+	if !validExpires(expires) {
+		return ErrInvalidExpires{expires}
+	}
+	expires = expires.Round(time.Second)
+
+	t, err := r.targets(delegator)
+	if err != nil {
+		return fmt.Errorf("error getting delegator (%q) metadata: %w", delegator, err)
+	}
+
+	index := -1
+	if t.Delegations != nil {
+		for i, role := range t.Delegations.Roles {
+			if role.Name == name {
+				index = i
+				break
+			}
+		}
+	}
+	if index < 0 {
+		return ErrNoDelegatedRole{Delegator: delegator, Role: name}
+	}
+	if t.Delegations.Keys == nil {
+		t.Delegations.Keys = make(map[string]*data.PublicKey)
+	}
+
+	role := t.Delegations.Roles[index]
+	resign, err := update(t.Delegations, index)
+	if err != nil {
+		return err
+	}
+	removeUnusedDelegationKeys(t.Delegations)
+	t.Expires = expires
+
+	delegatorFile := delegator + ".json"
+	if !r.local.FileIsStaged(delegatorFile) {
+		t.Version++
+	}
+
+	err = r.setMeta(delegatorFile, t)
+	if err != nil {
+		return fmt.Errorf("error setting metadata for %q: %w", delegatorFile, err)
+	}
+
+	if !resign {
+		return nil
+	}
+	return r.stageDelegatees(existingDelegateeNames(r.meta, role), expires)
+}
+
+// removeUnusedDelegationKeys removes the keys that no delegated role uses.
+func removeUnusedDelegationKeys(d *data.Delegations) {
+	used := make(map[string]struct{})
+	for _, role := range d.Roles {
+		for _, keyID := range role.KeyIDs {
+			used[keyID] = struct{}{}
+		}
+	}
+	for keyID := range d.Keys {
+		if _, ok := used[keyID]; !ok {
+			delete(d.Keys, keyID)
+		}
+	}
+}
+
 func (r *Repo) jsonMarshal(v interface{}) ([]byte, error) {
 	if r.prefix == "" && r.indent == "" {
 		return json.Marshal(v)
@@ -690,14 +1147,52 @@ func (r *Repo) dbsForRole(role string) ([]*verify.DB, error) {
 }
 
 func (r *Repo) signersForRole(role string) ([]keys.Signer, error) {
+	if roles.IsDelegatedTargetsRole(role) {
+		delegators, err := r.delegators()
+		if err != nil {
+			return nil, err
+		}
+		return r.delegateeSigners(role, delegators)
+	}
+
 	dbs, err := r.dbsForRole(role)
 	if err != nil {
 		return nil, err
 	}
 
+	return r.signersInDBs(role, role, dbs)
+}
+
+// delegateeSigners returns the signers for a delegated targets role. Besides
+// the role's own signers, hash bins can be signed by the signers saved for
+// the prefix of the bins' names, which all of the bins share.
+func (r *Repo) delegateeSigners(role string, delegators []*delegator) ([]keys.Signer, error) {
+	dbs, err := delegatorDBsFor(role, delegators)
+	if err != nil {
+		return nil, err
+	}
+
+	signers, err := r.signersInDBs(role, role, dbs)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range sharedKeysRolesFor(role, delegators) {
+		ss, err := r.signersInDBs(name, role, dbs)
+		if err != nil {
+			return nil, err
+		}
+		signers = append(signers, ss...)
+	}
+
+	return signers, nil
+}
+
+// signersInDBs returns the signers saved for keysRole that are valid keys of
+// role in dbs.
+func (r *Repo) signersInDBs(keysRole string, role string, dbs []*verify.DB) ([]keys.Signer, error) {
 	signers := []keys.Signer{}
 	for _, db := range dbs {
-		ss, err := r.getSignersInDB(role, db)
+		ss, err := r.getSignersInDB(keysRole, role, db)
 		if err != nil {
 			return nil, err
 		}
@@ -716,6 +1211,10 @@ func (r *Repo) setMeta(roleFilename string, meta interface{}) error {
 		return err
 	}
 
+	return r.setMetaWithSigners(roleFilename, meta, signers)
+}
+
+func (r *Repo) setMetaWithSigners(roleFilename string, meta interface{}, signers []keys.Signer) error {
 	s, err := sign.Marshal(meta, signers...)
 	if err != nil {
 		return err
@@ -789,6 +1288,22 @@ func (r *Repo) AddOrUpdateSignature(roleFilename string, signature data.Signatur
 		return ErrInvalidRole{role, "no trusted keys for role"}
 	}
 
+	// Keys of the previous root also sign root.json, so that clients which
+	// trust it can update to the new root.
+	if role == "root" {
+		prev, err := r.previousRoot()
+		if err != nil {
+			return err
+		}
+		if prev != nil {
+			db, err := rootKeysDB(prev)
+			if err != nil {
+				return err
+			}
+			dbs = append(dbs, db)
+		}
+	}
+
 	keyInDB := false
 	for _, db := range dbs {
 		roleData := db.GetRole(role)
@@ -843,8 +1358,8 @@ func (r *Repo) AddOrUpdateSignature(roleFilename string, signature data.Signatur
 // been revoked are omitted), except for the root role in which case all local
 // keys are returned (revoked root keys still need to sign new root metadata so
 // clients can verify the new root.json and update their keys db accordingly).
-func (r *Repo) getSignersInDB(roleName string, db *verify.DB) ([]keys.Signer, error) {
-	signers, err := r.local.GetSigners(roleName)
+func (r *Repo) getSignersInDB(keysRole string, roleName string, db *verify.DB) ([]keys.Signer, error) {
+	signers, err := r.local.GetSigners(keysRole)
 	if err != nil {
 		return nil, err
 	}
@@ -893,9 +1408,25 @@ func (r *Repo) SignedMeta(roleFilename string) (*data.Signed, error) {
 
 // delegatorDBs returns a list of key DBs for all incoming delegations.
 func (r *Repo) delegatorDBs(delegateeRole string) ([]*verify.DB, error) {
-	delegatorDBs := []*verify.DB{}
+	delegators, err := r.delegators()
+	if err != nil {
+		return nil, err
+	}
+	return delegatorDBsFor(delegateeRole, delegators)
+}
+
+// delegator holds the delegations of a targets role, and a key DB for them
+// once it is needed.
+type delegator struct {
+	delegations *data.Delegations
+	db          *verify.DB
+}
+
+// delegators returns the delegations of every targets role that has any.
+func (r *Repo) delegators() ([]*delegator, error) {
+	delegators := []*delegator{}
 	for metaName := range r.meta {
-		if roles.IsTopLevelManifest(metaName) && metaName != "targets.json" {
+		if roles.IsTopLevelManifest(metaName) && metaName != "targets.json" || roles.IsVersionedManifest(metaName) {
 			continue
 		}
 		roleName := strings.TrimSuffix(metaName, ".json")
@@ -908,10 +1439,19 @@ func (r *Repo) delegatorDBs(delegateeRole string) ([]*verify.DB, error) {
 		if t.Delegations == nil {
 			continue
 		}
+		delegators = append(delegators, &delegator{delegations: t.Delegations})
+	}
+	return delegators, nil
+}
 
+// delegatorDBsFor returns the key DBs of the delegators that delegate to the
+// given role.
+func delegatorDBsFor(delegateeRole string, delegators []*delegator) ([]*verify.DB, error) {
+	delegatorDBs := []*verify.DB{}
+	for _, d := range delegators {
 		delegatesToRole := false
-		for _, d := range t.Delegations.Roles {
-			if d.Name == delegateeRole {
+		for _, role := range d.delegations.Roles {
+			if role.Name == delegateeRole || role.IsSuccinctRoleName(delegateeRole) {
 				delegatesToRole = true
 				break
 			}
@@ -920,17 +1460,59 @@ func (r *Repo) delegatorDBs(delegateeRole string) ([]*verify.DB, error) {
 			continue
 		}
 
-		db, err := verify.NewDBFromDelegations(t.Delegations)
-		if err != nil {
-			return nil, err
+		if d.db == nil {
+			db, err := verify.NewDBFromDelegations(d.delegations)
+			if err != nil {
+				return nil, err
+			}
+			d.db = db
 		}
 
-		delegatorDBs = append(delegatorDBs, db)
+		delegatorDBs = append(delegatorDBs, d.db)
 	}
 
 	return delegatorDBs, nil
 }
 
+// sharedKeysRolesFor returns the names the keys of the given role can be
+// saved under, besides its own name, when it is one of a set of hash bins
+// sharing keys: the name of the succinct hash bin delegation it is a bin
+// of, or the prefix of the bins' names for other hash bins.
+func sharedKeysRolesFor(delegateeRole string, delegators []*delegator) []string {
+	names := []string{}
+	for _, d := range delegators {
+		for _, role := range d.delegations.Roles {
+			if role.IsSuccinctRoleName(delegateeRole) {
+				names = append(names, role.Name)
+			} else if role.Name == delegateeRole {
+				if prefix, ok := hashBinRolePrefix(role); ok {
+					names = append(names, prefix)
+				}
+			}
+		}
+	}
+	return names
+}
+
+// hashBinRolePrefix returns the prefix of the name of a role delegated to
+// as a hash bin, which is followed by the range of hash prefixes the bin
+// covers as in targets.HashBin.RoleName.
+func hashBinRolePrefix(role data.DelegatedRole) (string, bool) {
+	n := len(role.PathHashPrefixes)
+	if n == 0 {
+		return "", false
+	}
+	suffix := role.PathHashPrefixes[0]
+	if n > 1 {
+		suffix += "-" + role.PathHashPrefixes[n-1]
+	}
+	prefix := strings.TrimSuffix(role.Name, suffix)
+	if prefix == role.Name || !roles.IsDelegatedTargetsRole(prefix) {
+		return "", false
+	}
+	return prefix, true
+}
+
 // targetDelegationForPath finds the targets metadata for the role that should
 // sign the given path. The final delegation that led to the returned target
 // metadata is also returned.
@@ -1142,6 +1724,17 @@ func (r *Repo) AddTargetsWithExpiresToPreferredRole(paths []string, custom json.
 		updatedTargetsMeta["targets"] = t
 	}
 
+	return r.stageTargetsMeta(updatedTargetsMeta, expires)
+}
+
+// stageTargetsMeta signs and stages the given targets metadata with the
+// given expiration time, bumping the version of each role that is not
+// already staged. Roles that are not touched keep their current version.
+func (r *Repo) stageTargetsMeta(updatedTargetsMeta map[string]*data.Targets, expires time.Time) error {
+	// The delegations are loaded once, when the first delegated role is
+	// signed, as adding targets to hash bins may touch many of them.
+	var delegators []*delegator
+
 	exp := expires.Round(time.Second)
 	for roleName, targetsMeta := range updatedTargetsMeta {
 		targetsMeta.Expires = exp
@@ -1151,8 +1744,24 @@ func (r *Repo) AddTargetsWithExpiresToPreferredRole(paths []string, custom json.
 			targetsMeta.Version++
 		}
 
-		err := r.setMeta(manifestName, targetsMeta)
+		if !roles.IsDelegatedTargetsRole(roleName) {
+			if err := r.setMeta(manifestName, targetsMeta); err != nil {
+				return fmt.Errorf("error setting metadata for %q: %w", manifestName, err)
+			}
+			continue
+		}
+
+		if delegators == nil {
+			var err error
+			if delegators, err = r.delegators(); err != nil {
+				return err
+			}
+		}
+		signers, err := r.delegateeSigners(roleName, delegators)
 		if err != nil {
+			return err
+		}
+		if err := r.setMetaWithSigners(manifestName, targetsMeta, signers); err != nil {
 			return fmt.Errorf("error setting metadata for %q: %w", manifestName, err)
 		}
 	}
@@ -1178,11 +1787,11 @@ func (r *Repo) RemoveTargetsWithExpires(paths []string, expires time.Time) error
 		return ErrInvalidExpires{expires}
 	}
 
-	for metaName := range r.meta {
-		if metaName != "targets.json" && !roles.IsDelegatedTargetsManifest(metaName) {
-			continue
-		}
-
+	listed, err := r.snapshotMetadata()
+	if err != nil {
+		return err
+	}
+	for _, metaName := range listed {
 		err := r.removeTargetsWithExpiresFromMeta(metaName, paths, expires)
 		if err != nil {
 			return fmt.Errorf("could not remove %v from %v: %w", paths, metaName, err)
@@ -1192,6 +1801,34 @@ func (r *Repo) RemoveTargetsWithExpires(paths []string, expires time.Time) error
 	return nil
 }
 
+// RemoveTargetsFromRole is equivalent to RemoveTargetsFromRoleWithExpires,
+// but with a default expiration time.
+func (r *Repo) RemoveTargetsFromRole(role string, paths []string) error {
+	return r.RemoveTargetsFromRoleWithExpires(role, paths, data.DefaultExpires("targets"))
+}
+
+// RemoveTargetsFromRoleWithExpires removes the targets at paths from the
+// metadata of the given targets role only, leaving any other role listing
+// them untouched. If paths is empty, all of the role's targets are removed.
+func (r *Repo) RemoveTargetsFromRoleWithExpires(role string, paths []string, expires time.Time) error {
+	if !validExpires(expires) {
+		return ErrInvalidExpires{expires}
+	}
+
+	metaName := role + ".json"
+	if role != "targets" && !roles.IsDelegatedTargetsRole(role) {
+		return ErrInvalidRole{role, "only targets roles can list targets"}
+	}
+	if _, ok := r.meta[metaName]; !ok {
+		return ErrMissingMetadata{metaName}
+	}
+
+	if err := r.removeTargetsWithExpiresFromMeta(metaName, paths, expires); err != nil {
+		return fmt.Errorf("could not remove %v from %v: %w", paths, metaName, err)
+	}
+	return nil
+}
+
 func (r *Repo) removeTargetsWithExpiresFromMeta(metaName string, paths []string, expires time.Time) error {
 	roleName := strings.TrimSuffix(metaName, ".json")
 	t, err := r.targets(roleName)
@@ -1245,21 +1882,237 @@ func (r *Repo) removeTargetsWithExpiresFromMeta(metaName string, paths []string,
 	return err
 }
 
+func (r *Repo) Regenerate() error {
+	return r.RegenerateWithExpires(data.DefaultExpires("targets"))
+}
+
+// RegenerateWithExpires rebuilds the targets metadata from the target files
+// committed to the repository, and stages the result.
+//
+// Each target file is assigned to the role its path is delegated to by the
+// existing delegations, and the targets of every targets role are replaced
+// with the files found for it. Custom metadata of targets still present is
+// kept. If the repository uses consistent snapshots, the hash prefix is
+// stripped from the committed file names, and when the previous versions of
+// a target are still committed, the version in the targets metadata is the
+// one kept. ErrAmbiguousTarget is returned if it cannot be told apart.
+func (r *Repo) RegenerateWithExpires(expires time.Time) error {
+	if !validExpires(expires) {
+		return ErrInvalidExpires{expires}
+	}
+
+	walker, ok := r.local.(CommittedTargetsWalker)
+	if !ok {
+		return ErrRegenerateNotSupported
+	}
+
+	root, err := r.root()
+	if err != nil {
+		return err
+	}
+
+	snapshot, err := r.snapshot()
+	if err != nil {
+		return err
+	}
+
+	// Start every targets role with an empty set of targets, remembering
+	// any custom metadata so it survives the rebuild, and the files the
+	// targets are recorded with.
+	updatedTargetsMeta := map[string]*data.Targets{}
+	custom := map[string]*json.RawMessage{}
+	recorded := map[string]*data.FileMeta{}
+	listed, err := r.snapshotMetadata()
+	if err != nil {
+		return err
+	}
+	for _, metaName := range listed {
+		roleName := strings.TrimSuffix(metaName, ".json")
+		t, err := r.targets(roleName)
+		if err != nil {
+			return err
+		}
+		if _, ok := r.meta[metaName]; !ok {
+			// The metadata is lost, so continue from the version in the
+			// snapshot to avoid a rollback.
+			t.Version = snapshot.Meta[metaName].Version
+		}
+		for path, meta := range t.Targets {
+			path = util.NormalizeTarget(path)
+			if meta.Custom != nil {
+				custom[path] = meta.Custom
+			}
+			fileMeta := meta.FileMeta
+			recorded[path] = &fileMeta
+		}
+		t.Targets = make(data.TargetFiles)
+		updatedTargetsMeta[roleName] = t
+	}
+
+	// Detect hash prefixes with every supported algorithm, not just the
+	// ones this repo records, as older commits may have used others.
+	hashAlgorithms := r.hashAlgorithms
+	if len(hashAlgorithms) == 0 {
+		hashAlgorithms = []string{"sha512"}
+	}
+	detectAlgorithms := sets.DeduplicateStrings(append(append([]string{}, hashAlgorithms...), data.HashAlgorithms...))
+
+	// With consistent snapshots, the previous versions of a target are
+	// kept under their own hashes, so several files can map to one path.
+	candidates := map[string][]data.TargetFileMeta{}
+	if err := walker.WalkCommittedTargets(func(name string, target io.Reader) error {
+		fileMeta, err := util.GenerateTargetFileMeta(target, detectAlgorithms...)
+		if err != nil {
+			return err
+		}
+
+		path := name
+		if root.ConsistentSnapshot {
+			path = targetPathFromHashedPath(name, fileMeta.Hashes)
+		}
+		path = util.NormalizeTarget(path)
+		candidates[path] = append(candidates[path], fileMeta)
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	for path, files := range candidates {
+		fileMeta, err := currentTargetFile(path, files, recorded[path])
+		if err != nil {
+			return err
+		}
+
+		hashes := make(data.Hashes, len(hashAlgorithms))
+		for _, alg := range hashAlgorithms {
+			hashes[alg] = fileMeta.Hashes[alg]
+		}
+		fileMeta.Hashes = hashes
+		fileMeta.Custom = custom[path]
+
+		_, delegation, err := r.targetDelegationForPath(path, "")
+		if err != nil {
+			return err
+		}
+		roleName := delegation.Delegatee.Name
+		targetsMeta, ok := updatedTargetsMeta[roleName]
+		if !ok {
+			targetsMeta = data.NewTargets()
+			updatedTargetsMeta[roleName] = targetsMeta
+		}
+		targetsMeta.Targets[path] = fileMeta
+	}
+
+	exp := expires.Round(time.Second)
+	for roleName, targetsMeta := range updatedTargetsMeta {
+		targetsMeta.Expires = exp
+
+		manifestName := roleName + ".json"
+		if !r.local.FileIsStaged(manifestName) {
+			targetsMeta.Version++
+		}
+
+		if err := r.setMeta(manifestName, targetsMeta); err != nil {
+			return fmt.Errorf("error setting metadata for %q: %w", manifestName, err)
+		}
+	}
+
+	return nil
+}
+
+// currentTargetFile returns the file of the target at path out of the
+// committed files that map to it. If they do not all have the same content,
+// it is the one recorded in the targets metadata.
+func currentTargetFile(path string, files []data.TargetFileMeta, recorded *data.FileMeta) (data.TargetFileMeta, error) {
+	current := files[0]
+	for _, file := range files[1:] {
+		if util.FileMetaEqual(file.FileMeta, current.FileMeta) == nil {
+			continue
+		}
+		if recorded == nil {
+			return data.TargetFileMeta{}, ErrAmbiguousTarget{path}
+		}
+		matches := 0
+		for _, file := range files {
+			if util.FileMetaEqual(file.FileMeta, *recorded) == nil {
+				current = file
+				matches++
+			}
+		}
+		if matches == 0 {
+			return data.TargetFileMeta{}, ErrAmbiguousTarget{path}
+		}
+		break
+	}
+	return current, nil
+}
+
+// targetPathFromHashedPath returns the target path of a file committed with
+// a consistent snapshot name of the form dir/HASH.name. The name is returned
+// unchanged if it is not prefixed with one of the file's hashes.
+func targetPathFromHashedPath(name string, hashes data.Hashes) string {
+	dir, base := path.Split(name)
+	parts := strings.SplitN(base, ".", 2)
+	if len(parts) != 2 || parts[1] == "" {
+		return name
+	}
+	for _, hash := range hashes {
+		if hash.String() == parts[0] {
+			return dir + parts[1]
+		}
+	}
+	return name
+}
+
 func (r *Repo) Snapshot() error {
 	return r.SnapshotWithExpires(data.DefaultExpires("snapshot"))
 }
 
-func (r *Repo) snapshotMetadata() []string {
+// snapshotMetadata returns the metadata files listed by the snapshot:
+// targets.json and the metadata of the delegated roles that are delegated
+// to.
+func (r *Repo) snapshotMetadata() ([]string, error) {
+	delegated, err := r.delegatedMetadata()
+	if err != nil {
+		return nil, err
+	}
 	ret := []string{"targets.json"}
-
-	for name := range r.meta {
-		if !roles.IsVersionedManifest(name) &&
-			roles.IsDelegatedTargetsManifest(name) {
-			ret = append(ret, name)
+	for name := range delegated {
+		ret = append(ret, name)
+	}
+	sort.Strings(ret[1:])
+	return ret, nil
+}
+
+// delegatedMetadata returns the set of metadata files of the delegated
+// targets roles that are delegated to from targets.json, directly or
+// through other delegated roles. The metadata of other roles, which are no
+// longer delegated to, is left out of the snapshot and removed from the
+// repository by the next commit.
+func (r *Repo) delegatedMetadata() (map[string]struct{}, error) {
+	delegated := make(map[string]struct{})
+	queue := []string{"targets"}
+	for len(queue) > 0 {
+		t, err := r.targets(queue[0])
+		if err != nil {
+			return nil, err
+		}
+		queue = queue[1:]
+		if t.Delegations == nil {
+			continue
+		}
+		for _, role := range t.Delegations.Roles {
+			for _, name := range existingDelegateeNames(r.meta, role) {
+				metaName := name + ".json"
+				if _, ok := delegated[metaName]; ok || !roles.IsDelegatedTargetsManifest(metaName) {
+					continue
+				}
+				delegated[metaName] = struct{}{}
+				queue = append(queue, name)
+			}
 		}
 	}
-
-	return ret
+	return delegated, nil
 }
 
 func (r *Repo) SnapshotWithExpires(expires time.Time) error {
@@ -1277,11 +2130,36 @@ func (r *Repo) SnapshotWithExpires(expires time.Time) error {
 		return err
 	}
 
-	for _, metaName := range r.snapshotMetadata() {
-		if err := r.verifySignatures(metaName); err != nil {
+	// Load the delegations once, as there may be many delegated roles.
+	delegators, err := r.delegators()
+	if err != nil {
+		return err
+	}
+
+	listed, err := r.snapshotMetadata()
+	if err != nil {
+		return err
+	}
+	// Stop listing the metadata of roles that are no longer delegated to.
+	for metaName := range snapshot.Meta {
+		if roles.IsDelegatedTargetsManifest(metaName) {
+			delete(snapshot.Meta, metaName)
+		}
+	}
+	for _, metaName := range listed {
+		role := strings.TrimSuffix(metaName, ".json")
+		var dbs []*verify.DB
+		if roles.IsTopLevelRole(role) {
+			dbs, err = r.dbsForRole(role)
+		} else {
+			dbs, err = delegatorDBsFor(role, delegators)
+		}
+		if err != nil {
+			return err
+		}
+		if err := r.verifySignaturesInDBs(metaName, dbs); err != nil {
 			return err
 		}
-		var err error
 		snapshot.Meta[metaName], err = r.snapshotFileMeta(metaName)
 		if err != nil {
 			return err
@@ -1332,11 +2210,18 @@ func (r *Repo) TimestampWithExpires(expires time.Time) error {
 
 func (r *Repo) fileVersions() (map[string]int64, error) {
 	versions := make(map[string]int64)
+	delegated, err := r.delegatedMetadata()
+	if err != nil {
+		return nil, err
+	}
 
 	for fileName := range r.meta {
 		if roles.IsVersionedManifest(fileName) {
 			continue
 		}
+		if _, ok := delegated[fileName]; !ok && roles.IsDelegatedTargetsManifest(fileName) {
+			continue
+		}
 
 		roleName := strings.TrimSuffix(fileName, ".json")
 
@@ -1376,10 +2261,18 @@ func (r *Repo) fileVersions() (map[string]int64, error) {
 func (r *Repo) fileHashes() (map[string]data.Hashes, error) {
 	hashes := make(map[string]data.Hashes)
 
+	delegated, err := r.delegatedMetadata()
+	if err != nil {
+		return nil, err
+	}
+
 	for fileName := range r.meta {
 		if roles.IsVersionedManifest(fileName) {
 			continue
 		}
+		if _, ok := delegated[fileName]; !ok && roles.IsDelegatedTargetsManifest(fileName) {
+			continue
+		}
 
 		roleName := strings.TrimSuffix(fileName, ".json")
 
@@ -1447,7 +2340,11 @@ func (r *Repo) Commit() error {
 	if err != nil {
 		return err
 	}
-	for _, name := range r.snapshotMetadata() {
+	listed, err := r.snapshotMetadata()
+	if err != nil {
+		return err
+	}
+	for _, name := range listed {
 		expected, ok := snapshot.Meta[name]
 		if !ok {
 			return fmt.Errorf("tuf: snapshot.json missing hash for %s", name)
@@ -1505,18 +2402,23 @@ func (r *Repo) Clean() error {
 }
 
 func (r *Repo) verifySignatures(metaFilename string) error {
-	s, err := r.SignedMeta(metaFilename)
+	role := strings.TrimSuffix(metaFilename, ".json")
+
+	dbs, err := r.dbsForRole(role)
 	if err != nil {
 		return err
 	}
 
-	role := strings.TrimSuffix(metaFilename, ".json")
+	return r.verifySignaturesInDBs(metaFilename, dbs)
+}
 
-	dbs, err := r.dbsForRole(role)
+func (r *Repo) verifySignaturesInDBs(metaFilename string, dbs []*verify.DB) error {
+	s, err := r.SignedMeta(metaFilename)
 	if err != nil {
 		return err
 	}
 
+	role := strings.TrimSuffix(metaFilename, ".json")
 	for _, db := range dbs {
 		if err := db.Verify(s, role, 0); err != nil {
 			return ErrInsufficientSignatures{metaFilename, err}
@@ -22,6 +22,7 @@ import (
 	"github.com/theupdateframework/go-tuf/data"
 	"github.com/theupdateframework/go-tuf/encrypted"
 	"github.com/theupdateframework/go-tuf/internal/sets"
+	"github.com/theupdateframework/go-tuf/internal/signertest"
 	"github.com/theupdateframework/go-tuf/pkg/keys"
 	"github.com/theupdateframework/go-tuf/pkg/targets"
 	"github.com/theupdateframework/go-tuf/util"
@@ -329,6 +330,33 @@ func (rs *RepoSuite) TestGenKey(c *C) {
 	c.Assert(stagedRoot.Roles, DeepEquals, root.Roles)
 }
 
+func (rs *RepoSuite) TestGenKeyWithType(c *C) {
+	local := MemoryStore(make(map[string]json.RawMessage), nil)
+	r, err := NewRepo(local)
+	c.Assert(err, IsNil)
+
+	// generate a key of an unsupported type
+	_, err = r.GenKeyWithTypeAndExpires("root", "foo", data.DefaultExpires("root"))
+	c.Assert(err, Equals, ErrUnsupportedKeyType{"foo"})
+
+	// generate an ECDSA root key
+	ids, err := r.GenKeyWithTypeAndExpires("root", data.KeyTypeECDSA_SHA2_P256, data.DefaultExpires("root"))
+	c.Assert(err, IsNil)
+	c.Assert(ids, HasLen, 1)
+
+	root, err := r.root()
+	c.Assert(err, IsNil)
+	rs.assertNumUniqueKeys(c, root, "root", 1)
+	k, ok := root.Keys[ids[0]]
+	if !ok {
+		c.Fatal("missing key")
+	}
+	c.Assert(k.Type, Equals, data.KeyTypeECDSA_SHA2_P256)
+
+	// check the staged root metadata is signed with the new key
+	c.Assert(r.verifySignatures("root.json"), IsNil)
+}
+
 func addPrivateKey(c *C, r *Repo, role string, key keys.Signer) []string {
 	err := r.AddPrivateKey(role, key)
 	c.Assert(err, IsNil)
@@ -1043,6 +1071,161 @@ func (rs *RepoSuite) TestCommitFileSystemWithNewRepositories(c *C) {
 	c.Assert(newRepo().Commit(), IsNil)
 }
 
+func (rs *RepoSuite) TestRegenerate(c *C) {
+	tmp := newTmpDir(c)
+	local := FileSystemStore(tmp.path, nil)
+	r, err := NewRepo(local, "sha512", "sha256")
+	c.Assert(err, IsNil)
+
+	genKey(c, r, "root")
+	genKey(c, r, "targets")
+	genKey(c, r, "snapshot")
+	genKey(c, r, "timestamp")
+
+	// Delegate dir/* to role1.
+	role1Key, err := keys.GenerateEd25519Key()
+	c.Assert(err, IsNil)
+	c.Assert(local.SaveSigner("role1", role1Key), IsNil)
+	c.Assert(r.AddDelegatedRole("targets", data.DelegatedRole{
+		Name:      "role1",
+		KeyIDs:    role1Key.PublicData().IDs(),
+		Paths:     []string{"dir/*"},
+		Threshold: 1,
+	}, []*data.PublicKey{role1Key.PublicData()}), IsNil)
+
+	custom := json.RawMessage(`{"foo":"bar"}`)
+	tmp.writeStagedTarget("foo.txt", "foo")
+	c.Assert(r.AddTarget("foo.txt", custom), IsNil)
+	tmp.writeStagedTarget("dir/bar.txt", "bar")
+	c.Assert(r.AddTarget("dir/bar.txt", nil), IsNil)
+	c.Assert(r.Snapshot(), IsNil)
+	c.Assert(r.Timestamp(), IsNil)
+	c.Assert(r.Commit(), IsNil)
+
+	hashes, err := r.fileHashes()
+	c.Assert(err, IsNil)
+
+	// Publish a file directly, and delete one, without updating the metadata.
+	bazMeta, err := util.GenerateTargetFileMeta(strings.NewReader("baz"), "sha512", "sha256")
+	c.Assert(err, IsNil)
+	for _, p := range util.HashedPaths("targets/dir/baz.txt", bazMeta.Hashes) {
+		c.Assert(os.WriteFile(filepath.Join(tmp.path, "repository", p), []byte("baz"), 0644), IsNil)
+	}
+	for _, p := range util.HashedPaths("targets/foo.txt", hashes["targets/foo.txt"]) {
+		c.Assert(os.Remove(filepath.Join(tmp.path, "repository", p)), IsNil)
+	}
+
+	c.Assert(r.Regenerate(), IsNil)
+	tmp.assertExists("staged/targets.json")
+	tmp.assertExists("staged/role1.json")
+
+	t, err := r.topLevelTargets()
+	c.Assert(err, IsNil)
+	c.Assert(t.Version, Equals, int64(2))
+	c.Assert(t.Targets, HasLen, 0)
+	c.Assert(t.Delegations.Roles, HasLen, 1)
+
+	role1, err := r.targets("role1")
+	c.Assert(err, IsNil)
+	c.Assert(role1.Version, Equals, int64(2))
+	c.Assert(role1.Targets, HasLen, 2)
+	c.Assert(role1.Targets["dir/bar.txt"].Hashes, DeepEquals, hashes["targets/dir/bar.txt"])
+	c.Assert(role1.Targets["dir/baz.txt"].FileMeta, DeepEquals, bazMeta.FileMeta)
+
+	c.Assert(r.Snapshot(), IsNil)
+	c.Assert(r.Timestamp(), IsNil)
+	c.Assert(r.Commit(), IsNil)
+
+	// Regenerating keeps custom metadata of targets that are still present.
+	tmp.writeStagedTarget("foo.txt", "foo")
+	c.Assert(r.AddTarget("foo.txt", custom), IsNil)
+	c.Assert(r.Snapshot(), IsNil)
+	c.Assert(r.Timestamp(), IsNil)
+	c.Assert(r.Commit(), IsNil)
+	c.Assert(r.Regenerate(), IsNil)
+	t, err = r.topLevelTargets()
+	c.Assert(err, IsNil)
+	c.Assert(t.Targets, HasLen, 1)
+	c.Assert(*t.Targets["foo.txt"].Custom, DeepEquals, custom)
+}
+
+func (rs *RepoSuite) TestRegenerateLostMetadata(c *C) {
+	tmp := newTmpDir(c)
+	local := FileSystemStore(tmp.path, nil)
+	r, err := NewRepo(local)
+	c.Assert(err, IsNil)
+
+	genKey(c, r, "root")
+	genKey(c, r, "targets")
+	genKey(c, r, "snapshot")
+	genKey(c, r, "timestamp")
+	tmp.writeStagedTarget("foo.txt", "foo")
+	c.Assert(r.AddTarget("foo.txt", nil), IsNil)
+	c.Assert(r.Snapshot(), IsNil)
+	c.Assert(r.Timestamp(), IsNil)
+	c.Assert(r.Commit(), IsNil)
+
+	// Lose targets.json and reopen the repository.
+	c.Assert(os.Remove(filepath.Join(tmp.path, "repository", "targets.json")), IsNil)
+	r, err = NewRepo(FileSystemStore(tmp.path, nil))
+	c.Assert(err, IsNil)
+
+	c.Assert(r.Regenerate(), IsNil)
+	t, err := r.topLevelTargets()
+	c.Assert(err, IsNil)
+	c.Assert(t.Version, Equals, int64(2))
+	c.Assert(t.Targets, HasLen, 1)
+	c.Assert(t.Targets["foo.txt"].Length, Equals, int64(3))
+
+	c.Assert(r.Snapshot(), IsNil)
+	c.Assert(r.Timestamp(), IsNil)
+	c.Assert(r.Commit(), IsNil)
+	tmp.assertExists("repository/targets.json")
+}
+
+func (rs *RepoSuite) TestRegenerateUpdatedTarget(c *C) {
+	tmp := newTmpDir(c)
+	local := FileSystemStore(tmp.path, nil)
+	r, err := NewRepo(local)
+	c.Assert(err, IsNil)
+
+	genKey(c, r, "root")
+	genKey(c, r, "targets")
+	genKey(c, r, "snapshot")
+	genKey(c, r, "timestamp")
+
+	// Commit two versions of foo.txt, so that both are kept.
+	for _, content := range []string{"foo v1", "foo version 2"} {
+		tmp.writeStagedTarget("foo.txt", content)
+		c.Assert(r.AddTarget("foo.txt", nil), IsNil)
+		c.Assert(r.Snapshot(), IsNil)
+		c.Assert(r.Timestamp(), IsNil)
+		c.Assert(r.Commit(), IsNil)
+	}
+	hashes, err := r.fileHashes()
+	c.Assert(err, IsNil)
+
+	c.Assert(r.Regenerate(), IsNil)
+	t, err := r.topLevelTargets()
+	c.Assert(err, IsNil)
+	c.Assert(t.Targets, HasLen, 1)
+	c.Assert(t.Targets["foo.txt"].Length, Equals, int64(len("foo version 2")))
+	c.Assert(t.Targets["foo.txt"].Hashes, DeepEquals, hashes["targets/foo.txt"])
+
+	// Without the metadata, the current version cannot be told apart.
+	c.Assert(local.Clean(), IsNil)
+	c.Assert(os.Remove(filepath.Join(tmp.path, "repository", "targets.json")), IsNil)
+	r, err = NewRepo(FileSystemStore(tmp.path, nil))
+	c.Assert(err, IsNil)
+	c.Assert(r.Regenerate(), DeepEquals, ErrAmbiguousTarget{"foo.txt"})
+}
+
+func (rs *RepoSuite) TestRegenerateNotSupported(c *C) {
+	r, err := NewRepo(MemoryStore(nil, nil))
+	c.Assert(err, IsNil)
+	c.Assert(r.Regenerate(), Equals, ErrRegenerateNotSupported)
+}
+
 func (rs *RepoSuite) TestConsistentSnapshot(c *C) {
 	tmp := newTmpDir(c)
 	local := FileSystemStore(tmp.path, nil)
@@ -2375,6 +2558,215 @@ func (rs *RepoSuite) TestHashBinDelegations(c *C) {
 	})
 }
 
+func (rs *RepoSuite) TestSuccinctHashBinDelegations(c *C) {
+	tmp := newTmpDir(c)
+	local := FileSystemStore(tmp.path, nil)
+	r, err := NewRepo(local)
+	c.Assert(err, IsNil)
+
+	// Add one key to each role
+	genKey(c, r, "root")
+	targetsKeyIDs := genKey(c, r, "targets")
+	genKey(c, r, "snapshot")
+	genKey(c, r, "timestamp")
+
+	hb, err := targets.NewSuccinctHashBins("bins", 3)
+	c.Assert(err, IsNil)
+	names := []string{}
+	for i := uint64(0); i < hb.NumBins(); i++ {
+		names = append(names, hb.GetBin(i).RoleName())
+	}
+	c.Assert(names, DeepEquals, []string{
+		"bins-0", "bins-1", "bins-2", "bins-3", "bins-4", "bins-5", "bins-6", "bins-7",
+	})
+	binsKey, err := r.GenDelegatedKey(data.KeyTypeEd25519, names)
+	c.Assert(err, IsNil)
+
+	err = r.AddDelegatedRolesForPathHashBins("targets", hb, []*data.PublicKey{binsKey}, 1)
+	c.Assert(err, IsNil)
+
+	// Delegations to more bins than can be staged are refused.
+	tooMany := hb.SuccinctDelegatedRole(binsKey.IDs(), 1)
+	tooMany.Name, tooMany.NamePrefix = "many", "many"
+	tooMany.BitLength = targets.MaxSuccinctHashBinsBitLen + 1
+	err = r.AddDelegatedRole("targets", tooMany, []*data.PublicKey{binsKey})
+	c.Assert(err, FitsTypeOf, ErrInvalidRole{})
+
+	// targets.json holds a single delegation for all of the bins.
+	t, err := r.targets("targets")
+	c.Assert(err, IsNil)
+	c.Assert(t.Delegations.Roles, DeepEquals, []data.DelegatedRole{
+		hb.SuccinctDelegatedRole(binsKey.IDs(), 1),
+	})
+
+	c.Assert(r.Snapshot(), IsNil)
+	c.Assert(r.Timestamp(), IsNil)
+	c.Assert(r.Commit(), IsNil)
+
+	tmp.writeStagedTarget("foo.txt", "foo")
+	c.Assert(r.AddTarget("foo.txt", nil), IsNil)
+	c.Assert(r.Snapshot(), IsNil)
+	c.Assert(r.Timestamp(), IsNil)
+	c.Assert(r.Commit(), IsNil)
+
+	// foo.txt lands in the bin of its path hash, and only that bin gets a
+	// new version.
+	bin := t.Delegations.Roles[0].SuccinctRoleNameForPath("foo.txt")
+	snapshot, err := r.snapshot()
+	c.Assert(err, IsNil)
+	// 1 targets.json, 8 bins-*.json.
+	c.Assert(snapshot.Meta, HasLen, 9)
+	c.Assert(snapshot.Meta["targets.json"].Version, Equals, int64(1))
+	for _, name := range names {
+		version := int64(1)
+		if name == bin {
+			version = 2
+		}
+		c.Assert(snapshot.Meta[name+".json"].Version, Equals, version)
+	}
+
+	binTargets, err := r.targets(bin)
+	c.Assert(err, IsNil)
+	c.Assert(binTargets.Targets, HasLen, 1)
+	c.Assert(binTargets.Targets["foo.txt"], NotNil)
+
+	checkSigKeyIDs(c, local, map[string][]string{
+		"targets.json":       targetsKeyIDs,
+		"1.bins-0.json":      binsKey.IDs(),
+		"1.bins-7.json":      binsKey.IDs(),
+		"2." + bin + ".json": binsKey.IDs(),
+	})
+}
+
+func (rs *RepoSuite) TestHashBinsSharedKey(c *C) {
+	tmp := newTmpDir(c)
+	local := FileSystemStore(tmp.path, nil)
+	r, err := NewRepo(local)
+	c.Assert(err, IsNil)
+
+	genKey(c, r, "root")
+	genKey(c, r, "targets")
+	genKey(c, r, "snapshot")
+	genKey(c, r, "timestamp")
+
+	// The key is saved once for the prefix of the bins' names.
+	hb, err := targets.NewHashBins("bins_", 3)
+	c.Assert(err, IsNil)
+	binsKey, err := r.GenDelegatedKey(data.KeyTypeEd25519, []string{hb.RolePrefix()})
+	c.Assert(err, IsNil)
+	c.Assert(r.AddDelegatedRolesForPathHashBins("targets", hb, []*data.PublicKey{binsKey}, 1), IsNil)
+	tmp.assertExists("keys/bins_.json")
+	tmp.assertNotExist("keys/bins_0-1.json")
+
+	tmp.writeStagedTarget("foo.txt", "foo")
+	c.Assert(r.AddTarget("foo.txt", nil), IsNil)
+	c.Assert(r.Snapshot(), IsNil)
+	c.Assert(r.Timestamp(), IsNil)
+	c.Assert(r.Commit(), IsNil)
+
+	_, delegation, err := r.targetDelegationForPath("foo.txt", "")
+	c.Assert(err, IsNil)
+	checkSigKeyIDs(c, local, map[string][]string{
+		"1.bins_0-1.json":                          binsKey.IDs(),
+		"1." + delegation.Delegatee.Name + ".json": binsKey.IDs(),
+	})
+}
+
+func (rs *RepoSuite) TestSetHashBinsLayout(c *C) {
+	tmp := newTmpDir(c)
+	local := FileSystemStore(tmp.path, nil)
+	r, err := NewRepo(local)
+	c.Assert(err, IsNil)
+
+	// Add one key to each role
+	genKey(c, r, "root")
+	targetsKeyIDs := genKey(c, r, "targets")
+	genKey(c, r, "snapshot")
+	genKey(c, r, "timestamp")
+
+	tmp.writeStagedTarget("existing.txt", "existing")
+	c.Assert(r.AddTarget("existing.txt", nil), IsNil)
+	c.Assert(r.Snapshot(), IsNil)
+	c.Assert(r.Timestamp(), IsNil)
+	c.Assert(r.Commit(), IsNil)
+
+	hb, err := targets.NewSuccinctHashBins("bins", 4)
+	c.Assert(err, IsNil)
+	binsKey, err := keys.GenerateEd25519Key()
+	c.Assert(err, IsNil)
+	c.Assert(r.SetHashBinsLayout(hb, []keys.Signer{binsKey}, 2), DeepEquals, ErrNotEnoughKeys{"targets", 1, 2})
+	c.Assert(r.SetHashBinsLayout(nil, []keys.Signer{binsKey}, 1), DeepEquals, ErrInvalidRole{"targets", "no hash bins given"})
+
+	// An invalid layout saves no signers.
+	invalid, err := targets.NewSuccinctHashBins("invalid/bins", 4)
+	c.Assert(err, IsNil)
+	_, ok := r.SetHashBinsLayout(invalid, []keys.Signer{binsKey}, 1).(ErrInvalidRole)
+	c.Assert(ok, Equals, true)
+	signers, err := local.GetSigners("invalid/bins")
+	c.Assert(err, IsNil)
+	c.Assert(signers, HasLen, 0)
+
+	c.Assert(r.SetHashBinsLayout(hb, []keys.Signer{binsKey}, 1), IsNil)
+	c.Assert(r.SetHashBinsLayout(hb, []keys.Signer{binsKey}, 1), DeepEquals,
+		ErrInvalidRole{"targets", "hash bins can only be set up on a targets role without delegations"})
+	c.Assert(r.Snapshot(), IsNil)
+	c.Assert(r.Timestamp(), IsNil)
+	c.Assert(r.Commit(), IsNil)
+
+	// The signer is saved once for the whole delegation.
+	signers, err = local.GetSigners("bins")
+	c.Assert(err, IsNil)
+	c.Assert(signers, HasLen, 1)
+	signers, err = local.GetSigners("bins-0")
+	c.Assert(err, IsNil)
+	c.Assert(signers, HasLen, 0)
+
+	// The existing target was moved to its bin.
+	t, err := r.topLevelTargets()
+	c.Assert(err, IsNil)
+	c.Assert(t.Targets, HasLen, 0)
+	c.Assert(t.Version, Equals, int64(2))
+	delegation := t.Delegations.Roles[0]
+	existingBin := delegation.SuccinctRoleNameForPath("existing.txt")
+	binTargets, err := r.targets(existingBin)
+	c.Assert(err, IsNil)
+	c.Assert(binTargets.Targets["existing.txt"], NotNil)
+
+	oldSnapshot, err := r.snapshot()
+	c.Assert(err, IsNil)
+	// 1 targets.json, 16 bins-*.json.
+	c.Assert(oldSnapshot.Meta, HasLen, 17)
+
+	// New targets land in their bins, and only those bins get new versions.
+	tmp.writeStagedTarget("foo.txt", "foo")
+	tmp.writeStagedTarget("bar.txt", "bar")
+	c.Assert(r.AddTargets([]string{"foo.txt", "bar.txt"}, nil), IsNil)
+	c.Assert(r.Snapshot(), IsNil)
+	c.Assert(r.Timestamp(), IsNil)
+	c.Assert(r.Commit(), IsNil)
+
+	touched := map[string]struct{}{
+		delegation.SuccinctRoleNameForPath("foo.txt") + ".json": {},
+		delegation.SuccinctRoleNameForPath("bar.txt") + ".json": {},
+	}
+	snapshot, err := r.snapshot()
+	c.Assert(err, IsNil)
+	c.Assert(snapshot.Meta, HasLen, 17)
+	for name, meta := range snapshot.Meta {
+		if _, ok := touched[name]; ok {
+			c.Assert(meta.Version, Equals, oldSnapshot.Meta[name].Version+1)
+		} else {
+			c.Assert(meta, DeepEquals, oldSnapshot.Meta[name])
+		}
+	}
+
+	sigKeyIDs := map[string][]string{"targets.json": targetsKeyIDs}
+	for name := range touched {
+		sigKeyIDs[name] = binsKey.PublicData().IDs()
+	}
+	checkSigKeyIDs(c, local, sigKeyIDs)
+}
+
 func (rs *RepoSuite) TestResetTargetsDelegationsWithExpires(c *C) {
 	tmp := newTmpDir(c)
 	local := FileSystemStore(tmp.path, nil)
@@ -2442,18 +2834,288 @@ func (rs *RepoSuite) TestResetTargetsDelegationsWithExpires(c *C) {
 	c.Assert(r.Timestamp(), IsNil)
 	c.Assert(r.Commit(), IsNil)
 
+	// role1 is no longer delegated to, so its metadata is removed.
 	snapshot, err = r.snapshot()
 	c.Assert(err, IsNil)
-	c.Assert(snapshot.Meta, HasLen, 2)
+	c.Assert(snapshot.Meta, HasLen, 1)
 	c.Assert(snapshot.Meta["targets.json"].Version, Equals, int64(3))
-	c.Assert(snapshot.Meta["role1.json"].Version, Equals, int64(1))
 
 	checkSigKeyIDs(c, local, map[string][]string{
 		"2.targets.json": targetsKeyIDs,
 		"targets.json":   targetsKeyIDs,
-		"1.role1.json":   role1Key.PublicData().IDs(),
-		"role1.json":     role1Key.PublicData().IDs(),
 	})
+	tmp.assertNotExist("repository/role1.json")
+	tmp.assertNotExist("repository/1.role1.json")
+}
+
+func (rs *RepoSuite) TestGenDelegatedKey(c *C) {
+	tmp := newTmpDir(c)
+	local := FileSystemStore(tmp.path, nil)
+	r, err := NewRepo(local)
+	c.Assert(err, IsNil)
+
+	_, err = r.GenDelegatedKey(data.KeyTypeEd25519, []string{"role1", "targets"})
+	c.Assert(err, DeepEquals, ErrInvalidRole{"targets", "only delegated targets roles are supported"})
+	_, err = r.GenDelegatedKey("foo", []string{"role1"})
+	c.Assert(err, DeepEquals, ErrUnsupportedKeyType{"foo"})
+
+	// The key is saved for every delegatee.
+	pub, err := r.GenDelegatedKey(data.KeyTypeECDSA_SHA2_P256, []string{"role1", "role2"})
+	c.Assert(err, IsNil)
+	c.Assert(pub.Type, Equals, data.KeyTypeECDSA_SHA2_P256)
+	for _, role := range []string{"role1", "role2"} {
+		signers, err := local.GetSigners(role)
+		c.Assert(err, IsNil)
+		c.Assert(signers, HasLen, 1)
+		c.Assert(signers[0].PublicData().IDs(), DeepEquals, pub.IDs())
+	}
+
+	// No metadata is staged.
+	meta, err := local.GetMeta()
+	c.Assert(err, IsNil)
+	c.Assert(meta, HasLen, 0)
+}
+
+func (rs *RepoSuite) TestRemoveTargetsFromRole(c *C) {
+	tmp := newTmpDir(c)
+	local := FileSystemStore(tmp.path, nil)
+	r, err := NewRepo(local)
+	c.Assert(err, IsNil)
+
+	genKey(c, r, "root")
+	genKey(c, r, "targets")
+	genKey(c, r, "snapshot")
+	genKey(c, r, "timestamp")
+
+	role1Key, err := r.GenDelegatedKey(data.KeyTypeEd25519, []string{"role1"})
+	c.Assert(err, IsNil)
+	c.Assert(r.AddDelegatedRole("targets", data.DelegatedRole{
+		Name:      "role1",
+		KeyIDs:    role1Key.IDs(),
+		Paths:     []string{"*.txt"},
+		Threshold: 1,
+	}, []*data.PublicKey{role1Key}), IsNil)
+
+	tmp.writeStagedTarget("foo.txt", "foo")
+	tmp.writeStagedTarget("bar.txt", "bar")
+	c.Assert(r.AddTargetsToPreferredRole([]string{"foo.txt"}, nil, "targets"), IsNil)
+	c.Assert(r.AddTargets([]string{"foo.txt", "bar.txt"}, nil), IsNil)
+	c.Assert(r.Snapshot(), IsNil)
+	c.Assert(r.Timestamp(), IsNil)
+	c.Assert(r.Commit(), IsNil)
+
+	c.Assert(r.RemoveTargetsFromRole("root", nil), DeepEquals, ErrInvalidRole{"root", "only targets roles can list targets"})
+	c.Assert(r.RemoveTargetsFromRole("role2", nil), DeepEquals, ErrMissingMetadata{"role2.json"})
+
+	// Only role1 loses foo.txt.
+	c.Assert(r.RemoveTargetsFromRole("role1", []string{"foo.txt"}), IsNil)
+	c.Assert(r.Snapshot(), IsNil)
+	c.Assert(r.Timestamp(), IsNil)
+	c.Assert(r.Commit(), IsNil)
+
+	targets, err := r.targets("targets")
+	c.Assert(err, IsNil)
+	c.Assert(targets.Targets, HasLen, 1)
+	c.Assert(targets.Version, Equals, int64(1))
+	role1, err := r.targets("role1")
+	c.Assert(err, IsNil)
+	c.Assert(role1.Targets, HasLen, 1)
+	c.Assert(role1.Targets["bar.txt"], NotNil)
+	c.Assert(role1.Version, Equals, int64(2))
+}
+
+func (rs *RepoSuite) TestUpdateAndRemoveDelegatedRole(c *C) {
+	tmp := newTmpDir(c)
+	local := FileSystemStore(tmp.path, nil)
+	r, err := NewRepo(local)
+	c.Assert(err, IsNil)
+
+	genKey(c, r, "root")
+	targetsKeyIDs := genKey(c, r, "targets")
+	genKey(c, r, "snapshot")
+	genKey(c, r, "timestamp")
+
+	role1Key, err := r.GenDelegatedKey(data.KeyTypeEd25519, []string{"role1"})
+	c.Assert(err, IsNil)
+	role2Key, err := r.GenDelegatedKey(data.KeyTypeEd25519, []string{"role2"})
+	c.Assert(err, IsNil)
+
+	// Delegate from targets -> role1 for A/*, and targets -> role2 for B/*.
+	role1 := data.DelegatedRole{
+		Name:      "role1",
+		KeyIDs:    role1Key.IDs(),
+		Paths:     []string{"A/*"},
+		Threshold: 1,
+	}
+	c.Assert(r.AddDelegatedRole("targets", role1, []*data.PublicKey{role1Key}), IsNil)
+	role2 := data.DelegatedRole{
+		Name:      "role2",
+		KeyIDs:    role2Key.IDs(),
+		Paths:     []string{"B/*"},
+		Threshold: 1,
+	}
+	c.Assert(r.AddDelegatedRole("targets", role2, []*data.PublicKey{role2Key}), IsNil)
+	c.Assert(r.Snapshot(), IsNil)
+	c.Assert(r.Timestamp(), IsNil)
+	c.Assert(r.Commit(), IsNil)
+
+	c.Assert(r.UpdateDelegatedRole("targets", data.DelegatedRole{Name: "role3"}, nil), DeepEquals,
+		ErrNoDelegatedRole{Delegator: "targets", Role: "role3"})
+	c.Assert(r.RemoveDelegatedRole("role1", "role2"), DeepEquals,
+		ErrNoDelegatedRole{Delegator: "role1", Role: "role2"})
+
+	// Changing the paths of role1 only changes targets.json.
+	role1.Paths = []string{"A/*", "C/*"}
+	c.Assert(r.UpdateDelegatedRole("targets", role1, nil), IsNil)
+	c.Assert(r.Snapshot(), IsNil)
+	c.Assert(r.Timestamp(), IsNil)
+	c.Assert(r.Commit(), IsNil)
+
+	snapshot, err := r.snapshot()
+	c.Assert(err, IsNil)
+	c.Assert(snapshot.Meta["targets.json"].Version, Equals, int64(2))
+	c.Assert(snapshot.Meta["role1.json"].Version, Equals, int64(1))
+	c.Assert(snapshot.Meta["role2.json"].Version, Equals, int64(1))
+
+	t, err := r.targets("targets")
+	c.Assert(err, IsNil)
+	c.Assert(t.Delegations.Roles, DeepEquals, []data.DelegatedRole{role1, role2})
+
+	// Rotating the key of role1 signs role1.json with the new key, and the
+	// old key is removed from targets.json.
+	newRole1Key, err := r.GenDelegatedKey(data.KeyTypeEd25519, []string{"role1"})
+	c.Assert(err, IsNil)
+	role1.KeyIDs = newRole1Key.IDs()
+	role1.Threshold = 2
+	c.Assert(r.UpdateDelegatedRole("targets", role1, []*data.PublicKey{newRole1Key}), DeepEquals,
+		ErrNotEnoughKeys{"role1", 1, 2})
+	role1.Threshold = 1
+	c.Assert(r.UpdateDelegatedRole("targets", role1, nil), DeepEquals,
+		ErrKeyNotFound{"role1", newRole1Key.IDs()[0]})
+	c.Assert(r.UpdateDelegatedRole("targets", role1, []*data.PublicKey{newRole1Key}), IsNil)
+	c.Assert(r.Snapshot(), IsNil)
+	c.Assert(r.Timestamp(), IsNil)
+	c.Assert(r.Commit(), IsNil)
+
+	snapshot, err = r.snapshot()
+	c.Assert(err, IsNil)
+	c.Assert(snapshot.Meta["targets.json"].Version, Equals, int64(3))
+	c.Assert(snapshot.Meta["role1.json"].Version, Equals, int64(2))
+	c.Assert(snapshot.Meta["role2.json"].Version, Equals, int64(1))
+
+	t, err = r.targets("targets")
+	c.Assert(err, IsNil)
+	c.Assert(t.Delegations.Keys, HasLen, 2)
+	for _, id := range role1Key.IDs() {
+		c.Assert(t.Delegations.Keys[id], IsNil)
+	}
+	checkSigKeyIDs(c, local, map[string][]string{
+		"3.targets.json": targetsKeyIDs,
+		"2.role1.json":   newRole1Key.IDs(),
+		"role2.json":     role2Key.IDs(),
+	})
+
+	// Updates are checked like new delegations.
+	invalid := role1
+	invalid.Name = "../role1"
+	c.Assert(r.UpdateDelegatedRole("targets", invalid, nil), FitsTypeOf, ErrInvalidRole{})
+	invalid = role1
+	invalid.PathHashPrefixes = []string{"8f"}
+	c.Assert(r.UpdateDelegatedRole("targets", invalid, nil), Equals, data.ErrPathsAndPathHashesSet)
+
+	// role2 delegates to role3, and both role1 and role2 to role4.
+	role3Key, err := r.GenDelegatedKey(data.KeyTypeEd25519, []string{"role3", "role4"})
+	c.Assert(err, IsNil)
+	role3 := data.DelegatedRole{Name: "role3", KeyIDs: role3Key.IDs(), Paths: []string{"B/*"}, Threshold: 1}
+	c.Assert(r.AddDelegatedRole("role2", role3, []*data.PublicKey{role3Key}), IsNil)
+	role4 := data.DelegatedRole{Name: "role4", KeyIDs: role3Key.IDs(), Paths: []string{"*"}, Threshold: 1}
+	c.Assert(r.AddDelegatedRole("role1", role4, []*data.PublicKey{role3Key}), IsNil)
+	c.Assert(r.AddDelegatedRole("role2", role4, []*data.PublicKey{role3Key}), IsNil)
+	c.Assert(r.Snapshot(), IsNil)
+	c.Assert(r.Timestamp(), IsNil)
+	c.Assert(r.Commit(), IsNil)
+	tmp.assertExists("repository/role3.json")
+
+	// Removing role2 leaves role1 and its key alone, and removes the
+	// metadata of role2 and of role3, which is left without a delegator.
+	c.Assert(r.RemoveDelegatedRole("targets", "role2"), IsNil)
+	c.Assert(r.Snapshot(), IsNil)
+	c.Assert(r.Timestamp(), IsNil)
+	c.Assert(r.Commit(), IsNil)
+
+	t, err = r.targets("targets")
+	c.Assert(err, IsNil)
+	c.Assert(t.Version, Equals, int64(4))
+	c.Assert(t.Delegations.Roles, DeepEquals, []data.DelegatedRole{role1})
+	c.Assert(t.Delegations.Keys, HasLen, 1)
+	c.Assert(t.Delegations.Keys[newRole1Key.IDs()[0]], NotNil)
+
+	snapshot, err = r.snapshot()
+	c.Assert(err, IsNil)
+	listed := []string{}
+	for name := range snapshot.Meta {
+		listed = append(listed, name)
+	}
+	sort.Strings(listed)
+	c.Assert(listed, DeepEquals, []string{"role1.json", "role4.json", "targets.json"})
+	for _, name := range []string{"role2", "role3"} {
+		tmp.assertNotExist("repository/" + name + ".json")
+		tmp.assertNotExist("repository/1." + name + ".json")
+	}
+	tmp.assertExists("repository/role4.json")
+
+	// A fresh repository no longer sees the removed roles either.
+	r, err = NewRepo(local)
+	c.Assert(err, IsNil)
+	c.Assert(r.Snapshot(), IsNil)
+	snapshot, err = r.snapshot()
+	c.Assert(err, IsNil)
+	c.Assert(snapshot.Meta, HasLen, 3)
+}
+
+func (rs *RepoSuite) TestRevokeDelegatedRoleKey(c *C) {
+	tmp := newTmpDir(c)
+	local := FileSystemStore(tmp.path, nil)
+	r, err := NewRepo(local)
+	c.Assert(err, IsNil)
+
+	genKey(c, r, "root")
+	genKey(c, r, "targets")
+	genKey(c, r, "snapshot")
+	genKey(c, r, "timestamp")
+
+	key1, err := r.GenDelegatedKey(data.KeyTypeEd25519, []string{"role1"})
+	c.Assert(err, IsNil)
+	key2, err := r.GenDelegatedKey(data.KeyTypeEd25519, []string{"role1"})
+	c.Assert(err, IsNil)
+	role1 := data.DelegatedRole{
+		Name:      "role1",
+		KeyIDs:    append(key1.IDs(), key2.IDs()...),
+		Paths:     []string{"A/*"},
+		Threshold: 1,
+	}
+	c.Assert(r.AddDelegatedRole("targets", role1, []*data.PublicKey{key1, key2}), IsNil)
+	c.Assert(r.Snapshot(), IsNil)
+	c.Assert(r.Timestamp(), IsNil)
+	c.Assert(r.Commit(), IsNil)
+
+	c.Assert(r.RevokeDelegatedRoleKey("targets", "role1", "foo"), DeepEquals, ErrKeyNotFound{"role1", "foo"})
+
+	c.Assert(r.RevokeDelegatedRoleKey("targets", "role1", key1.IDs()[0]), IsNil)
+	c.Assert(r.Snapshot(), IsNil)
+	c.Assert(r.Timestamp(), IsNil)
+	c.Assert(r.Commit(), IsNil)
+
+	t, err := r.targets("targets")
+	c.Assert(err, IsNil)
+	c.Assert(t.Delegations.Roles[0].KeyIDs, DeepEquals, key2.IDs())
+	c.Assert(t.Delegations.Keys, HasLen, 1)
+	checkSigKeyIDs(c, local, map[string][]string{
+		"2.role1.json": key2.IDs(),
+	})
+
+	// The last key can't be revoked.
+	c.Assert(r.RevokeDelegatedRoleKey("targets", "role1", key2.IDs()[0]), DeepEquals, ErrNotEnoughKeys{"role1", 0, 1})
 }
 
 func (rs *RepoSuite) TestSignWithDelegations(c *C) {
@@ -2702,3 +3364,52 @@ func (rs *RepoSuite) TestTargetMetadataLength(c *C) {
 		c.Fatal("missing length field in foo.txt file meta")
 	}
 }
+
+// TestSignerHelperProcess is not a real test. It is run as an external
+// signing command by TestCommandSigner.
+func TestSignerHelperProcess(t *testing.T) {
+	signertest.HelperProcess()
+}
+
+func (rs *RepoSuite) TestCommandSigner(c *C) {
+	tmp := newTmpDir(c)
+	local := FileSystemStore(tmp.path, nil)
+	r, err := NewRepo(local)
+	c.Assert(err, IsNil)
+
+	genKey(c, r, "root")
+	genKey(c, r, "targets")
+
+	// Sign snapshot and timestamp through an external command.
+	commandKeyIDs := map[string][]string{}
+	for _, role := range []string{"snapshot", "timestamp"} {
+		key, err := keys.GenerateEd25519Key()
+		c.Assert(err, IsNil)
+		command := signertest.Command("TestSignerHelperProcess", key.PrivateKey)
+		signer, err := keys.NewCommandSignerFromKey(key.PublicData(), command)
+		c.Assert(err, IsNil)
+		commandKeyIDs[role+".json"] = addPrivateKey(c, r, role, signer)
+	}
+
+	// Only the reference to the key is persisted.
+	keysJSON := tmp.readFile("keys/timestamp.json")
+	pk := &persistedKeys{}
+	c.Assert(json.Unmarshal(keysJSON, pk), IsNil)
+	var privKeys []*data.PrivateKey
+	c.Assert(json.Unmarshal(pk.Data, &privKeys), IsNil)
+	c.Assert(privKeys, HasLen, 1)
+	c.Assert(privKeys[0].Type, Equals, keys.KeyTypeCommand)
+
+	// A new repo reloads the command signers from the keys directory.
+	r, err = NewRepo(FileSystemStore(tmp.path, nil))
+	c.Assert(err, IsNil)
+	c.Assert(r.AddTargets([]string{}, nil), IsNil)
+	c.Assert(r.Snapshot(), IsNil)
+	c.Assert(r.Timestamp(), IsNil)
+	checkSigKeyIDs(c, local, commandKeyIDs)
+
+	// Re-signing goes through the command too.
+	c.Assert(r.Sign("timestamp.json"), IsNil)
+	checkSigKeyIDs(c, local, commandKeyIDs)
+	c.Assert(r.Commit(), IsNil)
+}
@@ -0,0 +1,532 @@
+package tuf
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/theupdateframework/go-tuf/data"
+	"github.com/theupdateframework/go-tuf/internal/roles"
+	"github.com/theupdateframework/go-tuf/util"
+	"github.com/theupdateframework/go-tuf/verify"
+)
+
+// VerifyProblem is an inconsistency Verify found in the committed
+// repository.
+type VerifyProblem struct {
+	// File is the metadata file (e.g. snapshot.json) or target file (e.g.
+	// targets/foo.txt) the problem is with, relative to the repository.
+	File    string `json:"file"`
+	Problem string `json:"problem"`
+}
+
+func (p VerifyProblem) String() string {
+	return p.File + ": " + p.Problem
+}
+
+// ExpiringRole is a role whose committed metadata expires soon.
+type ExpiringRole struct {
+	Role    string    `json:"role"`
+	Expires time.Time `json:"expires"`
+}
+
+// VerifyReport is the result of auditing the committed repository.
+type VerifyReport struct {
+	// Problems are sorted by file.
+	Problems []VerifyProblem `json:"problems"`
+
+	// Expiring lists the roles that have not expired yet, but will before
+	// the time passed to Verify, sorted by expiration time.
+	Expiring []ExpiringRole `json:"expiring"`
+}
+
+// OK returns whether no problems were found. Roles that expire soon are not
+// problems.
+func (r *VerifyReport) OK() bool {
+	return len(r.Problems) == 0
+}
+
+// Verify audits the committed repository, ignoring anything that is staged.
+// It checks that:
+//
+//   - the metadata of every top-level and delegated role is signed by a
+//     threshold of the keys its delegators list for it, and has not expired
+//   - snapshot.json and timestamp.json list the versions, lengths and hashes
+//     of the metadata that is committed
+//   - every target file listed by a targets role is committed, under its
+//     consistent snapshot names if those are used, with the right length and
+//     hashes
+//   - there are no committed files that no metadata accounts for, other
+//     than the files of earlier versions of metadata and targets that
+//     consistent snapshots keep
+//
+// Roles that will have expired by expiringBefore are listed in the report.
+func (r *Repo) Verify(expiringBefore time.Time) (*VerifyReport, error) {
+	getter, ok := r.local.(CommittedMetaGetter)
+	if !ok {
+		return nil, ErrVerifyNotSupported
+	}
+	walker, ok := r.local.(CommittedTargetsWalker)
+	if !ok {
+		return nil, ErrVerifyNotSupported
+	}
+	committed, err := getter.GetCommittedMeta()
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := committed["root.json"]; !ok {
+		return nil, ErrNewRepository
+	}
+
+	v := &repoVerifier{
+		committed:      committed,
+		expiringBefore: expiringBefore,
+		versions:       make(map[string]int64),
+		targets:        make(map[string]*data.Targets),
+		report: &VerifyReport{
+			Problems: []VerifyProblem{},
+			Expiring: []ExpiringRole{},
+		},
+	}
+	if err := v.verifyMetadata(); err != nil {
+		return nil, err
+	}
+	if err := v.verifyTargetFiles(walker); err != nil {
+		return nil, err
+	}
+	v.verifyNoOrphanedMetadata()
+
+	sort.SliceStable(v.report.Problems, func(i, j int) bool {
+		return v.report.Problems[i].File < v.report.Problems[j].File
+	})
+	sort.SliceStable(v.report.Expiring, func(i, j int) bool {
+		return v.report.Expiring[i].Expires.Before(v.report.Expiring[j].Expires)
+	})
+	return v.report, nil
+}
+
+// repoVerifier holds the state of a Verify run.
+type repoVerifier struct {
+	committed      map[string]json.RawMessage
+	expiringBefore time.Time
+	report         *VerifyReport
+
+	root *data.Root
+
+	// versions maps the metadata files that belong to a role to the version
+	// they contain.
+	versions map[string]int64
+
+	// targets maps the metadata files of the targets roles that are
+	// reachable from the top-level targets role to their contents.
+	targets map[string]*data.Targets
+}
+
+func (v *repoVerifier) problem(file, format string, args ...interface{}) {
+	v.report.Problems = append(v.report.Problems, VerifyProblem{
+		File:    file,
+		Problem: fmt.Sprintf(format, args...),
+	})
+}
+
+// signed decodes the committed metadata file name into v, returning nil if
+// it is missing or malformed, which is reported as a problem.
+func (v *repoVerifier) signed(name string, meta interface{}) *data.Signed {
+	raw, ok := v.committed[name]
+	if !ok {
+		v.problem(name, "missing")
+		return nil
+	}
+	s := &data.Signed{}
+	if err := json.Unmarshal(raw, s); err != nil {
+		v.problem(name, "malformed metadata: %s", err)
+		return nil
+	}
+	if err := json.Unmarshal(s.Signed, meta); err != nil {
+		v.problem(name, "malformed metadata: %s", err)
+		return nil
+	}
+	return s
+}
+
+// checkSignatures reports a problem if s is not signed by the role in every
+// one of dbs.
+func (v *repoVerifier) checkSignatures(name string, s *data.Signed, dbs []*verify.DB) {
+	role := strings.TrimSuffix(name, ".json")
+	for _, db := range dbs {
+		if err := db.VerifyIgnoreExpiredCheck(s, role, 0); err != nil {
+			v.problem(name, "invalid signatures: %s", err)
+			return
+		}
+	}
+}
+
+// checkExpires reports a problem if the role has expired, and lists it in
+// the report if it expires soon.
+func (v *repoVerifier) checkExpires(name string, expires time.Time) {
+	if verify.IsExpired(expires) {
+		v.problem(name, "expired on %s", expires.UTC().Format(time.RFC3339))
+	} else if expires.Before(v.expiringBefore) {
+		v.report.Expiring = append(v.report.Expiring, ExpiringRole{
+			Role:    strings.TrimSuffix(name, ".json"),
+			Expires: expires,
+		})
+	}
+}
+
+// verifyMetadata checks the signatures and expiration of every role, and
+// the file metadata listed by snapshot.json and timestamp.json.
+func (v *repoVerifier) verifyMetadata() error {
+	root := &data.Root{}
+	s := v.signed("root.json", root)
+	if s == nil {
+		return nil
+	}
+	v.root = root
+	v.versions["root.json"] = root.Version
+	db, err := rootKeysDB(root)
+	if err != nil {
+		return err
+	}
+
+	// Clients only trust the root metadata if it is signed by the keys of
+	// the root it replaces as well.
+	rootDBs := []*verify.DB{db}
+	if root.Version > 1 {
+		prevName := util.VersionedPath("root.json", root.Version-1)
+		prev := &data.Root{}
+		if v.signed(prevName, prev) != nil {
+			prevDB, err := rootKeysDB(prev)
+			if err != nil {
+				return err
+			}
+			rootDBs = append(rootDBs, prevDB)
+		}
+	}
+	v.checkSignatures("root.json", s, rootDBs)
+	v.checkExpires("root.json", root.Expires)
+
+	snapshot := &data.Snapshot{}
+	snapshotSigned := v.signed("snapshot.json", snapshot)
+	if err := v.verifyTargetsRoles(db, snapshot); err != nil {
+		return err
+	}
+
+	if s := snapshotSigned; s != nil {
+		v.versions["snapshot.json"] = snapshot.Version
+		v.checkSignatures("snapshot.json", s, []*verify.DB{db})
+		v.checkExpires("snapshot.json", snapshot.Expires)
+		v.verifySnapshotMeta(snapshot)
+	}
+
+	timestamp := &data.Timestamp{}
+	if s := v.signed("timestamp.json", timestamp); s != nil {
+		v.versions["timestamp.json"] = timestamp.Version
+		v.checkSignatures("timestamp.json", s, []*verify.DB{db})
+		v.checkExpires("timestamp.json", timestamp.Expires)
+		v.verifyTimestampMeta(timestamp)
+	}
+	return nil
+}
+
+// verifyTargetsRoles walks the delegations from the top-level targets role,
+// checking each delegated role against the keys of every delegator that
+// delegates to it.
+func (v *repoVerifier) verifyTargetsRoles(rootDB *verify.DB, snapshot *data.Snapshot) error {
+	t := &data.Targets{}
+	s := v.signed("targets.json", t)
+	if s == nil {
+		return nil
+	}
+	v.checkSignatures("targets.json", s, []*verify.DB{rootDB})
+	v.checkExpires("targets.json", t.Expires)
+	v.versions["targets.json"] = t.Version
+	v.targets["targets.json"] = t
+
+	queue := []string{"targets.json"}
+	delegatees := []string{}
+	delegatorDBs := map[string][]*verify.DB{}
+	for len(queue) > 0 {
+		delegator := v.targets[queue[0]]
+		queue = queue[1:]
+		if delegator.Delegations == nil {
+			continue
+		}
+		db, err := verify.NewDBFromDelegations(delegator.Delegations)
+		if err != nil {
+			return err
+		}
+		for _, role := range delegator.Delegations.Roles {
+			for _, delegatee := range v.delegateeNames(role, snapshot) {
+				name := delegatee + ".json"
+				if _, ok := delegatorDBs[name]; !ok {
+					delegatees = append(delegatees, name)
+				}
+				delegatorDBs[name] = append(delegatorDBs[name], db)
+				if _, ok := v.targets[name]; ok {
+					continue
+				}
+				t := &data.Targets{}
+				if _, ok := v.committed[name]; !ok {
+					continue
+				}
+				if v.signed(name, t) == nil {
+					continue
+				}
+				v.targets[name] = t
+				v.versions[name] = t.Version
+				queue = append(queue, name)
+			}
+		}
+	}
+
+	// Check the signatures once all delegations are known, as a role may be
+	// delegated to by a role that is visited after it.
+	for _, name := range delegatees {
+		if _, ok := v.committed[name]; !ok {
+			v.problem(name, "missing")
+			continue
+		}
+		t, ok := v.targets[name]
+		if !ok {
+			// malformed metadata has already been reported
+			continue
+		}
+		s := &data.Signed{}
+		if err := json.Unmarshal(v.committed[name], s); err != nil {
+			return err
+		}
+		v.checkSignatures(name, s, delegatorDBs[name])
+		v.checkExpires(name, t.Expires)
+	}
+	return nil
+}
+
+// delegateeNames returns the names of the roles a delegation delegates to.
+// Only the bins of a succinct hash bin delegation that are listed in
+// snapshot.json or committed are returned, as there can be billions of
+// them.
+func (v *repoVerifier) delegateeNames(role data.DelegatedRole, snapshot *data.Snapshot) []string {
+	if !role.IsSuccinct() {
+		return []string{role.Name}
+	}
+	bins := make(map[string]struct{})
+	addBin := func(file string) {
+		if name := strings.TrimSuffix(file, ".json"); role.IsSuccinctRoleName(name) {
+			bins[name] = struct{}{}
+		}
+	}
+	for file := range snapshot.Meta {
+		addBin(file)
+	}
+	for file := range v.committed {
+		addBin(file)
+	}
+	return sortedNames(bins)
+}
+
+// verifySnapshotMeta checks that snapshot.json lists every targets role,
+// and that the files it lists match the committed ones.
+func (v *repoVerifier) verifySnapshotMeta(snapshot *data.Snapshot) {
+	for _, name := range v.targetsMetaNames() {
+		if _, ok := snapshot.Meta[name]; !ok {
+			v.problem("snapshot.json", "does not list %s", name)
+		}
+	}
+	listed := make(map[string]struct{}, len(snapshot.Meta))
+	for name := range snapshot.Meta {
+		listed[name] = struct{}{}
+	}
+	for _, name := range sortedNames(listed) {
+		expected := snapshot.Meta[name]
+		if _, ok := v.targets[name]; !ok {
+			v.problem("snapshot.json", "lists %s, which is not a delegated targets role", name)
+			continue
+		}
+		for _, file := range v.consistentMetaNames(name, expected.Version) {
+			raw, ok := v.committed[file]
+			if !ok {
+				v.problem(file, "missing, but listed in snapshot.json")
+				continue
+			}
+			actual, err := util.GenerateSnapshotFileMeta(bytes.NewReader(raw), hashAlgorithms(expected.Hashes)...)
+			if err != nil {
+				v.problem(file, "%s", err)
+				continue
+			}
+			if err := util.SnapshotFileMetaEqual(actual, expected); err != nil {
+				v.problem(file, "does not match snapshot.json: %s", err)
+			}
+		}
+	}
+}
+
+// verifyTimestampMeta checks that timestamp.json lists the committed
+// snapshot.json.
+func (v *repoVerifier) verifyTimestampMeta(timestamp *data.Timestamp) {
+	expected, ok := timestamp.Meta["snapshot.json"]
+	if !ok {
+		v.problem("timestamp.json", "does not list snapshot.json")
+		return
+	}
+	for _, file := range v.consistentMetaNames("snapshot.json", expected.Version) {
+		raw, ok := v.committed[file]
+		if !ok {
+			v.problem(file, "missing, but listed in timestamp.json")
+			continue
+		}
+		actual, err := util.GenerateTimestampFileMeta(bytes.NewReader(raw), hashAlgorithms(expected.Hashes)...)
+		if err != nil {
+			v.problem(file, "%s", err)
+			continue
+		}
+		if err := util.TimestampFileMetaEqual(actual, expected); err != nil {
+			v.problem(file, "does not match timestamp.json: %s", err)
+		}
+	}
+}
+
+// targetsMetaNames returns the sorted names of the metadata files of the
+// reachable targets roles.
+func (v *repoVerifier) targetsMetaNames() []string {
+	names := make([]string, 0, len(v.targets))
+	for name := range v.targets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// consistentMetaNames returns the names a metadata file at the given
+// version is committed under.
+func (v *repoVerifier) consistentMetaNames(name string, version int64) []string {
+	if v.root == nil || !v.root.ConsistentSnapshot {
+		return []string{name}
+	}
+	return []string{name, util.VersionedPath(name, version)}
+}
+
+// verifyTargetFiles checks that every target file listed by a targets role
+// is committed with the right length and hashes, and that every committed
+// target file is listed. With consistent snapshots, commits keep the files
+// of earlier versions of a target, so those are not reported.
+func (v *repoVerifier) verifyTargetFiles(walker CommittedTargetsWalker) error {
+	consistent := v.root != nil && v.root.ConsistentSnapshot
+
+	// expected maps committed target file names to the metadata the roles
+	// that list them expect.
+	expected := map[string][]data.TargetFileMeta{}
+	listed := map[string]struct{}{}
+	for _, metaName := range v.targetsMetaNames() {
+		for path, meta := range v.targets[metaName].Targets {
+			path = util.NormalizeTarget(path)
+			listed[path] = struct{}{}
+			names := []string{path}
+			if consistent {
+				names = util.HashedPaths(path, meta.Hashes)
+			}
+			for _, name := range names {
+				expected[name] = append(expected[name], meta)
+			}
+		}
+	}
+
+	found := make(map[string]struct{}, len(expected))
+	if err := walker.WalkCommittedTargets(func(name string, target io.Reader) error {
+		file := "targets/" + name
+		metas, ok := expected[name]
+		if !ok {
+			if consistent {
+				dir, base := path.Split(name)
+				if parts := strings.SplitN(base, ".", 2); len(parts) == 2 {
+					if _, ok := listed[dir+parts[1]]; ok {
+						return nil
+					}
+				}
+			}
+			v.problem(file, "not listed by any targets role")
+			return nil
+		}
+		found[name] = struct{}{}
+		actual, err := util.GenerateTargetFileMeta(target, data.HashAlgorithms...)
+		if err != nil {
+			return err
+		}
+		for _, meta := range metas {
+			if err := util.TargetFileMetaEqual(actual, meta); err != nil {
+				v.problem(file, "does not match its targets metadata: %s", err)
+				break
+			}
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	missing := make(map[string]struct{})
+	for name := range expected {
+		if _, ok := found[name]; !ok {
+			missing[name] = struct{}{}
+		}
+	}
+	for _, name := range sortedNames(missing) {
+		v.problem("targets/"+name, "missing")
+	}
+	return nil
+}
+
+// verifyNoOrphanedMetadata reports committed metadata files that belong to
+// no role. Older versions of a role's metadata are kept, so a versioned file
+// is only an orphan if it is newer than the current version.
+func (v *repoVerifier) verifyNoOrphanedMetadata() {
+	for name := range v.committed {
+		if _, ok := v.versions[name]; ok {
+			continue
+		}
+		if version, role, ok := parseVersionedName(name); ok && role != "timestamp.json" {
+			if current, ok := v.versions[role]; ok && version <= current {
+				continue
+			}
+		}
+		if roles.IsTopLevelManifest(name) {
+			// Problems with missing or malformed top-level metadata have
+			// already been reported.
+			continue
+		}
+		v.problem(name, "does not belong to any role")
+	}
+}
+
+// parseVersionedName splits a consistent snapshot metadata name like
+// 2.root.json into its version and the name of the metadata.
+func parseVersionedName(name string) (int64, string, bool) {
+	parts := strings.SplitN(name, ".", 2)
+	if len(parts) != 2 {
+		return 0, "", false
+	}
+	version, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil || version < 1 {
+		return 0, "", false
+	}
+	return version, parts[1], true
+}
+
+// hashAlgorithms returns the algorithms of hashes, or the default algorithm
+// if there are none.
+func hashAlgorithms(hashes data.Hashes) []string {
+	algs := make([]string, 0, len(hashes))
+	for alg := range hashes {
+		algs = append(algs, alg)
+	}
+	if len(algs) == 0 {
+		algs = append(algs, "sha512")
+	}
+	sort.Strings(algs)
+	return algs
+}
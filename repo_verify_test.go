@@ -0,0 +1,165 @@
+package tuf
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/theupdateframework/go-tuf/data"
+	"github.com/theupdateframework/go-tuf/pkg/keys"
+	"github.com/theupdateframework/go-tuf/verify"
+	. "gopkg.in/check.v1"
+)
+
+func (rs *RepoSuite) TestVerify(c *C) {
+	tmp := newTmpDir(c)
+	local := FileSystemStore(tmp.path, nil)
+	r, err := NewRepo(local, "sha256")
+	c.Assert(err, IsNil)
+
+	_, err = r.Verify(time.Now())
+	c.Assert(err, Equals, ErrNewRepository)
+
+	// root.json expires when the last key added to it does
+	genKey(c, r, "timestamp")
+	genKey(c, r, "snapshot")
+	genKey(c, r, "targets")
+	genKey(c, r, "root")
+	roleKey, err := keys.GenerateEd25519Key()
+	c.Assert(err, IsNil)
+	c.Assert(local.SaveSigner("role", roleKey), IsNil)
+	c.Assert(r.AddDelegatedRole("targets", data.DelegatedRole{
+		Name:      "role",
+		KeyIDs:    roleKey.PublicData().IDs(),
+		Paths:     []string{"A/*"},
+		Threshold: 1,
+	}, []*data.PublicKey{roleKey.PublicData()}), IsNil)
+	tmp.writeStagedTarget("foo.txt", "foo")
+	tmp.writeStagedTarget("A/bar.txt", "bar")
+	c.Assert(r.AddTargets([]string{"foo.txt", "A/bar.txt"}, nil), IsNil)
+	c.Assert(r.Snapshot(), IsNil)
+	c.Assert(r.Timestamp(), IsNil)
+	c.Assert(r.Commit(), IsNil)
+
+	report, err := r.Verify(time.Now())
+	c.Assert(err, IsNil)
+	c.Assert(report.Problems, DeepEquals, []VerifyProblem{})
+	c.Assert(report.Expiring, DeepEquals, []ExpiringRole{})
+	c.Assert(report.OK(), Equals, true)
+
+	report, err = r.Verify(time.Now().AddDate(0, 0, 10))
+	c.Assert(err, IsNil)
+	c.Assert(report.OK(), Equals, true)
+	expiring := []string{}
+	for _, role := range report.Expiring {
+		expiring = append(expiring, role.Role)
+	}
+	c.Assert(expiring, DeepEquals, []string{"timestamp", "snapshot"})
+	report, err = r.Verify(time.Now().AddDate(2, 0, 0))
+	c.Assert(err, IsNil)
+	c.Assert(report.Expiring, HasLen, 5)
+	c.Assert(report.Expiring[4].Role, Equals, "root")
+
+	// expired roles are problems
+	isExpired := verify.IsExpired
+	verify.IsExpired = func(t time.Time) bool { return true }
+	report, err = r.Verify(time.Now())
+	verify.IsExpired = isExpired
+	c.Assert(err, IsNil)
+	c.Assert(report.Problems, HasLen, 5)
+	c.Assert(report.Problems[0].File, Equals, "role.json")
+	c.Assert(report.Problems[0].Problem, Matches, "expired on .*")
+
+	// tamper with a target, and leave behind orphaned files
+	repoDir := filepath.Join(tmp.path, "repository")
+	fooHash := sha256.Sum256([]byte("foo"))
+	fooName := fmt.Sprintf("%x.foo.txt", fooHash)
+	c.Assert(os.WriteFile(filepath.Join(repoDir, "targets", fooName), []byte("bad"), 0644), IsNil)
+	c.Assert(os.WriteFile(filepath.Join(repoDir, "targets", "baz.txt"), []byte("baz"), 0644), IsNil)
+	barName := fmt.Sprintf("A/%x.bar.txt", sha256.Sum256([]byte("bar")))
+	c.Assert(os.Remove(filepath.Join(repoDir, "targets", barName)), IsNil)
+	targetsJSON, err := os.ReadFile(filepath.Join(repoDir, "targets.json"))
+	c.Assert(err, IsNil)
+	c.Assert(os.WriteFile(filepath.Join(repoDir, "2.targets.json"), targetsJSON, 0644), IsNil)
+	c.Assert(os.WriteFile(filepath.Join(repoDir, "other.json"), targetsJSON, 0644), IsNil)
+
+	// the versioned copies of a role must match snapshot.json
+	c.Assert(os.Remove(filepath.Join(repoDir, "1.role.json")), IsNil)
+
+	report, err = r.Verify(time.Now())
+	c.Assert(err, IsNil)
+	c.Assert(report.OK(), Equals, false)
+	problems := []string{}
+	for _, p := range report.Problems {
+		problems = append(problems, p.String())
+	}
+	c.Assert(problems, DeepEquals, []string{
+		"1.role.json: missing, but listed in snapshot.json",
+		"2.targets.json: does not belong to any role",
+		"other.json: does not belong to any role",
+		fmt.Sprintf("targets/%s: does not match its targets metadata: wrong sha256 hash, expected %x got %x", fooName, fooHash, sha256.Sum256([]byte("bad"))),
+		"targets/" + barName + ": missing",
+		"targets/baz.txt: not listed by any targets role",
+	})
+}
+
+func (rs *RepoSuite) TestVerifyInvalidSignatures(c *C) {
+	tmp := newTmpDir(c)
+	local := FileSystemStore(tmp.path, nil)
+	r, err := NewRepo(local)
+	c.Assert(err, IsNil)
+
+	genKey(c, r, "root")
+	genKey(c, r, "targets")
+	genKey(c, r, "snapshot")
+	genKey(c, r, "timestamp")
+	c.Assert(r.AddTargets([]string{}, nil), IsNil)
+	c.Assert(r.Snapshot(), IsNil)
+	c.Assert(r.Timestamp(), IsNil)
+	c.Assert(r.Commit(), IsNil)
+
+	// corrupt the signature of targets.json
+	path := filepath.Join(tmp.path, "repository", "targets.json")
+	raw, err := os.ReadFile(path)
+	c.Assert(err, IsNil)
+	s := &data.Signed{}
+	c.Assert(json.Unmarshal(raw, s), IsNil)
+	s.Signatures[0].Signature = data.HexBytes("bad")
+	raw, err = json.Marshal(s)
+	c.Assert(err, IsNil)
+	c.Assert(os.WriteFile(path, raw, 0644), IsNil)
+
+	report, err := r.Verify(time.Now())
+	c.Assert(err, IsNil)
+	problems := []string{}
+	for _, p := range report.Problems {
+		problems = append(problems, p.String())
+	}
+	c.Assert(problems, DeepEquals, []string{
+		"targets.json: invalid signatures: tuf: signature verification failed",
+		"targets.json: does not match snapshot.json: wrong length, expected 338 got 216",
+	})
+
+	r, err = NewRepo(struct{ LocalStore }{MemoryStore(nil, nil)})
+	c.Assert(err, IsNil)
+	_, err = r.Verify(time.Now())
+	c.Assert(err, Equals, ErrVerifyNotSupported)
+}
+
+func (rs *RepoSuite) TestVerifySuccinctDelegateeNames(c *C) {
+	role := data.DelegatedRole{Name: "bins", BitLength: 32, NamePrefix: "bins"}
+	v := &repoVerifier{committed: map[string]json.RawMessage{
+		"bins-00000002.json":   nil,
+		"1.bins-00000002.json": nil,
+		"bins-00000003.json":   nil,
+	}}
+	snapshot := &data.Snapshot{Meta: data.SnapshotFiles{
+		"targets.json":       {},
+		"bins-00000001.json": {},
+		"bins-00000002.json": {},
+	}}
+	c.Assert(v.delegateeNames(role, snapshot), DeepEquals, []string{"bins-00000001", "bins-00000002", "bins-00000003"})
+}
@@ -0,0 +1,484 @@
+package tuf
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/secure-systems-lab/go-securesystemslib/cjson"
+	"github.com/theupdateframework/go-tuf/data"
+	"github.com/theupdateframework/go-tuf/util"
+	"github.com/theupdateframework/go-tuf/verify"
+)
+
+// RootSigningBundle is a proposed root.json that is passed around the root
+// key holders in an offline signing ceremony.
+//
+// The bundle is exported from the repository with RootSigningBundle, each
+// holder signs their own copy of it with SignRootSigningBundle, and the
+// copies are combined with MergeRootSigningBundles. Once Status reports that
+// enough keys have signed, the signatures are added to the staged root.json
+// with AddRootSigningBundle.
+type RootSigningBundle struct {
+	// Root is the proposed root metadata with the signatures collected so
+	// far.
+	Root data.Signed `json:"root"`
+
+	// PreviousRoot is the signed portion of the root metadata the proposal
+	// replaces, if there is one. A threshold of its root keys must also sign
+	// the proposal, so that clients which trust it can update to the new
+	// root.
+	PreviousRoot json.RawMessage `json:"previous_root,omitempty"`
+
+	// Changes describes how the proposal differs from the previous root.
+	Changes []string `json:"changes"`
+}
+
+// RootKeysStatus reports which keys of a root role have signed a root
+// proposal.
+type RootKeysStatus struct {
+	Threshold int
+
+	// Signatures is the number of keys with a valid signature.
+	Signatures int
+
+	// Signed and Missing are the sorted IDs of the keys that have and have
+	// not signed.
+	Signed  []string
+	Missing []string
+}
+
+// ThresholdMet returns whether enough keys have signed.
+func (s *RootKeysStatus) ThresholdMet() bool {
+	return s.Signatures >= s.Threshold
+}
+
+// RootSigningStatus reports the progress of a root signing ceremony.
+type RootSigningStatus struct {
+	// Root covers the root keys listed by the proposal.
+	Root *RootKeysStatus
+
+	// PreviousRoot covers the root keys listed by the previous root, and is
+	// nil if there is none.
+	PreviousRoot *RootKeysStatus
+}
+
+// Complete returns whether the proposal is signed by a threshold of both the
+// new and the previous root keys.
+func (s *RootSigningStatus) Complete() bool {
+	return s.Root.ThresholdMet() && (s.PreviousRoot == nil || s.PreviousRoot.ThresholdMet())
+}
+
+// RootSigningBundle exports the staged root.json, or the committed one if
+// none is staged, as a proposal for an offline signing ceremony. Signatures
+// the metadata already has are kept.
+func (r *Repo) RootSigningBundle() (*RootSigningBundle, error) {
+	s, err := r.SignedMeta("root.json")
+	if err != nil {
+		return nil, err
+	}
+	payload, err := r.Payload("root.json")
+	if err != nil {
+		return nil, err
+	}
+	root, err := r.root()
+	if err != nil {
+		return nil, err
+	}
+	prev, err := r.previousRoot()
+	if err != nil {
+		return nil, err
+	}
+
+	b := &RootSigningBundle{
+		Root: data.Signed{
+			Signed:     payload,
+			Signatures: append(make([]data.Signature, 0, len(s.Signatures)), s.Signatures...),
+		},
+		Changes: rootChanges(prev, root),
+	}
+	if prev != nil {
+		if b.PreviousRoot, err = cjson.EncodeCanonical(prev); err != nil {
+			return nil, err
+		}
+	}
+	return b, nil
+}
+
+// SignRootSigningBundle signs the proposal in b with the local root keys,
+// and returns the number of keys it was signed with.
+//
+// The proposal is checked against the root metadata committed to the local
+// repository first, which the signer trusts: it must be the next version of
+// that root, and its previous root must be that root, or
+// ErrUntrustedRootSigningBundle is returned. The changes listed by b must be
+// the differences from that root, so that they can be shown to the signer,
+// or ErrRootSigningBundleChanges is returned.
+func (r *Repo) SignRootSigningBundle(b *RootSigningBundle) (int, error) {
+	if err := r.checkRootSigningBundle(b); err != nil {
+		return 0, err
+	}
+	return r.SignPayload("root", &b.Root)
+}
+
+// AddRootSigningBundle adds the signatures collected in b to the staged
+// root.json, which must be the metadata b proposes. Signatures by keys that
+// are in neither root are left out.
+func (r *Repo) AddRootSigningBundle(b *RootSigningBundle) error {
+	payload, err := r.Payload("root.json")
+	if err != nil {
+		return err
+	}
+	proposed, err := cjson.EncodeCanonical(b.Root.Signed)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(payload, proposed) {
+		return ErrStaleRootSigningBundle
+	}
+
+	dbs, err := b.keysDBs()
+	if err != nil {
+		return err
+	}
+	for _, sig := range b.Root.Signatures {
+		known, err := verifyRootSignature(dbs, proposed, sig)
+		if err != nil {
+			return err
+		}
+		if !known {
+			continue
+		}
+		if err := r.AddOrUpdateSignature("root.json", sig); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// MergeRootSigningBundles combines the signatures of several copies of the
+// same root proposal into a single bundle. Signatures by keys that are in
+// neither root are left out, and an invalid signature is an error. Each copy
+// is checked against the committed root metadata like in
+// SignRootSigningBundle.
+func (r *Repo) MergeRootSigningBundles(bundles ...*RootSigningBundle) (*RootSigningBundle, error) {
+	if len(bundles) == 0 {
+		return nil, ErrRootSigningBundleMismatch
+	}
+	first := bundles[0]
+	proposed, prevRoot, err := first.canonicalRoots()
+	if err != nil {
+		return nil, err
+	}
+	dbs, err := first.keysDBs()
+	if err != nil {
+		return nil, err
+	}
+
+	merged := &RootSigningBundle{
+		Root: data.Signed{
+			Signed:     first.Root.Signed,
+			Signatures: []data.Signature{},
+		},
+		PreviousRoot: first.PreviousRoot,
+		Changes:      first.Changes,
+	}
+	seen := make(map[string]struct{})
+	for _, b := range bundles {
+		p, prev, err := b.canonicalRoots()
+		if err != nil {
+			return nil, err
+		}
+		if !bytes.Equal(p, proposed) || !bytes.Equal(prev, prevRoot) {
+			return nil, ErrRootSigningBundleMismatch
+		}
+		if err := r.checkRootSigningBundle(b); err != nil {
+			return nil, err
+		}
+
+		for _, sig := range b.Root.Signatures {
+			if _, ok := seen[sig.KeyID]; ok {
+				continue
+			}
+			known, err := verifyRootSignature(dbs, proposed, sig)
+			if err != nil {
+				return nil, fmt.Errorf("tuf: invalid signature by key %s: %w", sig.KeyID, err)
+			}
+			if !known {
+				continue
+			}
+			seen[sig.KeyID] = struct{}{}
+			merged.Root.Signatures = append(merged.Root.Signatures, sig)
+		}
+	}
+	return merged, nil
+}
+
+// Status reports which root keys have signed the proposal in b.
+func (b *RootSigningBundle) Status() (*RootSigningStatus, error) {
+	root, err := unmarshalRoot(b.Root.Signed)
+	if err != nil {
+		return nil, err
+	}
+	status := &RootSigningStatus{}
+	if status.Root, err = rootKeysStatus(&b.Root, root); err != nil {
+		return nil, err
+	}
+
+	if len(b.PreviousRoot) > 0 {
+		prev, err := unmarshalRoot(b.PreviousRoot)
+		if err != nil {
+			return nil, err
+		}
+		if status.PreviousRoot, err = rootKeysStatus(&b.Root, prev); err != nil {
+			return nil, err
+		}
+	}
+	return status, nil
+}
+
+// checkRootSigningBundle checks that b proposes the next version of the
+// committed root metadata, which is its previous root, and that the changes
+// it lists are the differences from that root.
+func (r *Repo) checkRootSigningBundle(b *RootSigningBundle) error {
+	trustedRaw, err := r.committedRoot()
+	if err != nil {
+		return err
+	}
+	root, err := unmarshalRoot(b.Root.Signed)
+	if err != nil {
+		return err
+	}
+
+	var trusted *data.Root
+	version := int64(1)
+	if trustedRaw != nil {
+		if trusted, err = unmarshalRoot(trustedRaw); err != nil {
+			return err
+		}
+		version = trusted.Version + 1
+	}
+	if root.Version != version {
+		return ErrUntrustedRootSigningBundle
+	}
+	_, prev, err := b.canonicalRoots()
+	if err != nil {
+		return err
+	}
+	if trustedRaw == nil {
+		if prev != nil {
+			return ErrUntrustedRootSigningBundle
+		}
+	} else {
+		canonical, err := cjson.EncodeCanonical(trustedRaw)
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(prev, canonical) {
+			return ErrUntrustedRootSigningBundle
+		}
+	}
+
+	changes := rootChanges(trusted, root)
+	if len(changes) != len(b.Changes) {
+		return ErrRootSigningBundleChanges
+	}
+	for i, change := range changes {
+		if b.Changes[i] != change {
+			return ErrRootSigningBundleChanges
+		}
+	}
+	return nil
+}
+
+// canonicalRoots returns the canonical encodings of the proposed root and
+// of the previous root, which is nil if there is none.
+func (b *RootSigningBundle) canonicalRoots() ([]byte, []byte, error) {
+	proposed, err := cjson.EncodeCanonical(b.Root.Signed)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(b.PreviousRoot) == 0 {
+		return proposed, nil, nil
+	}
+	prev, err := cjson.EncodeCanonical(b.PreviousRoot)
+	if err != nil {
+		return nil, nil, err
+	}
+	return proposed, prev, nil
+}
+
+// keysDBs returns key DBs for the proposed root and the previous root.
+func (b *RootSigningBundle) keysDBs() ([]*verify.DB, error) {
+	raws := []json.RawMessage{b.Root.Signed}
+	if len(b.PreviousRoot) > 0 {
+		raws = append(raws, b.PreviousRoot)
+	}
+
+	dbs := make([]*verify.DB, 0, len(raws))
+	for _, raw := range raws {
+		root, err := unmarshalRoot(raw)
+		if err != nil {
+			return nil, err
+		}
+		db, err := rootKeysDB(root)
+		if err != nil {
+			return nil, err
+		}
+		dbs = append(dbs, db)
+	}
+	return dbs, nil
+}
+
+// verifyRootSignature checks sig over msg against the root keys in dbs. It
+// returns false if the key is a root key in none of them.
+func verifyRootSignature(dbs []*verify.DB, msg []byte, sig data.Signature) (bool, error) {
+	known := false
+	for _, db := range dbs {
+		role := db.GetRole("root")
+		if role == nil || !role.ValidKey(sig.KeyID) {
+			continue
+		}
+		verifier, err := db.GetVerifier(sig.KeyID)
+		if err != nil {
+			continue
+		}
+		if err := verifier.Verify(msg, sig.Signature); err != nil {
+			return false, verify.ErrInvalid
+		}
+		known = true
+	}
+	return known, nil
+}
+
+// rootKeysStatus reports which keys of the root role of root have a valid
+// signature in s.
+func rootKeysStatus(s *data.Signed, root *data.Root) (*RootKeysStatus, error) {
+	db, err := rootKeysDB(root)
+	if err != nil {
+		return nil, err
+	}
+	role := db.GetRole("root")
+	if role == nil {
+		return nil, verify.ErrUnknownRole{Role: "root"}
+	}
+	msg, err := cjson.EncodeCanonical(s.Signed)
+	if err != nil {
+		return nil, err
+	}
+
+	status := &RootKeysStatus{
+		Threshold: role.Threshold,
+		Signed:    []string{},
+		Missing:   []string{},
+	}
+	// A key can have several IDs, so it is counted once for all of them.
+	signed := make(map[string]struct{})
+	for _, sig := range s.Signatures {
+		if _, ok := signed[sig.KeyID]; ok || !role.ValidKey(sig.KeyID) {
+			continue
+		}
+		verifier, err := db.GetVerifier(sig.KeyID)
+		if err != nil {
+			continue
+		}
+		if err := verifier.Verify(msg, sig.Signature); err != nil {
+			continue
+		}
+		status.Signatures++
+		for _, id := range verifier.MarshalPublicKey().IDs() {
+			signed[id] = struct{}{}
+		}
+	}
+	for id := range role.KeyIDs {
+		if _, ok := signed[id]; ok {
+			status.Signed = append(status.Signed, id)
+		} else {
+			status.Missing = append(status.Missing, id)
+		}
+	}
+	sort.Strings(status.Signed)
+	sort.Strings(status.Missing)
+	return status, nil
+}
+
+// committedRoot returns the signed portion of the committed root.json, or nil
+// if there is none.
+func (r *Repo) committedRoot() (json.RawMessage, error) {
+	getter, ok := r.local.(CommittedMetaGetter)
+	if !ok {
+		return nil, ErrDiffNotSupported
+	}
+	committed, err := getter.GetCommittedMeta()
+	if err != nil {
+		return nil, err
+	}
+	raw, ok := committed["root.json"]
+	if !ok {
+		return nil, nil
+	}
+	s := &data.Signed{}
+	if err := json.Unmarshal(raw, s); err != nil {
+		return nil, err
+	}
+	return s.Signed, nil
+}
+
+// previousRoot returns the committed root metadata that precedes the
+// current root.json, or nil if there is none.
+func (r *Repo) previousRoot() (*data.Root, error) {
+	root, err := r.root()
+	if err != nil {
+		return nil, err
+	}
+	if root.Version <= 1 {
+		return nil, nil
+	}
+
+	// Committed root metadata is always also stored under its version, but
+	// r.meta may predate the last commit, so read it from the store.
+	meta, err := r.local.GetMeta()
+	if err != nil {
+		return nil, err
+	}
+	raw, ok := meta[util.VersionedPath("root.json", root.Version-1)]
+	if !ok {
+		return nil, nil
+	}
+	s := &data.Signed{}
+	if err := json.Unmarshal(raw, s); err != nil {
+		return nil, err
+	}
+	return unmarshalRoot(s.Signed)
+}
+
+func unmarshalRoot(raw json.RawMessage) (*data.Root, error) {
+	root := &data.Root{}
+	if err := json.Unmarshal(raw, root); err != nil {
+		return nil, err
+	}
+	return root, nil
+}
+
+// rootChanges describes how the root metadata next differs from prev, which
+// may be nil.
+func rootChanges(prev, next *data.Root) []string {
+	return diffRoot(prev, next).Lines()
+}
+
+// missingStrings returns the sorted strings in a that are not in b.
+func missingStrings(a, b []string) []string {
+	in := make(map[string]struct{}, len(b))
+	for _, s := range b {
+		in[s] = struct{}{}
+	}
+	missing := []string{}
+	for _, s := range a {
+		if _, ok := in[s]; !ok {
+			missing = append(missing, s)
+		}
+	}
+	sort.Strings(missing)
+	return missing
+}
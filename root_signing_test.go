@@ -0,0 +1,222 @@
+package tuf
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/theupdateframework/go-tuf/data"
+	"github.com/theupdateframework/go-tuf/pkg/keys"
+	"github.com/theupdateframework/go-tuf/verify"
+	. "gopkg.in/check.v1"
+)
+
+// copyRootSigningBundle returns a copy of b as read back from a file.
+func copyRootSigningBundle(c *C, b *RootSigningBundle) *RootSigningBundle {
+	raw, err := json.MarshalIndent(b, "", "  ")
+	c.Assert(err, IsNil)
+	copied := &RootSigningBundle{}
+	c.Assert(json.Unmarshal(raw, copied), IsNil)
+	return copied
+}
+
+func (rs *RepoSuite) TestRootSigningCeremony(c *C) {
+	files := map[string][]byte{"foo.txt": []byte("foo")}
+	local := MemoryStore(make(map[string]json.RawMessage), files)
+	r, err := NewRepo(local)
+	c.Assert(err, IsNil)
+
+	oldRootIDs := genKey(c, r, "root")
+	genKey(c, r, "targets")
+	genKey(c, r, "snapshot")
+	genKey(c, r, "timestamp")
+	c.Assert(r.AddTarget("foo.txt", nil), IsNil)
+	c.Assert(r.Snapshot(), IsNil)
+	c.Assert(r.Timestamp(), IsNil)
+	c.Assert(r.Commit(), IsNil)
+	committed, err := local.(CommittedMetaGetter).GetCommittedMeta()
+	c.Assert(err, IsNil)
+
+	// Rotate the root role to two keys held offline by separate holders,
+	// who have a copy of the committed repository.
+	holders := make([]*Repo, 2)
+	holderIDs := make([][]string, len(holders))
+	newRootIDs := []string{}
+	for i := range holders {
+		signer, err := keys.GenerateEd25519Key()
+		c.Assert(err, IsNil)
+		holderMeta := make(map[string]json.RawMessage, len(committed))
+		for name, meta := range committed {
+			holderMeta[name] = meta
+		}
+		holderStore := MemoryStore(holderMeta, nil)
+		c.Assert(holderStore.SaveSigner("root", signer), IsNil)
+		holders[i], err = NewRepo(holderStore)
+		c.Assert(err, IsNil)
+
+		c.Assert(r.AddVerificationKey("root", signer.PublicData()), IsNil)
+		holderIDs[i] = signer.PublicData().IDs()
+		newRootIDs = append(newRootIDs, holderIDs[i]...)
+	}
+	c.Assert(r.SetThreshold("root", 2), IsNil)
+	c.Assert(r.RevokeKey("root", oldRootIDs[0]), IsNil)
+
+	sort.Strings(newRootIDs)
+
+	b, err := r.RootSigningBundle()
+	c.Assert(err, IsNil)
+	staged, err := r.root()
+	c.Assert(err, IsNil)
+	expectedChanges := []string{"version: 1 -> 2"}
+	keyChanges := []string{fmt.Sprintf("key %s: removed", oldRootIDs[0])}
+	for _, id := range newRootIDs {
+		keyChanges = append(keyChanges, fmt.Sprintf("key %s: added (%s)", id, describeKey(staged.Keys[id])))
+	}
+	sort.Strings(keyChanges)
+	expectedChanges = append(expectedChanges, keyChanges...)
+	expectedChanges = append(expectedChanges, "role root: threshold 1 -> 2")
+	for _, id := range newRootIDs {
+		expectedChanges = append(expectedChanges, fmt.Sprintf("role root: added key %s", id))
+	}
+	expectedChanges = append(expectedChanges, fmt.Sprintf("role root: removed key %s", oldRootIDs[0]))
+	changes := []string{}
+	for _, change := range b.Changes {
+		// the expiry may or may not have moved to a later second
+		if !strings.HasPrefix(change, "expires: ") {
+			changes = append(changes, change)
+		}
+	}
+	c.Assert(changes, DeepEquals, expectedChanges)
+
+	// The old root key signed the staged root, but none of the new keys.
+	status, err := b.Status()
+	c.Assert(err, IsNil)
+	c.Assert(status.Complete(), Equals, false)
+	c.Assert(status.Root, DeepEquals, &RootKeysStatus{
+		Threshold:  2,
+		Signatures: 0,
+		Signed:     []string{},
+		Missing:    newRootIDs,
+	})
+	c.Assert(status.PreviousRoot, DeepEquals, &RootKeysStatus{
+		Threshold:  1,
+		Signatures: 1,
+		Signed:     oldRootIDs,
+		Missing:    []string{},
+	})
+
+	// Each holder signs their own copy.
+	signed := make([]*RootSigningBundle, len(holders))
+	for i, holder := range holders {
+		signed[i] = copyRootSigningBundle(c, b)
+		n, err := holder.SignRootSigningBundle(signed[i])
+		c.Assert(err, IsNil)
+		c.Assert(n, Equals, 1)
+		signed[i] = copyRootSigningBundle(c, signed[i])
+	}
+
+	partial, err := r.MergeRootSigningBundles(b, signed[0])
+	c.Assert(err, IsNil)
+	status, err = partial.Status()
+	c.Assert(err, IsNil)
+	c.Assert(status.Complete(), Equals, false)
+	c.Assert(status.Root.Signatures, Equals, 1)
+	c.Assert(status.Root.Missing, DeepEquals, holderIDs[1])
+	c.Assert(r.AddRootSigningBundle(partial), IsNil)
+	c.Assert(r.Snapshot(), DeepEquals, ErrInsufficientSignatures{"root.json", verify.ErrRoleThreshold{Expected: 2, Actual: 1}})
+
+	// A bundle with a made-up previous root, whose changes hide the root
+	// key rotation from the holders, is refused.
+	forged := copyRootSigningBundle(c, b)
+	forgedPrev, err := unmarshalRoot(forged.Root.Signed)
+	c.Assert(err, IsNil)
+	forgedPrev.Version = 1
+	forged.PreviousRoot, err = json.Marshal(forgedPrev)
+	c.Assert(err, IsNil)
+	proposed, err := unmarshalRoot(forged.Root.Signed)
+	c.Assert(err, IsNil)
+	forged.Changes = rootChanges(forgedPrev, proposed)
+	c.Assert(forged.Changes, DeepEquals, []string{"version: 1 -> 2"})
+	_, err = holders[0].SignRootSigningBundle(forged)
+	c.Assert(err, Equals, ErrUntrustedRootSigningBundle)
+	_, err = r.MergeRootSigningBundles(forged)
+	c.Assert(err, Equals, ErrUntrustedRootSigningBundle)
+
+	merged, err := r.MergeRootSigningBundles(partial, signed[1])
+	c.Assert(err, IsNil)
+	status, err = merged.Status()
+	c.Assert(err, IsNil)
+	c.Assert(status.Complete(), Equals, true)
+	c.Assert(status.Root.Missing, DeepEquals, []string{})
+
+	c.Assert(r.AddRootSigningBundle(merged), IsNil)
+	c.Assert(r.Snapshot(), IsNil)
+	c.Assert(r.Timestamp(), IsNil)
+	c.Assert(r.Commit(), IsNil)
+	checkSigKeyIDs(c, local, map[string][]string{
+		"2.root.json": append(append([]string{}, oldRootIDs...), newRootIDs...),
+	})
+}
+
+func (rs *RepoSuite) TestRootSigningBundleErrors(c *C) {
+	local := MemoryStore(make(map[string]json.RawMessage), nil)
+	r, err := NewRepo(local)
+	c.Assert(err, IsNil)
+
+	_, err = r.RootSigningBundle()
+	c.Assert(err, Equals, ErrMissingMetadata{"root.json"})
+
+	rootIDs := genKey(c, r, "root")
+	b, err := r.RootSigningBundle()
+	c.Assert(err, IsNil)
+	c.Assert(b.PreviousRoot, IsNil)
+	root, err := r.root()
+	c.Assert(err, IsNil)
+	c.Assert(b.Changes, DeepEquals, []string{
+		"version: 1",
+		"expires: " + root.Expires.UTC().Format(time.RFC3339),
+		"consistent snapshot: true",
+		fmt.Sprintf("key %s: added (%s)", rootIDs[0], describeKey(root.Keys[rootIDs[0]])),
+		"role root: added with threshold 1",
+		"role root: added key " + rootIDs[0],
+	})
+
+	// Bundles proposing different roots cannot be merged or added.
+	genKey(c, r, "targets")
+	other, err := r.RootSigningBundle()
+	c.Assert(err, IsNil)
+	_, err = r.MergeRootSigningBundles(b, other)
+	c.Assert(err, Equals, ErrRootSigningBundleMismatch)
+	c.Assert(r.AddRootSigningBundle(b), Equals, ErrStaleRootSigningBundle)
+
+	// An invalid signature by a root key cannot be merged.
+	tampered := copyRootSigningBundle(c, other)
+	tampered.Root.Signatures[0].Signature = data.HexBytes("bad")
+	_, err = r.MergeRootSigningBundles(other, tampered)
+	c.Assert(err, IsNil)
+	_, err = r.MergeRootSigningBundles(tampered, other)
+	c.Assert(err, ErrorMatches, "tuf: invalid signature by key .*: tuf: signature verification failed")
+
+	// Bundles whose changes do not match their roots are neither signed
+	// nor merged.
+	misleading := copyRootSigningBundle(c, other)
+	misleading.Changes = misleading.Changes[:len(misleading.Changes)-1]
+	_, err = r.SignRootSigningBundle(misleading)
+	c.Assert(err, Equals, ErrRootSigningBundleChanges)
+	_, err = r.MergeRootSigningBundles(other, misleading)
+	c.Assert(err, Equals, ErrRootSigningBundleChanges)
+	_, err = r.SignRootSigningBundle(other)
+	c.Assert(err, IsNil)
+
+	// Once a root is committed, only its next version can be signed.
+	genKey(c, r, "snapshot")
+	genKey(c, r, "timestamp")
+	c.Assert(r.AddTargets(nil, nil), IsNil)
+	c.Assert(r.Snapshot(), IsNil)
+	c.Assert(r.Timestamp(), IsNil)
+	c.Assert(r.Commit(), IsNil)
+	_, err = r.SignRootSigningBundle(other)
+	c.Assert(err, Equals, ErrUntrustedRootSigningBundle)
+}
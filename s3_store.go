@@ -0,0 +1,375 @@
+package tuf
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/theupdateframework/go-tuf/data"
+	"github.com/theupdateframework/go-tuf/internal/s3"
+	"github.com/theupdateframework/go-tuf/pkg/keys"
+)
+
+// S3StoreOptions configures an S3Store.
+type S3StoreOptions struct {
+	// Endpoint is the base URL of the S3 API, e.g. https://s3.amazonaws.com
+	// or http://localhost:9000 for a local MinIO. Buckets are addressed with
+	// path-style URLs.
+	Endpoint string
+
+	// Region is the region of the bucket, which defaults to us-east-1.
+	Region string
+
+	Bucket string
+
+	// AccessKeyID, SecretAccessKey and SessionToken are the credentials
+	// requests are signed with.
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+
+	// RepositoryPrefix is the key prefix of the committed repository, which
+	// is "repository/" by default.
+	RepositoryPrefix string
+
+	// StagedPrefix is the key prefix staged files are stored under, which
+	// is "staged/" by default. It must be outside RepositoryPrefix, and the
+	// other way around.
+	StagedPrefix string
+
+	// Keys stores the signing keys, which are not kept in the bucket. It
+	// defaults to a MemoryStore.
+	Keys LocalStore
+
+	// HTTPClient defaults to http.DefaultClient.
+	HTTPClient *http.Client
+}
+
+// S3Store returns a LocalStore that keeps the repository and the staged
+// files in a bucket of an S3-compatible API, such as AWS S3 or MinIO. The
+// committed repository has the same layout as the "repository" directory
+// of a FileSystemStore, so the objects under RepositoryPrefix can be served
+// to clients as is. The staged files are in the same bucket, so only that
+// prefix should be served. S3Store returns ErrStagedInRepository if
+// StagedPrefix is inside RepositoryPrefix.
+//
+// As S3 has no way to atomically replace several objects, Commit publishes
+// the target files first, then the metadata, with snapshot.json and lastly
+// timestamp.json at the end, and then removes the files that are no longer
+// listed. The staged files are only removed once all of that is done, so an
+// interrupted commit can be retried.
+//
+// The repository must use consistent snapshots for clients to never see a
+// mix of old and new files. Otherwise targets.json, the other metadata and
+// the target files are overwritten in place before snapshot.json and
+// timestamp.json, so a client updating during a commit may find files that
+// do not match the metadata it has.
+func S3Store(opts *S3StoreOptions) (LocalStore, error) {
+	if opts == nil {
+		opts = &S3StoreOptions{}
+	}
+	client, err := s3.New(s3.Config{
+		Endpoint:        opts.Endpoint,
+		Region:          opts.Region,
+		Bucket:          opts.Bucket,
+		AccessKeyID:     opts.AccessKeyID,
+		SecretAccessKey: opts.SecretAccessKey,
+		SessionToken:    opts.SessionToken,
+		HTTPClient:      opts.HTTPClient,
+	})
+	if err != nil {
+		return nil, err
+	}
+	repoPrefix := opts.RepositoryPrefix
+	if repoPrefix == "" {
+		repoPrefix = "repository/"
+	}
+	stagedPrefix := opts.StagedPrefix
+	if stagedPrefix == "" {
+		stagedPrefix = "staged/"
+	}
+	repoPrefix, stagedPrefix = cleanKeyPrefix(repoPrefix), cleanKeyPrefix(stagedPrefix)
+	if strings.HasPrefix(stagedPrefix, repoPrefix) || strings.HasPrefix(repoPrefix, stagedPrefix) {
+		return nil, ErrStagedInRepository
+	}
+	keyStore := opts.Keys
+	if keyStore == nil {
+		keyStore = MemoryStore(nil, nil)
+	}
+	return &s3Store{
+		client:       client,
+		repoPrefix:   repoPrefix,
+		stagedPrefix: stagedPrefix,
+		keys:         keyStore,
+	}, nil
+}
+
+// cleanKeyPrefix returns p with a trailing slash, or empty if p is.
+func cleanKeyPrefix(p string) string {
+	p = strings.Trim(p, "/")
+	if p == "" {
+		return ""
+	}
+	return p + "/"
+}
+
+type s3Store struct {
+	client       *s3.Client
+	repoPrefix   string
+	stagedPrefix string
+
+	// keys stores the signing keys, and implements the signer methods of
+	// LocalStore.
+	keys LocalStore
+}
+
+func (s *s3Store) GetMeta() (map[string]json.RawMessage, error) {
+	meta, err := s.GetCommittedMeta()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.readMeta(meta, s.stagedPrefix); err != nil {
+		return nil, err
+	}
+	return meta, nil
+}
+
+func (s *s3Store) GetCommittedMeta() (map[string]json.RawMessage, error) {
+	meta := make(map[string]json.RawMessage)
+	if err := s.readMeta(meta, s.repoPrefix); err != nil {
+		return nil, err
+	}
+	return meta, nil
+}
+
+// readMeta adds the metadata files directly under prefix to meta.
+func (s *s3Store) readMeta(meta map[string]json.RawMessage, prefix string) error {
+	ctx := context.Background()
+	objects, err := s.client.List(ctx, prefix, "/")
+	if err != nil {
+		return err
+	}
+	for _, obj := range objects {
+		name := strings.TrimPrefix(obj.Key, prefix)
+		if path.Ext(name) != ".json" {
+			continue
+		}
+		b, err := s.getObject(ctx, obj.Key)
+		if err != nil {
+			return err
+		}
+		meta[name] = b
+	}
+	return nil
+}
+
+func (s *s3Store) getObject(ctx context.Context, key string) ([]byte, error) {
+	body, _, err := s.client.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+	return io.ReadAll(body)
+}
+
+func (s *s3Store) SetMeta(name string, meta json.RawMessage) error {
+	return s.client.Put(context.Background(), s.stagedPrefix+name, bytes.NewReader(meta), int64(len(meta)), &s3.PutOptions{ContentType: "application/json"})
+}
+
+func (s *s3Store) FileIsStaged(name string) bool {
+	_, err := s.client.Head(context.Background(), s.stagedPrefix+name)
+	return err == nil
+}
+
+func (s *s3Store) RemoveStagedMeta(name string) error {
+	err := s.client.Delete(context.Background(), s.stagedPrefix+name)
+	if err != nil && !s3.IsNotFound(err) {
+		return err
+	}
+	return nil
+}
+
+func (s *s3Store) WalkStagedTargets(paths []string, targetsFn TargetsWalkFunc) error {
+	ctx := context.Background()
+	targetsPrefix := s.stagedPrefix + "targets/"
+	if len(paths) == 0 {
+		objects, err := s.client.List(ctx, targetsPrefix, "")
+		if err != nil {
+			return err
+		}
+		for _, obj := range objects {
+			paths = append(paths, strings.TrimPrefix(obj.Key, targetsPrefix))
+		}
+	} else {
+		// check all the files exist before processing any files
+		for _, path := range paths {
+			if _, err := s.client.Head(ctx, targetsPrefix+path); err != nil {
+				if s3.IsNotFound(err) {
+					return ErrFileNotFound{targetsPrefix + path}
+				}
+				return err
+			}
+		}
+	}
+	return s.walkObjects(ctx, targetsPrefix, paths, targetsFn)
+}
+
+func (s *s3Store) WalkCommittedTargets(targetsFn TargetsWalkFunc) error {
+	ctx := context.Background()
+	targetsPrefix := s.repoPrefix + "targets/"
+	objects, err := s.client.List(ctx, targetsPrefix, "")
+	if err != nil {
+		return err
+	}
+	paths := make([]string, 0, len(objects))
+	for _, obj := range objects {
+		paths = append(paths, strings.TrimPrefix(obj.Key, targetsPrefix))
+	}
+	return s.walkObjects(ctx, targetsPrefix, paths, targetsFn)
+}
+
+// walkObjects calls targetsFn with the content of the object prefix+path for
+// each of paths.
+func (s *s3Store) walkObjects(ctx context.Context, prefix string, paths []string, targetsFn TargetsWalkFunc) error {
+	for _, path := range paths {
+		body, _, err := s.client.Get(ctx, prefix+path)
+		if err != nil {
+			if s3.IsNotFound(err) {
+				return ErrFileNotFound{prefix + path}
+			}
+			return err
+		}
+		err = targetsFn(path, body)
+		body.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Commit publishes the staged files by copying them within the bucket, in
+// the order given by publishOrder, then removes the target files and the
+// delegated metadata that are no longer listed, and the staged files.
+func (s *s3Store) Commit(consistentSnapshot bool, versions map[string]int64, hashes map[string]data.Hashes) error {
+	ctx := context.Background()
+	staged, err := s.client.List(ctx, s.stagedPrefix, "")
+	if err != nil {
+		return err
+	}
+
+	// sources maps the paths to publish to the staged files they are
+	// copied from.
+	sources := make(map[string]string)
+	publish := []string{}
+	for _, obj := range staged {
+		relpath := strings.TrimPrefix(obj.Key, s.stagedPrefix)
+		var paths []string
+		if strings.HasPrefix(relpath, "targets/") {
+			paths = computeTargetPaths(consistentSnapshot, relpath, hashes)
+		} else if !metaNeedsRemoval(relpath, versions) {
+			paths = computeMetadataPaths(consistentSnapshot, relpath, versions)
+		}
+		for _, p := range paths {
+			sources[p] = obj.Key
+		}
+		publish = append(publish, paths...)
+	}
+	sort.SliceStable(publish, func(i, j int) bool {
+		return publishOrder(publish[i]) < publishOrder(publish[j])
+	})
+
+	for _, p := range publish {
+		if err := s.client.Copy(ctx, sources[p], s.repoPrefix+p, publishOptions(p)); err != nil {
+			return err
+		}
+	}
+	if err := s.removeUnlisted(ctx, consistentSnapshot, versions, hashes); err != nil {
+		return err
+	}
+	return s.Clean()
+}
+
+// removeUnlisted removes the committed target files and delegated metadata
+// that the metadata being committed, described by versions and hashes, no
+// longer lists. The repository is listed once everything has been
+// published, and removing files that are already gone is not an error, so a
+// commit that is retried after being interrupted removes whatever the
+// interrupted one did not.
+func (s *s3Store) removeUnlisted(ctx context.Context, consistentSnapshot bool, versions map[string]int64, hashes map[string]data.Hashes) error {
+	committed, err := s.client.List(ctx, s.repoPrefix+"targets/", "")
+	if err != nil {
+		return err
+	}
+	for _, obj := range committed {
+		relpath := strings.TrimPrefix(obj.Key, s.repoPrefix)
+		if targetNeedsRemoval(consistentSnapshot, relpath, hashes) {
+			if err := s.client.Delete(ctx, obj.Key); err != nil {
+				return err
+			}
+		}
+	}
+	committedMeta, err := s.client.List(ctx, s.repoPrefix, "/")
+	if err != nil {
+		return err
+	}
+	for _, obj := range committedMeta {
+		if metaNeedsRemoval(strings.TrimPrefix(obj.Key, s.repoPrefix), versions) {
+			if err := s.client.Delete(ctx, obj.Key); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// publishOptions returns the headers to publish the file at p with.
+// Metadata files other than the versioned ones are updated in place, so
+// clients are told to always revalidate them.
+func publishOptions(p string) *s3.PutOptions {
+	if strings.HasPrefix(p, "targets/") {
+		return nil
+	}
+	opts := &s3.PutOptions{ContentType: "application/json"}
+	if _, _, versioned := parseVersionedName(p); !versioned {
+		opts.CacheControl = "no-cache"
+	}
+	return opts
+}
+
+func (s *s3Store) GetSigners(role string) ([]keys.Signer, error) {
+	return s.keys.GetSigners(role)
+}
+
+func (s *s3Store) SaveSigner(role string, signer keys.Signer) error {
+	return s.keys.SaveSigner(role, signer)
+}
+
+func (s *s3Store) SignersForKeyIDs(keyIDs []string) []keys.Signer {
+	return s.keys.SignersForKeyIDs(keyIDs)
+}
+
+func (s *s3Store) Clean() error {
+	ctx := context.Background()
+	if _, err := s.client.Head(ctx, s.repoPrefix+"root.json"); err != nil {
+		if s3.IsNotFound(err) {
+			return ErrNewRepository
+		}
+		return err
+	}
+	staged, err := s.client.List(ctx, s.stagedPrefix, "")
+	if err != nil {
+		return err
+	}
+	for _, obj := range staged {
+		if err := s.client.Delete(ctx, obj.Key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
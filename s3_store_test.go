@@ -0,0 +1,165 @@
+package tuf
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/theupdateframework/go-tuf/internal/s3/s3test"
+)
+
+func TestS3Store(t *testing.T) {
+	srv := s3test.NewServer("tuf")
+	defer srv.Close()
+	srv.AccessKeyID = "key"
+	srv.MaxKeys = 3
+
+	local, err := S3Store(&S3StoreOptions{
+		Endpoint:         srv.URL,
+		Bucket:           "tuf",
+		AccessKeyID:      "key",
+		SecretAccessKey:  "secret",
+		RepositoryPrefix: "repo",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, ErrNewRepository, local.Clean())
+
+	r, err := NewRepo(local, "sha256")
+	require.NoError(t, err)
+	for _, role := range []string{"root", "targets", "snapshot", "timestamp"} {
+		_, err := r.GenKey(role)
+		require.NoError(t, err)
+	}
+	assert.True(t, local.FileIsStaged("root.json"))
+
+	srv.PutObject("staged/targets/foo.txt", []byte("foo"))
+	srv.PutObject("staged/targets/dir/bar.txt", []byte("bar"))
+	assert.Equal(t, ErrFileNotFound{"staged/targets/baz.txt"}, r.AddTarget("baz.txt", nil))
+	require.NoError(t, r.AddTargets(nil, nil))
+	require.NoError(t, r.Snapshot())
+	require.NoError(t, r.Timestamp())
+	srv.Writes()
+	require.NoError(t, r.Commit())
+
+	// Targets are published first, then the metadata, and timestamp.json
+	// last.
+	published := []string{}
+	for _, w := range srv.Writes() {
+		if strings.HasPrefix(w, "PUT ") {
+			published = append(published, strings.TrimPrefix(w, "PUT repo/"))
+		}
+	}
+	require.Len(t, published, 9)
+	assert.ElementsMatch(t, []string{
+		"targets/" + hashedName("dir/bar.txt", "bar"),
+		"targets/" + hashedName("foo.txt", "foo"),
+	}, published[:2])
+	assert.ElementsMatch(t, []string{
+		"1.root.json", "1.targets.json", "root.json", "targets.json",
+	}, published[2:6])
+	assert.Equal(t, []string{"1.snapshot.json", "snapshot.json", "timestamp.json"}, published[6:9])
+
+	assert.Equal(t, []string{
+		"repo/1.root.json",
+		"repo/1.snapshot.json",
+		"repo/1.targets.json",
+		"repo/root.json",
+		"repo/snapshot.json",
+		"repo/targets.json",
+		"repo/targets/" + hashedName("foo.txt", "foo"),
+		"repo/targets/" + hashedName("dir/bar.txt", "bar"),
+		"repo/timestamp.json",
+	}, srv.Keys())
+	timestamp := srv.Object("repo/timestamp.json")
+	assert.Equal(t, "application/json", timestamp.ContentType)
+	assert.Equal(t, "no-cache", timestamp.CacheControl)
+	assert.Equal(t, "", srv.Object("repo/1.root.json").CacheControl)
+
+	report, err := r.Verify(time.Now())
+	require.NoError(t, err)
+	assert.Equal(t, []VerifyProblem{}, report.Problems)
+
+	// A failed commit leaves the staged files, so it can be retried.
+	require.NoError(t, r.RemoveTarget("dir/bar.txt"))
+	require.NoError(t, r.Snapshot())
+	require.NoError(t, r.Timestamp())
+	srv.FailRequest = func(req *http.Request, key string) int {
+		if req.Method == http.MethodPut && key == "repo/timestamp.json" {
+			return http.StatusInternalServerError
+		}
+		return 0
+	}
+	assert.Error(t, r.Commit())
+	srv.FailRequest = nil
+	assert.True(t, local.FileIsStaged("timestamp.json"))
+	require.NoError(t, r.Commit())
+	assert.False(t, local.FileIsStaged("timestamp.json"))
+	assert.Nil(t, srv.Object("repo/targets/"+hashedName("dir/bar.txt", "bar")))
+
+	r, err = NewRepo(local, "sha256")
+	require.NoError(t, err)
+	targets, err := r.Targets()
+	require.NoError(t, err)
+	assert.Len(t, targets, 1)
+	assert.Contains(t, targets, "foo.txt")
+	report, err = r.Verify(time.Now())
+	require.NoError(t, err)
+	assert.Equal(t, []VerifyProblem{}, report.Problems)
+
+	// A commit interrupted once timestamp.json is live removes the
+	// unlisted targets when it is retried.
+	srv.PutObject("staged/targets/baz.txt", []byte("baz"))
+	require.NoError(t, r.AddTarget("baz.txt", nil))
+	require.NoError(t, r.RemoveTarget("foo.txt"))
+	require.NoError(t, r.Snapshot())
+	require.NoError(t, r.Timestamp())
+	foo := "repo/targets/" + hashedName("foo.txt", "foo")
+	srv.FailRequest = func(req *http.Request, key string) int {
+		if req.Method == http.MethodDelete && key == foo {
+			return http.StatusInternalServerError
+		}
+		return 0
+	}
+	assert.Error(t, r.Commit())
+	srv.FailRequest = nil
+	assert.NotNil(t, srv.Object(foo))
+	committed, err := local.(CommittedMetaGetter).GetCommittedMeta()
+	require.NoError(t, err)
+	staged, err := local.GetMeta()
+	require.NoError(t, err)
+	assert.Equal(t, staged["timestamp.json"], committed["timestamp.json"])
+
+	r, err = NewRepo(local, "sha256")
+	require.NoError(t, err)
+	require.NoError(t, r.Commit())
+	assert.Nil(t, srv.Object(foo))
+	assert.NotNil(t, srv.Object("repo/targets/"+hashedName("baz.txt", "baz")))
+	assert.False(t, local.FileIsStaged("timestamp.json"))
+	report, err = r.Verify(time.Now())
+	require.NoError(t, err)
+	assert.Equal(t, []VerifyProblem{}, report.Problems)
+}
+
+// hashedName returns the name a target is stored under in a repository with
+// consistent snapshots.
+func hashedName(name, content string) string {
+	return path.Join(path.Dir(name), fmt.Sprintf("%x.%s", sha256.Sum256([]byte(content)), path.Base(name)))
+}
+
+func TestS3StorePrefixes(t *testing.T) {
+	for _, opts := range []S3StoreOptions{
+		{RepositoryPrefix: "/"},
+		{RepositoryPrefix: "repo", StagedPrefix: "repo/staged"},
+		{RepositoryPrefix: "staged/repo"},
+	} {
+		opts.Endpoint, opts.Bucket = "http://localhost", "tuf"
+		_, err := S3Store(&opts)
+		assert.Equal(t, ErrStagedInRepository, err, "%+v", opts)
+	}
+}
@@ -19,6 +19,15 @@ func (r *Role) ValidKey(id string) bool {
 type DB struct {
 	roles     map[string]*Role
 	verifiers map[string]keys.Verifier
+
+	// succinctRoles holds the succinct hash bin delegations, whose roles
+	// are looked up by name rather than stored in roles.
+	succinctRoles []succinctRole
+}
+
+type succinctRole struct {
+	delegation data.DelegatedRole
+	role       *Role
 }
 
 func NewDB() *DB {
@@ -40,6 +49,12 @@ func NewDBFromDelegations(d *data.Delegations) (*DB, error) {
 			return nil, ErrInvalidDelegatedRole
 		}
 		role := &data.Role{Threshold: r.Threshold, KeyIDs: r.KeyIDs}
+		if r.IsSuccinct() {
+			if err := db.addSuccinctRole(r, role); err != nil {
+				return nil, err
+			}
+			continue
+		}
 		if err := db.AddRole(r.Name, role); err != nil {
 			return nil, err
 		}
@@ -75,8 +90,28 @@ func (db *DB) AddKey(id string, k *data.PublicKey) error {
 }
 
 func (db *DB) AddRole(name string, r *data.Role) error {
+	role, err := newRole(r)
+	if err != nil {
+		return err
+	}
+
+	db.roles[name] = role
+	return nil
+}
+
+func (db *DB) addSuccinctRole(d data.DelegatedRole, r *data.Role) error {
+	role, err := newRole(r)
+	if err != nil {
+		return err
+	}
+
+	db.succinctRoles = append(db.succinctRoles, succinctRole{d, role})
+	return nil
+}
+
+func newRole(r *data.Role) (*Role, error) {
 	if r.Threshold < 1 {
-		return ErrInvalidThreshold
+		return nil, ErrInvalidThreshold
 	}
 
 	role := &Role{
@@ -86,9 +121,7 @@ func (db *DB) AddRole(name string, r *data.Role) error {
 	for _, id := range r.KeyIDs {
 		role.KeyIDs[id] = struct{}{}
 	}
-
-	db.roles[name] = role
-	return nil
+	return role, nil
 }
 
 func (db *DB) GetVerifier(id string) (keys.Verifier, error) {
@@ -100,5 +133,13 @@ func (db *DB) GetVerifier(id string) (keys.Verifier, error) {
 }
 
 func (db *DB) GetRole(name string) *Role {
-	return db.roles[name]
+	if role, ok := db.roles[name]; ok {
+		return role
+	}
+	for _, s := range db.succinctRoles {
+		if s.delegation.IsSuccinctRoleName(name) {
+			return s.role
+		}
+	}
+	return nil
 }
@@ -72,6 +72,23 @@ func TestDelegationsDB(t *testing.T) {
 			// with valid signatures set up.
 			unmarshalErr: ErrNoSignatures,
 		},
+		{
+			testName: "succinct hash bins",
+			delegations: &data.Delegations{
+				Keys: map[string]*data.PublicKey{
+					key.PublicData().IDs()[0]: key.PublicData(),
+				},
+				Roles: []data.DelegatedRole{{
+					Name:       "bins",
+					KeyIDs:     key.PublicData().IDs(),
+					Threshold:  1,
+					BitLength:  4,
+					NamePrefix: "bins",
+				},
+				},
+			},
+			unmarshalErr: ErrNoSignatures,
+		},
 	}
 
 	for _, tt := range dbTests {
@@ -88,6 +105,34 @@ func TestDelegationsDB(t *testing.T) {
 	}
 }
 
+func TestSuccinctDelegationsDB(t *testing.T) {
+	key, err := keys.GenerateEd25519Key()
+	assert.Nil(t, err, "generating key failed")
+	db, err := NewDBFromDelegations(&data.Delegations{
+		Keys: map[string]*data.PublicKey{
+			key.PublicData().IDs()[0]: key.PublicData(),
+		},
+		Roles: []data.DelegatedRole{
+			{Name: "bins", KeyIDs: key.PublicData().IDs(), Threshold: 2, BitLength: 4, NamePrefix: "bins"},
+			{Name: "bins-0", KeyIDs: key.PublicData().IDs(), Threshold: 1, Paths: []string{"*"}},
+		},
+	})
+	assert.NoError(t, err)
+
+	// Explicit delegations take precedence over the bins.
+	assert.Equal(t, 1, db.GetRole("bins-0").Threshold)
+	for _, name := range []string{"bins-1", "bins-f"} {
+		role := db.GetRole(name)
+		if assert.NotNil(t, role, name) {
+			assert.Equal(t, 2, role.Threshold)
+			assert.True(t, role.ValidKey(key.PublicData().IDs()[0]))
+		}
+	}
+	for _, name := range []string{"bins", "bins-10", "other-1"} {
+		assert.Nil(t, db.GetRole(name), name)
+	}
+}
+
 // Test key database for compliance with TAP-12.
 //
 // Previously, every key's key ID was the SHA256 of the public key. TAP-12